@@ -129,8 +129,8 @@ pipeline {
           }
           post {
             always {
-              junit(allowEmptyResults: true, keepLongStdio: true, testResults: "${E2E_BASE_DIR}/outputs/TEST-*.xml")
-              archiveArtifacts allowEmptyArchive: true, artifacts: "${E2E_BASE_DIR}/outputs/TEST-*.xml"
+              junit(allowEmptyResults: true, keepLongStdio: true, testResults: "${E2E_BASE_DIR}/outputs/reports/TEST-*.xml")
+              archiveArtifacts allowEmptyArchive: true, artifacts: "${E2E_BASE_DIR}/outputs/TEST-*.xml,${E2E_BASE_DIR}/outputs/reports/**,${E2E_BASE_DIR}/outputs/diagnostics/**"
             }
           }
         }
@@ -85,8 +85,8 @@ pipeline {
           setEnvVar('SLACK_NOTIFY', true)
         }
         always {
-          junit(allowEmptyResults: true, keepLongStdio: true, testResults: "${BASE_DIR}/${E2E_SUITES}/**/*.xml")
-          archiveArtifacts(allowEmptyArchive: true, artifacts: "${BASE_DIR}/${E2E_SUITES}/**/*.xml")
+          junit(allowEmptyResults: true, keepLongStdio: true, testResults: "${BASE_DIR}/${E2E_SUITES}/**/reports/*.xml")
+          archiveArtifacts(allowEmptyArchive: true, artifacts: "${BASE_DIR}/${E2E_SUITES}/**/*.xml,${BASE_DIR}/${E2E_SUITES}/**/reports/**,${BASE_DIR}/outputs/diagnostics/**")
         }
       }
     }
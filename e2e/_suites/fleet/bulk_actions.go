@@ -0,0 +1,193 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+)
+
+// scenarioAgents returns the IDs of the agents enrolled in the policy of the scenario
+func (fts *FleetTestSuite) scenarioAgents() ([]string, error) {
+	agents, err := fts.kibanaClient.ListAgents(fts.currentContext)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, agent := range agents {
+		if agent.PolicyID == fts.Policy.ID {
+			ids = append(ids, agent.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("there are no agents enrolled in the %s policy", fts.Policy.Name)
+	}
+	return ids, nil
+}
+
+// allAgentsAreReassignedToPolicyWithin reassigns the agents of the scenario to a policy by name, waiting
+// for all of them to run the new policy
+func (fts *FleetTestSuite) allAgentsAreReassignedToPolicyWithin(policyName string, within string) error {
+	policies, err := fts.kibanaClient.ListPolicies(fts.currentContext)
+	if err != nil {
+		return err
+	}
+
+	var policy *kibana.Policy
+	for _, p := range policies {
+		if p.Name == policyName {
+			policy = &p
+			break
+		}
+	}
+	if policy == nil {
+		return fmt.Errorf("policy not found '%s'", policyName)
+	}
+
+	err = fts.runBulkAction(within, func(agents kibana.AgentSelector) (string, error) {
+		return fts.kibanaClient.BulkReassignAgents(fts.currentContext, agents, policy.ID)
+	}, func(agent kibana.Agent) error {
+		if agent.PolicyID != policy.ID || agent.PolicyRevision == 0 {
+			return fmt.Errorf("agent %s not running the %s policy yet (running '%s' revision %d)", agent.ID, policy.ID, agent.PolicyID, agent.PolicyRevision)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fts.Policy = *policy
+	return nil
+}
+
+// allAgentsAreUpgradedWithRolloutWithin upgrades the agents of the scenario, spreading the upgrades
+// over the rollout duration, and waits for all of them to run the version
+func (fts *FleetTestSuite) allAgentsAreUpgradedWithRolloutWithin(version string, rollout string, within string) error {
+	if version == "latest" {
+		version = common.ElasticAgentVersion
+	}
+	// Fleet does not report the git commit of a snapshot
+	version = downloads.RemoveCommitFromSnapshot(version)
+
+	rolloutDuration, err := time.ParseDuration(rollout)
+	if err != nil {
+		return err
+	}
+	if rolloutDuration < kibana.MinRolloutDuration {
+		return fmt.Errorf("the rollout of %s is shorter than the %s Fleet accepts", rollout, kibana.MinRolloutDuration)
+	}
+
+	return fts.runBulkAction(within, func(agents kibana.AgentSelector) (string, error) {
+		return fts.kibanaClient.BulkUpgradeAgents(fts.currentContext, kibana.BulkUpgradeRequest{
+			Agents:                 agents,
+			Version:                version,
+			RolloutDurationSeconds: int(rolloutDuration.Seconds()),
+		})
+	}, func(agent kibana.Agent) error {
+		retrievedVersion := agent.LocalMetadata.Elastic.Agent.Version
+		if agent.LocalMetadata.Elastic.Agent.Snapshot {
+			retrievedVersion += "-SNAPSHOT"
+		}
+
+		if retrievedVersion != version {
+			return fmt.Errorf("agent %s version mismatch required '%s' retrieved '%s'", agent.ID, version, retrievedVersion)
+		}
+		return nil
+	})
+}
+
+// allAgentsAreTaggedWithin adds a tag to the agents of the scenario
+func (fts *FleetTestSuite) allAgentsAreTaggedWithin(tag string, within string) error {
+	return fts.runBulkAction(within, func(agents kibana.AgentSelector) (string, error) {
+		return fts.kibanaClient.BulkUpdateAgentTags(fts.currentContext, agents, []string{tag}, nil)
+	}, func(agent kibana.Agent) error {
+		for _, t := range agent.Tags {
+			if t == tag {
+				return nil
+			}
+		}
+		return fmt.Errorf("agent %s is not tagged with %s yet (tags: %v)", agent.ID, tag, agent.Tags)
+	})
+}
+
+// allAgentsAreUnenrolledWithin unenrolls the agents of the scenario, without revoking their API keys,
+// so that they must acknowledge the action
+func (fts *FleetTestSuite) allAgentsAreUnenrolledWithin(within string) error {
+	return fts.runBulkAction(within, func(agents kibana.AgentSelector) (string, error) {
+		return fts.kibanaClient.BulkUnenrollAgents(fts.currentContext, agents, false)
+	}, func(agent kibana.Agent) error {
+		if agent.Status != "unenrolled" {
+			return fmt.Errorf("agent %s is not unenrolled yet (status: %s)", agent.ID, agent.Status)
+		}
+		return nil
+	})
+}
+
+// runBulkAction runs a bulk action on the agents of the scenario, waiting for the action to complete
+// and then for each agent to satisfy the check, all within the given duration, i.e. 2m
+func (fts *FleetTestSuite) runBulkAction(within string, bulkFn func(kibana.AgentSelector) (string, error), checkFn func(kibana.Agent) error) error {
+	maxTimeout, err := time.ParseDuration(within)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(maxTimeout)
+
+	ids, err := fts.scenarioAgents()
+	if err != nil {
+		return err
+	}
+
+	actionID, err := bulkFn(kibana.AgentsByID(ids...))
+	if err != nil {
+		return err
+	}
+
+	status, err := fts.kibanaClient.WaitForAction(fts.currentContext, actionID, maxTimeout)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"actionID": actionID,
+		"agents":   len(ids),
+		"type":     status.Type,
+	}).Info("Bulk action completed, checking the agents")
+
+	retryCount := 1
+	exp := utils.GetExponentialBackOff(time.Until(deadline))
+
+	checkAgentsFn := func() error {
+		for _, id := range ids {
+			agent, err := fts.kibanaClient.GetAgent(fts.currentContext, id)
+			if err == nil {
+				err = checkFn(agent)
+			}
+
+			if err != nil {
+				log.WithFields(log.Fields{
+					"agentID":     id,
+					"elapsedTime": exp.GetElapsedTime(),
+					"error":       err,
+					"retry":       retryCount,
+				}).Warn("Agent did not apply the bulk action yet")
+
+				retryCount++
+				return err
+			}
+		}
+		return nil
+	}
+
+	return backoff.Retry(checkAgentsFn, exp)
+}
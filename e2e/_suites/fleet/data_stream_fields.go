@@ -0,0 +1,113 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/internal/fields"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// fieldsSampleSize is the number of recent documents of a data stream which are validated
+const fieldsSampleSize = 50
+
+// ignoredDataStreamFields are the fields added to the events by the agent and Fleet, which are mapped by
+// the component templates of Fleet instead of the packages
+var ignoredDataStreamFields = []string{"elastic_agent", "metricset"}
+
+// theDataStreamConformsToItsPackageFields validates the recent documents of the agent in a data stream, i.e. system.cpu,
+// against the fields defined by its package and by ECS
+func (fts *FleetTestSuite) theDataStreamConformsToItsPackageFields(dataset string) error {
+	packageName, dataStream, found := strings.Cut(dataset, ".")
+	if !found {
+		return fmt.Errorf("the %s data stream does not have the <package>.<data stream> format", dataset)
+	}
+
+	schema, err := fts.dataStreamSchema(packageName, dataStream)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err != nil {
+		return err
+	}
+
+	query := elasticsearch.NewQuery().
+		Filter(
+			elasticsearch.Term("data_stream.dataset", dataset),
+			elasticsearch.Term("host.hostname", manifest.Hostname),
+		).
+		InNamespace(fts.dataNamespace()).
+		Last(10*time.Minute).
+		SortBy(elasticsearch.TimestampField, elasticsearch.Descending).
+		Build()
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
+	result, err := elasticsearch.WaitForNumberOfHits(fts.currentContext, elasticsearch.NamespaceIndex(fts.dataNamespace()), query, 1, maxTimeout)
+	if err != nil {
+		return err
+	}
+
+	validator := fields.Validator{
+		Schema:   schema,
+		Required: fields.RequiredFields,
+		Ignored:  ignoredDataStreamFields,
+	}
+
+	report := fields.Report{}
+	for i, hit := range result.Hits() {
+		if i == fieldsSampleSize {
+			break
+		}
+		report.Add(validator, hit.ID, hit.Source)
+	}
+
+	log.WithFields(log.Fields{
+		"dataset":    dataset,
+		"documents":  report.Documents,
+		"violations": len(report.Violations),
+	}).Info("Documents of the data stream validated against its package fields")
+
+	return report.Err()
+}
+
+// dataStreamSchema returns the fields defined for a data stream by the installed version of its package,
+// resolving the ones defined by ECS
+func (fts *FleetTestSuite) dataStreamSchema(packageName string, dataStream string) (fields.Schema, error) {
+	pkg, err := fts.kibanaClient.GetIntegrationByPackageName(fts.currentContext, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := fts.kibanaClient.GetPackageDataStreamFields(fts.currentContext, pkg, dataStream)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := fields.Schema{}
+	for name, content := range files {
+		definitions, err := fields.ParsePackageFields(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s of the %s package: %w", name, pkg.Name, err)
+		}
+		schema = schema.Merge(definitions)
+	}
+
+	ecs, err := fields.LoadECS(shell.GetEnv("ECS_VERSION", fields.DefaultECSVersion))
+	if err != nil {
+		return nil, err
+	}
+
+	return schema.ResolveExternal(ecs).Merge(ecs), nil
+}
@@ -0,0 +1,18 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+)
+
+// dataNamespace returns the namespace the agent of the scenario writes its data to. The stand-alone agents
+// are not managed by Fleet, so they write to the default one
+func (fts *FleetTestSuite) dataNamespace() string {
+	if fts.StandAlone || fts.Namespace == "" {
+		return elasticsearch.DefaultNamespace
+	}
+	return fts.Namespace
+}
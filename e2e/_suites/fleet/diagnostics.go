@@ -0,0 +1,213 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/diagnostics"
+	"github.com/elastic/e2e-testing/internal/installer"
+	"github.com/elastic/e2e-testing/internal/report"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// diagnosticsCollector keeps the diagnostics of the failed scenarios, under the outputs directory of the repository
+var diagnosticsCollector = diagnostics.NewCollector(filepath.Join("..", "..", "..", "outputs", "diagnostics"))
+
+// recorder records the scenarios of the suite, with the artifacts collected for the failed ones, for its reports
+var recorder = report.NewRecorder("fleet")
+
+// collectDiagnostics collects the diagnostics bundle of the agent, the logs of the services and samples of the
+// Fleet resources of a failed scenario into its own directory, before the clean up removes them. The artifacts
+// are attached to the scenario of the context for the reports of the suite
+func (fts *FleetTestSuite) collectDiagnostics(ctx context.Context, sc *godog.Scenario) {
+	span := fts.tx.StartSpan("Collect diagnostics", "test.scenario.diagnostics", nil)
+	fts.currentContext = apm.ContextWithSpan(ctx, span)
+	defer span.End()
+
+	dir, err := diagnosticsCollector.ScenarioDir(sc.Uri, sc.Name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"scenario": sc.Name,
+		}).Warn("Could not create the diagnostics directory of the scenario")
+		return
+	}
+
+	if fts.StandAlone || fts.InstallerType != "" {
+		bundle, err := fts.agentDiagnostics(dir)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"scenario": sc.Name,
+			}).Warn("Could not collect the diagnostics of the agent")
+		} else {
+			diagnosticsCollector.Add(sc.Uri, sc.Name, bundle)
+			report.Attach(ctx, report.Diagnostics, bundle)
+		}
+	}
+
+	for _, service := range fts.serviceInstances() {
+		name := service.Name
+		if service.Flavour != "" {
+			name = service.Flavour
+		}
+		logsPath := filepath.Join(dir, name+".log")
+
+		err := fts.getDeployer().SaveLogs(fts.currentContext, service, logsPath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"service": name,
+			}).Warn("Could not save the logs of the service")
+			continue
+		}
+		diagnosticsCollector.Add(sc.Uri, sc.Name, logsPath)
+		report.Attach(ctx, report.Logs, logsPath)
+	}
+
+	samples := fts.fleetSamples(dir)
+	diagnosticsCollector.Add(sc.Uri, sc.Name, samples...)
+	report.Attach(ctx, report.Samples, samples...)
+
+	log.WithFields(log.Fields{
+		"dir":      dir,
+		"scenario": sc.Name,
+	}).Info("Diagnostics of the failed scenario collected")
+}
+
+// serviceInstances returns the services added to the profile, with one request per instance of the scaled ones,
+// so that the logs of all of them are collected, i.e. the Fleet Server instances behind a load balancer
+func (fts *FleetTestSuite) serviceInstances() []deploy.ServiceRequest {
+	instances := []deploy.ServiceRequest{}
+	for _, service := range fts.services {
+		if service.Scale <= 1 {
+			instances = append(instances, service)
+			continue
+		}
+
+		// compose names the instances after the service and their index, i.e. fleet_fleet-server-ha_1
+		for i := 1; i <= service.Scale; i++ {
+			instances = append(instances, deploy.NewServiceContainerRequest(service.Name+"_"+strconv.Itoa(i)))
+		}
+	}
+
+	return instances
+}
+
+// agentDiagnostics collects the diagnostics bundle of the agent with its installer, falling back to
+// requesting it through Fleet for the agents which cannot run commands, i.e. when the installer fails
+func (fts *FleetTestSuite) agentDiagnostics(dir string) (string, error) {
+	installerType := fts.InstallerType
+	if fts.StandAlone {
+		installerType = "docker"
+	}
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName).WithInstallOptions(fts.InstallOptions)
+	agentInstaller, err := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, installerType)
+	if err == nil {
+		var bundle string
+		bundle, err = agentInstaller.Diagnostics(fts.currentContext, dir)
+		if err == nil {
+			return bundle, nil
+		}
+	}
+
+	if fts.StandAlone {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"error": err,
+	}).Debug("Could not collect the diagnostics with the installer, requesting them through Fleet")
+
+	return fts.fleetDiagnostics(dir)
+}
+
+// fleetDiagnostics requests the diagnostics bundle of the agent through Fleet, downloading it once uploaded
+func (fts *FleetTestSuite) fleetDiagnostics(dir string) (string, error) {
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err != nil {
+		return "", err
+	}
+
+	agent, err := fts.kibanaClient.GetAgentByHostnameFromList(fts.currentContext, manifest.Hostname)
+	if err != nil {
+		return "", err
+	}
+
+	actionID, err := fts.kibanaClient.RequestDiagnostics(fts.currentContext, agent.ID)
+	if err != nil {
+		return "", err
+	}
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute
+	_, err = fts.kibanaClient.WaitForAction(fts.currentContext, actionID, maxTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	uploads, err := fts.kibanaClient.ListAgentUploads(fts.currentContext, agent.ID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, upload := range uploads {
+		if upload.ActionID == actionID {
+			return fts.kibanaClient.DownloadAgentUpload(fts.currentContext, upload, dir)
+		}
+	}
+	return "", fmt.Errorf("the agent %s did not upload the diagnostics requested by the action %s", agent.ID, actionID)
+}
+
+// fleetSamples saves the agent policy of the scenario and the agent, as Fleet knows them, returning the
+// saved files. The resources which cannot be retrieved are skipped
+func (fts *FleetTestSuite) fleetSamples(dir string) []string {
+	samples := []string{}
+
+	if fts.Policy.ID != "" {
+		policy, err := fts.kibanaClient.GetPolicy(fts.currentContext, fts.Policy.ID)
+		samples = saveSample(samples, filepath.Join(dir, "policy.json"), policy, err)
+	}
+
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err == nil {
+		agent, err := fts.kibanaClient.GetAgentByHostnameFromList(fts.currentContext, manifest.Hostname)
+		samples = saveSample(samples, filepath.Join(dir, "agent.json"), agent, err)
+	}
+
+	return samples
+}
+
+// saveSample saves a resource as JSON, appending the file to the samples, unless the resource could not be retrieved
+func saveSample(samples []string, path string, resource interface{}, err error) []string {
+	if err == nil {
+		var content []byte
+		content, err = json.MarshalIndent(resource, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path, content, 0644)
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"sample": path,
+		}).Debug("Could not save the sample of the Fleet resource")
+		return samples
+	}
+
+	return append(samples, path)
+}
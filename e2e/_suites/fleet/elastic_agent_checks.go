@@ -16,76 +16,31 @@ import (
 	"github.com/elastic/e2e-testing/internal/elasticsearch"
 	"github.com/elastic/e2e-testing/internal/installer"
 	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/steps"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 func (fts *FleetTestSuite) checkDataStream() error {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"filter": []interface{}{
-					map[string]interface{}{
-						"exists": map[string]interface{}{
-							"field": "linux.memory.page_stats",
-						},
-					},
-					map[string]interface{}{
-						"exists": map[string]interface{}{
-							"field": "elastic_agent",
-						},
-					},
-					map[string]interface{}{
-						"range": map[string]interface{}{
-							"@timestamp": map[string]interface{}{
-								"gte": "now-1m",
-							},
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"data_stream.type": "metrics",
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"data_stream.dataset": "linux.memory",
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"data_stream.namespace": "default",
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"event.dataset": "linux.memory",
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"agent.type": "metricbeat",
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"metricset.period": 1000,
-						},
-					},
-					map[string]interface{}{
-						"term": map[string]interface{}{
-							"service.type": "linux",
-						},
-					},
-				},
-			},
-		},
-	}
-
-	indexName := "metrics-linux.memory-default"
-
-	_, err := elasticsearch.WaitForNumberOfHits(context.Background(), indexName, query, 1, 3*time.Minute)
+	query := elasticsearch.NewQuery().
+		Filter(
+			elasticsearch.Exists("linux.memory.page_stats"),
+			elasticsearch.Exists("elastic_agent"),
+			elasticsearch.Term("data_stream.type", "metrics"),
+			elasticsearch.Term("data_stream.dataset", "linux.memory"),
+			elasticsearch.Term("event.dataset", "linux.memory"),
+			elasticsearch.Term("agent.type", "metricbeat"),
+			elasticsearch.Term("metricset.period", 1000),
+			elasticsearch.Term("service.type", "linux"),
+		).
+		InNamespace(fts.Namespace).
+		Last(time.Minute).
+		Build()
+
+	indexName := elasticsearch.DataStreamName("metrics", "linux.memory", fts.Namespace)
+
+	_, err := elasticsearch.WaitForNumberOfHits(fts.currentContext, indexName, query, 1, 3*time.Minute)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -187,7 +142,7 @@ func (fts *FleetTestSuite) tagsAreInTheElasticAgentIndex() error {
 
 	indexName := ".fleet-agents"
 
-	_, err := elasticsearch.WaitForNumberOfHits(context.Background(), indexName, query, 1, 3*time.Minute)
+	_, err := elasticsearch.WaitForNumberOfHits(fts.currentContext, indexName, query, 1, 3*time.Minute)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -196,26 +151,9 @@ func (fts *FleetTestSuite) tagsAreInTheElasticAgentIndex() error {
 	return err
 }
 
-func (fts *FleetTestSuite) theAgentIsListedInFleetWithStatus(desiredStatus string) error {
-	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
-	manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
-	err := theAgentIsListedInFleetWithStatus(fts.currentContext, desiredStatus, manifest.Hostname)
-	if err != nil {
-		return err
-	}
-	if desiredStatus == "online" {
-		//get Agent Default Key
-		err := fts.theAgentGetDefaultAPIKey()
-		if err != nil {
-			return err
-		}
-	}
-	return err
-}
-
 func (fts *FleetTestSuite) theFileSystemAgentFolderIsEmpty() error {
 	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
-	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
 
 	pkgManifest, _ := agentInstaller.Inspect()
 	cmd := []string{
@@ -246,7 +184,7 @@ func (fts *FleetTestSuite) thereIsNewDataInTheIndexFromAgent() error {
 	agentService := deploy.NewServiceContainerRequest(common.ElasticAgentServiceName).WithFlavour(fts.Image)
 
 	manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
-	result, err := searchAgentData(fts.currentContext, manifest.Hostname, fts.RuntimeDependenciesStartDate, minimumHitsCount, maxTimeout)
+	result, err := searchAgentData(fts.currentContext, fts.dataNamespace(), manifest.Hostname, fts.RuntimeDependenciesStartDate, minimumHitsCount, maxTimeout)
 	if err != nil {
 		return err
 	}
@@ -256,7 +194,8 @@ func (fts *FleetTestSuite) thereIsNewDataInTheIndexFromAgent() error {
 	return elasticsearch.AssertHitsArePresent(result)
 }
 
-func searchAgentData(ctx context.Context, hostname string, startDate time.Time, minimumHitsCount int, maxTimeout time.Duration) (elasticsearch.SearchResult, error) {
+// searchAgentData searches the logs of the agent of a host in a namespace, since a date
+func searchAgentData(ctx context.Context, namespace string, hostname string, startDate time.Time, minimumHitsCount int, maxTimeout time.Duration) (elasticsearch.SearchResult, error) {
 	timezone := "America/New_York"
 
 	esQuery := map[string]interface{}{
@@ -324,6 +263,11 @@ func searchAgentData(ctx context.Context, hostname string, startDate time.Time,
 							},
 						},
 					},
+					{
+						"term": map[string]interface{}{
+							"data_stream.namespace": namespace,
+						},
+					},
 				},
 				"should":   []map[string]interface{}{},
 				"must_not": []map[string]interface{}{},
@@ -331,7 +275,7 @@ func searchAgentData(ctx context.Context, hostname string, startDate time.Time,
 		},
 	}
 
-	indexName := "logs-elastic_agent-default"
+	indexName := elasticsearch.DataStreamName("logs", "elastic_agent", namespace)
 
 	result, err := elasticsearch.WaitForNumberOfHits(ctx, indexName, esQuery, minimumHitsCount, maxTimeout)
 	if err != nil {
@@ -344,74 +288,10 @@ func searchAgentData(ctx context.Context, hostname string, startDate time.Time,
 }
 
 func theAgentIsListedInFleetWithStatus(ctx context.Context, desiredStatus string, hostname string) error {
-	log.Tracef("Checking if agent is listed in Fleet as %s", desiredStatus)
-
 	kibanaClient, err := kibana.NewClient()
 	if err != nil {
 		return err
 	}
-	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
-	retryCount := 1
-
-	exp := utils.GetExponentialBackOff(maxTimeout)
-
-	agentOnlineFn := func() error {
-		agentID, err := kibanaClient.GetAgentIDByHostname(ctx, hostname)
-		if err != nil {
-			retryCount++
-			return err
-		}
 
-		if agentID == "" {
-			// the agent is not listed in Fleet
-			if desiredStatus == "offline" || desiredStatus == "inactive" {
-				log.WithFields(log.Fields{
-					"elapsedTime": exp.GetElapsedTime(),
-					"hostname":    hostname,
-					"retries":     retryCount,
-					"status":      desiredStatus,
-				}).Info("The Agent is not present in Fleet, as expected")
-				return nil
-			}
-
-			retryCount++
-			return fmt.Errorf("the agent is not present in Fleet in the '%s' status, but it should", desiredStatus)
-		}
-
-		agentStatus, err := kibanaClient.GetAgentStatusByHostname(ctx, hostname)
-		isAgentInStatus := strings.EqualFold(agentStatus, desiredStatus)
-		if err != nil || !isAgentInStatus {
-			if err == nil {
-				err = fmt.Errorf("the Agent is not in the %s status yet", desiredStatus)
-			}
-
-			log.WithFields(log.Fields{
-				"agentID":         agentID,
-				"isAgentInStatus": isAgentInStatus,
-				"elapsedTime":     exp.GetElapsedTime(),
-				"hostname":        hostname,
-				"retry":           retryCount,
-				"status":          desiredStatus,
-			}).Warn(err.Error())
-
-			retryCount++
-
-			return err
-		}
-		log.WithFields(log.Fields{
-			"isAgentInStatus": isAgentInStatus,
-			"elapsedTime":     exp.GetElapsedTime(),
-			"hostname":        hostname,
-			"retries":         retryCount,
-			"status":          desiredStatus,
-		}).Info("The Agent is in the desired status")
-		return nil
-	}
-
-	err = backoff.Retry(agentOnlineFn, exp)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return steps.WaitForAgentStatus(ctx, kibanaClient, desiredStatus, hostname)
 }
@@ -6,16 +6,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"runtime"
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/installer"
+	"github.com/elastic/e2e-testing/internal/steps"
 	log "github.com/sirupsen/logrus"
 )
 
-var deployedAgentsCount = 0
-
 // this step infers the installer type from the underlying OS image
 // supported Docker images: centos and debian
 func (fts *FleetTestSuite) anAgentIsDeployedToFleet(image string) error {
@@ -31,16 +33,29 @@ func (fts *FleetTestSuite) anAgentIsDeployedToFleetOnTopOfBeat(beatsProcess stri
 	return fts.deployAgentToFleet(InstallerType("tar"), BeatsProcess(beatsProcess))
 }
 
-// supported installers: tar, rpm, deb
-func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstaller(installerType string) error {
-	return fts.deployAgentToFleet(InstallerType(installerType))
-}
-
 // supported installers: tar, rpm, deb
 func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerAndTags(installerType string, flags string) error {
 	return fts.deployAgentToFleet(InstallerType(installerType), Flags(flags))
 }
 
+// supported installers: tar, zip, msi
+// supported modes: privileged, unprivileged
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerInMode(installerType string, mode string) error {
+	switch mode {
+	case "privileged":
+		return fts.deployAgentToFleet(InstallerType(installerType), Unprivileged(false))
+	case "unprivileged":
+		return fts.deployAgentToFleet(InstallerType(installerType), Unprivileged(true))
+	}
+
+	return fmt.Errorf("unsupported mode %s: use privileged or unprivileged", mode)
+}
+
+// supported installers: tar, zip, msi
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerUnderBasePath(installerType string, basePath string) error {
+	return fts.deployAgentToFleet(InstallerType(installerType), BasePath(basePath))
+}
+
 func (fts *FleetTestSuite) deployAgentToFleet(opts ...DeploymentOpt) error {
 	// Default Options
 	args := &DeploymentOpts{
@@ -48,6 +63,7 @@ func (fts *FleetTestSuite) deployAgentToFleet(opts ...DeploymentOpt) error {
 		installerType:       "tar",
 		flags:               "",
 		boostrapFleetServer: false,
+		installOptions:      deploy.InstallOptions{},
 	}
 
 	for _, opt := range opts {
@@ -56,18 +72,21 @@ func (fts *FleetTestSuite) deployAgentToFleet(opts ...DeploymentOpt) error {
 	}
 
 	log.WithFields(log.Fields{
-		"installer": args.installerType,
+		"installer":      args.installerType,
+		"installOptions": args.installOptions,
 	}).Trace("Deploying an agent to Fleet with base image using an already bootstrapped Fleet Server")
 
-	deployedAgentsCount++
+	fts.deployedAgentsCount++
 
 	fts.InstallerType = args.installerType
 	fts.BeatsProcess = args.beatsProcess
 	fts.ElasticAgentFlags = args.flags
+	fts.InstallOptions = args.installOptions
 
 	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName).
-		WithScale(deployedAgentsCount).
-		WithVersion(fts.Version)
+		WithScale(fts.deployedAgentsCount).
+		WithVersion(fts.Version).
+		WithInstallOptions(fts.InstallOptions)
 
 	if fts.BeatsProcess != "" {
 		agentService = agentService.WithBackgroundProcess(fts.BeatsProcess)
@@ -77,17 +96,73 @@ func (fts *FleetTestSuite) deployAgentToFleet(opts ...DeploymentOpt) error {
 		agentService,
 	}
 	env := fts.getProfileEnv()
-	err := fts.getDeployer().Add(fts.currentContext, deploy.NewServiceRequest(common.FleetProfileName), services, env)
+	err := fts.addServices(deploy.NewServiceRequest(common.FleetProfileName), services, env)
 	if err != nil {
 		return err
 	}
+	// registered between the service and the install, the agents are un-enrolled once uninstalled
+	fts.cleanups.Push("agent enrollment", func(ctx context.Context) error {
+		return fts.unenrollHostname()
+	})
+
+	if len(fts.InstallOptions.CertificateAuthorities) > 0 {
+		err = fts.addCertificateAuthorities(agentService)
+		if err != nil {
+			return err
+		}
+		agentService = agentService.WithInstallOptions(fts.InstallOptions)
+	}
 
 	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
-	err = deploymentLifecycle(fts.currentContext, agentInstaller, fts.CurrentToken, fts.ElasticAgentFlags)
+	err = deploymentLifecycle(fts.currentContext, agentInstaller, fts.EnrollmentToken.APIKey, fts.ElasticAgentFlags)
+	return fts.recordAgent(fts.currentContext, err)
+}
+
+// recordAgent records the agent deployed by the scenario in the state of the agent steps, which check it in Fleet
+// and uninstall it. The agent is installed even when it could not enroll in Fleet. It returns the error of the
+// deployment, or the error of retrieving the host of the agent
+func (fts *FleetTestSuite) recordAgent(ctx context.Context, err error) error {
+	state, ok := steps.AgentFromContext(ctx)
+	if !ok {
+		return err
+	}
+
+	state.Service = deploy.NewServiceRequest(common.ElasticAgentServiceName).WithInstallOptions(fts.InstallOptions)
+	state.InstallerType = fts.InstallerType
+	state.Installed = err == nil || errors.Is(err, steps.ErrEnrollment)
 	if err != nil {
 		return err
 	}
-	return err
+
+	manifest, err := fts.getDeployer().GetServiceManifest(ctx, state.Service)
+	if err != nil {
+		return fmt.Errorf("could not get the host of the deployed agent: %w", err)
+	}
+
+	state.Hostname = manifest.Hostname
+	return nil
+}
+
+// agentLogs prints the logs of the agent deployed by the scenario, before the clean up stack removes it
+func (fts *FleetTestSuite) agentLogs(ctx context.Context) {
+	if fts.InstallerType == "" {
+		return
+	}
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
+	if fts.StandAlone {
+		// for the Docker image, we simply retrieve container logs
+		_ = fts.getDeployer().Logs(ctx, agentService)
+		return
+	}
+
+	// for the centos/debian flavour we need to retrieve the internal log files for the elastic-agent, as they are not
+	// exposed as container logs. For that reason we need to go through the installer abstraction
+	agentInstaller, _ := installer.Attach(ctx, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
+	err := agentInstaller.Logs(ctx)
+	if err != nil {
+		log.WithField("error", err).Warn("Could not get agent logs in the container")
+	}
 }
 
 // DeploymentOpts options to be applied to a deployment of the elastic-agent
@@ -95,12 +170,21 @@ type DeploymentOpts struct {
 	beatsProcess        string
 	boostrapFleetServer bool
 	installerType       string
+	installOptions      deploy.InstallOptions
 	flags               string
 }
 
 // DeploymentOpt an option to be applied to a deployment of the elastic-agent
 type DeploymentOpt func(*DeploymentOpts)
 
+// BasePath option to install the agent under a custom directory. Default is empty, so the installer's default is used
+func BasePath(basePath string) DeploymentOpt {
+	return func(args *DeploymentOpts) {
+		log.Tracef(">>> applying configuration to agent deployment [BasePath]: %s", basePath)
+		args.installOptions.BasePath = basePath
+	}
+}
+
 // BeatsProcess option to start a Beats process before the agent is running. Default is empty
 func BeatsProcess(beatsProcess string) DeploymentOpt {
 	return func(args *DeploymentOpts) {
@@ -120,8 +204,9 @@ func BootstrapFleetServer(boostrapFleetServer bool) DeploymentOpt {
 // InstallerType option to define the installer to use for the agent. Default is "tar"
 func InstallerType(installerType string) DeploymentOpt {
 	// FIXME: We need to cleanup the steps to support different operating systems
-	// for now we will force the zip installer type when the agent is running on windows
-	if runtime.GOOS == "windows" && common.Provider == "remote" {
+	// for now we will force the zip installer type when the agent is running on windows,
+	// unless the MSI installer is explicitly requested
+	if runtime.GOOS == "windows" && common.Provider == "remote" && installerType != "msi" {
 		installerType = "zip"
 	}
 
@@ -131,6 +216,22 @@ func InstallerType(installerType string) DeploymentOpt {
 	}
 }
 
+// FleetCA option to trust a custom CA when connecting to Fleet Server, as a local path to its PEM file. Default is empty
+func FleetCA(caFile string) DeploymentOpt {
+	return func(args *DeploymentOpts) {
+		log.Tracef(">>> applying configuration to agent deployment [FleetCA]: %s", caFile)
+		args.installOptions.CertificateAuthorities = append(args.installOptions.CertificateAuthorities, caFile)
+	}
+}
+
+// FleetURL option to enroll the agent into a Fleet Server other than the one of the profile. Default is empty
+func FleetURL(url string) DeploymentOpt {
+	return func(args *DeploymentOpts) {
+		log.Tracef(">>> applying configuration to agent deployment [FleetURL]: %s", url)
+		args.installOptions.FleetURL = url
+	}
+}
+
 // Flags option to pass flags to the enrollment of the agent. Default is empty
 func Flags(flags string) DeploymentOpt {
 	return func(args *DeploymentOpts) {
@@ -139,6 +240,36 @@ func Flags(flags string) DeploymentOpt {
 	}
 }
 
+// Unprivileged option to install the agent running as a non-root user. Default is false
+func Unprivileged(unprivileged bool) DeploymentOpt {
+	return func(args *DeploymentOpts) {
+		log.Tracef(">>> applying configuration to agent deployment [Unprivileged]: %t", unprivileged)
+		args.installOptions.Unprivileged = unprivileged
+	}
+}
+
+// addCertificateAuthorities copies the CAs to trust into the agent, pointing the install options to the copies
+func (fts *FleetTestSuite) addCertificateAuthorities(agentService deploy.ServiceRequest) error {
+	cas := fts.InstallOptions.CertificateAuthorities
+
+	err := fts.getDeployer().AddFiles(fts.currentContext, deploy.NewServiceRequest(common.FleetProfileName), agentService, cas)
+	if err != nil {
+		return err
+	}
+
+	// the agents in the host read the files where they are
+	if common.Provider == "remote" {
+		return nil
+	}
+
+	copies := make([]string, len(cas))
+	for i, ca := range cas {
+		copies[i] = "/" + filepath.Base(ca)
+	}
+	fts.InstallOptions.CertificateAuthorities = copies
+	return nil
+}
+
 func deploymentLifecycle(ctx context.Context, agentInstaller deploy.ServiceOperator, token string, flags string) error {
 	err := agentInstaller.Preinstall(ctx)
 	if err != nil {
@@ -152,7 +283,7 @@ func deploymentLifecycle(ctx context.Context, agentInstaller deploy.ServiceOpera
 
 	err = agentInstaller.Enroll(ctx, token, flags)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", steps.ErrEnrollment, err)
 	}
 
 	return agentInstaller.Postinstall(ctx)
@@ -5,90 +5,306 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/installer"
+	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/utils"
 	log "github.com/sirupsen/logrus"
 	"go.elastic.co/apm/v2"
 )
 
-func (fts *FleetTestSuite) anAttemptToEnrollANewAgentFails() error {
-	log.Trace("Enrolling a new agent with an revoked token")
+func (fts *FleetTestSuite) theAgentIsUnenrolled() error {
+	return fts.unenrollHostname()
+}
+
+func (fts *FleetTestSuite) theAgentIsReenrolledOnTheHost() error {
+	log.Trace("Re-enrolling the agent on the host with same token")
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
+	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
 
-	serviceName := common.ElasticAgentServiceName
-	agentService := deploy.NewServiceRequest(serviceName)
-	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
-	err := agentInstaller.Uninstall(fts.currentContext)
+	err := agentInstaller.Enroll(fts.currentContext, fts.EnrollmentToken.APIKey, fts.ElasticAgentFlags)
 	if err != nil {
-		log.Errorf("could not uninstall the current agent: %v", err)
 		return err
 	}
 
-	err = fts.deployAgentToFleet(InstallerType(fts.InstallerType))
-	if err == nil {
-		err = fmt.Errorf("the agent was enrolled although the token was previously revoked")
+	return nil
+}
 
-		log.WithFields(log.Fields{
-			"tokenID": fts.CurrentTokenID,
-			"error":   err,
-		}).Error(err.Error())
+// anEnrollmentTokenExpiringInIsCreated creates an enrollment token for the policy of the scenario, expiring
+// after the given duration, i.e. 30s. The next agents of the scenario are enrolled with it
+func (fts *FleetTestSuite) anEnrollmentTokenExpiringInIsCreated(expiration string) error {
+	d, err := time.ParseDuration(expiration)
+	if err != nil {
 		return err
 	}
 
-	// checking the error message produced by the install command in TAR installer
-	// to distinguish from other install errors
-	if err != nil && strings.Contains(err.Error(), "Error: enroll command failed") {
-		log.WithFields(log.Fields{
-			"err":   err,
-			"token": fts.CurrentToken,
-		}).Debug("As expected, it's not possible to enroll an agent with a revoked token")
-		return nil
+	key, err := fts.kibanaClient.CreateEnrollmentAPIKeyWithOptions(fts.currentContext, fts.Policy, kibana.EnrollmentAPIKeyOptions{
+		Name:       "e2e-expiring",
+		Expiration: d,
+	})
+	if err != nil {
+		return err
 	}
 
+	fts.useEnrollmentToken(key)
+	fts.TokenExpiresAt = time.Now().Add(d)
+
+	log.WithFields(log.Fields{
+		"expiresAt": fts.TokenExpiresAt,
+		"policyID":  fts.Policy.ID,
+		"tokenID":   key.ID,
+	}).Debug("Expiring enrollment token created")
 	return nil
 }
 
-func (fts *FleetTestSuite) theAgentIsUnenrolled() error {
-	return fts.unenrollHostname()
+// theEnrollmentTokenIsExpired waits for the current enrollment token to expire
+func (fts *FleetTestSuite) theEnrollmentTokenIsExpired() error {
+	if fts.TokenExpiresAt.IsZero() {
+		return fmt.Errorf("the enrollment token %s never expires", fts.EnrollmentToken.ID)
+	}
+
+	// Elasticsearch checks the expiration with its own clock, so a margin is added
+	remaining := time.Until(fts.TokenExpiresAt) + 5*time.Second
+	if remaining > 0 {
+		utils.Sleep(remaining)
+	}
+	return nil
 }
 
-func (fts *FleetTestSuite) theAgentIsReenrolledOnTheHost() error {
-	log.Trace("Re-enrolling the agent on the host with same token")
+// enrollmentTokensAreCreatedForThePolicy creates many enrollment tokens for the policy of the scenario, which are
+// referred to by their creation order in the next steps, starting at 1
+func (fts *FleetTestSuite) enrollmentTokensAreCreatedForThePolicy(count int) error {
+	for i := 1; i <= count; i++ {
+		key, err := fts.kibanaClient.CreateEnrollmentAPIKeyWithOptions(fts.currentContext, fts.Policy, kibana.EnrollmentAPIKeyOptions{
+			Name: fmt.Sprintf("e2e-token-%d", i),
+		})
+		if err != nil {
+			return err
+		}
+		fts.EnrollmentTokens = append(fts.EnrollmentTokens, key)
+	}
 
-	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
-	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	log.WithFields(log.Fields{
+		"count":    count,
+		"policyID": fts.Policy.ID,
+	}).Debug("Enrollment tokens created for the policy")
+	return nil
+}
+
+// enrollmentToken returns an enrollment token created by the steps, by its creation order, starting at 1
+func (fts *FleetTestSuite) enrollmentToken(index int) (kibana.EnrollmentAPIKey, error) {
+	if index < 1 || index > len(fts.EnrollmentTokens) {
+		return kibana.EnrollmentAPIKey{}, fmt.Errorf("there is no enrollment token %d, %d were created in the scenario", index, len(fts.EnrollmentTokens))
+	}
+	return fts.EnrollmentTokens[index-1], nil
+}
 
-	err := agentInstaller.Enroll(fts.currentContext, fts.CurrentToken, fts.ElasticAgentFlags)
+// theEnrollmentTokenOfThePolicyIsRevoked revokes an enrollment token created by the steps, by its creation order
+func (fts *FleetTestSuite) theEnrollmentTokenOfThePolicyIsRevoked(index int) error {
+	key, err := fts.enrollmentToken(index)
 	if err != nil {
 		return err
 	}
 
+	return fts.kibanaClient.DeleteEnrollmentAPIKey(fts.currentContext, key.ID)
+}
+
+// thePolicyHasActiveEnrollmentTokens checks the number of active enrollment tokens of the policy of the scenario,
+// including the one created for the scenario
+func (fts *FleetTestSuite) thePolicyHasActiveEnrollmentTokens(count int) error {
+	keys, err := fts.kibanaClient.ListPolicyEnrollmentAPIKeys(fts.currentContext, fts.Policy.ID)
+	if err != nil {
+		return err
+	}
+
+	active := 0
+	for _, key := range keys {
+		if key.Active {
+			active++
+		}
+	}
+
+	if active != count {
+		return fmt.Errorf("the policy %s has %d active enrollment tokens instead of %d", fts.Policy.ID, active, count)
+	}
 	return nil
 }
 
-func (fts *FleetTestSuite) theEnrollmentTokenIsRevoked() error {
+// supported installers: tar, rpm, deb, zip, msi
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerUsingTheEnrollmentToken(installerType string, index int) error {
+	key, err := fts.enrollmentToken(index)
+	if err != nil {
+		return err
+	}
+
+	fts.useEnrollmentToken(key)
+	return fts.deployAgentToFleet(InstallerType(installerType))
+}
+
+// anAgentIsDeployedToFleetWithInstallerAndDelayedEnrollment installs the agent with --delay-enroll, so that
+// it enrolls once its service starts instead of during the install.
+// supported installers: tar, zip, msi
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerAndDelayedEnrollment(installerType string) error {
+	return fts.deployAgentToFleet(InstallerType(installerType), Flags("--delay-enroll"))
+}
+
+// thePolicyIsCreatedInTheSpace moves the scenario to a Kibana space, with a new policy and enrollment token, so
+// that the next steps manage the Fleet resources of that space. The ID of the space is suffixed with the namespace
+// of the scenario, so that a space left behind by another run is not reused. The space is deleted on clean up
+func (fts *FleetTestSuite) thePolicyIsCreatedInTheSpace(space string) error {
+	space = space + "-" + fts.Namespace
+
+	_, err := fts.kibanaClient.CreateSpace(fts.currentContext, kibana.Space{
+		ID:          space,
+		Name:        space,
+		Description: "Space for the Fleet resources of an e2e scenario",
+	})
+	if err != nil {
+		return err
+	}
+	fts.cleanups.Push("space "+space, fts.removeSpace)
+
+	// the token of the default space is not used anymore, and it cannot be revoked from the new space
+	if fts.EnrollmentToken.ID != "" {
+		err = fts.kibanaClient.DeleteEnrollmentAPIKey(fts.currentContext, fts.EnrollmentToken.ID)
+		if err != nil {
+			return err
+		}
+		fts.EnrollmentToken = kibana.EnrollmentAPIKey{}
+	}
+
+	fts.Space = space
+	fts.kibanaClient = fts.suiteKibanaClient.WithSpace(space)
+
+	policy, err := fts.kibanaClient.CreatePolicyInNamespace(fts.currentContext, fts.Namespace)
+	if err != nil {
+		return err
+	}
+	fts.Policy = policy
+
+	key, err := fts.kibanaClient.CreateEnrollmentAPIKey(fts.currentContext, policy)
+	if err != nil {
+		return err
+	}
+	fts.EnrollmentToken = key
+
 	log.WithFields(log.Fields{
-		"token":   fts.CurrentToken,
-		"tokenID": fts.CurrentTokenID,
-	}).Trace("Revoking enrollment token")
+		"policyID": policy.ID,
+		"space":    space,
+	}).Info("Policy created in the space")
+	return nil
+}
 
-	err := fts.kibanaClient.DeleteEnrollmentAPIKey(fts.currentContext, fts.CurrentTokenID)
+// theAgentIsForceReenrolledIntoANewPolicy enrolls the installed agent with --force, using the token of a new policy,
+// which becomes the policy of the scenario
+func (fts *FleetTestSuite) theAgentIsForceReenrolledIntoANewPolicy() error {
+	policy, err := fts.kibanaClient.CreatePolicyInNamespace(fts.currentContext, fts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	key, err := fts.kibanaClient.CreateEnrollmentAPIKeyWithOptions(fts.currentContext, policy, kibana.EnrollmentAPIKeyOptions{Name: "e2e-reenroll"})
+	if err != nil {
+		return err
+	}
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName).WithInstallOptions(fts.InstallOptions)
+	agentInstaller, err := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	if err != nil {
+		return err
+	}
+
+	err = installer.Reenroll(fts.currentContext, agentInstaller, agentService, key.APIKey)
 	if err != nil {
 		return err
 	}
 
 	log.WithFields(log.Fields{
-		"token":   fts.CurrentToken,
-		"tokenID": fts.CurrentTokenID,
-	}).Debug("Token was revoked")
+		"from": fts.Policy.ID,
+		"to":   policy.ID,
+	}).Debug("Agent re-enrolled into a new policy")
+
+	fts.Policy = policy
+	return nil
+}
+
+// theAgentRunsTheLatestRevisionOfThePolicy checks that the agent enrolled the latest for the host runs the
+// policy of the scenario, at its latest revision
+func (fts *FleetTestSuite) theAgentRunsTheLatestRevisionOfThePolicy() error {
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err != nil {
+		return err
+	}
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
+	retryCount := 1
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	agentRunsPolicyFn := func() error {
+		policy, err := fts.kibanaClient.GetPolicy(fts.currentContext, fts.Policy.ID)
+		if err != nil {
+			retryCount++
+			return err
+		}
+
+		agent, err := fts.kibanaClient.GetLatestAgentByHostname(fts.currentContext, manifest.Hostname)
+		if err == nil && !agent.RunsPolicy(policy) {
+			err = fmt.Errorf("agent %s runs the revision %d of the policy %s instead of the revision %d of the policy %s", agent.ID, agent.PolicyRevision, agent.PolicyID, policy.Revision, policy.ID)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"hostname":    manifest.Hostname,
+				"retry":       retryCount,
+			}).Warn("The agent does not run the latest revision of the policy yet")
+
+			retryCount++
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"agentID":     agent.ID,
+			"elapsedTime": exp.GetElapsedTime(),
+			"policyID":    policy.ID,
+			"retries":     retryCount,
+			"revision":    agent.PolicyRevision,
+		}).Info("The agent runs the latest revision of the policy")
+		return nil
+	}
+
+	return backoff.Retry(agentRunsPolicyFn, exp)
+}
+
+// useEnrollmentToken makes the next agents of the scenario enroll with a token
+func (fts *FleetTestSuite) useEnrollmentToken(key kibana.EnrollmentAPIKey) {
+	fts.EnrollmentToken = key
+	fts.TokenExpiresAt = time.Time{}
+}
+
+// removeSpace moves the scenario back to the Kibana space of the suite, deleting the space of the scenario
+// with its resources
+func (fts *FleetTestSuite) removeSpace(ctx context.Context) error {
+	if fts.Space == "" {
+		return nil
+	}
+
+	fts.kibanaClient = fts.suiteKibanaClient
+
+	err := fts.kibanaClient.DeleteSpace(ctx, fts.Space)
+	if err != nil {
+		return err
+	}
 
-	// FIXME: Remove once https://github.com/elastic/kibana/issues/105078 is addressed
-	utils.Sleep(time.Duration(utils.TimeoutFactor) * 20 * time.Second)
+	fts.Space = ""
 	return nil
 }
 
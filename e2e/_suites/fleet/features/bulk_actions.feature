@@ -0,0 +1,34 @@
+@bulk_actions
+Feature: Bulk Actions
+  Scenarios for the actions Fleet runs on many agents at once
+
+Scenario: Reassigning agents to another policy in bulk
+  Given kibana uses "preconfigured-policies" profile
+    And an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When all agents are reassigned to "Test preconfigured policy" policy within "2m"
+  Then the agent is listed in Fleet as "online"
+    And the agent is enrolled into "Test preconfigured policy" policy
+
+Scenario: Tagging agents in bulk
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  Then all agents are tagged with "e2e" within "1m"
+
+Scenario: Un-enrolling agents in bulk
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When all agents are un-enrolled within "2m"
+  Then the agent is listed in Fleet as "inactive"
+
+Scenario Outline: Upgrading agents from <stale-version> in bulk with a rollout
+  Given a "<stale-version>" stale agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+    And certs are installed
+    And the "elastic-agent" process is "restarted" on the host
+  When all agents are upgraded to "latest" version with a "10m" rollout within "25m"
+  Then agent is in "latest" version
+
+  Examples: Stale versions
+    | stale-version |
+    | 8.6.0         |
@@ -0,0 +1,40 @@
+@enrollment_tokens
+Feature: Enrollment Tokens
+  Scenarios for the lifecycle of the enrollment tokens, and for enrolling the agents into other policies and spaces
+
+@expired-token
+Scenario: Enrolling with an expired enrollment token
+  Given an agent is deployed to Fleet with "tar" installer
+  When an enrollment token expiring in "30s" is created
+    And the enrollment token is expired
+  Then an attempt to enroll a new agent fails
+
+@many-tokens
+Scenario: Enrolling with one of the many enrollment tokens of a policy
+  Given "3" enrollment tokens are created for the policy
+  When the enrollment token "1" of the policy is revoked
+    And an agent is deployed to Fleet with "tar" installer using the enrollment token "2"
+  Then the agent is listed in Fleet as "online"
+    And the agent runs the latest revision of the policy
+    And the policy has "3" active enrollment tokens
+
+@space
+Scenario: Enrolling into a policy of a non-default space
+  Given the policy is created in the "e2e-fleet" space
+  When an agent is deployed to Fleet with "tar" installer
+  Then the agent is listed in Fleet as "online"
+    And the agent runs the latest revision of the policy
+
+@force-reenroll
+Scenario: Re-enrolling the agent into another policy with --force
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the agent is force re-enrolled into a new policy
+  Then the agent runs the latest revision of the policy
+
+@delay-enroll
+Scenario: Deploying the agent with delayed enrollment
+  Given an agent is deployed to Fleet with "tar" installer and delayed enrollment
+  When the "elastic-agent" process is in the "started" state on the host
+  Then the agent is listed in Fleet as "online"
+    And the agent runs the latest revision of the policy
@@ -12,6 +12,12 @@ Scenario Outline: Deploying the agent
   Then the agent is listed in Fleet as "online"
     And system package dashboards are listed in Fleet
 
+@install-unprivileged
+Scenario Outline: Deploying the agent in unprivileged mode
+  Given an agent is deployed to Fleet with "tar" installer in "unprivileged" mode
+  When the "elastic-agent" process is in the "started" state on the host
+  Then the agent is listed in Fleet as "online"
+
 @install-including-tags
 Scenario Outline: Deploying the agent including command line --tag for tags
   When an agent is deployed to Fleet with "tar" installer and "--tag=production,linux" flags
@@ -68,3 +74,10 @@ Scenario Outline: Un-installing the installed agent
   When the "elastic-agent" process is "uninstalled" on the host
   Then the file system Agent folder is empty
     And the agent is listed in Fleet as "offline"
+
+@uninstall-host-custom-base-path
+Scenario Outline: Un-installing the agent installed under a custom base path
+  Given an agent is deployed to Fleet with "tar" installer under the "/usr/local" base path
+  When the "elastic-agent" process is "uninstalled" on the host
+  Then the file system Agent folder is empty
+    And the agent is listed in Fleet as "offline"
@@ -0,0 +1,20 @@
+@fleet_server_modes
+Feature: Fleet Server Modes
+  Scenarios for agents connecting to many Fleet Server instances behind a load balancer
+
+Scenario: Enrolling an agent through a load balancer
+  Given "2" Fleet Server instances are deployed behind a load balancer
+  When an agent is deployed to Fleet with "tar" installer through the load balancer
+  Then the agent is listed in Fleet as "online"
+
+Scenario: Enrolling an agent through a load balancer with a custom CA
+  Given "2" Fleet Server instances with TLS are deployed behind a load balancer
+  When an agent is deployed to Fleet with "tar" installer through the load balancer
+  Then the agent is listed in Fleet as "online"
+
+Scenario: Failing over to another Fleet Server instance
+  Given "2" Fleet Server instances with TLS are deployed behind a load balancer
+    And an agent is deployed to Fleet with "tar" installer through the load balancer
+    And the agent is listed in Fleet as "online"
+  When a Fleet Server instance is killed
+  Then the agent fails over to another Fleet Server within "5m"
@@ -7,3 +7,9 @@ Scenario Outline: Adding the Linux Integration to an Agent ...
     And the agent is listed in Fleet as "online"
   When the "Linux" integration is "added" in the policy
   Then a Linux data stream exists with some data
+
+Scenario: Enrolling an Agent into a Linux policy declared as code
+  Given the "linux_memory" agent policy is applied
+    And an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  Then a Linux data stream exists with some data
@@ -12,3 +12,15 @@ Examples:
   | Endpoint    |
   | Linux       |
   | Windows     |
+
+@package_assets
+Scenario: Installing the assets of a package
+  Given the "nginx" package is installed
+  Then the assets of the "nginx" package are present
+    And the "access" ingest pipeline of the "nginx" package processes the sample documents
+
+@package_assets
+Scenario: Uninstalling the assets of a package
+  Given the "nginx" package is installed
+  When the "nginx" package is uninstalled
+  Then the assets of the "nginx" package are removed
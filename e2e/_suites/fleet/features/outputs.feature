@@ -0,0 +1,29 @@
+@outputs
+Feature: Outputs
+  Scenarios for the outputs where the agents send the events
+
+Scenario Outline: Sending the events of an Agent to a "<type>" output
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the policy uses a "<type>" output
+  Then events arrive on the "<type>" output
+
+@elasticsearch
+Examples: Elasticsearch
+| type          |
+| elasticsearch |
+
+@logstash
+Examples: Logstash
+| type     |
+| logstash |
+
+@kafka
+Examples: Kafka
+| type  |
+| kafka |
+
+@remote_elasticsearch
+Examples: Remote Elasticsearch
+| type                 |
+| remote_elasticsearch |
@@ -72,3 +72,24 @@ Scenario Outline: Adding <value> <integration> Integration to a Policy
   Examples: logfile + syslog
     | integration | value  |
     | logfile     | syslog |
+
+@data_stream_fields
+Scenario Outline: The <value> metrics conform to the fields of the System package
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the policy is updated to have "system/metrics" set to "<value>"
+  Then the "system.<value>" data stream conforms to its package fields
+
+  Examples: System/metrics
+    | value  |
+    | cpu    |
+    | memory |
+
+@ingest_performance
+Scenario: The events of an enrolled agent are ingested in time
+  Given an agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the policy is updated to have "system/metrics" set to "cpu"
+  Then ingest latency p95 for "logs-elastic_agent" is below "10s"
+    And ingest latency p95 for "metrics-system.cpu" is below "10s"
+    And ingest throughput for "metrics-system.cpu" is at least "0.05" events per second
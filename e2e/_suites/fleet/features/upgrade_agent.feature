@@ -16,6 +16,20 @@ Feature: Upgrade Agent
       | 8.6.0            |
       | 7.17.10          |
 
+  @local
+  Scenario Outline: Upgrading an installed agent from <stale-version> with the upgrade command
+    Given a "<stale-version>" stale agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+    And certs are installed
+    And the "elastic-agent" process is "restarted" on the host
+    When agent is upgraded to "latest" version using "local"
+    Then agent is in "latest" version
+
+    Examples: Stale versions
+      | stale-version    |
+      | latest           |
+      | 8.6.0            |
+
 # These are the version of elastic agent that still have the bug solved in
 # https://github.com/elastic/elastic-agent/pull/1791
     @skip
@@ -27,3 +41,20 @@ Feature: Upgrade Agent
       | 8.2.3            |
       | 8.1.3            |
       | 7.17.8           |
+
+  @upgrade-failure
+  Scenario Outline: Rolling back a failed upgrade with a <failure>
+    Given a "8.14.3" stale agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+    And certs are installed
+    And the "elastic-agent" process is "restarted" on the host
+    When agent is upgraded to "latest" version with a "<failure>"
+    Then the agent reports the upgrade as failed in Fleet
+    And agent is in "8.14.3" version
+    And the agent is listed in Fleet as "online"
+
+    Examples: Upgrade failures
+      | failure            |
+      | corrupted source   |
+      | unreachable source |
+      | killed upgrade     |
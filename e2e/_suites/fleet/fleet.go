@@ -8,32 +8,46 @@ import (
 	"context"
 	"time"
 
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/ingest"
 	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/steps"
 	"github.com/elastic/e2e-testing/internal/utils"
 
 	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
 )
 
 // FleetTestSuite represents the scenarios for Fleet-mode
 type FleetTestSuite struct {
+	steps.FleetState // policy of the scenario and the enrollment token of its agents, shared with the Fleet policy steps
 	// integrations
-	KibanaProfile       string
-	StandAlone          bool
-	CurrentToken        string // current enrollment token
-	CurrentTokenID      string // current enrollment tokenID
-	ElasticAgentStopped bool   // will be used to signal when the agent process can be called again in the tear-down stage
-	Image               string // base image used to install the agent
-	InstallerType       string
-	Integration         kibana.IntegrationPackage // the installed integration
-	Policy              kibana.Policy
-	PolicyUpdatedAt     string // the moment the policy was updated
-	Version             string // current elastic-agent version
-	kibanaClient        *kibana.Client
-	deployer            deploy.Deployment
-	dockerDeployer      deploy.Deployment // used for docker related deployents, such as the stand-alone containers
-	BeatsProcess        string            // (optional) name of the Beats that must be present before installing the elastic-agent
+	KibanaProfile      string
+	StandAlone         bool
+	Image              string // base image used to install the agent
+	InstallerType      string
+	InstallOptions     deploy.InstallOptions     // install-time settings for the agent package, i.e. base path or unprivileged mode
+	Integration        kibana.IntegrationPackage // the installed integration
+	Output             kibana.Output             // output created by the scenario, used by the policy
+	OutputService      string                    // compose service receiving the events of the output
+	FleetServer        fleetServerDeployment     // Fleet Server instances deployed by the scenario, behind a load balancer
+	EnrollmentTokens   []kibana.EnrollmentAPIKey // enrollment tokens created by the steps, referred to by their creation order
+	Space              string                    // Kibana space created by the scenario, where its Fleet resources live
+	Namespace          string                    // namespace of the data streams of the scenario, so that its data does not mix with the data of the others
+	IngestMeasurements []ingest.Measurement      // ingest measurements taken by the scenario, recorded in the ingest report
+	TokenExpiresAt     time.Time                 // the moment the current enrollment token expires, zero if it never expires
+	PolicyUpdatedAt    string                    // the moment the policy was updated
+	Version            string                    // current elastic-agent version
+	kibanaClient       *kibana.Client
+	suiteKibanaClient  *kibana.Client // client of the suite, restored once the scenario leaves its space
+	deployer           deploy.Deployment
+	dockerDeployer     deploy.Deployment // used for docker related deployents, such as the stand-alone containers
+	BeatsProcess       string            // (optional) name of the Beats that must be present before installing the elastic-agent
+	// package assets
+	InstalledPackage  kibana.IntegrationPackage  // package whose assets were installed by the scenario, uninstalled on clean up
+	UninstalledAssets kibana.PackageInstallation // assets of the package uninstalled by the scenario, which must be removed
 	// date controls for queries
 	AgentStoppedDate             time.Time
 	RuntimeDependenciesStartDate time.Time
@@ -42,6 +56,49 @@ type FleetTestSuite struct {
 	DefaultAPIKey     string
 	PermissionHashes  map[string]string
 	ElasticAgentFlags string
+	// scenario
+	tx                  *apm.Transaction        // transaction of the scenario
+	stepSpan            *apm.Span               // span of the running step
+	deployedAgentsCount int                     // agents deployed to Fleet by the scenario, scaling the agent service
+	cleanups            *cleanup.Stack          // removal of the resources created by the scenario, the last created first
+	services            []deploy.ServiceRequest // services added to the profile, whose logs are collected when the scenario fails
+}
+
+// fleetSuite keeps the clients and the deployers shared by the scenarios, which are created before the suite runs
+var fleetSuite *FleetTestSuite
+
+// newScenario creates the state of a scenario, with the clients and the deployers of the suite. Each scenario has
+// its own state, so that the scenarios do not share their resources and can run concurrently
+func newScenario(suite *FleetTestSuite) *FleetTestSuite {
+	fts := &FleetTestSuite{
+		Version: common.ElasticAgentVersion,
+	}
+
+	// the suite is not set up when only the step definitions are listed
+	if suite != nil {
+		fts.kibanaClient = suite.kibanaClient
+		fts.suiteKibanaClient = suite.suiteKibanaClient
+		fts.deployer = suite.deployer
+		fts.dockerDeployer = suite.dockerDeployer
+		fts.RuntimeDependenciesStartDate = suite.RuntimeDependenciesStartDate
+		fts.services = append([]deploy.ServiceRequest{}, suite.services...)
+	}
+
+	return fts
+}
+
+// scenarioKey is the key of the state of a scenario in its context
+type scenarioKey struct{}
+
+// withScenario returns a copy of the context with the state of the scenario
+func withScenario(ctx context.Context, fts *FleetTestSuite) context.Context {
+	return context.WithValue(ctx, scenarioKey{}, fts)
+}
+
+// scenarioFromContext returns the state of the scenario
+func scenarioFromContext(ctx context.Context) (*FleetTestSuite, bool) {
+	fts, ok := ctx.Value(scenarioKey{}).(*FleetTestSuite)
+	return fts, ok
 }
 
 func (fts *FleetTestSuite) getDeployer() deploy.Deployment {
@@ -51,6 +108,32 @@ func (fts *FleetTestSuite) getDeployer() deploy.Deployment {
 	return fts.deployer
 }
 
+// addServices adds the services to the profile, recording them for the diagnostics of the scenario. A service
+// added again, i.e. the agent service scaled up, replaces its previous record
+func (fts *FleetTestSuite) addServices(profile deploy.ServiceRequest, services []deploy.ServiceRequest, env map[string]string) error {
+	err := fts.getDeployer().Add(fts.currentContext, profile, services, env)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		fts.services = recordService(fts.services, service)
+	}
+	return nil
+}
+
+// recordService appends the service to the records, replacing the record of the same service
+func recordService(services []deploy.ServiceRequest, service deploy.ServiceRequest) []deploy.ServiceRequest {
+	for i, s := range services {
+		if s.Name == service.Name && s.Flavour == service.Flavour {
+			services[i] = service
+			return services
+		}
+	}
+
+	return append(services, service)
+}
+
 func (fts *FleetTestSuite) getProfileEnv() map[string]string {
 	env := map[string]string{}
 
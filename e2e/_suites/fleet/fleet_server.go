@@ -0,0 +1,271 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/certs"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/config"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// fleetServerHAService is the compose service of the scaled out Fleet Server instances
+	fleetServerHAService = "fleet-server-ha"
+	// fleetServerLBService is the compose service of the load balancer in front of the Fleet Server instances
+	fleetServerLBService = "fleet-server-lb"
+	// fleetServerLBPort is the port of the load balancer in the host
+	fleetServerLBPort = "8221"
+)
+
+// fleetServerDeployment represents the Fleet Server instances deployed by a scenario, on top of the Fleet Server
+// of the profile, which is the one managed by the stack. The instances are reached through a load balancer
+type fleetServerDeployment struct {
+	CAFile    string // local path to the CA of the instances, empty when they serve plain HTTP
+	HostID    string // Fleet Server host registered for the policy of the scenario
+	Instances int
+	StoppedAt time.Time // the moment an instance was stopped
+	URL       string    // URL of the load balancer, as reached by the agents
+}
+
+// fleetServerInstancesAreDeployedBehindALoadBalancer deploys Fleet Server instances serving plain HTTP
+func (fts *FleetTestSuite) fleetServerInstancesAreDeployedBehindALoadBalancer(instances int) error {
+	return fts.deployFleetServers(instances, false)
+}
+
+// fleetServerInstancesWithTLSAreDeployedBehindALoadBalancer deploys Fleet Server instances serving TLS
+// with a certificate issued by a custom CA
+func (fts *FleetTestSuite) fleetServerInstancesWithTLSAreDeployedBehindALoadBalancer(instances int) error {
+	return fts.deployFleetServers(instances, true)
+}
+
+// deployFleetServers deploys the Fleet Server instances and their load balancer, registering the load balancer
+// as the Fleet Server host of the policy of the scenario, so that the agents keep connecting to it once enrolled
+func (fts *FleetTestSuite) deployFleetServers(instances int, tls bool) error {
+	if instances < 1 {
+		return fmt.Errorf("at least one Fleet Server instance is needed, got %d", instances)
+	}
+
+	serviceToken, err := elasticsearch.GetAPIToken(fts.currentContext)
+	if err != nil {
+		return err
+	}
+
+	env := fts.getProfileEnv()
+	env["elasticAgentTag"] = common.ElasticAgentVersion
+	env["fleetServerServiceToken"] = serviceToken.AccessToken
+	env["fleetServerPolicyId"] = kibana.FleetServicePolicy.ID
+	env["fleetServerLBPort"] = fleetServerLBPort
+
+	// the variables are persisted for the profile, so they are always set not to reuse the ones of a previous scenario
+	scheme := "http"
+	env["fleetServerHAInsecureHTTP"] = "1"
+	env["fleetServerHACA"] = ""
+	env["fleetServerHACert"] = ""
+	env["fleetServerHACertKey"] = ""
+	env["fleetServerHACertsDir"] = filepath.Join(config.OpDir(), "certs", fleetServerHAService)
+
+	fts.FleetServer = fleetServerDeployment{Instances: instances}
+	if tls {
+		files, err := fts.fleetServerCertificates()
+		if err != nil {
+			return err
+		}
+
+		scheme = "https"
+		certsDir := "/usr/share/elastic-agent/certs/"
+		env["fleetServerHAInsecureHTTP"] = "0"
+		env["fleetServerHACA"] = certsDir + filepath.Base(files.CA)
+		env["fleetServerHACert"] = certsDir + filepath.Base(files.Cert)
+		env["fleetServerHACertKey"] = certsDir + filepath.Base(files.Key)
+		env["fleetServerHACertsDir"] = filepath.Dir(files.CA)
+		fts.FleetServer.CAFile = files.CA
+	}
+	env["fleetServerHAScheme"] = scheme
+
+	profile := deploy.NewServiceRequest(common.FleetProfileName)
+
+	// the load balancer resolves the instances when it starts, so they must be running before it
+	err = fts.addServices(profile, []deploy.ServiceRequest{deploy.NewServiceRequest(fleetServerHAService).WithScale(instances)}, env)
+	if err != nil {
+		return err
+	}
+	err = fts.addServices(profile, []deploy.ServiceRequest{deploy.NewServiceRequest(fleetServerLBService)}, env)
+	if err != nil {
+		return err
+	}
+	// registered after the services, the host is deleted while the instances are still running
+	fts.cleanups.Push("fleet server host", fts.removeFleetServers)
+
+	fts.FleetServer.URL = fmt.Sprintf("%s://%s:8220", scheme, fleetServerLBService)
+	if common.Provider == "remote" {
+		// the agents run in the host, reaching the load balancer through its published port
+		fts.FleetServer.URL = fmt.Sprintf("%s://localhost:%s", scheme, fleetServerLBPort)
+	}
+
+	host, err := fts.kibanaClient.CreateFleetServerHost(fts.currentContext, kibana.FleetServerHost{
+		Name:     "e2e-" + fleetServerLBService + "-" + uuid.New().String(),
+		HostURLs: []string{fts.FleetServer.URL},
+	})
+	if err != nil {
+		return err
+	}
+	fts.FleetServer.HostID = host.ID
+
+	fts.Policy.FleetServerHostID = host.ID
+	policy, err := fts.kibanaClient.UpdatePolicy(fts.currentContext, fts.Policy)
+	if err != nil {
+		return err
+	}
+	fts.Policy = policy
+
+	log.WithFields(log.Fields{
+		"hostID":    host.ID,
+		"instances": instances,
+		"policyID":  policy.ID,
+		"url":       fts.FleetServer.URL,
+	}).Info("Fleet Server instances deployed behind a load balancer")
+
+	return nil
+}
+
+// fleetServerCertificates issues the certificate of the Fleet Server instances, which is served by all of them,
+// so it's valid for the load balancer too
+func (fts *FleetTestSuite) fleetServerCertificates() (certs.Files, error) {
+	ca, err := certs.NewCA("e2e-fleet-server-ca")
+	if err != nil {
+		return certs.Files{}, err
+	}
+
+	dir := filepath.Join(config.OpDir(), "certs", fleetServerHAService)
+	return ca.WriteServerCertificate(dir, fleetServerHAService, fleetServerHAService, fleetServerLBService, "localhost", "127.0.0.1")
+}
+
+// anAgentIsDeployedToFleetWithInstallerThroughTheLoadBalancer deploys an agent connecting to the Fleet Server
+// instances of the scenario, trusting their CA when they serve TLS
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerThroughTheLoadBalancer(installerType string) error {
+	if fts.FleetServer.URL == "" {
+		return fmt.Errorf("there are no Fleet Server instances behind a load balancer in the scenario")
+	}
+
+	opts := []DeploymentOpt{InstallerType(installerType), FleetURL(fts.FleetServer.URL)}
+	if fts.FleetServer.CAFile != "" {
+		opts = append(opts, FleetCA(fts.FleetServer.CAFile))
+	}
+
+	return fts.deployAgentToFleet(opts...)
+}
+
+// aFleetServerInstanceIsKilled stops one of the Fleet Server instances behind the load balancer
+func (fts *FleetTestSuite) aFleetServerInstanceIsKilled() error {
+	if fts.FleetServer.Instances < 2 {
+		return fmt.Errorf("there must be at least two Fleet Server instances to fail over, got %d", fts.FleetServer.Instances)
+	}
+
+	// compose names the instances after the service and their index, i.e. fleet_fleet-server-ha_1
+	instance := deploy.NewServiceContainerRequest(fleetServerHAService + "_" + strconv.Itoa(fts.FleetServer.Instances))
+	err := fts.getDeployer().Stop(fts.currentContext, instance)
+	if err != nil {
+		return err
+	}
+	fts.FleetServer.StoppedAt = time.Now().UTC()
+
+	log.WithFields(log.Fields{
+		"instance": instance.Name,
+	}).Info("Fleet Server instance stopped")
+	return nil
+}
+
+// theAgentFailsOverToAnotherFleetServerWithin checks that the agent keeps checking in through the load balancer
+// after an instance was stopped, within the given duration, i.e. 5m
+func (fts *FleetTestSuite) theAgentFailsOverToAnotherFleetServerWithin(within string) error {
+	maxTimeout, err := time.ParseDuration(within)
+	if err != nil {
+		return err
+	}
+
+	if fts.FleetServer.StoppedAt.IsZero() {
+		return fmt.Errorf("no Fleet Server instance was stopped in the scenario")
+	}
+
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err != nil {
+		return err
+	}
+
+	retryCount := 1
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	failoverFn := func() error {
+		agent, err := fts.kibanaClient.GetAgentByHostnameFromList(fts.currentContext, manifest.Hostname)
+		if err == nil && (agent.Status != "online" || !agent.CheckedInAfter(fts.FleetServer.StoppedAt)) {
+			err = fmt.Errorf("agent %s did not check in since the Fleet Server instance was stopped (status: %s, last checkin: %s)", agent.ID, agent.Status, agent.LastCheckin)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"hostname":    manifest.Hostname,
+				"retry":       retryCount,
+			}).Warn("The agent did not fail over yet")
+
+			retryCount++
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    manifest.Hostname,
+			"lastCheckin": agent.LastCheckin,
+			"retries":     retryCount,
+		}).Info("The agent failed over to another Fleet Server instance")
+		return nil
+	}
+
+	return backoff.Retry(failoverFn, exp)
+}
+
+// removeFleetServers deletes the host of the Fleet Server instances of the scenario, restoring the default one in
+// the policy. The instances and their load balancer are removed with their services
+func (fts *FleetTestSuite) removeFleetServers(ctx context.Context) error {
+	defer func() {
+		fts.FleetServer = fleetServerDeployment{}
+	}()
+
+	if fts.FleetServer.HostID == "" {
+		return nil
+	}
+
+	// the host is deleted even if the policy keeps using it, reporting both errors to the clean up stack
+	var errs []error
+	if fts.Policy.ID != "" {
+		fts.Policy.FleetServerHostID = ""
+		_, err := fts.kibanaClient.UpdatePolicy(ctx, fts.Policy)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("the default Fleet Server host could not be restored in the policy %s: %w", fts.Policy.ID, err))
+		}
+	}
+
+	err := fts.kibanaClient.DeleteFleetServerHost(ctx, fts.FleetServer.HostID)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("the Fleet Server host %s could not be deleted: %w", fts.FleetServer.HostID, err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -19,13 +19,17 @@ import (
 	"github.com/cucumber/godog/colors"
 	"github.com/docker/go-connections/nat"
 	apme2e "github.com/elastic/e2e-testing/internal"
+	"github.com/elastic/e2e-testing/internal/cassette"
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/config"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/elasticsearch"
-	"github.com/elastic/e2e-testing/internal/installer"
 	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/report"
 	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/steps"
+	"github.com/elastic/e2e-testing/internal/upgrade"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -36,116 +40,15 @@ import (
 
 const testResourcesDir = "./testresources"
 
-var fts *FleetTestSuite
-
-var tx *apm.Transaction
-var stepSpan *apm.Span
-
-// afterScenario destroys the state created by a scenario
-func afterScenario(fts *FleetTestSuite) {
-	defer func() {
-		fts.DefaultAPIKey = ""
-		// Reset Kibana Profile to default
-		fts.KibanaProfile = ""
-		deployedAgentsCount = 0
-	}()
-
-	span := tx.StartSpan("Clean up", "test.scenario.clean", nil)
-	fts.currentContext = apm.ContextWithSpan(context.Background(), span)
-	defer span.End()
-
-	serviceName := common.ElasticAgentServiceName
-
-	// if DEVELOPER_MODE=true let's not uninstall/unenroll the agent
-	if !common.DeveloperMode && fts.InstallerType != "" {
-		agentService := deploy.NewServiceRequest(serviceName)
-
-		if !fts.StandAlone {
-			// for the centos/debian flavour we need to retrieve the internal log files for the elastic-agent, as they are not
-			// exposed as container logs. For that reason we need to go through the installer abstraction
-			agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
-
-			logsPath, _ := filepath.Abs(filepath.Join("..", "..", "..", "outputs", serviceName+uuid.New().String()+".tgz"))
-			_, err := shell.Execute(fts.currentContext, ".", "tar", "czf", logsPath, "--exclude", "*/components/*", "--exclude", "*/tmp/*", "--exclude", "*/downloads/*", "--exclude", "*/install/*", "--exclude", "/opt/Elastic/Agent/data/elastic-agent-*/elastic-agent", "/opt/Elastic/Agent/data")
-			if err != nil {
-				log.WithFields(log.Fields{
-					"serviceName": serviceName,
-					"path":        logsPath,
-				}).Warn("Failed to collect logs")
-			} else {
-				log.WithFields(log.Fields{
-					"serviceName": serviceName,
-					"path":        logsPath,
-				}).Info("Logs collected")
-			}
-
-			if log.IsLevelEnabled(log.DebugLevel) {
-				err := agentInstaller.Logs(fts.currentContext)
-				if err != nil {
-					log.WithField("error", err).Warn("Could not get agent logs in the container")
-				}
-			}
-			// only call it when the elastic-agent is present
-			if !fts.ElasticAgentStopped {
-				err := agentInstaller.Uninstall(fts.currentContext)
-				if err != nil {
-					log.Warnf("Could not uninstall the agent after the scenario: %v", err)
-				}
-			}
-		} else if log.IsLevelEnabled(log.DebugLevel) {
-			// for the Docker image, we simply retrieve container logs
-			_ = fts.getDeployer().Logs(fts.currentContext, agentService)
-		}
-
-		err := fts.unenrollHostname()
-		if err != nil {
-			manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
-			log.WithFields(log.Fields{
-				"err":      err,
-				"hostname": manifest.Hostname,
-			}).Warn("The agentIDs for the hostname could not be unenrolled")
-		}
-	}
-
-	env := fts.getProfileEnv()
-	_ = fts.getDeployer().Remove(fts.currentContext, deploy.NewServiceRequest(common.FleetProfileName), []deploy.ServiceRequest{deploy.NewServiceRequest(serviceName)}, env)
-
-	// TODO: Determine why this may be empty here before being cleared out
-	if fts.CurrentTokenID != "" {
-		err := fts.kibanaClient.DeleteEnrollmentAPIKey(fts.currentContext, fts.CurrentTokenID)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"err":     err,
-				"tokenID": fts.CurrentTokenID,
-			}).Warn("The enrollment token could not be deleted")
-		}
-	}
-
-	// TODO: Dont think this is needed if we are making all policies unique
-	// fts.kibanaClient.DeleteAllPolicies(fts.currentContext)
-
-	// clean up fields
-	fts.CurrentTokenID = ""
-	fts.CurrentToken = ""
-	fts.InstallerType = ""
-	fts.Image = ""
-	fts.StandAlone = false
-	fts.BeatsProcess = ""
-	fts.ElasticAgentFlags = ""
-}
-
-// beforeScenario creates the state needed by a scenario
-func beforeScenario(fts *FleetTestSuite) {
+// beforeScenario creates the state needed by a scenario, registering the clean up of the resources it creates.
+// It returns an error when the policy or the enrollment token of the scenario cannot be created, failing the
+// scenario, whose clean up stack still removes what was created
+func beforeScenario(fts *FleetTestSuite) error {
 	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute
 	exp := utils.GetExponentialBackOff(maxTimeout)
 
-	fts.StandAlone = false
-	fts.ElasticAgentStopped = false
-
-	fts.Version = common.ElasticAgentVersion
-
 	waitForPolicy := func() error {
-		policy, err := fts.kibanaClient.CreatePolicy(fts.currentContext)
+		policy, err := fts.kibanaClient.CreatePolicyInNamespace(fts.currentContext, fts.Namespace)
 		if err != nil {
 			return errors.Wrap(err, "A new policy could not be obtained, retrying.")
 		}
@@ -154,13 +57,14 @@ func beforeScenario(fts *FleetTestSuite) {
 			"id":          policy.ID,
 			"name":        policy.Name,
 			"description": policy.Description,
+			"namespace":   policy.Namespace,
 		}).Info("Policy created")
 
 		fts.Policy = policy
 
 		// Grab the system integration as we'll need to assign it a new name so it wont collide during
 		// multiple policy creations at once
-		integration, err := fts.kibanaClient.GetIntegrationByPackageName(context.Background(), "system")
+		integration, err := fts.kibanaClient.GetIntegrationByPackageName(fts.currentContext, "system")
 		if err != nil {
 			return err
 		}
@@ -168,7 +72,7 @@ func beforeScenario(fts *FleetTestSuite) {
 		packageDataStream := kibana.PackageDataStream{
 			Name:        fmt.Sprintf("%s-%s", integration.Name, uuid.New().String()),
 			Description: integration.Title,
-			Namespace:   "default",
+			Namespace:   fts.Namespace,
 			PolicyID:    fts.Policy.ID,
 			Enabled:     true,
 			Package:     integration,
@@ -209,7 +113,7 @@ func beforeScenario(fts *FleetTestSuite) {
 			}
 		}
 
-		err = fts.kibanaClient.AddIntegrationToPolicy(context.Background(), packageDataStream)
+		err = fts.kibanaClient.AddIntegrationToPolicy(fts.currentContext, packageDataStream)
 		if err != nil {
 			return err
 		}
@@ -219,18 +123,17 @@ func beforeScenario(fts *FleetTestSuite) {
 
 	err := backoff.Retry(waitForPolicy, exp)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Grab a new enrollment key for new agent
 	enrollmentKey, err := fts.kibanaClient.CreateEnrollmentAPIKey(fts.currentContext, fts.Policy)
-
 	if err != nil {
-		log.Fatal("Unable to create enrollment token for agent")
+		return fmt.Errorf("unable to create enrollment token for agent: %w", err)
 	}
 
-	fts.CurrentToken = enrollmentKey.APIKey
-	fts.CurrentTokenID = enrollmentKey.ID
+	fts.EnrollmentToken = enrollmentKey
+	return nil
 }
 
 // bootstrapFleet this method creates the runtime dependencies for the Fleet test suite, being of special
@@ -275,6 +178,16 @@ func bootstrapFleet(ctx context.Context, env map[string]string) error {
 			}).Fatal("Fleet could not be recreated")
 		}
 
+		// the space awareness is a global setting that cannot be disabled, so it's enabled once for the whole
+		// suite, instead of from the scenarios of the non-default spaces
+		err = kibanaClient.EnableFleetSpaceAwareness(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"env":   env,
+			}).Fatal("Fleet space awareness could not be enabled")
+		}
+
 		fleetServicePolicy := kibana.FleetServicePolicy
 
 		log.WithFields(log.Fields{
@@ -373,31 +286,61 @@ func setUpSuite() {
 		os.Exit(1)
 	}
 
+	err = elasticsearch.CheckConfig()
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
 	common.InitVersions()
 
-	fts = &FleetTestSuite{
-		kibanaClient:   kibanaClient,
-		deployer:       deploy.New(common.Provider),
-		dockerDeployer: deploy.New("docker"),
+	fleetSuite = &FleetTestSuite{
+		kibanaClient:      kibanaClient,
+		suiteKibanaClient: kibanaClient,
+		deployer:          deploy.New(common.Provider),
+		dockerDeployer:    deploy.New("docker"),
 	}
 }
 
 func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
+	fts := newScenario(fleetSuite)
+
+	// the scenarios are recorded before running the hooks of the suite, which attach the diagnostics to them
+	recorder.Register(ctx)
+
 	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
 		log.Tracef("Before Fleet scenario: %s", sc.Name)
 
-		tx = apme2e.StartTransaction(sc.Name, "test.scenario")
-		tx.Context.SetLabel("suite", "fleet")
+		fts.tx = apme2e.StartTransaction(sc.Name, "test.scenario")
+		fts.tx.Context.SetLabel("suite", "fleet")
+
+		// the resources created by the scenario register their removal in its clean up stack. Its namespace and
+		// its policy are kept in the context for the shared steps
+		fts.cleanups = cleanup.NewStack(sc.Name)
+		fts.Namespace = elasticsearch.NewNamespace("e2e")
+		ctx = steps.WithFleet(steps.WithNamespace(cleanup.WithStack(ctx, fts.cleanups), fts.Namespace), &fts.FleetState)
+		ctx = withScenario(ctx, fts)
+
+		// the Kibana and Elasticsearch requests of the scenario record or replay the cassette in its context
+		ctx, err := cassette.Start(ctx, sc.Name)
+		if err != nil {
+			return ctx, err
+		}
 
 		// context is initialised at the step hook, we are initialising it here to prevent panics
-		fts.currentContext = context.Background()
-		beforeScenario(fts)
+		fts.currentContext = ctx
 
-		return ctx, nil
+		err = beforeScenario(fts)
+		return ctx, err
 	})
 
 	ctx.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
 		log.Tracef("After Fleet scenario: %s", sc.Name)
+		fts, ok := scenarioFromContext(ctx)
+		if !ok {
+			return ctx, nil
+		}
+
 		if err != nil {
 			e := apm.DefaultTracer().NewError(err)
 			e.Context.SetLabel("scenario", sc.Name)
@@ -406,13 +349,38 @@ func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
 		}
 
 		f := func() {
-			tx.End()
+			fts.tx.End()
 
 			apm.DefaultTracer().Flush(nil)
 		}
 		defer f()
 
-		afterScenario(fts)
+		if err != nil {
+			fts.collectDiagnostics(ctx, sc)
+		}
+
+		span := fts.tx.StartSpan("Clean up", "test.scenario.clean", nil)
+		fts.currentContext = apm.ContextWithSpan(ctx, span)
+		if log.IsLevelEnabled(log.DebugLevel) {
+			fts.agentLogs(fts.currentContext)
+		}
+		fts.cleanups.Finish(fts.currentContext)
+		span.End()
+
+		if err := cassette.Stop(ctx); err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"scenario": sc.Name,
+			}).Warn("Could not save the cassette of the scenario")
+		}
+
+		if upgradeMatrixReport != nil {
+			upgradeMatrixReport.Record(sc.Name, err)
+		}
+
+		for _, m := range fts.IngestMeasurements {
+			ingestReport.Record(sc.Name, m)
+		}
 
 		log.Tracef("After Fleet scenario: %s", sc.Name)
 		return ctx, nil
@@ -420,10 +388,15 @@ func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
 
 	ctx.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
 		log.Tracef("Before step: %s", step.Text)
-		stepSpan = tx.StartSpan(step.Text, "test.scenario.step", nil)
-		fts.currentContext = apm.ContextWithSpan(context.Background(), stepSpan)
+		fts, ok := scenarioFromContext(ctx)
+		if !ok {
+			return ctx, nil
+		}
 
-		return ctx, nil
+		fts.stepSpan = fts.tx.StartSpan(step.Text, "test.scenario.step", nil)
+		fts.currentContext = apm.ContextWithSpan(ctx, fts.stepSpan)
+
+		return fts.currentContext, nil
 	})
 	ctx.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
 		if err != nil {
@@ -434,26 +407,54 @@ func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
 			e.Send()
 		}
 
-		if stepSpan != nil {
-			stepSpan.End()
+		if fts, ok := scenarioFromContext(ctx); ok && fts.stepSpan != nil {
+			fts.stepSpan.End()
 		}
 
 		log.Tracef("After step (%s): %s", status.String(), step.Text)
 		return ctx, nil
 	})
 
+	// the steps shared with the other suites, whose agents are deployed with the options of the scenario. They are
+	// registered after the hooks of the suite, which create the clean up stack and the policy of the scenario. The
+	// data streams are registered first, so that they are cleaned up once the agents do not send data anymore
+	steps.NewElasticsearchData(time.Duration(utils.TimeoutFactor) * time.Minute).Register(ctx)
+	steps.NewFleetPolicies(fts.suiteKibanaClient, filepath.Join(testResourcesDir, "policies")).Register(ctx)
+	steps.NewAgent(fts.deployer, common.FleetProfileName, fts.suiteKibanaClient).WithHooks(steps.AgentHooks{
+		Deploy: func(ctx context.Context, installerType string) error {
+			// the agent is deployed in the context of the step calling the hook, where its state is recorded
+			fts.currentContext = ctx
+			return fts.deployAgentToFleet(InstallerType(installerType))
+		},
+		Listed: func(ctx context.Context, status string) error {
+			if status != "online" {
+				return nil
+			}
+			// the permission hash of the output is checked against the API key of the online agent
+			return fts.theAgentGetDefaultAPIKey()
+		},
+	}).Register(ctx)
+
 	ctx.Step(`^a "([^"]*)" agent is deployed to Fleet$`, fts.anAgentIsDeployedToFleet)
 	ctx.Step(`^an agent is deployed to Fleet on top of "([^"]*)"$`, fts.anAgentIsDeployedToFleetOnTopOfBeat)
-	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer$`, fts.anAgentIsDeployedToFleetWithInstaller)
 	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer and "([^"]*)" flags$`, fts.anAgentIsDeployedToFleetWithInstallerAndTags)
-	ctx.Step(`^the agent is listed in Fleet as "([^"]*)"$`, fts.theAgentIsListedInFleetWithStatus)
+	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer in "([^"]*)" mode$`, fts.anAgentIsDeployedToFleetWithInstallerInMode)
+	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer under the "([^"]*)" base path$`, fts.anAgentIsDeployedToFleetWithInstallerUnderBasePath)
 	ctx.Step(`^the output permissions has "([^"]*)"$`, fts.verifyPermissionHashStatus)
 	ctx.Step(`^the host is restarted$`, fts.theHostIsRestarted)
 	ctx.Step(`^system package dashboards are listed in Fleet$`, fts.systemPackageDashboardsAreListedInFleet)
 	ctx.Step(`^the agent is un-enrolled$`, fts.theAgentIsUnenrolled)
 	ctx.Step(`^the agent is re-enrolled on the host$`, fts.theAgentIsReenrolledOnTheHost)
-	ctx.Step(`^the enrollment token is revoked$`, fts.theEnrollmentTokenIsRevoked)
-	ctx.Step(`^an attempt to enroll a new agent fails$`, fts.anAttemptToEnrollANewAgentFails)
+	ctx.Step(`^an enrollment token expiring in "([^"]*)" is created$`, fts.anEnrollmentTokenExpiringInIsCreated)
+	ctx.Step(`^the enrollment token is expired$`, fts.theEnrollmentTokenIsExpired)
+	ctx.Step(`^"(\d+)" enrollment tokens are created for the policy$`, fts.enrollmentTokensAreCreatedForThePolicy)
+	ctx.Step(`^the enrollment token "(\d+)" of the policy is revoked$`, fts.theEnrollmentTokenOfThePolicyIsRevoked)
+	ctx.Step(`^the policy has "(\d+)" active enrollment tokens$`, fts.thePolicyHasActiveEnrollmentTokens)
+	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer using the enrollment token "(\d+)"$`, fts.anAgentIsDeployedToFleetWithInstallerUsingTheEnrollmentToken)
+	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer and delayed enrollment$`, fts.anAgentIsDeployedToFleetWithInstallerAndDelayedEnrollment)
+	ctx.Step(`^the policy is created in the "([^"]*)" space$`, fts.thePolicyIsCreatedInTheSpace)
+	ctx.Step(`^the agent is force re-enrolled into a new policy$`, fts.theAgentIsForceReenrolledIntoANewPolicy)
+	ctx.Step(`^the agent runs the latest revision of the policy$`, fts.theAgentRunsTheLatestRevisionOfThePolicy)
 	ctx.Step(`^the "([^"]*)" process is "([^"]*)" on the host$`, fts.processStateChangedOnTheHost)
 	ctx.Step(`^the file system Agent folder is empty$`, fts.theFileSystemAgentFolderIsEmpty)
 	ctx.Step(`^a Linux data stream exists with some data$`, fts.checkDataStream)
@@ -468,12 +469,31 @@ func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
 	ctx.Step(`^certs are installed$`, fts.installCerts)
 	ctx.Step(`^agent is in "([^"]*)" version$`, fts.agentInVersion)
 	ctx.Step(`^agent is upgraded to "([^"]*)" version$`, fts.anAgentIsUpgradedToVersion)
+	ctx.Step(`^agent is upgraded to "([^"]*)" version using "([^"]*)"$`, fts.anAgentIsUpgradedToVersionUsingMethod)
+	ctx.Step(`^agent is upgraded to "([^"]*)" version with a "([^"]*)"$`, fts.anAgentIsUpgradedToVersionWithFailure)
+	ctx.Step(`^the agent reports the upgrade as failed in Fleet$`, fts.theAgentReportsTheUpgradeAsFailedInFleet)
+
+	// bulk actions steps
+	ctx.Step(`^all agents are reassigned to "([^"]*)" policy within "([^"]*)"$`, fts.allAgentsAreReassignedToPolicyWithin)
+	ctx.Step(`^all agents are upgraded to "([^"]*)" version with a "([^"]*)" rollout within "([^"]*)"$`, fts.allAgentsAreUpgradedWithRolloutWithin)
+	ctx.Step(`^all agents are tagged with "([^"]*)" within "([^"]*)"$`, fts.allAgentsAreTaggedWithin)
+	ctx.Step(`^all agents are un-enrolled within "([^"]*)"$`, fts.allAgentsAreUnenrolledWithin)
+
+	// fleet server modes steps
+	ctx.Step(`^"(\d+)" Fleet Server instances are deployed behind a load balancer$`, fts.fleetServerInstancesAreDeployedBehindALoadBalancer)
+	ctx.Step(`^"(\d+)" Fleet Server instances with TLS are deployed behind a load balancer$`, fts.fleetServerInstancesWithTLSAreDeployedBehindALoadBalancer)
+	ctx.Step(`^an agent is deployed to Fleet with "([^"]*)" installer through the load balancer$`, fts.anAgentIsDeployedToFleetWithInstallerThroughTheLoadBalancer)
+	ctx.Step(`^a Fleet Server instance is killed$`, fts.aFleetServerInstanceIsKilled)
+	ctx.Step(`^the agent fails over to another Fleet Server within "([^"]*)"$`, fts.theAgentFailsOverToAnotherFleetServerWithin)
 
 	//flags steps
 	ctx.Step(`^the elastic agent index contains the tags$`, fts.tagsAreInTheElasticAgentIndex)
 
 	// integrations steps
 	ctx.Step(`^the "([^"]*)" integration is "([^"]*)" in the policy$`, fts.theIntegrationIsOperatedInThePolicy)
+	ctx.Step(`^the "([^"]*)" agent policy is applied$`, fts.theAgentPolicyIsApplied)
+	ctx.Step(`^the policy uses a "([^"]*)" output$`, fts.thePolicyUsesAnOutput)
+	ctx.Step(`^events arrive on the "([^"]*)" output$`, fts.eventsArriveOnTheOutput)
 	ctx.Step(`^the "([^"]*)" datasource is shown in the policy as added$`, fts.thePolicyShowsTheDatasourceAdded)
 	ctx.Step(`^an "([^"]*)" is successfully deployed with an Agent using "([^"]*)" installer$`, fts.anIntegrationIsSuccessfullyDeployedWithAgentAndInstaller)
 
@@ -487,6 +507,14 @@ func InitializeFleetTestScenario(ctx *godog.ScenarioContext) {
 	// System Integration steps
 	ctx.Step(`^the policy is updated to have "([^"]*)" set to "([^"]*)"$`, fts.thePolicyIsUpdatedToHaveSystemSet)
 	ctx.Step(`^"([^"]*)" with "([^"]*)" metrics are present in the datastreams$`, fts.theMetricsInTheDataStream)
+	ctx.Step(`^the "([^"]*)" data stream conforms to its package fields$`, fts.theDataStreamConformsToItsPackageFields)
+	ctx.Step(`^the "([^"]*)" package is installed$`, fts.thePackageIsInstalled)
+	ctx.Step(`^the "([^"]*)" package is uninstalled$`, fts.thePackageIsUninstalled)
+	ctx.Step(`^the assets of the "([^"]*)" package are present$`, fts.theAssetsOfThePackageArePresent)
+	ctx.Step(`^the assets of the "([^"]*)" package are removed$`, fts.theAssetsOfThePackageAreRemoved)
+	ctx.Step(`^the "([^"]*)" ingest pipeline of the "([^"]*)" package processes the sample documents$`, fts.theIngestPipelineProcessesTheSampleDocuments)
+	ctx.Step(`^ingest latency p(\d+(?:\.\d+)?) for "([^"]*)" is below "([^"]*)"$`, fts.ingestLatencyIsBelow)
+	ctx.Step(`^ingest throughput for "([^"]*)" is at least "([^"]*)" events per second$`, fts.ingestThroughputIsAtLeast)
 
 	// stand-alone only steps
 	ctx.Step(`^a "([^"]*)" stand-alone agent is deployed$`, fts.aStandaloneAgentIsDeployed)
@@ -563,15 +591,21 @@ func InitializeFleetTestSuite(ctx *godog.TestSuiteContext) {
 			if err != nil {
 				log.WithError(err).Fatal("Could not bootstrap Fleet runtime dependencies")
 			}
+
+			// the services of the profile, whose logs are collected for the failed scenarios too
+			fleetSuite.services = []deploy.ServiceRequest{
+				deploy.NewServiceRequest("elasticsearch"),
+				deploy.NewServiceRequest("kibana"),
+				deploy.NewServiceRequest(common.ElasticAgentServiceName).WithFlavour(common.FleetServerAgentServiceName),
+			}
 		} else {
-			err := fts.kibanaClient.WaitForFleet(suiteContext)
+			err := fleetSuite.kibanaClient.WaitForFleet(suiteContext)
 			if err != nil {
 				log.WithError(err).Fatal("Could not determine Fleet's readiness.")
 			}
 		}
 
-		fts.Version = common.BeatVersionBase
-		fts.RuntimeDependenciesStartDate = time.Now().UTC()
+		fleetSuite.RuntimeDependenciesStartDate = time.Now().UTC()
 	})
 
 	ctx.AfterSuite(func() {
@@ -612,6 +646,21 @@ func TestMain(m *testing.M) {
 	flag.Parse()
 	opts.Paths = flag.Args()
 
+	// in matrix mode, only the scenarios generated from the upgrade matrix are run
+	if matrix, ok := upgrade.NewMatrixFromEnv(); ok {
+		featureFile, err := prepareUpgradeMatrix(matrix)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not prepare the upgrade matrix")
+		}
+		opts.Paths = []string{featureFile}
+	}
+
+	// the resources of the running scenarios are removed when the suite panics or exits with a fatal error
+	defer cleanup.Recover()
+	log.DeferExitHandler(func() { cleanup.FinishAll(context.Background()) })
+
 	status := godog.TestSuite{
 		Name:                 "fleet",
 		TestSuiteInitializer: InitializeFleetTestSuite,
@@ -619,6 +668,10 @@ func TestMain(m *testing.M) {
 		Options:              &opts,
 	}.Run()
 
+	writeUpgradeMatrixReport()
+	writeIngestReport()
+	report.WriteAll(recorder, diagnosticsCollector, "fleet", opts.Format)
+
 	// Optional: Run `testing` package's logic besides godog.
 	if st := m.Run(); st > status {
 		status = st
@@ -0,0 +1,149 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/diagnostics"
+	"github.com/elastic/e2e-testing/internal/ingest"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultIngestWindow is the window of the ingest measurements, ending when they are taken
+const defaultIngestWindow = "5m"
+
+// ingestReport keeps the ingest measurements of the scenarios, written next to the reports of the suite
+var ingestReport = ingest.NewReport()
+
+// ingestLatencyIsBelow checks a percentile of the latency of the events of the agent in a data stream,
+// i.e. logs-generic, which is measured and recorded
+func (fts *FleetTestSuite) ingestLatencyIsBelow(percentile float64, dataStream string, limit string) error {
+	maxLatency, err := time.ParseDuration(limit)
+	if err != nil {
+		return fmt.Errorf("the %s latency is not a duration: %w", limit, err)
+	}
+
+	m, err := fts.measureIngest(dataStream)
+	if err != nil {
+		return err
+	}
+
+	latency, err := m.Latency(percentile)
+	if err != nil {
+		return err
+	}
+
+	if latency >= maxLatency {
+		return fmt.Errorf("the p%v ingest latency of the %s data stream is %s, expected below %s", percentile, m.DataStream, latency, maxLatency)
+	}
+	return nil
+}
+
+// ingestThroughputIsAtLeast checks the events per second of the agent in a data stream, which is measured and recorded
+func (fts *FleetTestSuite) ingestThroughputIsAtLeast(dataStream string, rate string) error {
+	minRate, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return fmt.Errorf("the %s events per second is not a number: %w", rate, err)
+	}
+
+	m, err := fts.measureIngest(dataStream)
+	if err != nil {
+		return err
+	}
+
+	if m.EventsPerSecond < minRate {
+		return fmt.Errorf("the ingest throughput of the %s data stream is %.2f events per second, expected at least %v", m.DataStream, m.EventsPerSecond, minRate)
+	}
+	return nil
+}
+
+// measureIngest measures the ingestion of the events of the agent in a data stream of the namespace of the scenario,
+// waiting for its events to be ingested
+func (fts *FleetTestSuite) measureIngest(dataStream string) (ingest.Measurement, error) {
+	window, err := time.ParseDuration(shell.GetEnv("INGEST_WINDOW", defaultIngestWindow))
+	if err != nil {
+		return ingest.Measurement{}, fmt.Errorf("the INGEST_WINDOW is not a duration: %w", err)
+	}
+
+	// the data streams are named by type and dataset, i.e. logs-generic, and the namespace is the one of the scenario
+	if strings.Count(dataStream, "-") < 2 {
+		dataStream = dataStream + "-" + fts.dataNamespace()
+	}
+
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, deploy.NewServiceRequest(common.ElasticAgentServiceName))
+	if err != nil {
+		return ingest.Measurement{}, err
+	}
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
+	exp := utils.GetExponentialBackOff(maxTimeout)
+	retryCount := 1
+
+	var m ingest.Measurement
+	measureFn := func() error {
+		m, err = ingest.Measure(fts.currentContext, dataStream, manifest.Hostname, window)
+		if err == nil && len(m.LatencyMillis) == 0 {
+			err = fmt.Errorf("there aren't ingested events of the %s host in the %s data stream yet", manifest.Hostname, dataStream)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dataStream":  dataStream,
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"retry":       retryCount,
+			}).Warn("The ingestion could not be measured yet")
+
+			retryCount++
+			return err
+		}
+		return nil
+	}
+
+	err = backoff.Retry(measureFn, exp)
+	if err != nil {
+		return ingest.Measurement{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"dataStream":      m.DataStream,
+		"events":          m.Events,
+		"eventsPerSecond": m.EventsPerSecond,
+		"latencyMillis":   m.LatencyMillis,
+	}).Info("Ingestion measured")
+
+	fts.IngestMeasurements = append(fts.IngestMeasurements, m)
+	return m, nil
+}
+
+// writeIngestReport writes the ingest measurements to the file defined by the INGEST_REPORT environment variable,
+// next to the cucumber report of the suite by default
+func writeIngestReport() {
+	if len(ingestReport.Measurements()) == 0 {
+		return
+	}
+
+	reportFile := "ingest.json"
+	if reports := diagnostics.CucumberReports(opts.Format); len(reports) > 0 {
+		reportFile = strings.TrimSuffix(reports[0], ".json") + "-ingest.json"
+	}
+	reportFile = shell.GetEnv("INGEST_REPORT", reportFile)
+
+	err := ingestReport.Write(reportFile)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"report": reportFile,
+		}).Error("Could not write the ingest report")
+	}
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -20,7 +21,7 @@ const actionADDED = "added"
 const actionREMOVED = "removed"
 
 func (fts *FleetTestSuite) anIntegrationIsSuccessfullyDeployedWithAgentAndInstaller(integration string, installerType string) error {
-	err := fts.anAgentIsDeployedToFleetWithInstaller(installerType)
+	err := fts.deployAgentToFleet(InstallerType(installerType))
 	if err != nil {
 		return err
 	}
@@ -48,7 +49,7 @@ func (fts *FleetTestSuite) theIntegrationIsOperatedInThePolicy(packageName strin
 		packageDataStream := kibana.PackageDataStream{
 			Name:        fmt.Sprintf("%s-%s", integration.Name, uuid.New().String()),
 			Description: integration.Title,
-			Namespace:   "default",
+			Namespace:   fts.Namespace,
 			PolicyID:    policy.ID,
 			Enabled:     true,
 			Package:     integration,
@@ -111,72 +112,56 @@ func (fts *FleetTestSuite) thePolicyShowsTheDatasourceAdded(packageName string)
 	return nil
 }
 
+// integrationPolicies the package policies added by the integration steps, by package
+var integrationPolicies = map[string]kibana.PackagePolicySpec{
+	"apm": kibana.NewPackagePolicy("apm").WithInputs(
+		kibana.NewInput("apm", kibana.TextVar("host", "localhost:8200")),
+	),
+	"linux": kibana.NewPackagePolicy("linux").WithInputs(
+		kibana.NewInput("linux/metrics").WithStream("metrics", "linux.memory", kibana.TextVar("period", "1s")),
+	),
+	"windows": kibana.NewPackagePolicy("windows").WithInputs(
+		kibana.NewInput("winlog").WithStream("logs", "windows.powershell",
+			kibana.TextVar("event_id", "some_id"),
+			kibana.BoolVar("preserve_original_event", false),
+		),
+	),
+}
+
 func inputs(integration string) []kibana.Input {
-	switch integration {
-	case "apm":
-		return []kibana.Input{
-			{
-				Type:    "apm",
-				Enabled: true,
-				Streams: []kibana.Stream{},
-				Vars: map[string]kibana.Var{
-					"apm-server": {
-						Value: "host",
-						Type:  "localhost:8200",
-					},
-				},
-			},
-		}
-	case "linux":
-		return []kibana.Input{
-			{
-				Type:    "linux/metrics",
-				Enabled: true,
-				Streams: []kibana.Stream{
-					{
-						ID:      "linux/metrics-linux.memory-" + uuid.New().String(),
-						Enabled: true,
-						DS: kibana.DataStream{
-							Dataset: "linux.memory",
-							Type:    "metrics",
-						},
-						Vars: map[string]kibana.Var{
-							"period": {
-								Value: "1s",
-								Type:  "string",
-							},
-						},
-					},
-				},
-			},
-		}
-	case "windows":
-		return []kibana.Input{
-			{
-				Type:    "winlog",
-				Enabled: true,
-				Streams: []kibana.Stream{
-					{
-						ID:      "winlog-windows.powershell-" + uuid.New().String(),
-						Enabled: true,
-						DS: kibana.DataStream{
-							Dataset: "windows.powershell",
-							Type:    "logs",
-						},
-						Vars: map[string]kibana.Var{
-							"event_id": {
-								Value: "some_id",
-								Type:  "text",
-							},
-							"preserve_original_event": {
-								Value: "false",
-								Type:  "bool",
-							},
-						},
-					},
-				},
-			},
-		}
+	spec, ok := integrationPolicies[integration]
+	if !ok {
+		return []kibana.Input{}
+	}
+
+	return spec.BuildInputs()
+}
+
+// theAgentPolicyIsApplied applies the agent policy of a fixture in the testresources/policies directory,
+// so that the agents of the scenario are enrolled with it
+func (fts *FleetTestSuite) theAgentPolicyIsApplied(fixture string) error {
+	spec, err := kibana.LoadPolicySpec(filepath.Join(testResourcesDir, "policies", fixture+".yml"))
+	if err != nil {
+		return err
 	}
-	return []kibana.Input{}
+
+	policy, err := fts.kibanaClient.ApplyPolicy(fts.currentContext, spec)
+	if err != nil {
+		return err
+	}
+
+	enrollmentKey, err := fts.kibanaClient.CreateEnrollmentAPIKey(fts.currentContext, policy)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"fixture":  fixture,
+		"policyID": policy.ID,
+		"revision": policy.Revision,
+	}).Info("Agent policy applied")
+
+	fts.Policy = policy
+	fts.EnrollmentToken = enrollmentKey
+	return nil
 }
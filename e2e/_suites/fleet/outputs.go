@@ -0,0 +1,289 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// outputLabel is the label added by the Logstash pipeline of the logstash service to the events
+// it receives, so that they can be told apart from the events sent straight to Elasticsearch
+const outputLabel = "labels.e2e_output"
+
+// outputServices maps the output types to the compose services receiving their events
+var outputServices = map[string]string{
+	kibana.OutputTypeKafka:    "redpanda",
+	kibana.OutputTypeLogstash: "logstash",
+}
+
+// thePolicyUsesAnOutput creates an output of the given type, starting the service receiving its events
+// if needed, and sets it as the data output of the current policy
+func (fts *FleetTestSuite) thePolicyUsesAnOutput(outputType string) error {
+	name := fmt.Sprintf("e2e-%s-%s", outputType, uuid.New().String())
+
+	var output kibana.Output
+	switch outputType {
+	case kibana.OutputTypeElasticsearch:
+		output = kibana.NewElasticsearchOutput(name, "http://elasticsearch:9200")
+	case kibana.OutputTypeKafka:
+		output = kibana.NewKafkaOutput(name, name, "redpanda:9092")
+	case kibana.OutputTypeLogstash:
+		output = kibana.NewLogstashOutput(name, "logstash:5044")
+	case kibana.OutputTypeRemoteElasticsearch:
+		// the remote cluster is the one of the profile, reached with a service token, so its events cannot be told
+		// apart from the ones of the default output: the checks rely on the output the agent reports running
+		token, err := fts.kibanaClient.CreateServiceToken(fts.currentContext)
+		if err != nil {
+			return err
+		}
+		output = kibana.NewRemoteElasticsearchOutput(name, token.Value, "http://elasticsearch:9200")
+	default:
+		return fmt.Errorf("output type %s is not supported", outputType)
+	}
+
+	if serviceName, ok := outputServices[outputType]; ok {
+		env := fts.getProfileEnv()
+		env["logstashTag"] = common.StackVersion
+
+		err := fts.addServices(deploy.NewServiceRequest(common.FleetProfileName), []deploy.ServiceRequest{deploy.NewServiceRequest(serviceName)}, env)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"service": serviceName,
+			}).Error("Could not start the service receiving the events of the output")
+			return err
+		}
+		fts.OutputService = serviceName
+	}
+	// registered after the service, the output is deleted while the service is still running
+	fts.cleanups.Push("output "+name, fts.removeOutput)
+
+	output, err := fts.kibanaClient.CreateOutput(fts.currentContext, output)
+	if err != nil {
+		return err
+	}
+	fts.Output = output
+
+	policy, err := fts.kibanaClient.AssignOutputsToPolicy(fts.currentContext, fts.Policy.ID, output.ID, fts.Policy.MonitoringOutputID)
+	if err != nil {
+		return err
+	}
+	fts.Policy = policy
+
+	log.WithFields(log.Fields{
+		"outputID": output.ID,
+		"policyID": policy.ID,
+		"revision": policy.Revision,
+		"type":     outputType,
+	}).Info("Output assigned to the policy")
+
+	return nil
+}
+
+// eventsArriveOnTheOutput checks that the events of the agent are received by the given output type
+func (fts *FleetTestSuite) eventsArriveOnTheOutput(outputType string) error {
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
+	manifest, err := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
+	if err != nil {
+		return err
+	}
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
+
+	if outputType != fts.Output.Type {
+		return fmt.Errorf("the policy uses a %s output, not a %s one", fts.Output.Type, outputType)
+	}
+
+	// the events of the Elasticsearch outputs land in the same cluster, so the agent must run the output of the scenario
+	err = fts.theAgentRunsTheOutput(manifest.Hostname, maxTimeout)
+	if err != nil {
+		return err
+	}
+
+	switch outputType {
+	case kibana.OutputTypeKafka:
+		return fts.eventsArriveOnTheKafkaTopic(fts.Output.Topic, manifest.Hostname, maxTimeout)
+	case kibana.OutputTypeLogstash:
+		_, err = elasticsearch.WaitForNumberOfHits(fts.currentContext, "logs-*,metrics-*", outputQuery(manifest.Hostname, true), 1, maxTimeout)
+	case kibana.OutputTypeRemoteElasticsearch:
+		err = fts.theOutputIsHealthy(maxTimeout)
+		if err != nil {
+			return err
+		}
+		_, err = elasticsearch.WaitForNumberOfHits(fts.currentContext, "logs-*,metrics-*", outputQuery(manifest.Hostname, false), 1, maxTimeout)
+	case kibana.OutputTypeElasticsearch:
+		_, err = elasticsearch.WaitForNumberOfHits(fts.currentContext, "logs-*,metrics-*", outputQuery(manifest.Hostname, false), 1, maxTimeout)
+	default:
+		return fmt.Errorf("output type %s is not supported", outputType)
+	}
+
+	return err
+}
+
+// theAgentRunsTheOutput waits for the agent of the host to report the output of the scenario as the one of its
+// policy, with healthy components sending their events to it
+func (fts *FleetTestSuite) theAgentRunsTheOutput(hostname string, maxTimeout time.Duration) error {
+	retryCount := 1
+
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	outputFn := func() error {
+		agent, err := fts.kibanaClient.GetAgentByHostnameFromList(fts.currentContext, hostname)
+		if err == nil && !agent.OutputHealthy(fts.Output) {
+			err = fmt.Errorf("the agent %s does not run the %s output %s with healthy components yet", agent.ID, fts.Output.Type, fts.Output.ID)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"outputID":    fts.Output.ID,
+				"retry":       retryCount,
+			}).Warn("The agent does not run the output yet")
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    hostname,
+			"outputID":    fts.Output.ID,
+			"retries":     retryCount,
+		}).Info("The agent runs the output")
+		return nil
+	}
+
+	return backoff.Retry(outputFn, exp)
+}
+
+// theOutputIsHealthy waits for Fleet to report the output of the scenario as healthy, which it does for
+// the remote Elasticsearch outputs once Fleet Server reached the remote cluster
+func (fts *FleetTestSuite) theOutputIsHealthy(maxTimeout time.Duration) error {
+	retryCount := 1
+
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	healthFn := func() error {
+		health, err := fts.kibanaClient.GetOutputHealth(fts.currentContext, fts.Output.ID)
+		if err == nil && health.State != "HEALTHY" {
+			err = fmt.Errorf("the output %s is not healthy: state=%q, message=%q", fts.Output.ID, health.State, health.Message)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"retry":       retryCount,
+			}).Warn("The output is not healthy yet")
+
+			retryCount++
+
+			return err
+		}
+
+		return nil
+	}
+
+	return backoff.Retry(healthFn, exp)
+}
+
+// eventsArriveOnTheKafkaTopic consumes the topic from its beginning, until an event of the host is found
+func (fts *FleetTestSuite) eventsArriveOnTheKafkaTopic(topic string, hostname string, maxTimeout time.Duration) error {
+	retryCount := 1
+
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	consumeFn := func() error {
+		cmd := []string{"rpk", "topic", "consume", topic, "--offset", "start", "--num", "10", "--format", "%v\\n"}
+		output, err := fts.getDeployer().ExecIn(fts.currentContext, deploy.NewServiceRequest(common.FleetProfileName), deploy.NewServiceRequest(outputServices[kibana.OutputTypeKafka]), cmd)
+		if err == nil && !strings.Contains(output, hostname) {
+			err = fmt.Errorf("there are no events of the %s host in the %s topic yet", hostname, topic)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"retry":       retryCount,
+				"topic":       topic,
+			}).Warn("Events not found in the Kafka topic yet")
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    hostname,
+			"retries":     retryCount,
+			"topic":       topic,
+		}).Info("Events found in the Kafka topic")
+		return nil
+	}
+
+	return backoff.Retry(consumeFn, exp)
+}
+
+// outputQuery finds the recent events of a host, filtering the ones labelled by Logstash
+func outputQuery(hostname string, throughLogstash bool) map[string]interface{} {
+	labelled := elasticsearch.Term(outputLabel, "logstash")
+
+	query := elasticsearch.NewQuery().
+		Filter(elasticsearch.Term("host.hostname", hostname)).
+		Last(time.Minute)
+
+	if throughLogstash {
+		query.Filter(labelled)
+	} else {
+		query.MustNot(labelled)
+	}
+
+	return query.Build()
+}
+
+// removeOutput restores the default output of the policy, deleting the output of the scenario. The service
+// receiving its events is removed with the services of the scenario
+func (fts *FleetTestSuite) removeOutput(ctx context.Context) error {
+	defer func() {
+		fts.Output = kibana.Output{}
+		fts.OutputService = ""
+	}()
+
+	if fts.Output.ID == "" {
+		return nil
+	}
+
+	// the output is deleted even if the policy keeps using it, reporting both errors to the clean up stack
+	var errs []error
+	if fts.Policy.ID != "" {
+		_, err := fts.kibanaClient.AssignOutputsToPolicy(ctx, fts.Policy.ID, "", fts.Policy.MonitoringOutputID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("the default output could not be restored in the policy %s: %w", fts.Policy.ID, err))
+		}
+	}
+
+	err := fts.kibanaClient.DeleteOutput(ctx, fts.Output.ID)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("the output %s could not be deleted: %w", fts.Output.ID, err))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,235 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// pipelineSample represents a document run through an ingest pipeline, with the values of the fields
+// of the processed document, by their dotted name
+type pipelineSample struct {
+	Source   map[string]interface{} `json:"source"`
+	Expected map[string]interface{} `json:"expected"`
+}
+
+// thePackageIsInstalled installs the assets of the latest version of a package, which are uninstalled
+// when the scenario finishes
+func (fts *FleetTestSuite) thePackageIsInstalled(packageName string) error {
+	pkg, err := fts.kibanaClient.GetIntegrationByPackageName(fts.currentContext, packageName)
+	if err != nil {
+		return err
+	}
+
+	assets, err := fts.kibanaClient.InstallIntegrationAssets(fts.currentContext, pkg)
+	if err != nil {
+		return err
+	}
+	fts.InstalledPackage = pkg
+	fts.cleanups.Push("package "+pkg.Name, fts.removeInstalledPackage)
+
+	log.WithFields(log.Fields{
+		"assets":  len(assets),
+		"package": pkg.Name,
+		"version": pkg.Version,
+	}).Info("Package installed")
+	return nil
+}
+
+// thePackageIsUninstalled uninstalls the package installed by the scenario, keeping its assets to check they are removed
+func (fts *FleetTestSuite) thePackageIsUninstalled(packageName string) error {
+	pkg, err := fts.installedPackage(packageName)
+	if err != nil {
+		return err
+	}
+
+	installation, err := fts.kibanaClient.GetPackageInstallation(fts.currentContext, pkg)
+	if err != nil {
+		return err
+	}
+
+	err = fts.kibanaClient.UninstallIntegrationAssets(fts.currentContext, pkg)
+	if err != nil {
+		return err
+	}
+
+	fts.InstalledPackage = kibana.IntegrationPackage{}
+	fts.UninstalledAssets = installation
+	return nil
+}
+
+// theAssetsOfThePackageArePresent checks the index templates, component templates, ILM policies, ingest pipelines,
+// transforms and saved objects reported by Fleet for the package installed by the scenario exist
+func (fts *FleetTestSuite) theAssetsOfThePackageArePresent(packageName string) error {
+	pkg, err := fts.installedPackage(packageName)
+	if err != nil {
+		return err
+	}
+
+	installation, err := fts.kibanaClient.GetPackageInstallation(fts.currentContext, pkg)
+	if err != nil {
+		return err
+	}
+
+	if installation.Status != kibana.PackageInstalled {
+		return fmt.Errorf("the %s package is %s", pkg.Name, installation.Status)
+	}
+	if len(installation.Elasticsearch) == 0 {
+		return fmt.Errorf("the %s package did not install assets in Elasticsearch", pkg.Name)
+	}
+
+	missing, err := fts.packageAssetsInState(installation.Elasticsearch, installation.Kibana, false)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the %s package did not install %d assets: %s", pkg.Name, len(missing), strings.Join(missing, ", "))
+	}
+
+	log.WithFields(log.Fields{
+		"elasticsearch": len(installation.Elasticsearch),
+		"kibana":        len(installation.Kibana),
+		"package":       pkg.Name,
+	}).Info("The assets of the package are present")
+	return nil
+}
+
+// theAssetsOfThePackageAreRemoved checks the assets of the package uninstalled by the scenario do not exist anymore
+func (fts *FleetTestSuite) theAssetsOfThePackageAreRemoved(packageName string) error {
+	installation := fts.UninstalledAssets
+	if len(installation.Elasticsearch) == 0 {
+		return fmt.Errorf("the %s package was not uninstalled by the scenario", packageName)
+	}
+
+	remaining, err := fts.packageAssetsInState(installation.Elasticsearch, installation.Kibana, true)
+	if err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("the %s package did not remove %d assets: %s", packageName, len(remaining), strings.Join(remaining, ", "))
+	}
+	return nil
+}
+
+// theIngestPipelineProcessesTheSampleDocuments simulates the ingest pipeline of a data stream of the package installed
+// by the scenario, i.e. access for nginx, with the sample documents of the test resources
+func (fts *FleetTestSuite) theIngestPipelineProcessesTheSampleDocuments(dataStream string, packageName string) error {
+	pkg, err := fts.installedPackage(packageName)
+	if err != nil {
+		return err
+	}
+
+	sampleFile := filepath.Join(testResourcesDir, "pipelines", fmt.Sprintf("%s.%s.json", pkg.Name, dataStream))
+	content, err := os.ReadFile(sampleFile)
+	if err != nil {
+		return err
+	}
+
+	var samples []pipelineSample
+	if err := json.Unmarshal(content, &samples); err != nil {
+		return fmt.Errorf("could not parse the samples of %s: %w", sampleFile, err)
+	}
+
+	docs := []map[string]interface{}{}
+	for _, sample := range samples {
+		docs = append(docs, sample.Source)
+	}
+
+	// the ingest pipelines of the packages are versioned, i.e. logs-nginx.access-1.20.0
+	pipelineID := fmt.Sprintf("logs-%s.%s-%s", pkg.Name, dataStream, pkg.Version)
+	simulated, err := elasticsearch.SimulatePipeline(fts.currentContext, pipelineID, docs)
+	if err != nil {
+		return err
+	}
+
+	mismatches := []string{}
+	for i, doc := range simulated {
+		if doc.Error != "" {
+			mismatches = append(mismatches, fmt.Sprintf("sample %d failed: %s", i, doc.Error))
+			continue
+		}
+
+		hit := elasticsearch.Hit{ID: fmt.Sprintf("sample %d", i), Source: doc.Source}
+		for field, expected := range samples[i].Expected {
+			value, ok := hit.Field(field)
+			if !ok || !reflect.DeepEqual(value, expected) {
+				mismatches = append(mismatches, fmt.Sprintf("sample %d has %v in %s, expected %v", i, value, field, expected))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("the %s pipeline did not process the samples as expected:\n%s", pipelineID, strings.Join(mismatches, "\n"))
+	}
+	return nil
+}
+
+// installedPackage returns the package installed by the scenario, checking it's the expected one
+func (fts *FleetTestSuite) installedPackage(packageName string) (kibana.IntegrationPackage, error) {
+	if fts.InstalledPackage.Name != packageName {
+		return kibana.IntegrationPackage{}, fmt.Errorf("the %s package was not installed by the scenario", packageName)
+	}
+	return fts.InstalledPackage, nil
+}
+
+// packageAssetsInState returns the assets which exist, if exist is true, or the ones which do not, as type/id. The
+// Elasticsearch assets whose existence cannot be checked are skipped
+func (fts *FleetTestSuite) packageAssetsInState(es []kibana.InstalledAsset, kb []kibana.InstalledAsset, exist bool) ([]string, error) {
+	found := []string{}
+
+	for _, asset := range es {
+		if !elasticsearch.SupportsAssetType(asset.Type) {
+			log.WithFields(log.Fields{
+				"id":   asset.ID,
+				"type": asset.Type,
+			}).Debug("The existence of the asset cannot be checked")
+			continue
+		}
+
+		ok, err := elasticsearch.AssetExists(fts.currentContext, asset.Type, asset.ID)
+		if err != nil {
+			return nil, err
+		}
+		if ok == exist {
+			found = append(found, asset.Type+"/"+asset.ID)
+		}
+	}
+
+	for _, asset := range kb {
+		ok, err := fts.kibanaClient.SavedObjectExists(fts.currentContext, asset.Type, asset.ID)
+		if err != nil {
+			return nil, err
+		}
+		if ok == exist {
+			found = append(found, asset.Type+"/"+asset.ID)
+		}
+	}
+
+	return found, nil
+}
+
+// removeInstalledPackage uninstalls the package installed by the scenario, if it was not uninstalled by its steps
+func (fts *FleetTestSuite) removeInstalledPackage(ctx context.Context) error {
+	defer func() {
+		fts.InstalledPackage = kibana.IntegrationPackage{}
+		fts.UninstalledAssets = kibana.PackageInstallation{}
+	}()
+
+	if fts.InstalledPackage.Name == "" {
+		return nil
+	}
+
+	return fts.kibanaClient.UninstallIntegrationAssets(ctx, fts.InstalledPackage)
+}
@@ -5,7 +5,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"time"
 
@@ -92,5 +91,5 @@ func (fts *FleetTestSuite) kibanaUsesProfile(profile string) error {
 
 	env := fts.getProfileEnv()
 
-	return bootstrapFleet(context.Background(), env)
+	return bootstrapFleet(fts.currentContext, env)
 }
@@ -17,7 +17,7 @@ import (
 
 func (fts *FleetTestSuite) processStateChangedOnTheHost(pr string, state string) error {
 	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
-	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
 	if state == "started" {
 		err := agentInstaller.Start(fts.currentContext)
 		return err
@@ -29,17 +29,7 @@ func (fts *FleetTestSuite) processStateChangedOnTheHost(pr string, state string)
 
 		return nil
 	} else if state == "uninstalled" {
-		err := agentInstaller.Uninstall(fts.currentContext)
-		if err != nil {
-			return err
-		}
-
-		// signal that the elastic-agent was uninstalled
-		if pr == common.ElasticAgentProcessName {
-			fts.ElasticAgentStopped = true
-		}
-
-		return nil
+		return agentInstaller.Uninstall(fts.currentContext)
 	} else if state != "stopped" {
 		return godog.ErrPending
 	}
@@ -91,7 +91,7 @@ func (fts *FleetTestSuite) thereIsNoNewDataInTheIndexAfterAgentShutsDown() error
 
 	agentService := deploy.NewServiceContainerRequest(common.ElasticAgentServiceName)
 	manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
-	result, err := searchAgentData(fts.currentContext, manifest.Hostname, fts.AgentStoppedDate, minimumHitsCount, maxTimeout)
+	result, err := searchAgentData(fts.currentContext, fts.dataNamespace(), manifest.Hostname, fts.AgentStoppedDate, minimumHitsCount, maxTimeout)
 	if err != nil {
 		if strings.Contains(err.Error(), "type:index_not_found_exception") {
 			return err
@@ -112,10 +112,13 @@ func (fts *FleetTestSuite) startStandAloneAgent(image string, bootstrapFleetServ
 
 	dockerImageTag := common.ElasticAgentVersion
 
-	common.ProfileEnv["elasticAgentDockerNamespace"] = deploy.GetDockerNamespaceEnvVar("beats")
-	common.ProfileEnv["elasticAgentDockerImageSuffix"] = ""
+	// the environment of the stand-alone agent is kept in the scenario, not to leak into the other scenarios
+	env := fts.getProfileEnv()
+
+	env["elasticAgentDockerNamespace"] = deploy.GetDockerNamespaceEnvVar("beats")
+	env["elasticAgentDockerImageSuffix"] = ""
 	if image != "default" {
-		common.ProfileEnv["elasticAgentDockerImageSuffix"] = "-" + image
+		env["elasticAgentDockerImageSuffix"] = "-" + image
 	}
 
 	if downloads.UseElasticAgentCISnapshots() {
@@ -135,10 +138,9 @@ func (fts *FleetTestSuite) startStandAloneAgent(image string, bootstrapFleetServ
 	if err != nil {
 		return err
 	}
-	fts.CurrentToken = enrollmentKey.APIKey
-	fts.CurrentTokenID = enrollmentKey.ID
+	fts.EnrollmentToken = enrollmentKey
 
-	cfg, err := kibana.NewFleetConfig(fts.CurrentToken)
+	cfg, err := kibana.NewFleetConfig(fts.EnrollmentToken.APIKey)
 	if err != nil {
 		return err
 	}
@@ -146,24 +148,24 @@ func (fts *FleetTestSuite) startStandAloneAgent(image string, bootstrapFleetServ
 	// See https://github.com/elastic/beats/blob/4accfa8/x-pack/elastic-agent/pkg/agent/cmd/container.go#L73-L85
 	// to understand the environment variables used by the elastic-agent to automatically
 	// enroll the new agent container in Fleet
-	common.ProfileEnv["fleetInsecure"] = "1"
-	common.ProfileEnv["fleetUrl"] = cfg.FleetServerURL()
-	common.ProfileEnv["fleetEnroll"] = "1"
-	common.ProfileEnv["fleetEnrollmentToken"] = cfg.EnrollmentToken
+	env["fleetInsecure"] = "1"
+	env["fleetUrl"] = cfg.FleetServerURL()
+	env["fleetEnroll"] = "1"
+	env["fleetEnrollmentToken"] = cfg.EnrollmentToken
 
-	common.ProfileEnv["fleetServerPort"] = "8221" // fixed port to avoid collitions with the stack's fleet-server
+	env["fleetServerPort"] = "8221" // fixed port to avoid collitions with the stack's fleet-server
 
-	common.ProfileEnv["elasticAgentTag"] = dockerImageTag
+	env["elasticAgentTag"] = dockerImageTag
 
 	if bootstrapFleetServer {
-		common.ProfileEnv["fleetServerMode"] = "1"
+		env["fleetServerMode"] = "1"
 	} else {
-		common.ProfileEnv["fleetServerMode"] = "0"
+		env["fleetServerMode"] = "0"
 	}
 
 	agentService := deploy.NewServiceContainerRequest(common.ElasticAgentServiceName)
 
-	err = fts.getDeployer().Add(fts.currentContext, deploy.NewServiceContainerRequest(common.FleetProfileName), []deploy.ServiceRequest{agentService}, common.ProfileEnv)
+	err = fts.addServices(deploy.NewServiceContainerRequest(common.FleetProfileName), []deploy.ServiceRequest{agentService}, env)
 	if err != nil {
 		log.Error("Could not deploy the elastic-agent")
 		return err
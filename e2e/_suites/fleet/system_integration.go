@@ -7,6 +7,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -179,8 +180,6 @@ func metricsInputs(integration string, set string, file string, metrics string)
 			Streams: data,
 		},
 	}
-
-	return []kibana.Input{}
 }
 
 func parseJSONMetrics(data *gabs.Container, integration string, set string, metrics string) []kibana.Stream {
@@ -221,7 +220,7 @@ func readJSONFile(file string) (*gabs.Container, error) {
 	}).Info("Successfully Opened " + file)
 
 	defer jsonFile.Close()
-	data, err := os.ReadAll(jsonFile)
+	data, err := io.ReadAll(jsonFile)
 	if err != nil {
 		return nil, err
 	}
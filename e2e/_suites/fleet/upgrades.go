@@ -6,12 +6,15 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/installer"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/upgrade"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
@@ -21,10 +24,68 @@ const (
 	upgradeMaxTimeout = 10 * time.Minute
 )
 
+// upgradeMatrixReport the compatibility report of the upgrade matrix, only present when running in matrix mode
+var upgradeMatrixReport *upgrade.Report
+
+// prepareUpgradeMatrix resolves the versions of the upgrade matrix, generating the feature file with its
+// scenarios in a temporary directory. It returns the path to the feature file
+func prepareUpgradeMatrix(m upgrade.Matrix) (string, error) {
+	// the version under test is needed to resolve the "latest" version
+	common.InitVersions()
+
+	resolved, err := m.Resolve(upgrade.NewResolver(common.ElasticAgentVersion))
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "upgrade-matrix")
+	if err != nil {
+		return "", err
+	}
+
+	featureFile, err := resolved.WriteFeature(dir)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"from":       resolved.From,
+		"to":         resolved.To,
+		"installers": resolved.Installers,
+		"methods":    resolved.Methods,
+	}).Info("Running the upgrade matrix")
+
+	upgradeMatrixReport = upgrade.NewReport(resolved)
+	return featureFile, nil
+}
+
+// writeUpgradeMatrixReport writes the compatibility report of the upgrade matrix to the file defined by
+// the UPGRADE_MATRIX_REPORT environment variable, if running in matrix mode
+func writeUpgradeMatrixReport() {
+	if upgradeMatrixReport == nil {
+		return
+	}
+
+	// print the table as is, including line breaks
+	fmt.Println(upgradeMatrixReport.Table())
+
+	reportFile := shell.GetEnv("UPGRADE_MATRIX_REPORT", "upgrade-matrix.md")
+	err := upgradeMatrixReport.Write(reportFile)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"report": reportFile,
+		}).Error("Could not write the upgrade matrix report")
+	}
+}
+
 func (fts *FleetTestSuite) agentInVersion(version string) error {
 	switch version {
 	case "latest":
 		version = downloads.GetSnapshotVersion(common.ElasticAgentVersion)
+	default:
+		// Fleet does not report the git commit of a snapshot
+		version = downloads.RemoveCommitFromSnapshot(version)
 	}
 	log.Tracef("Checking if agent is in version %s. Current version: %s", version, fts.Version)
 
@@ -76,6 +137,12 @@ func (fts *FleetTestSuite) agentInVersion(version string) error {
 }
 
 func (fts *FleetTestSuite) anAgentIsUpgradedToVersion(desiredVersion string) error {
+	return fts.anAgentIsUpgradedToVersionUsingMethod(desiredVersion, upgrade.MethodFleet)
+}
+
+// supported methods: fleet, which sends an upgrade action from Fleet, and local,
+// which runs the 'elastic-agent upgrade' command on the host
+func (fts *FleetTestSuite) anAgentIsUpgradedToVersionUsingMethod(desiredVersion string, method string) error {
 	switch desiredVersion {
 	case "latest":
 		desiredVersion = common.ElasticAgentVersion
@@ -84,16 +151,97 @@ func (fts *FleetTestSuite) anAgentIsUpgradedToVersion(desiredVersion string) err
 
 	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
 
-	/*
-		// upgrading using the command is needed for stand-alone mode, only
-		agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	switch method {
+	case upgrade.MethodFleet:
+		manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
+		return fts.kibanaClient.UpgradeAgent(fts.currentContext, manifest.Hostname, desiredVersion)
+	case upgrade.MethodLocal:
+		agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
 
-		log.Tracef("Upgrading agent from %s to %s with 'upgrade' command.", desiredVersion, fts.Version)
+		log.Tracef("Upgrading agent from %s to %s with 'upgrade' command.", fts.Version, desiredVersion)
 		return agentInstaller.Upgrade(fts.currentContext, desiredVersion)
-	*/
+	}
 
+	return fmt.Errorf("unsupported upgrade method %s: use %s or %s", method, upgrade.MethodFleet, upgrade.MethodLocal)
+}
+
+// supported failures: corrupted source, killed upgrade and unreachable source. The error of the upgrade command
+// is expected for some failures, so it's only logged, leaving the assertion to the status reported to Fleet
+func (fts *FleetTestSuite) anAgentIsUpgradedToVersionWithFailure(desiredVersion string, failure string) error {
+	upgradeFailure, err := installer.ParseUpgradeFailure(failure)
+	if err != nil {
+		return err
+	}
+
+	switch desiredVersion {
+	case "latest":
+		desiredVersion = common.ElasticAgentVersion
+	}
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
+	agentInstaller, err := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
+	if err != nil {
+		return err
+	}
+
+	log.Tracef("Upgrading agent from %s to %s with a %s.", fts.Version, desiredVersion, upgradeFailure)
+	err = installer.UpgradeWithFailure(fts.currentContext, agentInstaller, desiredVersion, upgradeFailure)
+	if installer.IsUpgradeCommandError(err) {
+		// the failure of the upgrade command is expected, and Fleet reports the upgrade as failed
+		log.WithFields(log.Fields{
+			"error":   err,
+			"failure": upgradeFailure,
+			"version": desiredVersion,
+		}).Debug("The upgrade command failed")
+		return nil
+	}
+
+	return err
+}
+
+func (fts *FleetTestSuite) theAgentReportsTheUpgradeAsFailedInFleet() error {
+	retryCount := 0
+	maxTimeout := upgradeMaxTimeout
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
 	manifest, _ := fts.getDeployer().GetServiceManifest(fts.currentContext, agentService)
-	return fts.kibanaClient.UpgradeAgent(fts.currentContext, manifest.Hostname, desiredVersion)
+
+	upgradeFailedFn := func() error {
+		retryCount++
+
+		agent, err := fts.kibanaClient.GetAgentByHostname(fts.currentContext, manifest.Hostname)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"maxTimeout":  maxTimeout,
+				"retries":     retryCount,
+			}).Warn("Could not get agent by hostname")
+			return err
+		}
+
+		if !agent.UpgradeFailed() {
+			err := fmt.Errorf("the upgrade of the agent %s is not reported as failed", agent.ID)
+			log.WithFields(log.Fields{
+				"elapsedTime":    exp.GetElapsedTime(),
+				"maxTimeout":     maxTimeout,
+				"retries":        retryCount,
+				"status":         agent.Status,
+				"upgradeDetails": agent.UpgradeDetails,
+			}).Warn(err.Error())
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"errorMsg":    agent.UpgradeDetails.Metadata.ErrorMsg,
+			"failedState": agent.UpgradeDetails.Metadata.FailedState,
+			"status":      agent.Status,
+		}).Info("The upgrade of the agent is reported as failed in Fleet")
+		return nil
+	}
+
+	return backoff.Retry(upgradeFailedFn, exp)
 }
 
 func (fts *FleetTestSuite) anStaleAgentIsDeployedToFleetWithInstaller(staleVersion string, installerType string) error {
@@ -106,12 +254,12 @@ func (fts *FleetTestSuite) anStaleAgentIsDeployedToFleetWithInstaller(staleVersi
 
 	log.Tracef("The stale version is %s", fts.Version)
 
-	return fts.anAgentIsDeployedToFleetWithInstaller(installerType)
+	return fts.deployAgentToFleet(InstallerType(installerType))
 }
 
 func (fts *FleetTestSuite) installCerts() error {
 	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName)
-	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService, fts.InstallerType)
+	agentInstaller, _ := installer.Attach(fts.currentContext, fts.getDeployer(), agentService.WithInstallOptions(fts.InstallOptions), fts.InstallerType)
 
 	err := agentInstaller.InstallCerts(fts.currentContext)
 	if err != nil {
@@ -0,0 +1,91 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cucumber/godog"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/elastic/e2e-testing/internal/diagnostics"
+	"github.com/elastic/e2e-testing/internal/report"
+	"github.com/elastic/e2e-testing/internal/steps"
+)
+
+// diagnosticsCollector keeps the diagnostics of the failed scenarios, under the outputs directory of the repository
+var diagnosticsCollector = diagnostics.NewCollector(filepath.Join("..", "..", "..", "outputs", "diagnostics"))
+
+// recorder records the scenarios of the suite, with the artifacts collected for the failed ones, for its reports
+var recorder = report.NewRecorder("k8s-autodiscover")
+
+// collectDiagnostics collects a sample of the resources of the namespace of a failed scenario and the logs of its
+// pods into its own directory, before the clean up deletes the namespace. The artifacts are attached to the
+// scenario of the context for the reports of the suite
+func collectDiagnostics(ctx context.Context, sc *godog.Scenario) {
+	pods, ok := steps.PodsFromContext(ctx)
+	if !ok {
+		return
+	}
+	kubectl := pods.Kubectl
+
+	dir, err := diagnosticsCollector.ScenarioDir(sc.Uri, sc.Name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"scenario": sc.Name,
+		}).Warn("Could not create the diagnostics directory of the scenario")
+		return
+	}
+
+	resourcesPath := filepath.Join(dir, "resources.yaml")
+	resources, err := kubectl.Run(ctx, "get", "all,configmaps,events", "-o", "yaml")
+	if err == nil {
+		err = os.WriteFile(resourcesPath, []byte(resources), 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": kubectl.Namespace,
+		}).Warn("Could not sample the resources of the namespace")
+	} else {
+		diagnosticsCollector.Add(sc.Uri, sc.Name, resourcesPath)
+		report.Attach(ctx, report.Samples, resourcesPath)
+	}
+
+	names, err := kubectl.Run(ctx, "get", "pods", "-o", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": kubectl.Namespace,
+		}).Warn("Could not list the pods of the namespace")
+	}
+
+	for _, pod := range strings.Fields(names) {
+		logsPath := filepath.Join(dir, pod+".log")
+
+		logs, err := kubectl.Run(ctx, "logs", pod, "--all-containers")
+		if err == nil {
+			err = os.WriteFile(logsPath, []byte(logs), 0644)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"pod":   pod,
+			}).Warn("Could not save the logs of the pod")
+			continue
+		}
+		diagnosticsCollector.Add(sc.Uri, sc.Name, logsPath)
+		report.Attach(ctx, report.Logs, logsPath)
+	}
+
+	log.WithFields(log.Fields{
+		"dir":      dir,
+		"scenario": sc.Name,
+	}).Info("Diagnostics of the failed scenario collected")
+}
@@ -0,0 +1,222 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package cassette records the HTTP interactions with the Kibana and Elasticsearch APIs into cassette
+// files, one per scenario, and replays them without a running stack.
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/internal/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ModeOff the HTTP interactions are neither recorded nor replayed
+	ModeOff = ""
+	// ModeRecord the HTTP interactions are sent to the stack and recorded into the cassette of the scenario
+	ModeRecord = "record"
+	// ModeReplay the HTTP interactions are served from the cassette of the scenario, without a stack
+	ModeReplay = "replay"
+)
+
+// unsafeChars characters that are replaced in the file names of the cassettes
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Request represents a recorded HTTP request, without host nor credentials
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"` // path and query of the request
+	Body   string `json:"body,omitempty"`
+}
+
+// Response represents a recorded HTTP response
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction represents a recorded HTTP request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette represents the HTTP interactions of a scenario. It's safe for concurrent use
+type Cassette struct {
+	Name         string        `json:"name"`
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	path string
+	used map[int]bool // interactions already replayed
+}
+
+// New creates an empty cassette, stored in a directory using the name
+func New(dir string, name string) *Cassette {
+	return &Cassette{
+		Name:         name,
+		Interactions: []Interaction{},
+		path:         filepath.Join(dir, FileName(name)),
+		used:         map[int]bool{},
+	}
+}
+
+// Load reads the cassette of a name from a directory
+func Load(dir string, name string) (*Cassette, error) {
+	c := New(dir, name)
+
+	bytes, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cassette %s: %w", c.path, err)
+	}
+
+	err = json.Unmarshal(bytes, c)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse cassette %s: %w", c.path, err)
+	}
+
+	return c, nil
+}
+
+// FileName returns the name of the cassette file for a name, i.e. a scenario
+func FileName(name string) string {
+	return strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(name), "_"), "_") + ".json"
+}
+
+// Path returns the path to the cassette file
+func (c *Cassette) Path() string {
+	return c.path
+}
+
+// Record appends an interaction to the cassette
+func (c *Cassette) Record(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = append(c.Interactions, i)
+}
+
+// Find returns the first interaction for the method and URL which was not replayed yet. Polling requests
+// replay the interactions in the recorded order, repeating the last one when all of them were replayed
+func (c *Cassette) Find(method string, url string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last := -1
+	for idx, i := range c.Interactions {
+		if i.Request.Method != method || i.Request.URL != url {
+			continue
+		}
+
+		last = idx
+		if !c.used[idx] {
+			c.used[idx] = true
+			return i, true
+		}
+	}
+
+	if last < 0 {
+		return Interaction{}, false
+	}
+
+	return c.Interactions[last], true
+}
+
+// Save writes the cassette file, creating its directory if needed
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(c.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create the cassettes directory: %w", err)
+	}
+
+	bytes, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(c.path, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write cassette %s: %w", c.path, err)
+	}
+
+	log.WithFields(log.Fields{
+		"cassette":     c.path,
+		"interactions": len(c.Interactions),
+	}).Debug("Cassette saved")
+	return nil
+}
+
+type cassetteKey struct{}
+
+// WithCassette returns a copy of the context with the cassette of the scenario. The transports of the Kibana and
+// Elasticsearch clients read it from the context of each request
+func WithCassette(ctx context.Context, c *Cassette) context.Context {
+	return context.WithValue(ctx, cassetteKey{}, c)
+}
+
+// FromContext returns the cassette of the scenario, nil if there is none
+func FromContext(ctx context.Context) *Cassette {
+	c, _ := ctx.Value(cassetteKey{}).(*Cassette)
+	return c
+}
+
+// Mode returns the cassette mode, read from the HTTP_CASSETTE_MODE environment variable
+func Mode() string {
+	return shell.GetEnv("HTTP_CASSETTE_MODE", ModeOff)
+}
+
+// Dir returns the directory of the cassette files, read from the HTTP_CASSETTE_DIR environment variable
+func Dir() string {
+	return shell.GetEnv("HTTP_CASSETTE_DIR", "cassettes")
+}
+
+// Start inserts the cassette of a scenario into its context: a new one in record mode, or the recorded one in
+// replay mode. The context is returned as is when the cassettes are off
+func Start(ctx context.Context, name string) (context.Context, error) {
+	var c *Cassette
+	switch mode := Mode(); mode {
+	case ModeOff:
+		return ctx, nil
+	case ModeRecord:
+		c = New(Dir(), name)
+	case ModeReplay:
+		var err error
+		c, err = Load(Dir(), name)
+		if err != nil {
+			return ctx, err
+		}
+	default:
+		return ctx, fmt.Errorf("unsupported cassette mode %s: use %s or %s", mode, ModeRecord, ModeReplay)
+	}
+
+	log.WithFields(log.Fields{
+		"cassette": c.Path(),
+		"mode":     Mode(),
+	}).Debug("Cassette inserted")
+	return WithCassette(ctx, c), nil
+}
+
+// Stop ejects the cassette of the scenario of the context, saving it in record mode
+func Stop(ctx context.Context) error {
+	c := FromContext(ctx)
+	if c == nil || Mode() != ModeRecord {
+		return nil
+	}
+
+	return c.Save()
+}
@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cassette
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileName(t *testing.T) {
+	assert.Equal(t, "deploying_the_tar_agent.json", FileName(`Deploying the "tar" agent`))
+	assert.Equal(t, "upgrading_from_8.13.4.json", FileName("Upgrading from 8.13.4"))
+}
+
+func Test_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Set-Cookie", "sid=secret")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		_, _ = w.Write([]byte(`{"status":"` + strings.Repeat("o", calls) + `k"}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("HTTP_CASSETTE_DIR", dir)
+	t.Setenv("HTTP_CASSETTE_MODE", ModeRecord)
+
+	client := &http.Client{Transport: WrapTransport(http.DefaultTransport)}
+	ctx, err := Start(context.Background(), "Recording a scenario")
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Do(newRequest(ctx, http.MethodPost, srv.URL+"/_cluster/health?wait_for_status=yellow", `{"a":1}`))
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+	}
+	assert.Nil(t, Stop(ctx))
+
+	recorded, err := Load(dir, "Recording a scenario")
+	assert.Nil(t, err)
+	assert.Len(t, recorded.Interactions, 2)
+	assert.Equal(t, "/_cluster/health?wait_for_status=yellow", recorded.Interactions[0].Request.URL)
+	assert.Equal(t, `{"a":1}`, recorded.Interactions[0].Request.Body)
+	assert.Empty(t, recorded.Interactions[0].Response.Headers.Get("Set-Cookie"))
+
+	t.Setenv("HTTP_CASSETTE_MODE", ModeReplay)
+
+	// the host is not part of the recorded interactions, so any host replays them
+	client = &http.Client{Transport: WrapTransport(nil)}
+	ctx, err = Start(context.Background(), "Recording a scenario")
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, Stop(ctx))
+	}()
+
+	bodies := []string{}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Do(newRequest(ctx, http.MethodPost, "http://replayed:9200/_cluster/health?wait_for_status=yellow", ""))
+		assert.Nil(t, err)
+		assert.Equal(t, "Elasticsearch", resp.Header.Get("X-Elastic-Product"))
+
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		bodies = append(bodies, string(body))
+	}
+	assert.Equal(t, []string{`{"status":"ok"}`, `{"status":"ook"}`, `{"status":"ook"}`}, bodies)
+	assert.Equal(t, 2, calls)
+
+	_, err = client.Do(newRequest(ctx, http.MethodGet, "http://replayed:9200/_cat/indices", ""))
+	assert.ErrorContains(t, err, "has no interaction for GET /_cat/indices")
+
+	// the requests of other scenarios are not replayed with the cassette
+	_, err = client.Do(newRequest(context.Background(), http.MethodGet, "http://replayed:9200/_cluster/health?wait_for_status=yellow", ""))
+	assert.ErrorContains(t, err, "there is no cassette to replay")
+}
+
+// newRequest creates a request with a context, i.e. the one of a scenario
+func newRequest(ctx context.Context, method string, url string, body string) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	return req
+}
+
+func Test_Start(t *testing.T) {
+	t.Run("Cassettes are off by default", func(t *testing.T) {
+		t.Setenv("HTTP_CASSETTE_MODE", "")
+
+		ctx, err := Start(context.Background(), "Scenario")
+		assert.Nil(t, err)
+		assert.Nil(t, FromContext(ctx))
+		assert.Equal(t, http.DefaultTransport, WrapTransport(http.DefaultTransport))
+	})
+
+	t.Run("Missing cassettes are reported in replay mode", func(t *testing.T) {
+		t.Setenv("HTTP_CASSETTE_DIR", t.TempDir())
+		t.Setenv("HTTP_CASSETTE_MODE", ModeReplay)
+
+		_, err := Start(context.Background(), "Scenario")
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown modes are rejected", func(t *testing.T) {
+		t.Setenv("HTTP_CASSETTE_MODE", "rewind")
+
+		_, err := Start(context.Background(), "Scenario")
+		assert.Error(t, err)
+	})
+}
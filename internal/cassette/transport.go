@@ -0,0 +1,121 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper recording or replaying the interactions with the cassette
+// in the context of each request. Without a cassette, the requests are sent as is
+type Transport struct {
+	next   http.RoundTripper
+	replay bool
+}
+
+// WrapTransport wraps a transport to record or replay the interactions, depending on the cassette mode.
+// The transport is returned as is when the cassettes are off
+func WrapTransport(next http.RoundTripper) http.RoundTripper {
+	switch Mode() {
+	case ModeRecord:
+		return &Transport{next: next}
+	case ModeReplay:
+		return &Transport{next: next, replay: true}
+	}
+
+	return next
+}
+
+// NewReplayTransport creates a transport which only replays the interactions of the cassette in the context
+// of the requests
+func NewReplayTransport() *Transport {
+	return &Transport{replay: true}
+}
+
+// RoundTrip records or replays the request with the cassette in its context
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := FromContext(req.Context())
+	if c == nil {
+		if t.replay {
+			return nil, fmt.Errorf("there is no cassette to replay %s %s", req.Method, req.URL.RequestURI())
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	if t.replay {
+		return replay(c, req)
+	}
+
+	return record(c, t.next, req)
+}
+
+func replay(c *Cassette, req *http.Request) (*http.Response, error) {
+	i, ok := c.Find(req.Method, req.URL.RequestURI())
+	if !ok {
+		return nil, fmt.Errorf("the cassette %s has no interaction for %s %s", c.Name, req.Method, req.URL.RequestURI())
+	}
+
+	header := i.Response.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewBufferString(i.Response.Body)),
+		ContentLength: int64(len(i.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func record(c *Cassette, next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = io.ReadAll(body)
+			_ = body.Close()
+		}
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// cookies can carry sessions, so they are never recorded
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+
+	c.Record(Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.RequestURI(),
+			Body:   string(reqBody),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    header,
+			Body:       string(respBody),
+		},
+	})
+
+	return resp, nil
+}
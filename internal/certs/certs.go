@@ -0,0 +1,169 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package certs creates throwaway certificate authorities and the certificates they issue, so that
+// the services of a deployment can be reached with TLS connections trusting a custom CA.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// validity is the lifetime of the certificates, long enough for any test run
+const validity = 24 * time.Hour
+
+// CA represents a certificate authority able to issue certificates
+type CA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+// Files represents the paths to the PEM files of a certificate, its key and the CA which issued it
+type Files struct {
+	CA   string
+	Cert string
+	Key  string
+}
+
+// NewCA creates a self-signed certificate authority
+func NewCA(commonName string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newTemplate(commonName)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}, nil
+}
+
+// CertPEM returns the certificate of the CA, PEM encoded
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// IssueServerCertificate issues a certificate for a server reachable at the hosts, which can be DNS names
+// or IP addresses. It returns the certificate and its key, PEM encoded
+func (ca *CA) IssueServerCertificate(hosts ...string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commonName := "localhost"
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+
+	template, err := newTemplate(commonName)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// WriteServerCertificate issues a certificate for a server reachable at the hosts, writing it, its key and
+// the CA into the dir directory as ca.pem, <name>.pem and <name>.key
+func (ca *CA) WriteServerCertificate(dir string, name string, hosts ...string) (Files, error) {
+	certPEM, keyPEM, err := ca.IssueServerCertificate(hosts...)
+	if err != nil {
+		return Files{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Files{}, err
+	}
+
+	files := Files{
+		CA:   filepath.Join(dir, "ca.pem"),
+		Cert: filepath.Join(dir, name+".pem"),
+		Key:  filepath.Join(dir, name+".key"),
+	}
+
+	// the files are read by the services of the containers, which do not run as the current user
+	contents := map[string][]byte{
+		files.CA:   ca.certPEM,
+		files.Cert: certPEM,
+		files.Key:  keyPEM,
+	}
+	for path, content := range contents {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return Files{}, err
+		}
+	}
+
+	return files, nil
+}
+
+func newTemplate(commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"Elastic E2E"},
+		},
+		NotBefore: now.Add(-time.Minute),
+		NotAfter:  now.Add(validity),
+	}, nil
+}
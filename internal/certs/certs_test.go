@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCA_IssueServerCertificate(t *testing.T) {
+	ca, err := NewCA("e2e-ca")
+	require.NoError(t, err)
+
+	certPEM, keyPEM, err := ca.IssueServerCertificate("fleet-server", "127.0.0.1")
+	require.NoError(t, err)
+
+	// the certificate and the key are a valid pair
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(ca.CertPEM()))
+
+	for _, host := range []string{"fleet-server", "127.0.0.1"} {
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: pool})
+		assert.NoError(t, err, host)
+	}
+
+	t.Run("Hosts not in the certificate are not trusted", func(t *testing.T) {
+		_, err := cert.Verify(x509.VerifyOptions{DNSName: "kibana", Roots: pool})
+		assert.Error(t, err)
+	})
+
+	t.Run("Certificates of other CAs are not trusted", func(t *testing.T) {
+		other, err := NewCA("other-ca")
+		require.NoError(t, err)
+
+		otherPool := x509.NewCertPool()
+		require.True(t, otherPool.AppendCertsFromPEM(other.CertPEM()))
+
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: "fleet-server", Roots: otherPool})
+		assert.Error(t, err)
+	})
+}
+
+func TestCA_WriteServerCertificate(t *testing.T) {
+	ca, err := NewCA("e2e-ca")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	files, err := ca.WriteServerCertificate(dir, "fleet-server", "fleet-server")
+	require.NoError(t, err)
+
+	caPEM, err := os.ReadFile(files.CA)
+	require.NoError(t, err)
+	assert.Equal(t, ca.CertPEM(), caPEM)
+
+	_, err = tls.LoadX509KeyPair(files.Cert, files.Key)
+	assert.NoError(t, err)
+}
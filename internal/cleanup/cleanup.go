@@ -0,0 +1,235 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package cleanup provides the stack of clean up functions of a scenario. The calls creating a resource, i.e.
+// creating a policy or adding a service to a deployment, register the function removing it in the stack found
+// in their context, and the calls removing the resource unregister it. Once the scenario finishes, the functions
+// run in reverse order of registration, so that a resource is removed before the ones it depends on.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// Func removes a resource created by a scenario
+type Func func(ctx context.Context) error
+
+// entry represents a function removing a resource, by a name describing the resource, i.e. agent policy 1234
+type entry struct {
+	name string
+	fn   Func
+}
+
+// Stack represents the clean up functions registered by a scenario
+type Stack struct {
+	scenario string
+	mu       sync.Mutex
+	entries  []entry
+}
+
+// live keeps the stacks of the scenarios which did not finish, to be finished when the suite panics or exits
+var live = struct {
+	mu     sync.Mutex
+	stacks map[*Stack]struct{}
+}{stacks: map[*Stack]struct{}{}}
+
+// NewStack creates the empty stack of clean up functions of a scenario
+func NewStack(scenario string) *Stack {
+	s := &Stack{scenario: scenario}
+
+	live.mu.Lock()
+	live.stacks[s] = struct{}{}
+	live.mu.Unlock()
+
+	return s
+}
+
+// Push registers a function removing a resource of the scenario. A resource registered again, i.e. a service
+// added twice, is only removed once, in the position of its last registration
+func (s *Stack) Push(name string, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.remove(name), entry{name: name, fn: fn})
+}
+
+// Forget unregisters the function removing a resource, because the scenario removed it
+func (s *Stack) Forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = s.remove(name)
+}
+
+// remove returns the entries without the one of a resource, it must be called holding the lock
+func (s *Stack) remove(name string) []entry {
+	entries := make([]entry, 0, len(s.entries)+1)
+	for _, e := range s.entries {
+		if e.name != name {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Pending returns the names of the resources pending to be removed, the last registered first
+func (s *Stack) Pending() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.entries))
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		names = append(names, s.entries[i].name)
+	}
+	return names
+}
+
+// Run runs the registered functions, the last registered first, emptying the stack. A failing function does
+// not stop the next ones
+func (s *Stack) Run(ctx context.Context) Summary {
+	s.mu.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.mu.Unlock()
+
+	summary := Summary{Scenario: s.scenario, Failed: map[string]error{}}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+
+		log.WithField("resource", e.name).Trace("Cleaning up")
+		err := e.fn(ctx)
+		if err != nil {
+			summary.Failed[e.name] = err
+			continue
+		}
+		summary.Removed = append(summary.Removed, e.name)
+	}
+
+	return summary
+}
+
+// Finish runs the functions of the stack and logs the summary of the clean up. The resources are kept in
+// developer mode, to be inspected, and the summary lists them
+func (s *Stack) Finish(ctx context.Context) Summary {
+	live.mu.Lock()
+	delete(live.stacks, s)
+	live.mu.Unlock()
+
+	var summary Summary
+	if common.DeveloperMode {
+		summary = Summary{Scenario: s.scenario, Kept: s.Pending()}
+
+		s.mu.Lock()
+		s.entries = nil
+		s.mu.Unlock()
+	} else {
+		summary = s.Run(ctx)
+	}
+
+	summary.log()
+	return summary
+}
+
+// Summary represents the result of the clean up of a scenario
+type Summary struct {
+	Scenario string
+	Removed  []string         // resources removed, the last created first
+	Failed   map[string]error // resources which could not be removed, by name
+	Kept     []string         // resources left behind in developer mode
+}
+
+// String returns the summary as a list of the resources which were not removed
+func (s Summary) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "clean up of the %q scenario: %d removed, %d failed, %d kept", s.Scenario, len(s.Removed), len(s.Failed), len(s.Kept))
+	for name, err := range s.Failed {
+		fmt.Fprintf(&sb, "\n  - %s: %v", name, err)
+	}
+	for _, name := range s.Kept {
+		fmt.Fprintf(&sb, "\n  - %s", name)
+	}
+	return sb.String()
+}
+
+// log logs the summary, as a warning when some resources could not be removed
+func (s Summary) log() {
+	if len(s.Removed) == 0 && len(s.Failed) == 0 && len(s.Kept) == 0 {
+		return
+	}
+
+	if len(s.Failed) > 0 {
+		log.Warn(s.String())
+		return
+	}
+	if len(s.Kept) > 0 {
+		log.Info("Resources left behind in developer mode, " + s.String())
+		return
+	}
+	log.Debug(s.String())
+}
+
+// stackKey is the key of the Stack of a scenario in its context
+type stackKey struct{}
+
+// WithStack returns a copy of the context with the stack of clean up functions of the scenario
+func WithStack(ctx context.Context, s *Stack) context.Context {
+	return context.WithValue(ctx, stackKey{}, s)
+}
+
+// FromContext returns the stack of clean up functions of the scenario
+func FromContext(ctx context.Context) (*Stack, bool) {
+	s, ok := ctx.Value(stackKey{}).(*Stack)
+	return s, ok
+}
+
+// Register registers a function removing a resource in the stack of the context. It returns false if the
+// context has no stack, i.e. for the resources of the suite, which are not removed after a scenario
+func Register(ctx context.Context, name string, fn Func) bool {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	s.Push(name, fn)
+	return true
+}
+
+// Forget unregisters the function removing a resource from the stack of the context, if any
+func Forget(ctx context.Context, name string) {
+	if s, ok := FromContext(ctx); ok {
+		s.Forget(name)
+	}
+}
+
+// FinishAll finishes the stacks of the scenarios which did not finish, i.e. when the suite exits because of
+// a fatal error
+func FinishAll(ctx context.Context) {
+	live.mu.Lock()
+	stacks := make([]*Stack, 0, len(live.stacks))
+	for s := range live.stacks {
+		stacks = append(stacks, s)
+	}
+	live.mu.Unlock()
+
+	for _, s := range stacks {
+		s.Finish(ctx)
+	}
+}
+
+// Recover finishes the stacks of the scenarios which did not finish when the suite panics, panicking again
+// after it. It must be deferred, i.e. defer cleanup.Recover()
+func Recover() {
+	if r := recover(); r != nil {
+		log.WithField("panic", r).Error("The suite panicked, cleaning up the running scenarios")
+		FinishAll(context.Background())
+		panic(r)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStack(t *testing.T) {
+	s := NewStack("Deploying an agent")
+	ctx := WithStack(context.Background(), s)
+
+	order := []string{}
+	register := func(name string, err error) {
+		require.True(t, Register(ctx, name, func(ctx context.Context) error {
+			order = append(order, name)
+			return err
+		}))
+	}
+
+	register("agent policy 1", nil)
+	register("enrollment token 2", errors.New("not allowed"))
+	register("service fleet/elastic-agent", nil)
+	register("agent install elastic-agent", nil)
+	register("namespace test", nil)
+	Forget(ctx, "namespace test")
+	// registered again, the service is removed in the position of its last registration
+	register("service fleet/elastic-agent", nil)
+
+	assert.Equal(t, []string{"service fleet/elastic-agent", "agent install elastic-agent", "enrollment token 2", "agent policy 1"}, s.Pending())
+
+	summary := s.Finish(ctx)
+	assert.Equal(t, []string{"service fleet/elastic-agent", "agent install elastic-agent", "enrollment token 2", "agent policy 1"}, order)
+	assert.Equal(t, []string{"service fleet/elastic-agent", "agent install elastic-agent", "agent policy 1"}, summary.Removed)
+	assert.EqualError(t, summary.Failed["enrollment token 2"], "not allowed")
+	assert.Contains(t, summary.String(), "enrollment token 2: not allowed")
+	assert.Empty(t, s.Pending())
+}
+
+func TestStack_DeveloperMode(t *testing.T) {
+	defer func(developerMode bool) { common.DeveloperMode = developerMode }(common.DeveloperMode)
+	common.DeveloperMode = true
+
+	s := NewStack("Deploying an agent")
+	ran := false
+	s.Push("agent policy 1", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	summary := s.Finish(context.Background())
+	assert.False(t, ran)
+	assert.Equal(t, []string{"agent policy 1"}, summary.Kept)
+	assert.Contains(t, summary.String(), "agent policy 1")
+}
+
+func TestRegister_WithoutStack(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, Register(ctx, "agent policy 1", func(ctx context.Context) error { return nil }))
+	Forget(ctx, "agent policy 1")
+}
+
+func TestRecover(t *testing.T) {
+	s := NewStack("Panicking")
+	ran := false
+	s.Push("agent policy 1", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer Recover()
+		panic("boom")
+	})
+	assert.True(t, ran)
+
+	// the stacks are finished once
+	ran = false
+	FinishAll(context.Background())
+	assert.False(t, ran)
+}
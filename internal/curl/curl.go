@@ -18,6 +18,7 @@ import (
 type HTTPRequest struct {
 	BasicAuthUser     string
 	BasicAuthPassword string
+	Client            *http.Client // client sending the request, http.DefaultClient when nil
 	EncodeURL         bool
 	Headers           map[string]string
 	method            string
@@ -114,7 +115,12 @@ func request(r HTTPRequest) (string, error) {
 		req.SetBasicAuth(r.BasicAuthUser, r.BasicAuthPassword)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client := http.DefaultClient
+	if r.Client != nil {
+		client = r.Client
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":      err,
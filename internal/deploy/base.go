@@ -6,9 +6,12 @@ package deploy
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
@@ -19,12 +22,14 @@ type Deployment interface {
 	Add(ctx context.Context, profile ServiceRequest, services []ServiceRequest, env map[string]string) error    // adds service deployments
 	AddFiles(ctx context.Context, profile ServiceRequest, service ServiceRequest, files []string) error         // adds files to a service
 	Bootstrap(ctx context.Context, profile ServiceRequest, env map[string]string, waitCB func() error) error    // will bootstrap or reuse existing cluster if kubernetes is selected
+	CopyFrom(ctx context.Context, profile ServiceRequest, service ServiceRequest, src string, dst string) error // copies a file or directory of a service into a local directory
 	Destroy(ctx context.Context, profile ServiceRequest) error                                                  // Teardown deployment
 	ExecIn(ctx context.Context, profile ServiceRequest, service ServiceRequest, cmd []string) (string, error)   // Execute arbitrary commands in service
 	GetServiceManifest(ctx context.Context, service ServiceRequest) (*ServiceManifest, error)                   // inspects service
 	Logs(ctx context.Context, service ServiceRequest) error                                                     // prints logs of deployed service
 	PreBootstrap(ctx context.Context) error                                                                     // run any pre-bootstrap commands
 	Remove(ctx context.Context, profile ServiceRequest, services []ServiceRequest, env map[string]string) error // Removes services from deployment
+	SaveLogs(ctx context.Context, service ServiceRequest, dst string) error                                     // writes logs of deployed service into a local file
 	Start(ctx context.Context, service ServiceRequest) error                                                    // Starts a service or container depending on Deployment
 	Stop(ctx context.Context, service ServiceRequest) error                                                     // Stop a service or container depending on deployment
 }
@@ -32,6 +37,7 @@ type Deployment interface {
 // ServiceOperator represents the operations that can be performed by a service
 type ServiceOperator interface {
 	AddFiles(ctx context.Context, files []string) error                // adds files to service environment
+	Diagnostics(ctx context.Context, dst string) (string, error)       // collects the diagnostics bundle into a local directory
 	Enroll(ctx context.Context, token string, extraFlags string) error // handle any enrollment/registering of service
 	Exec(ctx context.Context, args []string) (string, error)           // exec arbitrary commands in service environment
 	Inspect() (ServiceOperatorManifest, error)                         // returns manifest for package
@@ -90,14 +96,80 @@ type WaitForServiceRequest struct {
 // ServiceRequest represents the service to be created using the provider
 type ServiceRequest struct {
 	Name                string
-	BackgroundProcesses []string // optional, configured using builder method to add processes that must be installed in the service
-	Flavour             string   // optional, configured using builder method
-	IsContainer         bool     // optional, set to true when the service is backed by a container
-	Scale               int      // default: 1
+	BackgroundProcesses []string       // optional, configured using builder method to add processes that must be installed in the service
+	Flavour             string         // optional, configured using builder method
+	InstallOptions      InstallOptions // optional, configured using builder method to customise the install of the service package
+	IsContainer         bool           // optional, set to true when the service is backed by a container
+	Scale               int            // default: 1
 	Version             string
 	WaitStrategies      []WaitForServiceRequest // wait strategies for the service
 }
 
+// InstallOptions install-time settings for a service package, passed to the install and enroll commands
+type InstallOptions struct {
+	BasePath               string            // optional, the directory under which the service is installed
+	CertificateAuthorities []string          // optional, paths in the service environment to the CAs trusted for the connections to Fleet
+	FleetURL               string            // optional, the Fleet Server the service connects to, instead of the default one
+	ProxyDisabled          bool              // optional, ignores the proxy environment variables for the connections to Fleet
+	ProxyHeaders           map[string]string // optional, headers sent to the proxy on the connections to Fleet
+	ProxyURL               string            // optional, the proxy used for the connections to Fleet
+	Tags                   []string          // optional, tags added to the service
+	Unprivileged           bool              // optional, set to true to run the service as a non-root user
+}
+
+// EnrollFlags returns the flags accepted by both the install and enroll commands
+func (o InstallOptions) EnrollFlags() []string {
+	flags := []string{}
+
+	if o.ProxyURL != "" {
+		flags = append(flags, "--proxy-url="+o.ProxyURL)
+	}
+	if o.ProxyDisabled {
+		flags = append(flags, "--proxy-disabled")
+	}
+
+	// sort the headers, so that the flags are always the same
+	headers := make([]string, 0, len(o.ProxyHeaders))
+	for k := range o.ProxyHeaders {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+	for _, k := range headers {
+		flags = append(flags, fmt.Sprintf("--proxy-header=%s=%s", k, o.ProxyHeaders[k]))
+	}
+
+	if len(o.Tags) > 0 {
+		flags = append(flags, "--tag="+strings.Join(o.Tags, ","))
+	}
+
+	return flags
+}
+
+// Flags returns the flags for the install command, which include the enroll ones
+func (o InstallOptions) Flags() []string {
+	flags := []string{}
+
+	if o.BasePath != "" {
+		flags = append(flags, "--base-path="+o.BasePath)
+	}
+	if o.Unprivileged {
+		flags = append(flags, "--unprivileged")
+	}
+
+	return append(flags, o.EnrollFlags()...)
+}
+
+// HasFleetConnection returns true if the options change how the service connects to Fleet Server,
+// which is part of the Fleet configuration instead of the flags of the options
+func (o InstallOptions) HasFleetConnection() bool {
+	return o.FleetURL != "" || len(o.CertificateAuthorities) > 0
+}
+
+// IsInstallOnly returns true if the options can only be honoured by the install command
+func (o InstallOptions) IsInstallOnly() bool {
+	return o.BasePath != "" || o.Unprivileged
+}
+
 // NewServiceRequest creates a request for a service
 func NewServiceRequest(n string) ServiceRequest {
 	return ServiceRequest{
@@ -142,6 +214,12 @@ func (sr ServiceRequest) WithFlavour(f string) ServiceRequest {
 	return sr
 }
 
+// WithInstallOptions adds the install-time settings for the service package
+func (sr ServiceRequest) WithInstallOptions(o InstallOptions) ServiceRequest {
+	sr.InstallOptions = o
+	return sr
+}
+
 // WithScale adds the scale index to the service
 func (sr ServiceRequest) WithScale(s int) ServiceRequest {
 	if s < 1 {
@@ -168,6 +246,34 @@ func (sr ServiceRequest) WaitingFor(w ...WaitForServiceRequest) ServiceRequest {
 	return sr
 }
 
+// removeOnCleanup registers the removal of the services added to a deployment in the clean up stack of the
+// scenario, each service on its own, so that removing one of them does not remove the others
+func removeOnCleanup(ctx context.Context, d Deployment, profile ServiceRequest, services []ServiceRequest, env map[string]string) {
+	envCopy := make(map[string]string, len(env))
+	for k, v := range env {
+		envCopy[k] = v
+	}
+
+	for _, srv := range services {
+		srv := srv
+		cleanup.Register(ctx, serviceResource(profile, srv), func(ctx context.Context) error {
+			return d.Remove(ctx, profile, []ServiceRequest{srv}, envCopy)
+		})
+	}
+}
+
+// forgetRemoved unregisters the removal of the services removed from a deployment
+func forgetRemoved(ctx context.Context, profile ServiceRequest, services []ServiceRequest) {
+	for _, srv := range services {
+		cleanup.Forget(ctx, serviceResource(profile, srv))
+	}
+}
+
+// serviceResource returns the name of a service in the clean up stack, i.e. service fleet/elastic-agent-1
+func serviceResource(profile ServiceRequest, srv ServiceRequest) string {
+	return "service " + profile.Name + "/" + srv.GetName()
+}
+
 // New creates a new deployment
 func New(provider string) Deployment {
 	if strings.EqualFold(provider, "docker") {
@@ -123,3 +123,36 @@ func Test_ServiceRequest_GetVersion(t *testing.T) {
 		assert.Equal(t, "4.5.6", srv.Version, "Service has version")
 	})
 }
+
+func Test_ServiceRequest_WithInstallOptions(t *testing.T) {
+	t.Run("ServiceRequest without install options", func(t *testing.T) {
+		srv := NewServiceRequest("foo")
+
+		assert.Empty(t, srv.InstallOptions.Flags(), "Service has no install flags")
+		assert.False(t, srv.InstallOptions.IsInstallOnly(), "Service options are accepted by the enroll command")
+	})
+
+	t.Run("ServiceRequest including install options", func(t *testing.T) {
+		srv := NewServiceRequest("foo").WithInstallOptions(InstallOptions{
+			BasePath:     "/custom",
+			ProxyHeaders: map[string]string{"b": "2", "a": "1"},
+			ProxyURL:     "http://proxy:3128",
+			Tags:         []string{"production", "linux"},
+			Unprivileged: true,
+		})
+
+		expected := []string{
+			"--base-path=/custom", "--unprivileged", "--proxy-url=http://proxy:3128",
+			"--proxy-header=a=1", "--proxy-header=b=2", "--tag=production,linux",
+		}
+		assert.Equal(t, expected, srv.InstallOptions.Flags(), "Service has install flags")
+		assert.Equal(t, expected[2:], srv.InstallOptions.EnrollFlags(), "Service has enroll flags")
+		assert.True(t, srv.InstallOptions.IsInstallOnly(), "Service options are only accepted by the install command")
+	})
+
+	t.Run("ServiceRequest ignoring the proxy", func(t *testing.T) {
+		srv := NewServiceRequest("foo").WithInstallOptions(InstallOptions{ProxyDisabled: true})
+
+		assert.Equal(t, []string{"--proxy-disabled"}, srv.InstallOptions.EnrollFlags(), "Service has enroll flags")
+	})
+}
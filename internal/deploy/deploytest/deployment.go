@@ -0,0 +1,238 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package deploytest provides a recording fake of a deploy.Deployment, so that the code
+// building commands for a deployment can be tested without running any service.
+package deploytest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+)
+
+// Call represents an invocation of a method of the Deployment
+type Call struct {
+	Method  string                // name of the invoked method, i.e. ExecIn
+	Service deploy.ServiceRequest // service the method was invoked for
+	Args    []string              // command for ExecIn, files for AddFiles, empty otherwise
+}
+
+// reply represents a canned output for the commands starting with a prefix
+type reply struct {
+	prefix []string
+	output string
+	err    error
+}
+
+// Deployment is a fake deploy.Deployment that records the calls to its methods, replaying
+// canned outputs for the executed commands. It's safe for concurrent use
+type Deployment struct {
+	Manifest deploy.ServiceManifest // returned by GetServiceManifest
+
+	calls   []Call
+	mu      sync.Mutex
+	replies []reply
+}
+
+// New creates a recording Deployment, without canned outputs: every command succeeds with an empty output
+func New() *Deployment {
+	return &Deployment{
+		Manifest: deploy.ServiceManifest{
+			Hostname: "deploytest",
+			Platform: "linux",
+		},
+		calls:   []Call{},
+		replies: []reply{},
+	}
+}
+
+// WithOutput replays the output and error for the commands starting with the given prefix. When more
+// than one prefix matches a command, the longest one wins, and for equal lengths the latest one wins
+func (d *Deployment) WithOutput(output string, err error, prefix ...string) *Deployment {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.replies = append(d.replies, reply{prefix: prefix, output: output, err: err})
+	return d
+}
+
+// Calls returns the recorded calls, in order
+func (d *Deployment) Calls() []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	calls := make([]Call, len(d.calls))
+	copy(calls, d.calls)
+	return calls
+}
+
+// Commands returns the commands executed with ExecIn, in order
+func (d *Deployment) Commands() [][]string {
+	return d.argsFor("ExecIn")
+}
+
+// Copies returns the source and destination of the files copied with CopyFrom, in order
+func (d *Deployment) Copies() [][]string {
+	return d.argsFor("CopyFrom")
+}
+
+// Files returns the files added with AddFiles, in order
+func (d *Deployment) Files() [][]string {
+	return d.argsFor("AddFiles")
+}
+
+// Reset removes the recorded calls, keeping the canned outputs
+func (d *Deployment) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls = []Call{}
+}
+
+func (d *Deployment) argsFor(method string) [][]string {
+	args := [][]string{}
+	for _, c := range d.Calls() {
+		if c.Method == method {
+			args = append(args, c.Args)
+		}
+	}
+	return args
+}
+
+func (d *Deployment) record(method string, service deploy.ServiceRequest, args ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls = append(d.calls, Call{Method: method, Service: service, Args: args})
+}
+
+func (d *Deployment) replay(cmd []string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var match *reply
+	for i := range d.replies {
+		r := &d.replies[i]
+		if !hasPrefix(cmd, r.prefix) {
+			continue
+		}
+		if match == nil || len(r.prefix) >= len(match.prefix) {
+			match = r
+		}
+	}
+
+	if match == nil {
+		return "", nil
+	}
+	return match.output, match.err
+}
+
+func hasPrefix(cmd []string, prefix []string) bool {
+	if len(prefix) > len(cmd) {
+		return false
+	}
+
+	for i, p := range prefix {
+		if !strings.EqualFold(cmd[i], p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add records the services added to the deployment
+func (d *Deployment) Add(ctx context.Context, profile deploy.ServiceRequest, services []deploy.ServiceRequest, env map[string]string) error {
+	for _, srv := range services {
+		d.record("Add", srv)
+	}
+	return nil
+}
+
+// AddFiles records the files added to a service
+func (d *Deployment) AddFiles(ctx context.Context, profile deploy.ServiceRequest, service deploy.ServiceRequest, files []string) error {
+	d.record("AddFiles", service, files...)
+	return nil
+}
+
+// Bootstrap records the bootstrap of the profile, calling the wait callback
+func (d *Deployment) Bootstrap(ctx context.Context, profile deploy.ServiceRequest, env map[string]string, waitCB func() error) error {
+	d.record("Bootstrap", profile)
+	if waitCB == nil {
+		return nil
+	}
+	return waitCB()
+}
+
+// CopyFrom records the file copied out of a service
+func (d *Deployment) CopyFrom(ctx context.Context, profile deploy.ServiceRequest, service deploy.ServiceRequest, src string, dst string) error {
+	d.record("CopyFrom", service, src, dst)
+	return nil
+}
+
+// Destroy records the teardown of the profile
+func (d *Deployment) Destroy(ctx context.Context, profile deploy.ServiceRequest) error {
+	d.record("Destroy", profile)
+	return nil
+}
+
+// ExecIn records the command, replaying its canned output
+func (d *Deployment) ExecIn(ctx context.Context, profile deploy.ServiceRequest, service deploy.ServiceRequest, cmd []string) (string, error) {
+	d.record("ExecIn", service, cmd...)
+	return d.replay(cmd)
+}
+
+// GetServiceManifest returns the manifest of the Deployment, named after the service
+func (d *Deployment) GetServiceManifest(ctx context.Context, service deploy.ServiceRequest) (*deploy.ServiceManifest, error) {
+	d.record("GetServiceManifest", service)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m := d.Manifest
+	if m.Name == "" {
+		m.Name = service.Name
+	}
+	return &m, nil
+}
+
+// Logs records the logs request for a service
+func (d *Deployment) Logs(ctx context.Context, service deploy.ServiceRequest) error {
+	d.record("Logs", service)
+	return nil
+}
+
+// PreBootstrap records the pre-bootstrap
+func (d *Deployment) PreBootstrap(ctx context.Context) error {
+	d.record("PreBootstrap", deploy.ServiceRequest{})
+	return nil
+}
+
+// Remove records the services removed from the deployment
+func (d *Deployment) Remove(ctx context.Context, profile deploy.ServiceRequest, services []deploy.ServiceRequest, env map[string]string) error {
+	for _, srv := range services {
+		d.record("Remove", srv)
+	}
+	return nil
+}
+
+// SaveLogs records the logs saved for a service
+func (d *Deployment) SaveLogs(ctx context.Context, service deploy.ServiceRequest, dst string) error {
+	d.record("SaveLogs", service, dst)
+	return nil
+}
+
+// Start records the start of a service
+func (d *Deployment) Start(ctx context.Context, service deploy.ServiceRequest) error {
+	d.record("Start", service)
+	return nil
+}
+
+// Stop records the stop of a service
+func (d *Deployment) Stop(ctx context.Context, service deploy.ServiceRequest) error {
+	d.record("Stop", service)
+	return nil
+}
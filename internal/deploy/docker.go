@@ -41,7 +41,13 @@ func (c *dockerDeploymentManifest) Add(ctx context.Context, profile ServiceReque
 
 	serviceManager := NewServiceManager()
 
-	return serviceManager.AddServicesToCompose(c.Context, profile, services, env)
+	err := serviceManager.AddServicesToCompose(c.Context, profile, services, env)
+	if err != nil {
+		return err
+	}
+
+	removeOnCleanup(ctx, c, profile, services, env)
+	return nil
 }
 
 // Bootstrap sets up environment with docker compose
@@ -93,6 +99,21 @@ func (c *dockerDeploymentManifest) AddFiles(ctx context.Context, profile Service
 	return nil
 }
 
+// CopyFrom copies a file or directory of a service into a local directory
+func (c *dockerDeploymentManifest) CopyFrom(ctx context.Context, profile ServiceRequest, service ServiceRequest, src string, dst string) error {
+	// TODO: profile is not used because we are using the docker client, not docker-compose, to reach the service
+	span, _ := apm.StartSpanOptions(ctx, "Copying files from Docker Compose deployment", "docker-compose.files.copy-from", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("profile", profile)
+	span.Context.SetLabel("service", service)
+	span.Context.SetLabel("src", src)
+	defer span.End()
+
+	manifest, _ := c.GetServiceManifest(ctx, service)
+	return CopyFileFromContainer(ctx, manifest.Name, src, dst)
+}
+
 // Destroy teardown docker environment
 func (c *dockerDeploymentManifest) Destroy(ctx context.Context, profile ServiceRequest) error {
 	span, _ := apm.StartSpanOptions(ctx, "Destroying compose deployment", "docker-compose.manifest.destroy", apm.SpanOptions{
@@ -258,9 +279,23 @@ func (c *dockerDeploymentManifest) Remove(ctx context.Context, profile ServiceRe
 			return err
 		}
 	}
+
+	forgetRemoved(ctx, profile, services)
 	return nil
 }
 
+// SaveLogs writes the logs of a service into a local file
+func (c *dockerDeploymentManifest) SaveLogs(ctx context.Context, service ServiceRequest, dst string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Saving logs from compose deployment", "docker-compose.manifest.save-logs", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("service", service)
+	defer span.End()
+
+	manifest, _ := c.GetServiceManifest(ctx, service)
+	return SaveContainerLogs(ctx, manifest.Name, dst)
+}
+
 // Start a container
 func (c *dockerDeploymentManifest) Start(ctx context.Context, service ServiceRequest) error {
 	span, _ := apm.StartSpanOptions(ctx, "Starting service from compose deployment", "docker-compose.service.start", apm.SpanOptions{
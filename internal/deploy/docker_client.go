@@ -155,6 +155,96 @@ func CopyFileToContainer(ctx context.Context, containerName string, srcPath stri
 	return nil
 }
 
+// CopyFileFromContainer copies a file or directory out of a container into the target directory
+func CopyFileFromContainer(ctx context.Context, containerName string, srcPath string, targetDir string) error {
+	dockerClient := getDockerClient()
+	defer dockerClient.Close()
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+		"src":       srcPath,
+		"targetDir": targetDir,
+	}).Trace("Copying file from container")
+
+	reader, _, err := dockerClient.CopyFromContainer(ctx, containerName, srcPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"src":       srcPath,
+		}).Error("Could not copy file from container")
+		return err
+	}
+	defer reader.Close()
+
+	return extractTar(reader, targetDir)
+}
+
+// extractTar extracts the files and directories of a TAR stream into the target directory
+func extractTar(reader io.Reader, targetDir string) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(targetDir, filepath.Clean("/"+header.Name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tarReader)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SaveContainerLogs writes the stdout and stderr of a container to a file, with timestamps
+func SaveContainerLogs(ctx context.Context, containerName string, target string) error {
+	dockerClient := getDockerClient()
+	defer dockerClient.Close()
+
+	reader, err := dockerClient.ContainerLogs(ctx, containerName, container.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not get the logs of the container")
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = stdcopy.StdCopy(file, file, reader)
+	return err
+}
+
 // ExecCommandIntoContainer executes a command, as a user, into a container
 func ExecCommandIntoContainer(ctx context.Context, container string, user string, cmd []string) (string, error) {
 	return ExecCommandIntoContainerWithEnv(ctx, container, user, cmd, []string{})
@@ -71,6 +71,7 @@ func (ep *EPServiceManager) Add(ctx context.Context, profile ServiceRequest, ser
 		}
 	}
 
+	removeOnCleanup(ctx, ep, profile, services, env)
 	return nil
 }
 
@@ -191,6 +192,20 @@ func (ep *EPServiceManager) AddFiles(ctx context.Context, profile ServiceRequest
 	return nil
 }
 
+// CopyFrom copies a file or directory of a service into a local directory
+func (ep *EPServiceManager) CopyFrom(ctx context.Context, profile ServiceRequest, service ServiceRequest, src string, dst string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Copying files from Elastic Package deployment", "elastic-package.files.copy-from", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("profile", profile)
+	span.Context.SetLabel("service", service)
+	span.Context.SetLabel("src", src)
+	defer span.End()
+
+	manifest, _ := ep.GetServiceManifest(ctx, service)
+	return CopyFileFromContainer(ctx, manifest.Name, src, dst)
+}
+
 // Destroy teardown docker environment
 func (ep *EPServiceManager) Destroy(ctx context.Context, profile ServiceRequest) error {
 	span, _ := apm.StartSpanOptions(ctx, "Destroying Elastic-Package deployment", "elastic-package.manifest.destroy", apm.SpanOptions{
@@ -325,9 +340,23 @@ func (ep *EPServiceManager) Remove(ctx context.Context, profile ServiceRequest,
 			return err
 		}
 	}
+
+	forgetRemoved(ctx, profile, services)
 	return nil
 }
 
+// SaveLogs writes the logs of a service into a local file
+func (ep *EPServiceManager) SaveLogs(ctx context.Context, service ServiceRequest, dst string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Saving Elastic Package logs", "elastic-package.manifest.save-logs", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("service", service)
+	defer span.End()
+
+	manifest, _ := ep.GetServiceManifest(ctx, service)
+	return SaveContainerLogs(ctx, manifest.Name, dst)
+}
+
 // Start a container
 func (ep *EPServiceManager) Start(ctx context.Context, service ServiceRequest) error {
 	span, _ := apm.StartSpanOptions(ctx, "Starting service from Elastic Package deployment", "elastic-package.service.start", apm.SpanOptions{
@@ -6,8 +6,11 @@ package deploy
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/elastic/e2e-testing/internal/kubernetes"
@@ -45,6 +48,8 @@ func (c *kubernetesDeploymentManifest) Add(ctx context.Context, profile ServiceR
 			return err
 		}
 	}
+
+	removeOnCleanup(ctx, c, profile, services, env)
 	return nil
 }
 
@@ -95,6 +100,32 @@ func (c *kubernetesDeploymentManifest) Bootstrap(ctx context.Context, profile Se
 	return nil
 }
 
+// CopyFrom copies a file or directory of a service into a local directory. The files are read
+// as an encoded TAR stream, as kubectl cp needs the name of a pod
+func (c *kubernetesDeploymentManifest) CopyFrom(ctx context.Context, profile ServiceRequest, service ServiceRequest, src string, dst string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Copying files from kubernetes deployment", "kubernetes.files.copy-from", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("profile", profile)
+	span.Context.SetLabel("service", service)
+	span.Context.SetLabel("src", src)
+	defer span.End()
+
+	kubectl = cluster.Kubectl().WithNamespace(ctx, getNamespaceFromProfile(profile))
+	tarCmd := fmt.Sprintf("tar cf - -C %s %s | base64", filepath.Dir(src), filepath.Base(src))
+	output, err := kubectl.Run(ctx, "exec", "deployment/"+service.Name, "--", "sh", "-c", tarCmd)
+	if err != nil {
+		return err
+	}
+
+	tarball, err := base64.StdEncoding.DecodeString(output)
+	if err != nil {
+		return errors.Wrap(err, "could not decode the files copied from the service")
+	}
+
+	return extractTar(strings.NewReader(string(tarball)), dst)
+}
+
 // Destroy teardown kubernetes environment
 func (c *kubernetesDeploymentManifest) Destroy(ctx context.Context, profile ServiceRequest) error {
 	span, _ := apm.StartSpanOptions(ctx, "Destroying kubernetes deployment", "kubernetes.manifest.destroy", apm.SpanOptions{
@@ -220,9 +251,31 @@ func (c *kubernetesDeploymentManifest) Remove(ctx context.Context, profile Servi
 			return err
 		}
 	}
+
+	forgetRemoved(ctx, profile, services)
 	return nil
 }
 
+// SaveLogs writes the logs of a service into a local file
+func (c *kubernetesDeploymentManifest) SaveLogs(ctx context.Context, service ServiceRequest, dst string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Saving kubernetes logs", "kubernetes.manifest.save-logs", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("service", service)
+	defer span.End()
+
+	kubectl = cluster.Kubectl().WithNamespace(ctx, "default")
+	logs, err := kubectl.Run(ctx, "logs", "--timestamps", "deployment/"+service.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, []byte(logs), 0644)
+}
+
 // Start a container
 func (c *kubernetesDeploymentManifest) Start(ctx context.Context, service ServiceRequest) error {
 	return nil
@@ -6,6 +6,8 @@ package deploy
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -39,6 +41,24 @@ func (c *remoteDeploymentManifest) AddFiles(ctx context.Context, profile Service
 	return nil
 }
 
+// CopyFrom copies a file or directory of the host into a local directory, as the services run on the host
+func (c *remoteDeploymentManifest) CopyFrom(ctx context.Context, profile ServiceRequest, service ServiceRequest, src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(dst, filepath.Base(src))
+	if info.IsDir() {
+		return io.CopyDir(src, target)
+	}
+
+	if err := io.MkdirAll(dst); err != nil {
+		return err
+	}
+	return io.CopyFile(src, target, 10000)
+}
+
 // Destroy teardown environment
 func (c *remoteDeploymentManifest) Destroy(ctx context.Context, profile ServiceRequest) error {
 	return nil
@@ -120,6 +140,11 @@ func (c *remoteDeploymentManifest) Remove(ctx context.Context, profile ServiceRe
 	return nil
 }
 
+// SaveLogs does nothing, as the services of the host are not containers
+func (c *remoteDeploymentManifest) SaveLogs(ctx context.Context, service ServiceRequest, dst string) error {
+	return nil
+}
+
 // Start a container
 func (c *remoteDeploymentManifest) Start(ctx context.Context, service ServiceRequest) error {
 	return nil
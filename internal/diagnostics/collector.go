@@ -0,0 +1,185 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package diagnostics keeps the artifacts collected for the failed scenarios of a test suite, i.e. the
+// diagnostics bundle of the agent and the logs of the services, in a directory per scenario, attaching
+// them to the cucumber report once the suite finishes.
+package diagnostics
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// artifactsMimeType is the mime type of the embedding listing the artifacts of a scenario
+const artifactsMimeType = "text/plain"
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// scenario represents the artifacts collected for a run of a scenario. Scenario outlines run once per example,
+// so the runs of a scenario are kept in order
+type scenario struct {
+	dir       string
+	artifacts []string
+}
+
+// Collector keeps the artifacts of the failed scenarios under a base directory. It's safe for concurrent use
+type Collector struct {
+	base      string
+	mu        sync.Mutex
+	scenarios map[string][]*scenario // by feature URI and scenario name
+}
+
+// NewCollector creates a collector keeping the artifacts under the base directory
+func NewCollector(base string) *Collector {
+	return &Collector{
+		base:      base,
+		scenarios: map[string][]*scenario{},
+	}
+}
+
+// ScenarioDir creates the directory for the artifacts of a run of a scenario, named after the feature
+// and the scenario, i.e. <base>/features-outputs-feature/sending-events-to-kafka
+func (c *Collector) ScenarioDir(featureURI string, name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := scenarioKey(featureURI, name)
+	dir := filepath.Join(c.base, slug(featureURI), slug(name))
+	if runs := len(c.scenarios[key]); runs > 0 {
+		dir = fmt.Sprintf("%s-%d", dir, runs+1)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	c.scenarios[key] = append(c.scenarios[key], &scenario{dir: dir, artifacts: []string{}})
+	return dir, nil
+}
+
+// Add records artifacts for the latest run of a scenario
+func (c *Collector) Add(featureURI string, name string, artifacts ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	runs := c.scenarios[scenarioKey(featureURI, name)]
+	if len(runs) == 0 {
+		return
+	}
+
+	latest := runs[len(runs)-1]
+	latest.artifacts = append(latest.artifacts, artifacts...)
+}
+
+// AttachToCucumberReport embeds the list of artifacts of each failed scenario into its failed step of a
+// cucumber JSON report, so that the reports link the failures to their diagnostics
+func (c *Collector) AttachToCucumberReport(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	features := []map[string]interface{}{}
+	if err := json.Unmarshal(content, &features); err != nil {
+		return fmt.Errorf("could not parse the cucumber report %s: %v", path, err)
+	}
+
+	attached := map[string]int{}
+	for _, feature := range features {
+		uri, _ := feature["uri"].(string)
+		elements, _ := feature["elements"].([]interface{})
+
+		for _, e := range elements {
+			element, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			step := failedStep(element)
+			if step == nil {
+				continue
+			}
+
+			name, _ := element["name"].(string)
+			key := scenarioKey(uri, name)
+			runs := c.scenarios[key]
+			if attached[key] >= len(runs) {
+				continue
+			}
+
+			run := runs[attached[key]]
+			attached[key]++
+
+			embeddings, _ := step["embeddings"].([]interface{})
+			step["embeddings"] = append(embeddings, map[string]interface{}{
+				"mime_type": artifactsMimeType,
+				"data":      base64.StdEncoding.EncodeToString([]byte(run.summary())),
+			})
+		}
+	}
+
+	content, err = json.MarshalIndent(features, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// summary lists the directory and the artifacts of a run
+func (s *scenario) summary() string {
+	lines := []string{"Diagnostics: " + s.dir}
+	for _, a := range s.artifacts {
+		lines = append(lines, "- "+a)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CucumberReports returns the paths of the cucumber reports of a godog format flag,
+// i.e. pretty,cucumber:outputs/TEST-fleet.json,junit:outputs/TEST-fleet.xml
+func CucumberReports(format string) []string {
+	reports := []string{}
+	for _, f := range strings.Split(format, ",") {
+		name, path, ok := strings.Cut(strings.TrimSpace(f), ":")
+		if ok && name == "cucumber" && path != "" {
+			reports = append(reports, path)
+		}
+	}
+	return reports
+}
+
+// failedStep returns the failed step of a scenario, or nil if the scenario did not fail
+func failedStep(element map[string]interface{}) map[string]interface{} {
+	steps, _ := element["steps"].([]interface{})
+	for _, s := range steps {
+		step, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		result, _ := step["result"].(map[string]interface{})
+		if result["status"] == "failed" {
+			return step
+		}
+	}
+	return nil
+}
+
+func scenarioKey(featureURI string, name string) string {
+	return featureURI + "#" + name
+}
+
+// slug converts a name into a directory name, i.e. features/Fleet Outputs.feature -> features-fleet-outputs-feature
+func slug(name string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package diagnostics
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector_ScenarioDir(t *testing.T) {
+	base := t.TempDir()
+	c := NewCollector(base)
+
+	dir, err := c.ScenarioDir("features/outputs.feature", "Events arrive on the output")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "features-outputs-feature", "events-arrive-on-the-output"), dir)
+	assert.DirExists(t, dir)
+
+	// the examples of an outline do not share the directory
+	dir, err = c.ScenarioDir("features/outputs.feature", "Events arrive on the output")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "features-outputs-feature", "events-arrive-on-the-output-2"), dir)
+}
+
+func TestCollector_AttachToCucumberReport(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "cucumber.json"))
+	require.NoError(t, err)
+
+	report := filepath.Join(t.TempDir(), "TEST-fleet.json")
+	require.NoError(t, os.WriteFile(report, content, 0644))
+
+	c := NewCollector("outputs/diagnostics")
+	for _, artifact := range []string{"kafka.zip", "elasticsearch.zip"} {
+		_, err := c.ScenarioDir("features/outputs.feature", "Events arrive on the output")
+		require.NoError(t, err)
+		c.Add("features/outputs.feature", "Events arrive on the output", artifact)
+	}
+	// scenarios not in the report are ignored
+	c.Add("features/unknown.feature", "Unknown", "unknown.zip")
+
+	require.NoError(t, c.AttachToCucumberReport(report))
+
+	content, err = os.ReadFile(report)
+	require.NoError(t, err)
+
+	var features []struct {
+		Elements []struct {
+			Steps []struct {
+				Embeddings []struct {
+					MimeType string `json:"mime_type"`
+					Data     string `json:"data"`
+				} `json:"embeddings"`
+				Result struct {
+					Status string `json:"status"`
+				} `json:"result"`
+			} `json:"steps"`
+		} `json:"elements"`
+	}
+	require.NoError(t, json.Unmarshal(content, &features))
+	require.Len(t, features, 1)
+
+	embedded := func(element int, step int) string {
+		embeddings := features[0].Elements[element].Steps[step].Embeddings
+		if len(embeddings) == 0 {
+			return ""
+		}
+		require.Len(t, embeddings, 1)
+		assert.Equal(t, "text/plain", embeddings[0].MimeType)
+
+		data, err := base64.StdEncoding.DecodeString(embeddings[0].Data)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Empty(t, embedded(0, 0))
+	assert.Equal(t, "Diagnostics: outputs/diagnostics/features-outputs-feature/events-arrive-on-the-output\n- kafka.zip", embedded(0, 1))
+	assert.Empty(t, embedded(1, 0))
+	assert.Equal(t, "Diagnostics: outputs/diagnostics/features-outputs-feature/events-arrive-on-the-output-2\n- elasticsearch.zip", embedded(2, 0))
+	assert.Empty(t, embedded(2, 1))
+}
+
+func TestCucumberReports(t *testing.T) {
+	assert.Equal(t, []string{"outputs/TEST-fleet.json"}, CucumberReports("pretty,cucumber:outputs/TEST-fleet.json,junit:outputs/TEST-fleet.xml"))
+	assert.Empty(t, CucumberReports("pretty"))
+}
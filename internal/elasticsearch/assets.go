@@ -0,0 +1,153 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// assetPaths are the API paths of the types of assets the packages install in Elasticsearch, by the type
+// reported by Fleet, i.e. index_template
+var assetPaths = map[string]string{
+	"component_template":     "/_component_template/%s",
+	"data_stream_ilm_policy": "/_ilm/policy/%s",
+	"ilm_policy":             "/_ilm/policy/%s",
+	"index_template":         "/_index_template/%s",
+	"ingest_pipeline":        "/_ingest/pipeline/%s",
+	"ml_model":               "/_ml/trained_models/%s",
+	"transform":              "/_transform/%s",
+}
+
+// SupportsAssetType returns true if the existence of the assets of a type can be checked
+func SupportsAssetType(assetType string) bool {
+	_, ok := assetPaths[assetType]
+	return ok
+}
+
+// AssetExists returns true if an asset installed by a package exists in Elasticsearch, by its type, i.e. index_template,
+// and its ID
+func AssetExists(ctx context.Context, assetType string, id string) (bool, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Checking asset", "elasticsearch.asset.exists", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("type", assetType)
+	span.Context.SetLabel("id", id)
+	defer span.End()
+
+	assetPath, ok := assetPaths[assetType]
+	if !ok {
+		return false, fmt.Errorf("the %s assets are not supported", assetType)
+	}
+
+	esClient, err := getElasticsearchClient(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(assetPath, url.PathEscape(id)), nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := esClient.Perform(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	body, _ := io.ReadAll(res.Body)
+	return false, fmt.Errorf("could not get the %s %s: %s %s", assetType, id, res.Status, body)
+}
+
+// SimulatedDocument represents a document processed by a simulated ingest pipeline, with its error if the pipeline failed
+type SimulatedDocument struct {
+	Source map[string]interface{}
+	Error  string
+}
+
+// SimulatePipeline runs the documents through an ingest pipeline without indexing them, returning the processed documents
+// in the same order
+func SimulatePipeline(ctx context.Context, pipelineID string, docs []map[string]interface{}) ([]SimulatedDocument, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Simulating pipeline", "elasticsearch.pipeline.simulate", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("pipeline", pipelineID)
+	defer span.End()
+
+	esClient, err := getElasticsearchClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reqDocs := []map[string]interface{}{}
+	for _, doc := range docs {
+		reqDocs = append(reqDocs, map[string]interface{}{"_source": doc})
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"docs": reqDocs}); err != nil {
+		return nil, err
+	}
+
+	res, err := esClient.Ingest.Simulate(&buf,
+		esClient.Ingest.Simulate.WithContext(ctx),
+		esClient.Ingest.Simulate.WithPipelineID(pipelineID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("could not simulate the %s pipeline: %s", pipelineID, res.String())
+	}
+
+	var resp struct {
+		Docs []struct {
+			Doc struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"doc"`
+			Error *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("could not parse the simulation of the %s pipeline: %w", pipelineID, err)
+	}
+
+	simulated := []SimulatedDocument{}
+	for _, d := range resp.Docs {
+		doc := SimulatedDocument{Source: d.Doc.Source}
+		if d.Error != nil {
+			doc.Error = d.Error.Type + ": " + d.Error.Reason
+		}
+		simulated = append(simulated, doc)
+	}
+
+	log.WithFields(log.Fields{
+		"docs":     len(simulated),
+		"pipeline": pipelineID,
+	}).Debug("Pipeline simulated")
+
+	return simulated, nil
+}
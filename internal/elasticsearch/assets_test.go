@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newAssetsServer starts a fake Elasticsearch with the assets at the given paths, and a pipeline
+// appending an exclamation mark to the message field of the documents
+func newAssetsServer(t *testing.T, paths ...string) {
+	mux := http.NewServeMux()
+	for _, p := range paths {
+		mux.HandleFunc("GET "+p, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{}`))
+		})
+	}
+	// the client sends the simulations with GET and a body
+	mux.HandleFunc("/_ingest/pipeline/{id}/_simulate", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Docs []struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"docs"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		docs := []interface{}{}
+		for _, d := range req.Docs {
+			message, ok := d.Source["message"].(string)
+			if !ok {
+				docs = append(docs, map[string]interface{}{"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": "field [message] not present"}})
+				continue
+			}
+			d.Source["message"] = message + "!"
+			docs = append(docs, map[string]interface{}{"doc": map[string]interface{}{"_source": d.Source}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"docs": docs})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	newFakeElasticsearch(t, mux)
+}
+
+func TestAssetExists(t *testing.T) {
+	ctx := context.Background()
+	newAssetsServer(t, "/_index_template/metrics-system.cpu", "/_ingest/pipeline/logs-system.syslog-1.55.0")
+
+	exists, err := AssetExists(ctx, "index_template", "metrics-system.cpu")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	exists, err = AssetExists(ctx, "ingest_pipeline", "logs-system.syslog-1.55.0")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	exists, err = AssetExists(ctx, "component_template", "metrics-system.cpu@package")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	assert.False(t, SupportsAssetType("csp_rule_template"))
+	_, err = AssetExists(ctx, "csp_rule_template", "rule")
+	assert.NotNil(t, err)
+}
+
+func TestSimulatePipeline(t *testing.T) {
+	newAssetsServer(t)
+
+	docs, err := SimulatePipeline(context.Background(), "logs-system.syslog-1.55.0", []map[string]interface{}{
+		{"message": "hello"},
+		{"event": "no message"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "hello!", docs[0].Source["message"])
+	assert.Empty(t, docs[0].Error)
+	assert.Equal(t, "illegal_argument_exception: field [message] not present", docs[1].Error)
+}
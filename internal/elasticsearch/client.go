@@ -9,15 +9,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/cassette"
 	curl "github.com/elastic/e2e-testing/internal/curl"
 	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/transport"
 	"github.com/elastic/e2e-testing/internal/utils"
 	es "github.com/elastic/go-elasticsearch/v8"
 	log "github.com/sirupsen/logrus"
@@ -51,7 +50,7 @@ func DeleteIndex(ctx context.Context, index string) error {
 		return err
 	}
 
-	res, err := esClient.Indices.Delete([]string{index})
+	res, err := esClient.Indices.Delete([]string{index}, esClient.Indices.Delete.WithContext(ctx))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"indexName": index,
@@ -65,7 +64,7 @@ func DeleteIndex(ctx context.Context, index string) error {
 		"status":    res.Status(),
 	}).Debug("Index deleted using Elasticsearch Go client")
 
-	res, err = esClient.Indices.DeleteAlias([]string{index}, []string{index})
+	res, err = esClient.Indices.DeleteAlias([]string{index}, []string{index}, esClient.Indices.DeleteAlias.WithContext(ctx))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"indexAlias": index,
@@ -90,71 +89,53 @@ type Endpoint struct {
 	Credentials string
 }
 
-// GetElasticSearchEndpoint - Query environment for correct endpoint information
-func GetElasticSearchEndpoint() *Endpoint {
-	creds := fmt.Sprintf("%s:%s", shell.GetEnv("ELASTICSEARCH_USERNAME", "elastic"), shell.GetEnv("ELASTICSEARCH_PASSWORD", "changeme"))
-	remoteESHost := shell.GetEnv("ELASTICSEARCH_URL", "")
-	if remoteESHost != "" {
-		remoteESHost = utils.RemoveQuotes(remoteESHost)
-		u, err := url.Parse(remoteESHost)
-		if err != nil {
-			log.WithField("error", err).Fatal("Could not parse ELASTICSEARCH_URL")
-		}
-		host, port, err := net.SplitHostPort(u.Host)
-		if err != nil {
-			log.Fatal("Could not determine host/port from ELASTICSEARCH_URL")
-		}
-		remoteESHostPort, _ := strconv.Atoi(port)
-		return &Endpoint{
-			Scheme:      u.Scheme,
-			Host:        host,
-			Port:        remoteESHostPort,
-			Credentials: creds,
-		}
-	}
-	return &Endpoint{
-		Scheme:      "http",
-		Host:        "localhost",
-		Port:        9200,
-		Credentials: creds,
+// GetElasticSearchEndpoint returns the endpoint of Elasticsearch, configured with the ELASTICSEARCH_* environment variables
+func GetElasticSearchEndpoint() (*Endpoint, error) {
+	cfg, err := NewClientConfigFromEnv()
+	if err != nil {
+		return nil, err
 	}
+
+	return cfg.Endpoint()
 }
 
-// getElasticsearchClient returns a client connected to the running elasticseach, defined
-// at configuration level. Then we will inspect the running container to get its port bindings
-// and from them, get the one related to the Elasticsearch port (9200). As it is bound to a
-// random port at localhost, we will build the URL with the bound port at localhost.
-//
-//nolint:unused
+// getElasticsearchClient returns a client connected to the running elasticseach, configured with
+// the ELASTICSEARCH_* environment variables
 func getElasticsearchClient(ctx context.Context) (*es.Client, error) {
-	esEndpoint := GetElasticSearchEndpoint()
-	return getElasticsearchClientFromHostPort(ctx, esEndpoint.Host, esEndpoint.Port, esEndpoint.Scheme)
+	cfg, err := NewClientConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return newElasticsearchClient(cfg)
 }
 
-// getElasticsearchClientFromHostPort returns a client connected to a running elasticseach, defined
-// at configuration level. Then we will inspect the running container to get its port bindings
-// and from them, get the one related to the Elasticsearch port (9200). As it is bound to a
-// random port at localhost, we will build the URL with the bound port at localhost.
-//
-//nolint:unused
-func getElasticsearchClientFromHostPort(ctx context.Context, host string, port int, scheme string) (*es.Client, error) {
-	cfg := es.Config{
-		Addresses: []string{fmt.Sprintf("%s://%s:%d", scheme, host, port)},
-		Username:  shell.GetEnv("ELASTICSEARCH_USERNAME", "admin"),
-		Password:  shell.GetEnv("ELASTICSEARCH_PASSWORD", "changeme"),
+// newElasticsearchClient returns a client with the configuration, instrumenting its requests
+// and recording or replaying them in the cassette of the scenario
+func newElasticsearchClient(cfg ClientConfig) (*es.Client, error) {
+	httpTransport, err := transport.Get(cfg.transportConfig())
+	if err != nil {
+		return nil, err
 	}
 
+	var transport http.RoundTripper = httpTransport
+
 	// avoid using common properties to avoid cyclical references
 	elasticAPMActive := shell.GetEnvBool("ELASTIC_APM_ACTIVE")
 	if elasticAPMActive {
-		cfg.Transport = apmelasticsearch.WrapRoundTripper(http.DefaultTransport)
+		transport = apmelasticsearch.WrapRoundTripper(transport)
+	}
+
+	esCfg, err := cfg.esConfig(cassette.WrapTransport(transport))
+	if err != nil {
+		return nil, err
 	}
 
-	esClient, err := es.NewClient(cfg)
+	esClient, err := es.NewClient(esCfg)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"config": cfg,
-			"error":  err,
+			"addresses": esCfg.Addresses,
+			"error":     err,
 		}).Error("Could not obtain an Elasticsearch client")
 
 		return nil, err
@@ -226,7 +207,7 @@ func GetAPIToken(ctx context.Context) (SecurityTokenResponse, error) {
 		return result, err
 	}
 
-	res, err := esClient.Security.GetToken(&buf)
+	res, err := esClient.Security.GetToken(&buf, esClient.Security.GetToken.WithContext(ctx))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -300,6 +281,7 @@ func Search(ctx context.Context, indexName string, query map[string]interface{})
 	}).Trace("Elasticsearch query")
 
 	res, err := esClient.Search(
+		esClient.Search.WithContext(ctx),
 		esClient.Search.WithIndex(indexName),
 		esClient.Search.WithBody(&buf),
 		esClient.Search.WithTrackTotalHits(true),
@@ -357,7 +339,7 @@ func WaitForElasticsearch(ctx context.Context, maxTimeoutMinutes time.Duration)
 	retryCount := 1
 
 	clusterStatus := func() error {
-		esClient, err := getElasticsearchClient(context.Background())
+		esClient, err := getElasticsearchClient(ctx)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err,
@@ -371,7 +353,7 @@ func WaitForElasticsearch(ctx context.Context, maxTimeoutMinutes time.Duration)
 		})
 		defer span.End()
 
-		if _, err := esClient.Cluster.Health(); err != nil {
+		if _, err := esClient.Cluster.Health(esClient.Cluster.Health.WithContext(ctx)); err != nil {
 			log.WithFields(log.Fields{
 				"error":       err,
 				"retry":       retryCount,
@@ -416,7 +398,7 @@ func WaitForClusterHealth(ctx context.Context) error {
 	retryCount := 1
 
 	healthFunction := func() error {
-		response, err := esClient.Cluster.Health()
+		response, err := esClient.Cluster.Health(esClient.Cluster.Health.WithContext(ctx))
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":       err,
@@ -457,17 +439,20 @@ func WaitForClusterHealth(ctx context.Context) error {
 func WaitForIndices() (string, error) {
 	exp := utils.GetExponentialBackOff(60 * time.Second)
 
-	esEndpoint := GetElasticSearchEndpoint()
+	cfg, err := NewClientConfigFromEnv()
+	if err != nil {
+		return "", err
+	}
+
+	r, err := cfg.httpRequest("/_cat/indices?v")
+	if err != nil {
+		return "", err
+	}
+
 	retryCount := 1
 	body := ""
 
 	catIndices := func() error {
-		r := curl.HTTPRequest{
-			URL:               fmt.Sprintf("%s://%s:%d/_cat/indices?v", esEndpoint.Scheme, esEndpoint.Host, esEndpoint.Port),
-			BasicAuthPassword: shell.GetEnv("ELASTICSEARCH_PASSWORD", "changeme"),
-			BasicAuthUser:     shell.GetEnv("ELASTICSEARCH_USERNAME", "admin"),
-		}
-
 		response, err := curl.Get(r)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -492,7 +477,7 @@ func WaitForIndices() (string, error) {
 		return nil
 	}
 
-	err := backoff.Retry(catIndices, exp)
+	err = backoff.Retry(catIndices, exp)
 	return body, err
 }
 
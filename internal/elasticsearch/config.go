@@ -0,0 +1,287 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	curl "github.com/elastic/e2e-testing/internal/curl"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/transport"
+	"github.com/elastic/e2e-testing/internal/utils"
+	es "github.com/elastic/go-elasticsearch/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultURL the Elasticsearch of the stack deployed by the tests, reached from the host
+	defaultURL = "http://localhost:9200"
+	// defaultTimeout the default time to wait for the response of a request to Elasticsearch
+	defaultTimeout = time.Minute
+	// defaultMaxRetries the default number of retries of the failed requests to Elasticsearch
+	defaultMaxRetries = 3
+	// defaultRetryBackoff the default wait before the first retry, which is doubled on each retry
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// retryOnStatus the status codes of the responses which are retried, as Elasticsearch is not available yet
+var retryOnStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests}
+
+// ClientConfig represents the address, authentication, TLS, timeout and retry settings of the Elasticsearch
+// client and of the curl helpers. The credentials are used in order of precedence: API key and then basic auth
+type ClientConfig struct {
+	URL      string
+	CloudID  string // Elastic Cloud deployment, taking precedence over the URL
+	Username string
+	Password string
+
+	APIKey string // encoded API key, sent as 'Authorization: ApiKey <key>'
+
+	CACert             string // path to the PEM file of the CA to trust
+	CAFingerprint      string // hex SHA-256 fingerprint of a certificate of the chain to trust, instead of a CA
+	ClientCert         string // path to the PEM file of the client certificate
+	ClientKey          string // path to the PEM file of the client key
+	InsecureSkipVerify bool
+
+	Timeout      time.Duration // time to wait for the response of a request
+	MaxRetries   int           // retries of the failed requests, disabled when zero
+	RetryBackoff time.Duration // wait before the first retry, doubled on each retry
+}
+
+// NewClientConfigFromEnv reads the configuration from the ELASTICSEARCH_* environment variables, validating it
+func NewClientConfigFromEnv() (ClientConfig, error) {
+	cfg := ClientConfig{
+		URL:                utils.RemoveQuotes(shell.GetEnv("ELASTICSEARCH_URL", defaultURL)),
+		CloudID:            shell.GetEnv("ELASTICSEARCH_CLOUD_ID", ""),
+		Username:           shell.GetEnv("ELASTICSEARCH_USERNAME", "admin"),
+		Password:           shell.GetEnv("ELASTICSEARCH_PASSWORD", "changeme"),
+		APIKey:             shell.GetEnv("ELASTICSEARCH_API_KEY", ""),
+		CACert:             shell.GetEnv("ELASTICSEARCH_CA_CERT", ""),
+		CAFingerprint:      shell.GetEnv("ELASTICSEARCH_CA_FINGERPRINT", ""),
+		ClientCert:         shell.GetEnv("ELASTICSEARCH_CLIENT_CERT", ""),
+		ClientKey:          shell.GetEnv("ELASTICSEARCH_CLIENT_KEY", ""),
+		InsecureSkipVerify: shell.GetEnvBool("ELASTICSEARCH_INSECURE_SKIP_VERIFY"),
+		Timeout:            defaultTimeout,
+		MaxRetries:         defaultMaxRetries,
+		RetryBackoff:       defaultRetryBackoff,
+	}
+
+	for name, d := range map[string]*time.Duration{"ELASTICSEARCH_TIMEOUT": &cfg.Timeout, "ELASTICSEARCH_RETRY_BACKOFF": &cfg.RetryBackoff} {
+		if v := shell.GetEnv(name, ""); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return ClientConfig{}, fmt.Errorf("invalid %s %s: %w", name, v, err)
+			}
+			*d = parsed
+		}
+	}
+
+	if v := shell.GetEnv("ELASTICSEARCH_MAX_RETRIES", ""); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil {
+			return ClientConfig{}, fmt.Errorf("invalid ELASTICSEARCH_MAX_RETRIES %s: %w", v, err)
+		}
+		cfg.MaxRetries = retries
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return ClientConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// CheckConfig validates the configuration of the ELASTICSEARCH_* environment variables, including the certificates
+// it refers to, so that the test suites fail at startup instead of on their first request to Elasticsearch
+func CheckConfig() error {
+	cfg, err := NewClientConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	address, _ := cfg.Address()
+	log.WithFields(log.Fields{
+		"address":    address,
+		"apiKey":     cfg.APIKey != "",
+		"caCert":     cfg.CACert,
+		"clientCert": cfg.ClientCert,
+		"maxRetries": cfg.MaxRetries,
+		"timeout":    cfg.Timeout,
+	}).Debug("Elasticsearch configuration")
+
+	_, err = cfg.transportConfig().TLSConfig()
+	return err
+}
+
+// Validate returns an error describing the first invalid setting of the configuration
+func (cfg ClientConfig) Validate() error {
+	address, err := cfg.Address()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid Elasticsearch URL %s: %w", address, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid Elasticsearch URL %s: an http or https URL with a host is required, i.e. %s", address, defaultURL)
+	}
+
+	if err := cfg.transportConfig().Validate(); err != nil {
+		return err
+	}
+
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("the Elasticsearch timeout must be positive, got %s", cfg.Timeout)
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("the Elasticsearch max retries cannot be negative, got %d", cfg.MaxRetries)
+	}
+	if cfg.RetryBackoff < 0 {
+		return fmt.Errorf("the Elasticsearch retry backoff cannot be negative, got %s", cfg.RetryBackoff)
+	}
+
+	return nil
+}
+
+// Address returns the URL of Elasticsearch, which is the one of the Elastic Cloud deployment when set
+func (cfg ClientConfig) Address() (string, error) {
+	if cfg.CloudID == "" {
+		return strings.TrimSuffix(cfg.URL, "/"), nil
+	}
+
+	// the Cloud ID is <name>:<base64 of <host>$<elasticsearch id>$<kibana id>>
+	encoded := cfg.CloudID
+	if _, after, found := strings.Cut(cfg.CloudID, ":"); found {
+		encoded = after
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid Elasticsearch Cloud ID %s: %w", cfg.CloudID, err)
+	}
+
+	parts := strings.Split(string(decoded), "$")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid Elasticsearch Cloud ID %s: the host and the Elasticsearch ID are required", cfg.CloudID)
+	}
+
+	return fmt.Sprintf("https://%s.%s", parts[1], parts[0]), nil
+}
+
+// Endpoint returns the scheme, host, port and basic auth credentials of Elasticsearch, defaulting the port
+// to the one of the scheme
+func (cfg ClientConfig) Endpoint() (*Endpoint, error) {
+	address, err := cfg.Address()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Elasticsearch URL %s: %w", address, err)
+	}
+
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in the Elasticsearch URL %s: %w", address, err)
+		}
+	}
+
+	return &Endpoint{
+		Scheme:      u.Scheme,
+		Host:        u.Hostname(),
+		Port:        port,
+		Credentials: fmt.Sprintf("%s:%s", cfg.Username, cfg.Password),
+	}, nil
+}
+
+// esConfig returns the configuration of the Elasticsearch Go client, sending the requests through the transport
+func (cfg ClientConfig) esConfig(transport http.RoundTripper) (es.Config, error) {
+	address, err := cfg.Address()
+	if err != nil {
+		return es.Config{}, err
+	}
+
+	esCfg := es.Config{
+		Addresses:     []string{address},
+		Transport:     transport,
+		MaxRetries:    cfg.MaxRetries,
+		DisableRetry:  cfg.MaxRetries == 0,
+		RetryOnStatus: retryOnStatus,
+		RetryBackoff:  cfg.retryBackoff,
+	}
+
+	if cfg.APIKey != "" {
+		esCfg.APIKey = cfg.APIKey
+	} else {
+		esCfg.Username = cfg.Username
+		esCfg.Password = cfg.Password
+	}
+
+	return esCfg, nil
+}
+
+// retryBackoff returns the wait before a retry, starting at 1
+func (cfg ClientConfig) retryBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return cfg.RetryBackoff * time.Duration(1<<uint(attempt-1))
+}
+
+// httpRequest returns a request of the curl helpers for a path of the Elasticsearch API, i.e. /_cat/indices,
+// with the same authentication, TLS and timeout settings as the client
+func (cfg ClientConfig) httpRequest(path string) (curl.HTTPRequest, error) {
+	address, err := cfg.Address()
+	if err != nil {
+		return curl.HTTPRequest{}, err
+	}
+
+	t, err := transport.Get(cfg.transportConfig())
+	if err != nil {
+		return curl.HTTPRequest{}, err
+	}
+
+	r := curl.HTTPRequest{
+		Client: &http.Client{Transport: t, Timeout: cfg.Timeout},
+		URL:    address + path,
+	}
+
+	if cfg.APIKey != "" {
+		r.Headers = map[string]string{"Authorization": "ApiKey " + cfg.APIKey}
+	} else {
+		r.BasicAuthUser = cfg.Username
+		r.BasicAuthPassword = cfg.Password
+	}
+
+	return r, nil
+}
+
+// transportConfig returns the TLS and timeout settings of the HTTP transport, shared by the client and the
+// curl helpers
+func (cfg ClientConfig) transportConfig() transport.Config {
+	return transport.Config{
+		Service:               "Elasticsearch",
+		CACert:                cfg.CACert,
+		CAFingerprint:         cfg.CAFingerprint,
+		ClientCert:            cfg.ClientCert,
+		ClientKey:             cfg.ClientKey,
+		InsecureSkipVerify:    cfg.InsecureSkipVerify,
+		ResponseHeaderTimeout: cfg.Timeout,
+	}
+}
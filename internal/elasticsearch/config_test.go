@@ -0,0 +1,248 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	curl "github.com/elastic/e2e-testing/internal/curl"
+	"github.com/elastic/e2e-testing/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeElasticsearch starts a fake Elasticsearch serving the requests with the given handler, and points
+// the clients of the test to it
+func newFakeElasticsearch(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the Go client checks that the server is Elasticsearch
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("ELASTICSEARCH_URL", srv.URL)
+
+	return srv
+}
+
+// newElasticsearchServer starts a fake Elasticsearch answering the searches, failing the first requests
+// with the given status codes
+func newElasticsearchServer(t *testing.T, failures ...int) *[]*http.Request {
+	requests := []*http.Request{}
+	newFakeElasticsearch(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+
+		if len(failures) > 0 {
+			w.WriteHeader(failures[0])
+			failures = failures[1:]
+			return
+		}
+		_, _ = w.Write([]byte(`{"took": 1, "hits": {"total": {"value": 0}, "hits": []}}`))
+	}))
+
+	return &requests
+}
+
+func TestNewClientConfigFromEnv(t *testing.T) {
+	t.Run("Defaults to the local stack", func(t *testing.T) {
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, defaultURL, cfg.URL)
+		assert.Equal(t, "admin", cfg.Username)
+		assert.Equal(t, defaultTimeout, cfg.Timeout)
+		assert.Equal(t, defaultMaxRetries, cfg.MaxRetries)
+		assert.Equal(t, defaultRetryBackoff, cfg.RetryBackoff)
+
+		endpoint, err := cfg.Endpoint()
+		assert.Nil(t, err)
+		assert.Equal(t, &Endpoint{Scheme: "http", Host: "localhost", Port: 9200, Credentials: "admin:changeme"}, endpoint)
+	})
+
+	t.Run("Durations and retries", func(t *testing.T) {
+		t.Setenv("ELASTICSEARCH_TIMEOUT", "30s")
+		t.Setenv("ELASTICSEARCH_RETRY_BACKOFF", "1s")
+		t.Setenv("ELASTICSEARCH_MAX_RETRIES", "0")
+
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, 30*time.Second, cfg.Timeout)
+		assert.Equal(t, time.Second, cfg.RetryBackoff)
+		assert.Equal(t, 0, cfg.MaxRetries)
+	})
+
+	invalid := map[string]map[string]string{
+		"URL without scheme":       {"ELASTICSEARCH_URL": "localhost:9200"},
+		"URL without host":         {"ELASTICSEARCH_URL": "http://"},
+		"Cloud ID without host":    {"ELASTICSEARCH_CLOUD_ID": "e2e:" + base64.StdEncoding.EncodeToString([]byte("$es$kb"))},
+		"Cloud ID not in base64":   {"ELASTICSEARCH_CLOUD_ID": "e2e:not-base64"},
+		"Timeout without unit":     {"ELASTICSEARCH_TIMEOUT": "30"},
+		"Negative timeout":         {"ELASTICSEARCH_TIMEOUT": "-1s"},
+		"Retries not a number":     {"ELASTICSEARCH_MAX_RETRIES": "many"},
+		"Negative retries":         {"ELASTICSEARCH_MAX_RETRIES": "-1"},
+		"Fingerprint not in hex":   {"ELASTICSEARCH_CA_FINGERPRINT": "not-hex"},
+		"CA and fingerprint":       {"ELASTICSEARCH_CA_CERT": "ca.pem", "ELASTICSEARCH_CA_FINGERPRINT": hex.EncodeToString(make([]byte, sha256.Size))},
+		"Client cert without key":  {"ELASTICSEARCH_CLIENT_CERT": "client.pem"},
+		"Client key without cert":  {"ELASTICSEARCH_CLIENT_KEY": "client-key.pem"},
+		"Retry backoff negative":   {"ELASTICSEARCH_RETRY_BACKOFF": "-1s"},
+		"Retry backoff not a time": {"ELASTICSEARCH_RETRY_BACKOFF": "soon"},
+	}
+	for name, env := range invalid {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+
+			_, err := NewClientConfigFromEnv()
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("Missing CA files fail the check", func(t *testing.T) {
+		t.Setenv("ELASTICSEARCH_CA_CERT", filepath.Join(t.TempDir(), "missing.pem"))
+
+		assert.Error(t, CheckConfig())
+	})
+}
+
+func TestClientConfigAddress(t *testing.T) {
+	cloudID := "e2e:" + base64.StdEncoding.EncodeToString([]byte("us-east-1.aws.found.io:443$es-id$kb-id"))
+
+	cfg := ClientConfig{URL: "http://elasticsearch:9200", CloudID: cloudID}
+	address, err := cfg.Address()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://es-id.us-east-1.aws.found.io:443", address)
+
+	endpoint, err := ClientConfig{URL: "https://elasticsearch.example.com/", Username: "elastic", Password: "secret"}.Endpoint()
+	assert.Nil(t, err)
+	assert.Equal(t, &Endpoint{Scheme: "https", Host: "elasticsearch.example.com", Port: 443, Credentials: "elastic:secret"}, endpoint)
+}
+
+func TestClientConfigRetryBackoff(t *testing.T) {
+	cfg := ClientConfig{RetryBackoff: 100 * time.Millisecond}
+
+	assert.Equal(t, 100*time.Millisecond, cfg.retryBackoff(1))
+	assert.Equal(t, 200*time.Millisecond, cfg.retryBackoff(2))
+	assert.Equal(t, 400*time.Millisecond, cfg.retryBackoff(3))
+}
+
+func TestClientAuthentication(t *testing.T) {
+	ctx := context.Background()
+	requests := newElasticsearchServer(t)
+	t.Setenv("ELASTICSEARCH_USERNAME", "elastic")
+
+	_, err := Search(ctx, "logs-*", NewQuery().Build())
+	assert.Nil(t, err)
+	assert.Equal(t, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ==", (*requests)[0].Header.Get("Authorization"))
+
+	_, err = WaitForIndices()
+	assert.Nil(t, err)
+	assert.Equal(t, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ==", (*requests)[1].Header.Get("Authorization"), "the curl helpers use the same credentials")
+
+	t.Setenv("ELASTICSEARCH_API_KEY", "a2V5OnNlY3JldA==")
+
+	_, err = Search(ctx, "logs-*", NewQuery().Build())
+	assert.Nil(t, err)
+	assert.Equal(t, "APIKey a2V5OnNlY3JldA==", (*requests)[2].Header.Get("Authorization"), "the Go client sends the scheme in uppercase")
+
+	_, err = WaitForIndices()
+	assert.Nil(t, err)
+	assert.Equal(t, "ApiKey a2V5OnNlY3JldA==", (*requests)[3].Header.Get("Authorization"))
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("ELASTICSEARCH_RETRY_BACKOFF", "1ms")
+
+	t.Run("Unavailable responses are retried", func(t *testing.T) {
+		requests := newElasticsearchServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+		_, err := Search(ctx, "logs-*", NewQuery().Build())
+		assert.Nil(t, err)
+		assert.Len(t, *requests, 3)
+	})
+
+	t.Run("Retries can be disabled", func(t *testing.T) {
+		requests := newElasticsearchServer(t, http.StatusServiceUnavailable)
+		t.Setenv("ELASTICSEARCH_MAX_RETRIES", "0")
+
+		_, err := Search(ctx, "logs-*", NewQuery().Build())
+		assert.Error(t, err)
+		assert.Len(t, *requests, 1)
+	})
+}
+
+func TestClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(caFile, caPEM, 0644))
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	get := func(cfg ClientConfig) error {
+		cfg.URL = srv.URL
+		cfg.Timeout = defaultTimeout
+
+		r, err := cfg.httpRequest("/_cat/indices")
+		if err != nil {
+			return err
+		}
+
+		_, err = curl.Get(r)
+		return err
+	}
+
+	t.Run("Unknown CAs are rejected", func(t *testing.T) {
+		assert.Error(t, get(ClientConfig{}))
+	})
+
+	t.Run("Custom CAs are trusted", func(t *testing.T) {
+		assert.Nil(t, get(ClientConfig{CACert: caFile}))
+	})
+
+	t.Run("Fingerprints are trusted", func(t *testing.T) {
+		assert.Nil(t, get(ClientConfig{CAFingerprint: fingerprint}))
+	})
+
+	t.Run("Fingerprints in the openssl format", func(t *testing.T) {
+		openssl := ""
+		for i := 0; i < len(fingerprint); i += 2 {
+			if i > 0 {
+				openssl += ":"
+			}
+			openssl += fingerprint[i : i+2]
+		}
+		assert.Nil(t, get(ClientConfig{CAFingerprint: openssl}))
+	})
+
+	t.Run("Other fingerprints are rejected", func(t *testing.T) {
+		assert.Error(t, get(ClientConfig{CAFingerprint: hex.EncodeToString(make([]byte, sha256.Size))}))
+	})
+
+	t.Run("Transports are shared by TLS configuration", func(t *testing.T) {
+		t1, err := transport.Get(ClientConfig{CACert: caFile, Timeout: defaultTimeout}.transportConfig())
+		assert.Nil(t, err)
+		t2, err := transport.Get(ClientConfig{CACert: caFile, Timeout: defaultTimeout, APIKey: "key"}.transportConfig())
+		assert.Nil(t, err)
+
+		assert.Same(t, t1, t2)
+	})
+}
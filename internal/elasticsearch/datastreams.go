@@ -0,0 +1,205 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// DefaultNamespace is the namespace of the data streams when the policies do not set one
+const DefaultNamespace = "default"
+
+// maxNamespaceLength is the maximum length of a namespace, in bytes
+const maxNamespaceLength = 100
+
+// DataStreamTypes are the types of the data streams the agents write to
+var DataStreamTypes = []string{"logs", "metrics", "traces"}
+
+// DataStream represents a data stream, as returned by the data streams API
+type DataStream struct {
+	Name       string `json:"name"`
+	Generation int    `json:"generation"`
+	Status     string `json:"status"`
+	Template   string `json:"template"`
+	Indices    []struct {
+		Name string `json:"index_name"`
+	} `json:"indices"`
+}
+
+// NewNamespace returns a unique namespace, so that the data of a scenario does not mix with the data
+// of the others, i.e. e2e3f2a4c1b9d07
+func NewNamespace(prefix string) string {
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	return strings.ToLower(prefix) + id[:12]
+}
+
+// ValidateNamespace returns an error if the namespace cannot be part of the name of a data stream
+func ValidateNamespace(namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("the namespace cannot be empty")
+	}
+	if len(namespace) > maxNamespaceLength {
+		return fmt.Errorf("the %s namespace is longer than %d bytes", namespace, maxNamespaceLength)
+	}
+	if namespace != strings.ToLower(namespace) {
+		return fmt.Errorf("the %s namespace must be lowercase", namespace)
+	}
+	if strings.ContainsAny(namespace, `-\/*?"<>|, #:`) {
+		return fmt.Errorf("the %s namespace contains invalid characters", namespace)
+	}
+	return nil
+}
+
+// DataStreamName returns the name of the data stream of a type and dataset in a namespace, i.e. logs-elastic_agent-default
+func DataStreamName(dataStreamType string, dataset string, namespace string) string {
+	return fmt.Sprintf("%s-%s-%s", dataStreamType, dataset, namespace)
+}
+
+// NamespacePatterns returns the patterns matching the data streams of a namespace, of every type,
+// i.e. logs-*-default. The namespaces do not contain dashes, so the patterns match no other namespace
+func NamespacePatterns(namespace string) []string {
+	patterns := []string{}
+	for _, t := range DataStreamTypes {
+		patterns = append(patterns, DataStreamName(t, "*", namespace))
+	}
+	return patterns
+}
+
+// NamespaceIndex returns the index to search the data of a namespace, of every type
+func NamespaceIndex(namespace string) string {
+	return strings.Join(NamespacePatterns(namespace), ",")
+}
+
+// InNamespace scopes the query to the documents of a namespace
+func (q *QueryBuilder) InNamespace(namespace string) *QueryBuilder {
+	return q.Filter(Term("data_stream.namespace", namespace))
+}
+
+// SearchInNamespace searches the documents of a namespace, scoping the query to it
+func SearchInNamespace(ctx context.Context, namespace string, query *QueryBuilder) (SearchResult, error) {
+	return Search(ctx, NamespaceIndex(namespace), query.InNamespace(namespace).Build())
+}
+
+// GetDataStreams returns the data streams matching the patterns
+func GetDataStreams(ctx context.Context, patterns ...string) ([]DataStream, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting data streams", "elasticsearch.data-streams.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("patterns", strings.Join(patterns, ","))
+	defer span.End()
+
+	esClient, err := getElasticsearchClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := esClient.Indices.GetDataStream(
+		esClient.Indices.GetDataStream.WithContext(ctx),
+		esClient.Indices.GetDataStream.WithName(patterns...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return []DataStream{}, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("could not get the %s data streams: %s", strings.Join(patterns, ","), res.String())
+	}
+
+	var resp struct {
+		DataStreams []DataStream `json:"data_streams"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("could not parse the data streams: %w", err)
+	}
+
+	return resp.DataStreams, nil
+}
+
+// DeleteDataStreams deletes the data streams matching the patterns, and their backing indices. Patterns
+// matching no data stream are not an error
+func DeleteDataStreams(ctx context.Context, patterns ...string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting data streams", "elasticsearch.data-streams.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("patterns", strings.Join(patterns, ","))
+	defer span.End()
+
+	esClient, err := getElasticsearchClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := esClient.Indices.DeleteDataStream(patterns, esClient.Indices.DeleteDataStream.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("could not delete the %s data streams: %s", strings.Join(patterns, ","), res.String())
+	}
+
+	log.WithFields(log.Fields{
+		"patterns": patterns,
+		"status":   res.Status(),
+	}).Debug("Data streams deleted")
+
+	return nil
+}
+
+// RolloverDataStreams rolls over the data streams matching the patterns, so that the next documents
+// are written to new backing indices. It returns the names of the data streams rolled over
+func RolloverDataStreams(ctx context.Context, patterns ...string) ([]string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Rolling over data streams", "elasticsearch.data-streams.rollover", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("patterns", strings.Join(patterns, ","))
+	defer span.End()
+
+	// the rollover API does not expand wildcards
+	dataStreams, err := GetDataStreams(ctx, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	esClient, err := getElasticsearchClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rolledOver := []string{}
+	for _, ds := range dataStreams {
+		res, err := esClient.Indices.Rollover(ds.Name, esClient.Indices.Rollover.WithContext(ctx))
+		if err != nil {
+			return rolledOver, err
+		}
+		res.Body.Close()
+
+		if res.IsError() {
+			return rolledOver, fmt.Errorf("could not roll over the %s data stream: %s", ds.Name, res.Status())
+		}
+
+		rolledOver = append(rolledOver, ds.Name)
+	}
+
+	log.WithFields(log.Fields{
+		"dataStreams": rolledOver,
+		"patterns":    patterns,
+	}).Debug("Data streams rolled over")
+
+	return rolledOver, nil
+}
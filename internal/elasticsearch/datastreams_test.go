@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDataStreams is a fake Elasticsearch keeping data streams by name, with their generation
+type fakeDataStreams struct {
+	mu          sync.Mutex
+	dataStreams map[string]int
+}
+
+// match returns the names of the data streams matching the comma-separated patterns, sorted
+func (f *fakeDataStreams) match(patterns string) []string {
+	names := []string{}
+	for name := range f.dataStreams {
+		for _, pattern := range strings.Split(patterns, ",") {
+			if matched, _ := path.Match(pattern, name); matched {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newDataStreamsServer(t *testing.T, names ...string) *fakeDataStreams {
+	f := &fakeDataStreams{dataStreams: map[string]int{}}
+	for _, name := range names {
+		f.dataStreams[name] = 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_data_stream/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		dataStreams := []map[string]interface{}{}
+		for _, name := range f.match(r.PathValue("name")) {
+			dataStreams = append(dataStreams, map[string]interface{}{"name": name, "generation": f.dataStreams[name]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data_streams": dataStreams})
+	})
+	mux.HandleFunc("DELETE /_data_stream/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		names := f.match(r.PathValue("name"))
+		if len(names) == 0 && !strings.Contains(r.PathValue("name"), "*") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"type": "index_not_found_exception"}, "status": 404}`))
+			return
+		}
+		for _, name := range names {
+			delete(f.dataStreams, name)
+		}
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	})
+	mux.HandleFunc("POST /{name}/_rollover", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.dataStreams[r.PathValue("name")]++
+		_, _ = w.Write([]byte(`{"acknowledged": true, "rolled_over": true}`))
+	})
+
+	newFakeElasticsearch(t, mux)
+
+	return f
+}
+
+func TestNewNamespace(t *testing.T) {
+	namespace := NewNamespace("E2E")
+
+	assert.True(t, strings.HasPrefix(namespace, "e2e"))
+	assert.Len(t, namespace, 15)
+	assert.Nil(t, ValidateNamespace(namespace))
+	assert.NotEqual(t, namespace, NewNamespace("e2e"))
+}
+
+func TestValidateNamespace(t *testing.T) {
+	assert.Nil(t, ValidateNamespace(DefaultNamespace))
+
+	for _, namespace := range []string{"", "Upper", "with-dash", "with space", "a*b", strings.Repeat("a", 101)} {
+		assert.NotNil(t, ValidateNamespace(namespace), namespace)
+	}
+}
+
+func TestNamespacePatterns(t *testing.T) {
+	assert.Equal(t, []string{"logs-*-e2e1", "metrics-*-e2e1", "traces-*-e2e1"}, NamespacePatterns("e2e1"))
+	assert.Equal(t, "logs-*-e2e1,metrics-*-e2e1,traces-*-e2e1", NamespaceIndex("e2e1"))
+	assert.Equal(t, "logs-elastic_agent-e2e1", DataStreamName("logs", "elastic_agent", "e2e1"))
+}
+
+func TestQueryInNamespace(t *testing.T) {
+	query := NewQuery().Filter(Term("data_stream.dataset", "system.cpu")).InNamespace("e2e1").Build()
+
+	filter := query["query"].(Clause)["bool"].(map[string]interface{})["filter"].([]Clause)
+	assert.Equal(t, Term("data_stream.namespace", "e2e1"), filter[1])
+}
+
+func TestDataStreamsOfANamespace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Get", func(t *testing.T) {
+		newDataStreamsServer(t, "logs-elastic_agent-e2e1", "metrics-system.cpu-e2e1", "logs-elastic_agent-e2e2")
+
+		dataStreams, err := GetDataStreams(ctx, NamespacePatterns("e2e1")...)
+		assert.Nil(t, err)
+		assert.Len(t, dataStreams, 2)
+		assert.Equal(t, "logs-elastic_agent-e2e1", dataStreams[0].Name)
+		assert.Equal(t, "metrics-system.cpu-e2e1", dataStreams[1].Name)
+	})
+
+	t.Run("Delete keeps the other namespaces", func(t *testing.T) {
+		f := newDataStreamsServer(t, "logs-elastic_agent-e2e1", "metrics-system.cpu-e2e1", "logs-elastic_agent-e2e2")
+
+		err := DeleteDataStreams(ctx, NamespacePatterns("e2e1")...)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{"logs-elastic_agent-e2e2": 1}, f.dataStreams)
+	})
+
+	t.Run("Delete missing data streams", func(t *testing.T) {
+		newDataStreamsServer(t)
+
+		err := DeleteDataStreams(ctx, "logs-elastic_agent-e2e1")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Rollover", func(t *testing.T) {
+		f := newDataStreamsServer(t, "logs-elastic_agent-e2e1", "logs-elastic_agent-e2e2")
+
+		rolledOver, err := RolloverDataStreams(ctx, NamespacePatterns("e2e1")...)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"logs-elastic_agent-e2e1"}, rolledOver)
+		assert.Equal(t, map[string]int{"logs-elastic_agent-e2e1": 2, "logs-elastic_agent-e2e2": 1}, f.dataStreams)
+	})
+}
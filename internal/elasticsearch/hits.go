@@ -0,0 +1,290 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Hit represents a document returned by a search
+type Hit struct {
+	ID     string
+	Index  string
+	Source map[string]interface{}
+}
+
+// Hits returns the documents of a search result, in the order they were returned
+func (r SearchResult) Hits() []Hit {
+	hits := []Hit{}
+
+	outer, ok := r["hits"].(map[string]interface{})
+	if !ok {
+		return hits
+	}
+	inner, ok := outer["hits"].([]interface{})
+	if !ok {
+		return hits
+	}
+
+	for _, h := range inner {
+		raw, ok := h.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		hit := Hit{Source: map[string]interface{}{}}
+		hit.ID, _ = raw["_id"].(string)
+		hit.Index, _ = raw["_index"].(string)
+		if source, ok := raw["_source"].(map[string]interface{}); ok {
+			hit.Source = source
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits
+}
+
+// Field returns the value of a field of the document, i.e. host.name, which is found both in nested objects
+// and in dotted keys, as the documents may come with any of them
+func (h Hit) Field(field string) (interface{}, bool) {
+	return lookupField(h.Source, field)
+}
+
+func lookupField(object map[string]interface{}, field string) (interface{}, bool) {
+	if value, ok := object[field]; ok {
+		return value, true
+	}
+
+	for i := strings.Index(field, "."); i >= 0; i = nextDot(field, i) {
+		nested, ok := object[field[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := lookupField(nested, field[i+1:]); ok {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+func nextDot(field string, from int) int {
+	i := strings.Index(field[from+1:], ".")
+	if i < 0 {
+		return -1
+	}
+	return from + 1 + i
+}
+
+// HitMatcher checks a document, returning an error describing why it does not match
+type HitMatcher func(hit Hit) error
+
+// HitsMatcher checks the documents of a search result, returning an error describing why they do not match
+type HitsMatcher func(hits []Hit) error
+
+// HasField matches the documents with a value for a field
+func HasField(field string) HitMatcher {
+	return func(hit Hit) error {
+		if value, ok := hit.Field(field); !ok || value == nil {
+			return fmt.Errorf("document %s does not have the %s field", hit.ID, field)
+		}
+		return nil
+	}
+}
+
+// FieldEquals matches the documents with a value for a field. The numbers are compared by value, as the ones
+// decoded from JSON are float64
+func FieldEquals(field string, expected interface{}) HitMatcher {
+	return func(hit Hit) error {
+		value, ok := hit.Field(field)
+		if !ok {
+			return fmt.Errorf("document %s does not have the %s field", hit.ID, field)
+		}
+		if !valuesEqual(value, expected) {
+			return fmt.Errorf("document %s has %v in the %s field, expected %v", hit.ID, value, field, expected)
+		}
+		return nil
+	}
+}
+
+// FieldMatches matches the documents with a value for a field matching a regular expression
+func FieldMatches(field string, pattern *regexp.Regexp) HitMatcher {
+	return func(hit Hit) error {
+		value, ok := hit.Field(field)
+		if !ok {
+			return fmt.Errorf("document %s does not have the %s field", hit.ID, field)
+		}
+		if !pattern.MatchString(fmt.Sprint(value)) {
+			return fmt.Errorf("document %s has %v in the %s field, which does not match %s", hit.ID, value, field, pattern)
+		}
+		return nil
+	}
+}
+
+// EveryHit matches the search results where all the documents match, failing for the empty ones
+func EveryHit(matcher HitMatcher) HitsMatcher {
+	return func(hits []Hit) error {
+		if len(hits) == 0 {
+			return fmt.Errorf("there aren't documents to match")
+		}
+
+		for _, hit := range hits {
+			if err := matcher(hit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyHit matches the search results where at least one of the documents matches
+func AnyHit(matcher HitMatcher) HitsMatcher {
+	return func(hits []Hit) error {
+		var lastErr error
+		for _, hit := range hits {
+			lastErr = matcher(hit)
+			if lastErr == nil {
+				return nil
+			}
+		}
+
+		if lastErr == nil {
+			return fmt.Errorf("there aren't documents to match")
+		}
+		return fmt.Errorf("none of the %d documents match, i.e. %w", len(hits), lastErr)
+	}
+}
+
+// HitsCountAtLeast matches the search results with a minimum number of documents
+func HitsCountAtLeast(count int) HitsMatcher {
+	return func(hits []Hit) error {
+		if len(hits) < count {
+			return fmt.Errorf("there are %d documents, expected at least %d", len(hits), count)
+		}
+		return nil
+	}
+}
+
+// DistinctValuesCount matches the search results with a number of distinct values for a field
+func DistinctValuesCount(field string, count int) HitsMatcher {
+	return func(hits []Hit) error {
+		values := DistinctValues(hits, field)
+		if len(values) != count {
+			return fmt.Errorf("there are %d distinct values for the %s field, expected %d: %v", len(values), field, count, values)
+		}
+		return nil
+	}
+}
+
+// PercentileAtMost matches the search results where a percentile of a numeric field, i.e. 95, is at most a value
+func PercentileAtMost(field string, percentile float64, limit float64) HitsMatcher {
+	return func(hits []Hit) error {
+		value, err := Percentile(hits, field, percentile)
+		if err != nil {
+			return err
+		}
+		if value > limit {
+			return fmt.Errorf("the p%v of the %s field is %v, expected at most %v", percentile, field, value, limit)
+		}
+		return nil
+	}
+}
+
+// AssertHits returns an error if the documents of a search result do not match any of the matchers
+func AssertHits(result SearchResult, matchers ...HitsMatcher) error {
+	hits := result.Hits()
+	for _, matcher := range matchers {
+		if err := matcher(hits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DistinctValues returns the distinct values of a field in the documents, in the order they are found.
+// The documents without the field are skipped
+func DistinctValues(hits []Hit, field string) []interface{} {
+	values := []interface{}{}
+	seen := map[string]bool{}
+	for _, hit := range hits {
+		value, ok := hit.Field(field)
+		if !ok {
+			continue
+		}
+
+		key := fmt.Sprintf("%#v", value)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, value)
+	}
+	return values
+}
+
+// Percentile returns a percentile of a numeric field in the documents, from 0 to 100, using the nearest-rank method.
+// The documents without the field are skipped
+func Percentile(hits []Hit, field string, percentile float64) (float64, error) {
+	if percentile < 0 || percentile > 100 {
+		return 0, fmt.Errorf("the percentile must be between 0 and 100, got %v", percentile)
+	}
+
+	values := []float64{}
+	for _, hit := range hits {
+		value, ok := hit.Field(field)
+		if !ok {
+			continue
+		}
+
+		number, ok := toFloat(value)
+		if !ok {
+			return 0, fmt.Errorf("document %s has %v in the %s field, which is not a number", hit.ID, value, field)
+		}
+		values = append(values, number)
+	}
+
+	if len(values) == 0 {
+		return 0, fmt.Errorf("there aren't documents with the %s field", field)
+	}
+
+	sort.Float64s(values)
+	rank := int(math.Ceil(percentile / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1], nil
+}
+
+func valuesEqual(value interface{}, expected interface{}) bool {
+	if a, ok := toFloat(value); ok {
+		if b, ok := toFloat(expected); ok {
+			return a == b
+		}
+	}
+	return reflect.DeepEqual(value, expected)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
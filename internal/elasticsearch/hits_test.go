@@ -0,0 +1,121 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadSearchResult loads a search result from the testdata directory
+func loadSearchResult(t *testing.T, name string) elasticsearch.SearchResult {
+	t.Helper()
+
+	bytes, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	var result elasticsearch.SearchResult
+	require.NoError(t, json.Unmarshal(bytes, &result))
+	return result
+}
+
+func TestHits(t *testing.T) {
+	hits := loadSearchResult(t, "search_result.json").Hits()
+	require.Len(t, hits, 4)
+
+	assert.Equal(t, "a1", hits[0].ID)
+	assert.Equal(t, ".ds-logs-elastic_agent-default-2024.05.02-000001", hits[0].Index)
+
+	t.Run("Nested and dotted fields", func(t *testing.T) {
+		for i, expected := range []string{"agent-1", "agent-1", "agent-2", "agent-2"} {
+			value, ok := hits[i].Field("host.hostname")
+			assert.True(t, ok)
+			assert.Equal(t, expected, value)
+		}
+
+		value, ok := hits[2].Field("host.os.family")
+		assert.True(t, ok)
+		assert.Equal(t, "redhat", value)
+
+		_, ok = hits[3].Field("event.duration")
+		assert.False(t, ok)
+	})
+
+	t.Run("Empty search result", func(t *testing.T) {
+		assert.Empty(t, elasticsearch.SearchResult{}.Hits())
+	})
+}
+
+func TestAssertHits(t *testing.T) {
+	result := loadSearchResult(t, "search_result.json")
+
+	t.Run("Matching hits", func(t *testing.T) {
+		err := elasticsearch.AssertHits(result,
+			elasticsearch.HitsCountAtLeast(4),
+			elasticsearch.EveryHit(elasticsearch.FieldEquals("event.dataset", "elastic_agent")),
+			elasticsearch.EveryHit(elasticsearch.FieldMatches("host.hostname", regexp.MustCompile(`^agent-\d$`))),
+			elasticsearch.EveryHit(elasticsearch.HasField("@timestamp")),
+			elasticsearch.AnyHit(elasticsearch.FieldEquals("event.duration", 300)),
+			elasticsearch.DistinctValuesCount("host.os.family", 2),
+			elasticsearch.PercentileAtMost("event.duration", 95, 300),
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Not every hit has the field", func(t *testing.T) {
+		err := elasticsearch.AssertHits(result, elasticsearch.EveryHit(elasticsearch.HasField("event.duration")))
+		assert.EqualError(t, err, "document b2 does not have the event.duration field")
+	})
+
+	t.Run("No hit matches", func(t *testing.T) {
+		err := elasticsearch.AssertHits(result, elasticsearch.AnyHit(elasticsearch.FieldMatches("message", regexp.MustCompile("(?i)error"))))
+		assert.Error(t, err)
+	})
+
+	t.Run("Too many distinct values", func(t *testing.T) {
+		err := elasticsearch.AssertHits(result, elasticsearch.DistinctValuesCount("host.hostname", 1))
+		assert.EqualError(t, err, "there are 2 distinct values for the host.hostname field, expected 1: [agent-1 agent-2]")
+	})
+
+	t.Run("Percentile above the limit", func(t *testing.T) {
+		err := elasticsearch.AssertHits(result, elasticsearch.PercentileAtMost("event.duration", 50, 100))
+		assert.EqualError(t, err, "the p50 of the event.duration field is 200, expected at most 100")
+	})
+
+	t.Run("Empty search result", func(t *testing.T) {
+		err := elasticsearch.AssertHits(elasticsearch.SearchResult{}, elasticsearch.EveryHit(elasticsearch.HasField("@timestamp")))
+		assert.Error(t, err)
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	hits := loadSearchResult(t, "search_result.json").Hits()
+
+	for percentile, expected := range map[float64]float64{0: 100, 33: 100, 34: 200, 66: 200, 67: 300, 100: 300} {
+		value, err := elasticsearch.Percentile(hits, "event.duration", percentile)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, "p%v", percentile)
+	}
+
+	_, err := elasticsearch.Percentile(hits, "message", 50)
+	assert.Error(t, err)
+
+	_, err = elasticsearch.Percentile(hits, "event.duration", 101)
+	assert.Error(t, err)
+}
+
+func TestDistinctValues(t *testing.T) {
+	hits := loadSearchResult(t, "search_result.json").Hits()
+
+	assert.Equal(t, []interface{}{"Elastic Agent started", "Fleet Server connection established", "Unit state changed"}, elasticsearch.DistinctValues(hits, "message"))
+	assert.Empty(t, elasticsearch.DistinctValues(hits, "not.a.field"))
+}
@@ -0,0 +1,178 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"time"
+)
+
+// SortOrder represents the order of the hits for a field
+type SortOrder string
+
+const (
+	// Ascending sorts the hits from the lowest value of a field
+	Ascending SortOrder = "asc"
+	// Descending sorts the hits from the highest value of a field
+	Descending SortOrder = "desc"
+)
+
+// TimestampField is the field of the time of the events in the data streams
+const TimestampField = "@timestamp"
+
+// Clause represents a clause of the query DSL, as sent to Elasticsearch
+type Clause map[string]interface{}
+
+// RangeBounds represents the bounds of a range clause, where the nil bounds are not set. The values are numbers,
+// dates or date math expressions, i.e. now-1m
+type RangeBounds struct {
+	Gt     interface{}
+	Gte    interface{}
+	Lt     interface{}
+	Lte    interface{}
+	Format string // format of the dates of the bounds, i.e. strict_date_optional_time
+}
+
+// BoolQuery represents the clauses of a bool clause
+type BoolQuery struct {
+	Must               []Clause
+	Filter             []Clause
+	Should             []Clause
+	MustNot            []Clause
+	MinimumShouldMatch int // only sent when there are should clauses
+}
+
+// Term matches the documents with the exact value for a field
+func Term(field string, value interface{}) Clause {
+	return Clause{"term": map[string]interface{}{field: value}}
+}
+
+// Terms matches the documents with any of the exact values for a field
+func Terms(field string, values ...interface{}) Clause {
+	return Clause{"terms": map[string]interface{}{field: values}}
+}
+
+// MatchPhrase matches the documents with the phrase in an analyzed field
+func MatchPhrase(field string, phrase string) Clause {
+	return Clause{"match_phrase": map[string]interface{}{field: phrase}}
+}
+
+// Exists matches the documents with a value for a field
+func Exists(field string) Clause {
+	return Clause{"exists": map[string]interface{}{"field": field}}
+}
+
+// Range matches the documents with a value for a field within the bounds
+func Range(field string, bounds RangeBounds) Clause {
+	r := map[string]interface{}{}
+	for name, bound := range map[string]interface{}{"gt": bounds.Gt, "gte": bounds.Gte, "lt": bounds.Lt, "lte": bounds.Lte} {
+		if bound != nil {
+			r[name] = bound
+		}
+	}
+	if bounds.Format != "" {
+		r["format"] = bounds.Format
+	}
+
+	return Clause{"range": map[string]interface{}{field: r}}
+}
+
+// TimeWindow matches the documents with a date for a field from a time, included, to another one, excluded.
+// A zero time leaves that side of the window open
+func TimeWindow(field string, from time.Time, to time.Time) Clause {
+	bounds := RangeBounds{Format: "strict_date_optional_time"}
+	if !from.IsZero() {
+		bounds.Gte = from.UTC().Format(time.RFC3339Nano)
+	}
+	if !to.IsZero() {
+		bounds.Lt = to.UTC().Format(time.RFC3339Nano)
+	}
+
+	return Range(field, bounds)
+}
+
+// Bool combines clauses
+func Bool(b BoolQuery) Clause {
+	body := map[string]interface{}{}
+	for name, clauses := range map[string][]Clause{"must": b.Must, "filter": b.Filter, "should": b.Should, "must_not": b.MustNot} {
+		if len(clauses) > 0 {
+			body[name] = clauses
+		}
+	}
+	if len(b.Should) > 0 && b.MinimumShouldMatch > 0 {
+		body["minimum_should_match"] = b.MinimumShouldMatch
+	}
+
+	return Clause{"bool": body}
+}
+
+// QueryBuilder builds the body of a search, as a bool query with its sorting
+type QueryBuilder struct {
+	query BoolQuery
+	sort  []map[string]interface{}
+}
+
+// NewQuery creates a builder for a query matching all the documents
+func NewQuery() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+// Filter adds clauses the documents must match, without scoring them
+func (q *QueryBuilder) Filter(clauses ...Clause) *QueryBuilder {
+	q.query.Filter = append(q.query.Filter, clauses...)
+	return q
+}
+
+// Must adds clauses the documents must match
+func (q *QueryBuilder) Must(clauses ...Clause) *QueryBuilder {
+	q.query.Must = append(q.query.Must, clauses...)
+	return q
+}
+
+// MustNot adds clauses the documents must not match
+func (q *QueryBuilder) MustNot(clauses ...Clause) *QueryBuilder {
+	q.query.MustNot = append(q.query.MustNot, clauses...)
+	return q
+}
+
+// Should adds clauses the documents must match at least one of
+func (q *QueryBuilder) Should(clauses ...Clause) *QueryBuilder {
+	q.query.Should = append(q.query.Should, clauses...)
+	q.query.MinimumShouldMatch = 1
+	return q
+}
+
+// Within filters the documents with a timestamp from a time, included, to another one, excluded
+func (q *QueryBuilder) Within(from time.Time, to time.Time) *QueryBuilder {
+	return q.Filter(TimeWindow(TimestampField, from, to))
+}
+
+// Since filters the documents with a timestamp from a time, included
+func (q *QueryBuilder) Since(from time.Time) *QueryBuilder {
+	return q.Within(from, time.Time{})
+}
+
+// Last filters the documents with a timestamp in the last period of time, as seen by Elasticsearch, i.e. 1m
+func (q *QueryBuilder) Last(period time.Duration) *QueryBuilder {
+	return q.Filter(Range(TimestampField, RangeBounds{Gte: fmt.Sprintf("now-%ds", int64(period.Seconds()))}))
+}
+
+// SortBy sorts the hits by a field, after the previous sorting fields
+func (q *QueryBuilder) SortBy(field string, order SortOrder) *QueryBuilder {
+	q.sort = append(q.sort, map[string]interface{}{field: map[string]interface{}{"order": order}})
+	return q
+}
+
+// Build returns the body of the search, to be used with Search and WaitForNumberOfHits
+func (q *QueryBuilder) Build() map[string]interface{} {
+	body := map[string]interface{}{
+		"query": Bool(q.query),
+	}
+	if len(q.sort) > 0 {
+		body["sort"] = q.sort
+	}
+
+	return body
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertQueryJSON(t *testing.T, expected string, query interface{}) {
+	t.Helper()
+
+	actual, err := json.Marshal(query)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+}
+
+func TestQueryBuilder(t *testing.T) {
+	t.Run("Empty query matches all the documents", func(t *testing.T) {
+		assertQueryJSON(t, `{"query": {"bool": {}}}`, elasticsearch.NewQuery().Build())
+	})
+
+	t.Run("Clauses and sorting", func(t *testing.T) {
+		query := elasticsearch.NewQuery().
+			Filter(elasticsearch.Term("host.hostname", "agent-1"), elasticsearch.Exists("event.dataset")).
+			Must(elasticsearch.MatchPhrase("message", "Elastic Agent started")).
+			MustNot(elasticsearch.Terms("tags", "logstash", "kafka")).
+			Should(elasticsearch.Term("event.dataset", "elastic_agent")).
+			SortBy("@timestamp", elasticsearch.Descending).
+			SortBy("event.sequence", elasticsearch.Ascending).
+			Build()
+
+		assertQueryJSON(t, `{
+			"query": {
+				"bool": {
+					"filter": [
+						{"term": {"host.hostname": "agent-1"}},
+						{"exists": {"field": "event.dataset"}}
+					],
+					"must": [{"match_phrase": {"message": "Elastic Agent started"}}],
+					"must_not": [{"terms": {"tags": ["logstash", "kafka"]}}],
+					"should": [{"term": {"event.dataset": "elastic_agent"}}],
+					"minimum_should_match": 1
+				}
+			},
+			"sort": [
+				{"@timestamp": {"order": "desc"}},
+				{"event.sequence": {"order": "asc"}}
+			]
+		}`, query)
+	})
+
+	t.Run("Time windows", func(t *testing.T) {
+		from := time.Date(2024, 5, 2, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+		to := from.Add(5 * time.Minute)
+
+		assertQueryJSON(t, `{"query": {"bool": {"filter": [
+			{"range": {"@timestamp": {"gte": "2024-05-02T08:00:00Z", "lt": "2024-05-02T08:05:00Z", "format": "strict_date_optional_time"}}}
+		]}}}`, elasticsearch.NewQuery().Within(from, to).Build())
+
+		assertQueryJSON(t, `{"query": {"bool": {"filter": [
+			{"range": {"@timestamp": {"gte": "2024-05-02T08:00:00Z", "format": "strict_date_optional_time"}}}
+		]}}}`, elasticsearch.NewQuery().Since(from).Build())
+
+		assertQueryJSON(t, `{"query": {"bool": {"filter": [
+			{"range": {"@timestamp": {"gte": "now-60s"}}}
+		]}}}`, elasticsearch.NewQuery().Last(time.Minute).Build())
+	})
+}
+
+func TestRange(t *testing.T) {
+	assertQueryJSON(t, `{"range": {"event.duration": {"gt": 10, "lte": 100}}}`,
+		elasticsearch.Range("event.duration", elasticsearch.RangeBounds{Gt: 10, Lte: 100}))
+}
+
+func TestBool(t *testing.T) {
+	nested := elasticsearch.Bool(elasticsearch.BoolQuery{
+		Should:             []elasticsearch.Clause{elasticsearch.Term("a", 1), elasticsearch.Term("b", 2)},
+		MinimumShouldMatch: 2,
+	})
+
+	assertQueryJSON(t, `{"bool": {"must": [{"bool": {
+		"should": [{"term": {"a": 1}}, {"term": {"b": 2}}],
+		"minimum_should_match": 2
+	}}]}}`, elasticsearch.Bool(elasticsearch.BoolQuery{Must: []elasticsearch.Clause{nested}}))
+}
@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fields
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/e2e-testing/internal/config"
+	internalio "github.com/elastic/e2e-testing/internal/io"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultECSVersion is the version of ECS the documents are validated against, unless another one is set
+const DefaultECSVersion = "8.11.0"
+
+// ecsFlatURL is the location of the flattened definitions of the fields of a version of ECS
+const ecsFlatURL = "https://raw.githubusercontent.com/elastic/ecs/v%s/generated/ecs/ecs_flat.yml"
+
+// LoadECS loads the definitions of the fields of a version of ECS, downloading them the first time,
+// and keeping them in the workspace for the next runs
+func LoadECS(version string) (Schema, error) {
+	dir := filepath.Join(config.OpDir(), "ecs", version)
+	file := filepath.Join(dir, "ecs_flat.yml")
+
+	found, err := internalio.Exists(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		err = internalio.MkdirAll(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		req := &utils.DownloadRequest{URL: fmt.Sprintf(ecsFlatURL, version), DownloadPath: dir}
+		err = utils.DownloadFile(req)
+		if err != nil {
+			return nil, fmt.Errorf("downloading ECS %s: %w", version, err)
+		}
+
+		err = os.Rename(req.UnsanitizedFilePath, file)
+		if err != nil {
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"file":    file,
+			"version": version,
+		}).Debug("ECS fields downloaded")
+	}
+
+	content, err := internalio.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseECS(content)
+}
@@ -0,0 +1,155 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package fields validates the documents ingested in the data streams against the field definitions
+// of the Elastic Common Schema (ECS) and of the integration packages.
+package fields
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ExternalECS is the external schema of the package fields defined by ECS
+const ExternalECS = "ecs"
+
+// Definition represents the definition of a field
+type Definition struct {
+	Name     string
+	Type     string
+	Required bool
+	External string // schema defining the field, i.e. ecs, when the package does not define its type
+}
+
+// Schema represents the definitions of the fields, by their full name, i.e. host.os.family. The names may
+// contain wildcards, i.e. labels.*
+type Schema map[string]Definition
+
+// packageField represents a field in the fields.yml files of the packages
+type packageField struct {
+	Name     string         `yaml:"name"`
+	Type     string         `yaml:"type"`
+	Required bool           `yaml:"required"`
+	External string         `yaml:"external"`
+	Fields   []packageField `yaml:"fields"`
+}
+
+// ecsField represents a field in the ecs_flat.yml file of ECS
+type ecsField struct {
+	Type     string `yaml:"type"`
+	Required bool   `yaml:"required"`
+}
+
+// ParsePackageFields parses a fields.yml file of a package, where the fields are nested in groups
+func ParsePackageFields(content []byte) (Schema, error) {
+	var fields []packageField
+	if err := yaml.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("parsing package fields: %w", err)
+	}
+
+	schema := Schema{}
+	flattenPackageFields(schema, "", fields)
+	return schema, nil
+}
+
+func flattenPackageFields(schema Schema, prefix string, fields []packageField) {
+	for _, f := range fields {
+		name := f.Name
+		if prefix != "" {
+			name = prefix + "." + f.Name
+		}
+
+		if f.Type == "group" || (f.Type == "" && len(f.Fields) > 0) {
+			flattenPackageFields(schema, name, f.Fields)
+			continue
+		}
+
+		fieldType := f.Type
+		if fieldType == "" && f.External == "" {
+			// the packages default to keyword when the type is not set
+			fieldType = "keyword"
+		}
+
+		schema[name] = Definition{Name: name, Type: fieldType, Required: f.Required, External: f.External}
+
+		// the objects may define some of their properties
+		flattenPackageFields(schema, name, f.Fields)
+	}
+}
+
+// ParseECS parses the ecs_flat.yml file of ECS, where the fields are keyed by their full name
+func ParseECS(content []byte) (Schema, error) {
+	var fields map[string]ecsField
+	if err := yaml.Unmarshal(content, &fields); err != nil {
+		return nil, fmt.Errorf("parsing ECS fields: %w", err)
+	}
+
+	schema := Schema{}
+	for name, f := range fields {
+		schema[name] = Definition{Name: name, Type: f.Type, Required: f.Required}
+	}
+	return schema, nil
+}
+
+// Merge returns a schema with the definitions of the schema and the others, where the definitions of the schema
+// take precedence
+func (s Schema) Merge(others ...Schema) Schema {
+	merged := Schema{}
+	for i := len(others) - 1; i >= 0; i-- {
+		for name, d := range others[i] {
+			merged[name] = d
+		}
+	}
+	for name, d := range s {
+		merged[name] = d
+	}
+	return merged
+}
+
+// ResolveExternal returns a schema where the fields defined by ECS take their type from it, keeping the rest
+// of the definitions untouched
+func (s Schema) ResolveExternal(ecs Schema) Schema {
+	resolved := Schema{}
+	for name, d := range s {
+		if d.External == ExternalECS && d.Type == "" {
+			if e, ok := ecs[name]; ok {
+				d.Type = e.Type
+			}
+		}
+		resolved[name] = d
+	}
+	return resolved
+}
+
+// Lookup returns the definition of a field, matching the names with wildcards too
+func (s Schema) Lookup(name string) (Definition, bool) {
+	if d, ok := s[name]; ok {
+		return d, true
+	}
+
+	for pattern, d := range s {
+		if !strings.Contains(pattern, "*") {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return d, true
+		}
+	}
+
+	return Definition{}, false
+}
+
+// RequiredFields returns the names of the required fields of the schema
+func (s Schema) RequiredFields() []string {
+	names := []string{}
+	for name, d := range s {
+		if d.Required {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,85 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fields_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/fields"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadSchema loads the package fields of the system.cpu data stream, with the ECS fields they refer to
+func loadSchema(t *testing.T) fields.Schema {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "ecs_flat.yml"))
+	require.NoError(t, err)
+	ecs, err := fields.ParseECS(content)
+	require.NoError(t, err)
+
+	content, err = os.ReadFile(filepath.Join("testdata", "system_cpu_fields.yml"))
+	require.NoError(t, err)
+	pkg, err := fields.ParsePackageFields(content)
+	require.NoError(t, err)
+
+	return pkg.ResolveExternal(ecs).Merge(ecs)
+}
+
+func TestParsePackageFields(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "system_cpu_fields.yml"))
+	require.NoError(t, err)
+
+	schema, err := fields.ParsePackageFields(content)
+	require.NoError(t, err)
+
+	assert.Equal(t, fields.Definition{Name: "system.cpu.cores", Type: "long"}, schema["system.cpu.cores"])
+	assert.Equal(t, fields.Definition{Name: "system.cpu.user.pct", Type: "scaled_float"}, schema["system.cpu.user.pct"])
+	assert.Equal(t, fields.Definition{Name: "system.cpu.total.pct", Type: "scaled_float", Required: true}, schema["system.cpu.total.pct"])
+	assert.Equal(t, fields.Definition{Name: "host.name", External: fields.ExternalECS}, schema["host.name"])
+
+	t.Run("Fields default to keyword", func(t *testing.T) {
+		assert.Equal(t, "keyword", schema["system.cpu.tags"].Type)
+	})
+
+	t.Run("Groups are not fields", func(t *testing.T) {
+		_, ok := schema["system.cpu"]
+		assert.False(t, ok)
+		_, ok = schema["system.cpu.total"]
+		assert.False(t, ok)
+	})
+
+	t.Run("Invalid YAML", func(t *testing.T) {
+		_, err := fields.ParsePackageFields([]byte("name: not a list"))
+		assert.Error(t, err)
+	})
+}
+
+func TestSchema(t *testing.T) {
+	schema := loadSchema(t)
+
+	t.Run("External fields take their type from ECS", func(t *testing.T) {
+		assert.Equal(t, fields.Definition{Name: "host.ip", Type: "ip", External: fields.ExternalECS}, schema["host.ip"])
+	})
+
+	t.Run("Package fields take precedence", func(t *testing.T) {
+		assert.Equal(t, fields.Definition{Name: "data_stream.type", Type: "constant_keyword"}, schema["data_stream.type"])
+	})
+
+	t.Run("Wildcards", func(t *testing.T) {
+		d, ok := schema.Lookup("system.cpu.meta.model")
+		assert.True(t, ok)
+		assert.Equal(t, "object", d.Type)
+
+		_, ok = schema.Lookup("system.cpu.idle.pct")
+		assert.False(t, ok)
+	})
+
+	// the package defines @timestamp as optional, taking precedence over ECS
+	assert.ElementsMatch(t, []string{"ecs.version", "system.cpu.total.pct"}, schema.RequiredFields())
+}
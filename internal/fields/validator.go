@@ -0,0 +1,255 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fields
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ViolationKind represents the reason a document does not conform to a schema
+type ViolationKind string
+
+const (
+	// UnknownField the document has a field which is not defined
+	UnknownField ViolationKind = "unknown field"
+	// TypeMismatch the document has a value which does not match the type of the field
+	TypeMismatch ViolationKind = "type mismatch"
+	// MissingField the document does not have a required field
+	MissingField ViolationKind = "missing field"
+)
+
+// RequiredFields are the fields every document ingested by an agent must have
+var RequiredFields = []string{
+	"@timestamp",
+	"agent.id",
+	"agent.type",
+	"agent.version",
+	"data_stream.dataset",
+	"data_stream.namespace",
+	"data_stream.type",
+	"event.dataset",
+	"host.name",
+}
+
+// Violation represents a field of a document not conforming to a schema
+type Violation struct {
+	Document string // ID of the document
+	Field    string
+	Kind     ViolationKind
+	Detail   string
+}
+
+// String returns the violation in a human readable way
+func (v Violation) String() string {
+	if v.Detail == "" {
+		return fmt.Sprintf("%s: %s", v.Kind, v.Field)
+	}
+	return fmt.Sprintf("%s: %s (%s)", v.Kind, v.Field, v.Detail)
+}
+
+// Validator checks documents against a schema
+type Validator struct {
+	Schema   Schema
+	Required []string // fields every document must have, besides the required ones of the schema
+	Ignored  []string // fields, and the fields below them, which are not validated, i.e. the ones added by ingest pipelines
+}
+
+// Validate returns the violations of a document, in the order of its fields
+func (v Validator) Validate(id string, doc map[string]interface{}) []Violation {
+	violations := []Violation{}
+
+	values := map[string][]interface{}{}
+	v.collect(values, "", doc)
+
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		d, ok := v.Schema.Lookup(name)
+		if !ok {
+			violations = append(violations, Violation{Document: id, Field: name, Kind: UnknownField})
+			continue
+		}
+
+		for _, value := range values[name] {
+			if !matchesType(d.Type, value) {
+				violations = append(violations, Violation{
+					Document: id,
+					Field:    name,
+					Kind:     TypeMismatch,
+					Detail:   fmt.Sprintf("%v is not a %s", value, d.Type),
+				})
+				break
+			}
+		}
+	}
+
+	required := append(append([]string{}, v.Required...), v.Schema.RequiredFields()...)
+	sort.Strings(required)
+	for i, name := range required {
+		if i > 0 && required[i-1] == name {
+			continue
+		}
+		if _, ok := values[name]; !ok && !v.containsObject(values, name) {
+			violations = append(violations, Violation{Document: id, Field: name, Kind: MissingField})
+		}
+	}
+
+	return violations
+}
+
+// collect flattens the fields of a document, down to the ones holding values or the ones defined as objects
+func (v Validator) collect(values map[string][]interface{}, prefix string, value interface{}) {
+	if v.ignored(prefix) {
+		return
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		// the defined fields are not flattened, so the objects are validated against their type as a whole
+		if _, ok := v.Schema.Lookup(prefix); ok && prefix != "" {
+			values[prefix] = append(values[prefix], val)
+			return
+		}
+
+		for key, child := range val {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			v.collect(values, name, child)
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			values[prefix] = append(values[prefix], val)
+			return
+		}
+		for _, item := range val {
+			v.collect(values, prefix, item)
+		}
+	default:
+		values[prefix] = append(values[prefix], val)
+	}
+}
+
+// containsObject returns true if a field is found below an object, i.e. the host field of an object type
+func (v Validator) containsObject(values map[string][]interface{}, name string) bool {
+	for field := range values {
+		if strings.HasPrefix(field, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (v Validator) ignored(name string) bool {
+	for _, ignored := range v.Ignored {
+		if name == ignored || strings.HasPrefix(name, ignored+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesType returns true if a value of a document can be indexed as a type. The values are the ones
+// decoded from JSON, so the numbers are float64
+func matchesType(fieldType string, value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	switch fieldType {
+	case "keyword", "constant_keyword", "wildcard", "text", "match_only_text", "version":
+		// Elasticsearch indexes the numbers and booleans as strings
+		switch value.(type) {
+		case string, float64, bool:
+			return true
+		}
+		return false
+	case "long", "integer", "short", "byte", "unsigned_long":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "float", "double", "half_float", "scaled_float":
+		_, ok := value.(float64)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "date", "date_nanos":
+		switch value.(type) {
+		case string, float64:
+			return true
+		}
+		return false
+	case "ip":
+		s, ok := value.(string)
+		return ok && net.ParseIP(s) != nil
+	case "object", "flattened", "nested", "histogram", "aggregate_metric_double":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "geo_point":
+		switch value.(type) {
+		case map[string]interface{}, string, []interface{}:
+			return true
+		}
+		return false
+	}
+
+	// the types which are not known, or not set, such as the ones of the external fields not found in ECS
+	return true
+}
+
+// Report represents the violations of the documents sampled from a data stream
+type Report struct {
+	Documents  int
+	Violations []Violation
+}
+
+// Add validates a document, adding its violations to the report
+func (r *Report) Add(v Validator, id string, doc map[string]interface{}) {
+	r.Documents++
+	r.Violations = append(r.Violations, v.Validate(id, doc)...)
+}
+
+// Err returns an error summarising the violations, grouped by kind and field, or nil if there are none
+func (r Report) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+
+	type group struct {
+		example   Violation
+		documents map[string]bool
+	}
+
+	keys := []string{}
+	groups := map[string]*group{}
+	for _, v := range r.Violations {
+		key := string(v.Kind) + " " + v.Field
+		g, ok := groups[key]
+		if !ok {
+			g = &group{example: v, documents: map[string]bool{}}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.documents[v.Document] = true
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, key := range keys {
+		g := groups[key]
+		lines = append(lines, fmt.Sprintf("%s in %d of %d documents, i.e. %s", g.example, len(g.documents), r.Documents, g.example.Document))
+	}
+
+	return fmt.Errorf("%d fields do not conform to the schema:\n%s", len(keys), strings.Join(lines, "\n"))
+}
@@ -0,0 +1,77 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fields_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/fields"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadDocuments(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "system_cpu_docs.json"))
+	require.NoError(t, err)
+
+	var docs []map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &docs))
+	return docs
+}
+
+func TestValidate(t *testing.T) {
+	docs := loadDocuments(t)
+	validator := fields.Validator{
+		Schema:   loadSchema(t),
+		Required: fields.RequiredFields,
+		Ignored:  []string{"elastic_agent"},
+	}
+
+	t.Run("Conforming document", func(t *testing.T) {
+		assert.Empty(t, validator.Validate("a", docs[0]))
+	})
+
+	t.Run("Document with violations", func(t *testing.T) {
+		assert.Equal(t, []fields.Violation{
+			{Document: "b", Field: "event.duration", Kind: fields.TypeMismatch, Detail: "1.5 is not a long"},
+			{Document: "b", Field: "host.ip", Kind: fields.TypeMismatch, Detail: "not-an-ip is not a ip"},
+			{Document: "b", Field: "system.cpu.cores", Kind: fields.TypeMismatch, Detail: "4 is not a long"},
+			{Document: "b", Field: "system.cpu.idle.pct", Kind: fields.UnknownField},
+			{Document: "b", Field: "agent.version", Kind: fields.MissingField},
+			{Document: "b", Field: "system.cpu.total.pct", Kind: fields.MissingField},
+		}, validator.Validate("b", docs[1]))
+	})
+
+	t.Run("Ignored fields", func(t *testing.T) {
+		validator.Ignored = nil
+		violations := validator.Validate("b", docs[1])
+		assert.Contains(t, violations, fields.Violation{Document: "b", Field: "elastic_agent.id", Kind: fields.UnknownField})
+	})
+}
+
+func TestReport(t *testing.T) {
+	docs := loadDocuments(t)
+	validator := fields.Validator{Schema: loadSchema(t), Ignored: []string{"elastic_agent"}}
+
+	report := fields.Report{}
+	assert.NoError(t, report.Err())
+
+	report.Add(validator, "a", docs[0])
+	report.Add(validator, "b", docs[1])
+	report.Add(validator, "c", docs[1])
+
+	assert.Equal(t, 3, report.Documents)
+	assert.EqualError(t, report.Err(), `5 fields do not conform to the schema:
+missing field: system.cpu.total.pct in 2 of 3 documents, i.e. b
+type mismatch: event.duration (1.5 is not a long) in 2 of 3 documents, i.e. b
+type mismatch: host.ip (not-an-ip is not a ip) in 2 of 3 documents, i.e. b
+type mismatch: system.cpu.cores (4 is not a long) in 2 of 3 documents, i.e. b
+unknown field: system.cpu.idle.pct in 2 of 3 documents, i.e. b`)
+}
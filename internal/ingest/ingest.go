@@ -0,0 +1,160 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package ingest measures how quickly the events shipped by the agents are ingested into the data streams,
+// as the latency between the moment of an event and the moment it's ingested, and as events per second.
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"go.elastic.co/apm/v2"
+)
+
+// IngestedField is the field where the final pipeline of Fleet stores the moment a document is ingested
+const IngestedField = "event.ingested"
+
+// Percentiles are the percentiles of the ingest latency computed by the measurements
+var Percentiles = []float64{50, 90, 95, 99}
+
+// Measurement represents the ingestion of the events of a host into a data stream over a window
+type Measurement struct {
+	Scenario        string             `json:"scenario,omitempty"`
+	DataStream      string             `json:"data_stream"`
+	Host            string             `json:"host"`
+	From            time.Time          `json:"from"`
+	To              time.Time          `json:"to"`
+	Events          int                `json:"events"`
+	EventsPerSecond float64            `json:"events_per_second"`
+	LatencyMillis   map[string]float64 `json:"latency_ms"` // by percentile, i.e. p95, and max
+	latencies       []time.Duration    // sorted
+}
+
+// Latency returns a percentile of the ingest latency, using the nearest rank
+func (m Measurement) Latency(percentile float64) (time.Duration, error) {
+	if percentile < 0 || percentile > 100 {
+		return 0, fmt.Errorf("the percentile must be between 0 and 100, got %v", percentile)
+	}
+	if len(m.latencies) == 0 {
+		return 0, fmt.Errorf("there aren't events with the %s field in the %s data stream", IngestedField, m.DataStream)
+	}
+
+	rank := int(math.Ceil(percentile / 100 * float64(len(m.latencies))))
+	if rank < 1 {
+		rank = 1
+	}
+	return m.latencies[rank-1], nil
+}
+
+// Compute computes the ingest latency and throughput of the documents of a host in a data stream, which
+// were found in a window. The documents without the ingested field are counted for the throughput only
+func Compute(dataStream string, host string, from time.Time, to time.Time, hits []elasticsearch.Hit) (Measurement, error) {
+	if !to.After(from) {
+		return Measurement{}, fmt.Errorf("the window of the measurement is empty: from %s to %s", from, to)
+	}
+
+	m := Measurement{
+		DataStream:      dataStream,
+		Host:            host,
+		From:            from,
+		To:              to,
+		Events:          len(hits),
+		EventsPerSecond: float64(len(hits)) / to.Sub(from).Seconds(),
+		LatencyMillis:   map[string]float64{},
+		latencies:       []time.Duration{},
+	}
+
+	for _, hit := range hits {
+		ingested, ok, err := timeField(hit, IngestedField)
+		if err != nil {
+			return Measurement{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		timestamp, ok, err := timeField(hit, elasticsearch.TimestampField)
+		if err != nil {
+			return Measurement{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		latency := ingested.Sub(timestamp)
+		if latency < 0 {
+			// the clocks of the host and Elasticsearch are not in sync
+			latency = 0
+		}
+		m.latencies = append(m.latencies, latency)
+	}
+
+	sort.Slice(m.latencies, func(i, j int) bool { return m.latencies[i] < m.latencies[j] })
+
+	if len(m.latencies) > 0 {
+		for _, p := range Percentiles {
+			latency, _ := m.Latency(p)
+			m.LatencyMillis[fmt.Sprintf("p%v", p)] = millis(latency)
+		}
+		m.LatencyMillis["max"] = millis(m.latencies[len(m.latencies)-1])
+	}
+
+	return m, nil
+}
+
+// Measure measures the ingestion of the events of a host into a data stream, i.e. logs-generic-default, over
+// a window ending now. A search returns 10000 documents at most, so the window must be short enough for the
+// throughput of the data stream
+func Measure(ctx context.Context, dataStream string, host string, window time.Duration) (Measurement, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Measuring ingestion", "elasticsearch.ingest.measure", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("dataStream", dataStream)
+	span.Context.SetLabel("host", host)
+	defer span.End()
+
+	to := time.Now().UTC()
+	from := to.Add(-window)
+
+	query := elasticsearch.NewQuery().
+		Filter(elasticsearch.Term("host.name", host)).
+		Within(from, to).
+		SortBy(elasticsearch.TimestampField, elasticsearch.Ascending).
+		Build()
+
+	result, err := elasticsearch.Search(ctx, dataStream, query)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	return Compute(dataStream, host, from, to, result.Hits())
+}
+
+// timeField returns the value of a date field of a document, false if the document does not have it
+func timeField(hit elasticsearch.Hit, field string) (time.Time, bool, error) {
+	value, ok := hit.Field(field)
+	if !ok || value == nil {
+		return time.Time{}, false, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("document %s has %v in the %s field, which is not a date", hit.ID, value, field)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("document %s has %s in the %s field, which is not a date: %w", hit.ID, s, field, err)
+	}
+	return t, true, nil
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
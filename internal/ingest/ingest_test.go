@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/stretchr/testify/assert"
+)
+
+var from = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// newHit creates a document with an event at an offset of the start of the window, ingested after a latency
+func newHit(id int, offset time.Duration, latency time.Duration) elasticsearch.Hit {
+	timestamp := from.Add(offset)
+	return elasticsearch.Hit{
+		ID: fmt.Sprintf("doc-%d", id),
+		Source: map[string]interface{}{
+			"@timestamp": timestamp.Format(time.RFC3339Nano),
+			"event": map[string]interface{}{
+				"ingested": timestamp.Add(latency).Format(time.RFC3339Nano),
+			},
+		},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	hits := []elasticsearch.Hit{}
+	for i := 1; i <= 20; i++ {
+		hits = append(hits, newHit(i, time.Duration(i)*time.Second, time.Duration(i)*100*time.Millisecond))
+	}
+	// events without the ingested field only count for the throughput
+	hits = append(hits, elasticsearch.Hit{ID: "doc-21", Source: map[string]interface{}{"@timestamp": from.Format(time.RFC3339Nano)}})
+
+	m, err := Compute("logs-generic-default", "host-1", from, from.Add(10*time.Second), hits)
+	assert.Nil(t, err)
+	assert.Equal(t, 21, m.Events)
+	assert.Equal(t, 2.1, m.EventsPerSecond)
+
+	p95, err := m.Latency(95)
+	assert.Nil(t, err)
+	assert.Equal(t, 1900*time.Millisecond, p95)
+
+	assert.Equal(t, map[string]float64{"p50": 1000, "p90": 1800, "p95": 1900, "p99": 2000, "max": 2000}, m.LatencyMillis)
+}
+
+func TestComputeClockSkew(t *testing.T) {
+	m, err := Compute("logs-generic-default", "host-1", from, from.Add(time.Minute), []elasticsearch.Hit{newHit(1, 0, -time.Second)})
+	assert.Nil(t, err)
+
+	p50, err := m.Latency(50)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), p50)
+}
+
+func TestComputeErrors(t *testing.T) {
+	_, err := Compute("logs-generic-default", "host-1", from, from, nil)
+	assert.NotNil(t, err)
+
+	invalid := elasticsearch.Hit{ID: "doc-1", Source: map[string]interface{}{"@timestamp": "yesterday", "event": map[string]interface{}{"ingested": "today"}}}
+	_, err = Compute("logs-generic-default", "host-1", from, from.Add(time.Minute), []elasticsearch.Hit{invalid})
+	assert.NotNil(t, err)
+
+	m, err := Compute("logs-generic-default", "host-1", from, from.Add(time.Minute), nil)
+	assert.Nil(t, err)
+	_, err = m.Latency(95)
+	assert.NotNil(t, err)
+}
+
+func TestReportWrite(t *testing.T) {
+	m, err := Compute("logs-generic-default", "host-1", from, from.Add(time.Second), []elasticsearch.Hit{newHit(1, 0, time.Second)})
+	assert.Nil(t, err)
+
+	r := NewReport()
+	r.Record("Ingest latency", m)
+
+	path := filepath.Join(t.TempDir(), "ingest.json")
+	assert.Nil(t, r.Write(path))
+
+	bytes, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	var measurements []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(bytes, &measurements))
+	assert.Len(t, measurements, 1)
+	assert.Equal(t, "Ingest latency", measurements[0]["scenario"])
+	assert.Equal(t, "logs-generic-default", measurements[0]["data_stream"])
+	assert.Equal(t, float64(1000), measurements[0]["latency_ms"].(map[string]interface{})["p95"])
+}
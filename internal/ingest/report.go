@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Report represents the measurements of the scenarios of a test suite. It's safe for concurrent use
+type Report struct {
+	mu           sync.Mutex
+	measurements []Measurement
+}
+
+// NewReport creates a report without measurements
+func NewReport() *Report {
+	return &Report{measurements: []Measurement{}}
+}
+
+// Record records the measurement of a scenario
+func (r *Report) Record(scenario string, m Measurement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m.Scenario = scenario
+	r.measurements = append(r.measurements, m)
+}
+
+// Measurements returns the measurements, in the order they were recorded
+func (r *Report) Measurements() []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	measurements := make([]Measurement, len(r.measurements))
+	copy(measurements, r.measurements)
+	return measurements
+}
+
+// Write writes the measurements to a JSON file
+func (r *Report) Write(path string) error {
+	bytes, err := json.MarshalIndent(r.Measurements(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the ingest measurements to %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -7,18 +7,44 @@ package installer
 import (
 	"context"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/io"
+	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/systemd"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
 	"go.elastic.co/apm/v2"
 )
 
+// fetchElasticArtifact downloads an Elastic artifact, returning the binary name and path. It's declared
+// as a variable so that tests are able to replace it, avoiding the download of the artifacts
+var fetchElasticArtifact = downloads.FetchElasticArtifactForSnapshots
+
+// mkdirAll and removeAll create and remove the directories of the installers in the host running the tests.
+// They are declared as variables so that tests are able to replace them, leaving the host untouched
+var (
+	mkdirAll  = io.MkdirAll
+	removeAll = os.RemoveAll
+)
+
+// loadImage and tagImage load and tag the Docker image of the agent in the Docker daemon of the host. They are
+// declared as variables so that tests are able to replace them, not requiring a Docker daemon
+var (
+	loadImage = deploy.LoadImage
+	tagImage  = deploy.TagImage
+)
+
+// diagnosticsBundle is the name of the diagnostics bundle created by the agent
+const diagnosticsBundle = "elastic-agent-diagnostics.zip"
+
 type elasticAgentPackage struct {
 	service  deploy.ServiceRequest
 	deploy   deploy.Deployment
@@ -30,6 +56,22 @@ func (p *elasticAgentPackage) PkgMetadata() deploy.ServiceInstallerMetadata {
 	return p.metadata
 }
 
+// uninstallOnCleanup registers the uninstall of the agent in the clean up stack of the scenario, once the
+// install subcommand installed it in the host
+func (p *elasticAgentPackage) uninstallOnCleanup(ctx context.Context, uninstall cleanup.Func) {
+	cleanup.Register(ctx, p.installResource(), uninstall)
+}
+
+// forgetUninstalled unregisters the uninstall of the agent, because the scenario uninstalled it
+func (p *elasticAgentPackage) forgetUninstalled(ctx context.Context) {
+	cleanup.Forget(ctx, p.installResource())
+}
+
+// installResource returns the name of the installed agent in the clean up stack, i.e. agent install elastic-agent
+func (p *elasticAgentPackage) installResource() string {
+	return "agent install " + p.service.GetName()
+}
+
 // Attach will attach a installer to a deployment allowing
 // the installation of a package to be transparently configured no matter the backend
 func Attach(ctx context.Context, deploy deploy.Deployment, service deploy.ServiceRequest, installType string) (deploy.ServiceOperator, error) {
@@ -57,6 +99,9 @@ func Attach(ctx context.Context, deploy deploy.Deployment, service deploy.Servic
 		case "zip":
 			install := AttachElasticAgentZIPPackage(deploy, service)
 			return install, nil
+		case "msi":
+			install := AttachElasticAgentMSIPackage(deploy, service)
+			return install, nil
 		case "rpm":
 			install := AttachElasticAgentRPMPackage(deploy, service)
 			return install, nil
@@ -72,15 +117,77 @@ func Attach(ctx context.Context, deploy deploy.Deployment, service deploy.Servic
 	return nil, nil
 }
 
-// doUpgrade upgrade an elastic-agent package using the 'upgrade' command
-func doUpgrade(ctx context.Context, so deploy.ServiceOperator) error {
+// extractedDirName returns the name of the directory extracted from the archive of a version of an artifact, i.e.
+// elastic-agent-8.6.0-SNAPSHOT-linux-x86_64, resolving the version aliases
+func extractedDirName(artifact string, version string, metadata deploy.ServiceInstallerMetadata) string {
+	if downloads.IsAlias(version) {
+		v, err := downloads.GetElasticArtifactVersion(version)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"version": version,
+			}).Warn("Failed to get the version, keeping current version")
+		} else {
+			version = v
+		}
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s", artifact, downloads.GetSnapshotVersion(version), metadata.Os, metadata.Arch)
+}
+
+// agentInstallPath returns the location where the elastic-agent is installed by the install command,
+// under the base path of the install options or the default one
+func agentInstallPath(service deploy.ServiceRequest, defaultBasePath string) string {
+	basePath := service.InstallOptions.BasePath
+	if basePath == "" {
+		basePath = defaultBasePath
+	}
+
+	return path.Join(basePath, "Elastic", "Agent")
+}
+
+// enrollOptionsFlags returns the flags for the install options of a service, for the packages installed by
+// the OS package manager, which only run the enroll command. Those packages are always installed
+// at the same location and running as root, so the options only honoured by the install command are rejected
+func enrollOptionsFlags(pkgType string, service deploy.ServiceRequest) ([]string, error) {
+	if service.InstallOptions.IsInstallOnly() {
+		return nil, fmt.Errorf("the %s installer does not support a custom base path or the unprivileged mode", pkgType)
+	}
+
+	return service.InstallOptions.EnrollFlags(), nil
+}
+
+// fleetFlags returns the flags to enroll a service into Fleet with the token, connecting to the Fleet Server
+// of its install options when present
+func fleetFlags(token string, service deploy.ServiceRequest) ([]string, error) {
+	cfg, err := kibana.NewFleetConfig(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if service.InstallOptions.FleetURL != "" {
+		err := cfg.SetFleetServerURL(service.InstallOptions.FleetURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cfg.CertificateAuthorities = service.InstallOptions.CertificateAuthorities
+
+	return cfg.Flags(), nil
+}
+
+// doUpgrade upgrade an elastic-agent package to a version using the 'upgrade' command. If the version
+// is empty, the version under test is used
+func doUpgrade(ctx context.Context, so deploy.ServiceOperator, version string) error {
 	pkgMetadata := so.PkgMetadata()
 
 	// downloading target release for the upgrade
-	version := common.ElasticAgentVersion
+	if version == "" {
+		version = common.ElasticAgentVersion
+	}
 
 	artifact := common.ElasticAgentServiceName
-	_, binaryPath, err := downloads.FetchElasticArtifactForSnapshots(ctx, false, artifact, version, pkgMetadata.Os, pkgMetadata.Arch, pkgMetadata.FileExtension, pkgMetadata.Docker, pkgMetadata.XPack)
+	binaryName, binaryPath, err := fetchElasticArtifact(ctx, false, artifact, version, pkgMetadata.Os, pkgMetadata.Arch, pkgMetadata.FileExtension, pkgMetadata.Docker, pkgMetadata.XPack)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"artifact":        artifact,
@@ -91,15 +198,18 @@ func doUpgrade(ctx context.Context, so deploy.ServiceOperator) error {
 		return err
 	}
 
+	if pkgMetadata.Os == "windows" {
+		binaryPath, err = windowsArtifactPath(ctx, so, binaryName, binaryPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	if downloads.SnapshotHasCommit(version) {
 		version = downloads.RemoveCommitFromSnapshot(version)
 	}
 
-	cmds := []string{"elastic-agent", "upgrade", version, "-v"}
-	if pkgMetadata.PackageType == "zip" {
-		cmds = []string{`C:\Program Files\Elastic\Agent\elastic-agent.exe`, "uninstall", version, "-v"}
-	}
-	cmds = append(cmds, "--source-uri", "file://"+binaryPath)
+	cmds := upgradeCmds(pkgMetadata, version, sourceURI(pkgMetadata, binaryPath))
 
 	span, _ := apm.StartSpanOptions(ctx, "Upgrading Elastic Agent", "elastic-agent."+pkgMetadata.PackageType+".upgrade", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
@@ -115,11 +225,66 @@ func doUpgrade(ctx context.Context, so deploy.ServiceOperator) error {
 	return nil
 }
 
+// doDiagnostics runs the 'diagnostics' command of the agent, copying the bundle out of the service
+// environment into the dst directory. It returns the local path to the bundle
+func doDiagnostics(ctx context.Context, so deploy.ServiceOperator, d deploy.Deployment, service deploy.ServiceRequest, dst string) (string, error) {
+	pkgMetadata := so.PkgMetadata()
+
+	bundle := "/tmp/" + diagnosticsBundle
+	cmds := []string{"elastic-agent", "diagnostics", "--file", bundle}
+	if pkgMetadata.Os == "windows" {
+		bundle = windowsPath("C:", diagnosticsBundle)
+		cmds = []string{windowsAgentBinary(pkgMetadata.AgentPath), "diagnostics", "--file", bundle}
+	}
+
+	span, _ := apm.StartSpanOptions(ctx, "Collecting Elastic Agent diagnostics", "elastic-agent."+pkgMetadata.PackageType+".diagnostics", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("arguments", cmds)
+	defer span.End()
+
+	_, err := so.Exec(ctx, cmds)
+	if err != nil {
+		return "", fmt.Errorf("failed to collect the diagnostics of the agent: %v", err)
+	}
+
+	err = d.CopyFrom(ctx, deploy.NewServiceRequest(common.FleetProfileName), service, bundle, dst)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy the diagnostics of the agent: %v", err)
+	}
+
+	log.WithFields(log.Fields{
+		"bundle": bundle,
+		"dst":    dst,
+	}).Debug("Diagnostics of the agent collected")
+
+	return filepath.Join(dst, diagnosticsBundle), nil
+}
+
+// upgradeCmds represents the command and arguments to upgrade an elastic-agent package to a version,
+// downloading the artifact from the source URI
+func upgradeCmds(pkgMetadata deploy.ServiceInstallerMetadata, version string, uri string) []string {
+	if pkgMetadata.Os == "windows" {
+		return []string{windowsAgentBinary(pkgMetadata.AgentPath), "upgrade", version, "-v", "--source-uri", uri}
+	}
+
+	return []string{"elastic-agent", "upgrade", version, "-v", "--source-uri", uri}
+}
+
+// sourceURI converts the path to an artifact in the service environment into a file URI
+func sourceURI(pkgMetadata deploy.ServiceInstallerMetadata, binaryPath string) string {
+	if pkgMetadata.Os == "windows" {
+		return windowsFileURI(binaryPath)
+	}
+
+	return "file://" + binaryPath
+}
+
 // createAgentDirectories makes sure the agent directories belong to the root user
 func createAgentDirectories(ctx context.Context, i deploy.ServiceOperator, osArgs []string) error {
 	agentPath := i.PkgMetadata().AgentPath
 
-	err := io.MkdirAll(agentPath)
+	err := mkdirAll(agentPath)
 	if err != nil {
 		return err
 	}
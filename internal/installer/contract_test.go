@@ -0,0 +1,435 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/cleanup"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/deploy/deploytest"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	"github.com/stretchr/testify/assert"
+)
+
+// installerContract represents the commands an installer must execute in the service environment for each
+// of the operations of the agent lifecycle. A nil list of commands means the operation executes nothing
+type installerContract struct {
+	attach    func(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator
+	install   [][]string // commands of the pre-install, install and post-install operations
+	files     [][]string // files added to the service environment by the install operations
+	dirs      []string   // directories created in the host by the install operations
+	images    []string   // Docker images tagged by the install operations
+	enroll    []string   // command executed before the enrollment flags
+	restart   [][]string
+	upgrade   []string
+	uninstall [][]string
+	bundle    string // path to the diagnostics bundle in the service environment
+}
+
+// fakeArtifact replaces the download of the artifacts for the duration of a test, returning a well-known binary
+func fakeArtifact(t *testing.T, binaryName string, binaryPath string) {
+	original := fetchElasticArtifact
+	t.Cleanup(func() {
+		fetchElasticArtifact = original
+	})
+
+	fetchElasticArtifact = func(ctx context.Context, useCISnapshots bool, artifact string, version string, os string, arch string, extension string, isDocker bool, xpack bool) (string, string, error) {
+		return binaryName, binaryPath, nil
+	}
+}
+
+// fakeHost represents the directories and Docker images the installers create in the host running the tests
+type fakeHost struct {
+	dirs   []string
+	images []string
+}
+
+// newFakeHost replaces the operations of the installers in the host for the duration of a test, recording them
+func newFakeHost(t *testing.T) *fakeHost {
+	h := &fakeHost{}
+
+	originalMkdirAll, originalRemoveAll := mkdirAll, removeAll
+	originalLoadImage, originalTagImage := loadImage, tagImage
+	t.Cleanup(func() {
+		mkdirAll, removeAll = originalMkdirAll, originalRemoveAll
+		loadImage, tagImage = originalLoadImage, originalTagImage
+	})
+
+	mkdirAll = func(path string) error {
+		h.dirs = append(h.dirs, path)
+		return nil
+	}
+	removeAll = func(path string) error { return nil }
+	loadImage = func(imagePath string) error { return nil }
+	tagImage = func(src string, targets ...string) error {
+		h.images = append(h.images, targets...)
+		return nil
+	}
+
+	return h
+}
+
+func enrollFlags(t *testing.T, token string) []string {
+	cfg, err := kibana.NewFleetConfig(token)
+	assert.Nil(t, err)
+
+	return cfg.Flags()
+}
+
+func Test_InstallerContracts(t *testing.T) {
+	ctx := context.Background()
+	service := deploy.NewServiceRequest("elastic-agent")
+
+	// the upgrade command does not accept the commit of a snapshot
+	version := downloads.RemoveCommitFromSnapshot(common.ElasticAgentVersion)
+	linuxUpgrade := []string{"elastic-agent", "upgrade", version, "-v", "--source-uri", "file:///tmp/elastic-agent"}
+
+	// the tar packages are extracted into the working directory, renaming the directory of the version
+	workDir := common.GetElasticAgentWorkingPath()
+	extract := func(os string, arch string) [][]string {
+		return [][]string{
+			{"tar", "-zxf", "/tmp/elastic-agent", "-C", workDir},
+			{"rm", "-fr", common.GetElasticAgentWorkingPath("elastic-agent")},
+			{"mv", "-f", common.GetElasticAgentWorkingPath("elastic-agent-" + downloads.GetSnapshotVersion(common.ElasticAgentVersion) + "-" + os + "-" + arch), common.GetElasticAgentWorkingPath("elastic-agent")},
+		}
+	}
+	arch := func(attach func(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator) string {
+		return attach(deploytest.New(), service).PkgMetadata().Arch
+	}
+
+	contracts := map[string]installerContract{
+		"tar": {
+			attach:    AttachElasticAgentTARPackage,
+			install:   append([][]string{{"sudo", "chown", "-R", "root:root", "/opt/Elastic/Agent"}}, extract("linux", arch(AttachElasticAgentTARPackage))...),
+			dirs:      []string{"/opt/Elastic/Agent"},
+			enroll:    []string{common.GetElasticAgentWorkingPath("elastic-agent", "elastic-agent"), "install"},
+			restart:   [][]string{{"systemctl", "restart", "elastic-agent"}},
+			upgrade:   linuxUpgrade,
+			uninstall: [][]string{{"/opt/Elastic/Agent/elastic-agent", "uninstall", "-f"}},
+			bundle:    "/tmp/elastic-agent-diagnostics.zip",
+		},
+		"tar-darwin": {
+			attach:    AttachElasticAgentTARDarwinPackage,
+			install:   append([][]string{{"sudo", "chown", "-R", "root:wheel", "/opt/Elastic/Agent"}}, extract("darwin", arch(AttachElasticAgentTARDarwinPackage))...),
+			dirs:      []string{"/opt/Elastic/Agent"},
+			enroll:    []string{"sudo", common.GetElasticAgentWorkingPath("elastic-agent", "elastic-agent"), "install"},
+			restart:   [][]string{{"launchctl", "stop", "elastic-agent"}, {"launchctl", "start", "elastic-agent"}},
+			upgrade:   linuxUpgrade,
+			uninstall: [][]string{{"sudo", "elastic-agent", "uninstall", "-f"}},
+			bundle:    "/tmp/elastic-agent-diagnostics.zip",
+		},
+		"deb": {
+			attach: AttachElasticAgentDEBPackage,
+			install: [][]string{
+				{"sudo", "chown", "-R", "root:root", "/var/lib/elastic-agent"},
+				{"apt", "install", "/elastic-agent", "-y"},
+				{"systemctl", "restart", "elastic-agent"},
+			},
+			files:     [][]string{{"/tmp/elastic-agent"}},
+			dirs:      []string{"/var/lib/elastic-agent"},
+			enroll:    []string{"elastic-agent", "enroll"},
+			restart:   [][]string{{"systemctl", "restart", "elastic-agent"}},
+			upgrade:   linuxUpgrade,
+			uninstall: [][]string{{"elastic-agent", "uninstall", "-f"}},
+			bundle:    "/tmp/elastic-agent-diagnostics.zip",
+		},
+		"rpm": {
+			attach: AttachElasticAgentRPMPackage,
+			install: [][]string{
+				{"sudo", "chown", "-R", "root:root", "/var/lib/elastic-agent"},
+				{"yum", "localinstall", "/elastic-agent", "-y"},
+				{"systemctl", "restart", "elastic-agent"},
+			},
+			files:     [][]string{{"/tmp/elastic-agent"}},
+			dirs:      []string{"/var/lib/elastic-agent"},
+			enroll:    []string{"elastic-agent", "enroll"},
+			restart:   [][]string{{"systemctl", "restart", "elastic-agent"}},
+			upgrade:   linuxUpgrade,
+			uninstall: [][]string{{"elastic-agent", "uninstall", "-f"}},
+			bundle:    "/tmp/elastic-agent-diagnostics.zip",
+		},
+		"docker": {
+			attach: AttachElasticAgentDockerPackage,
+			images: []string{
+				"docker.elastic.co/observability-ci/elastic-agent:" + downloads.GetSnapshotVersion(common.ElasticAgentVersion) + "-" + arch(AttachElasticAgentDockerPackage),
+				"docker.elastic.co/observability-ci/elastic-agent:" + downloads.GetFullVersion(common.ElasticAgentVersion) + "-" + arch(AttachElasticAgentDockerPackage),
+			},
+			restart:   [][]string{{"systemctl", "restart", "elastic-agent"}},
+			upgrade:   linuxUpgrade,
+			uninstall: [][]string{{"elastic-agent", "uninstall", "-f"}},
+			bundle:    "/tmp/elastic-agent-diagnostics.zip",
+		},
+		"zip": {
+			attach: AttachElasticAgentZIPPackage,
+			install: [][]string{
+				{"powershell.exe", "Test-Path", `C:\elastic-agent`},
+				{"powershell.exe", "Expand-Archive", "-Force", "-Path", `C:\elastic-agent.zip`, "-DestinationPath", `C:\`},
+				{"powershell.exe", "Move-Item", "-Force", "-Path", windowsPath("C:", "elastic-agent-"+downloads.GetSnapshotVersion(common.ElasticAgentVersion)+"-windows-x86_64"), "-Destination", `C:\elastic-agent`},
+			},
+			enroll:    []string{`C:\elastic-agent\elastic-agent.exe`, "install"},
+			restart:   [][]string{windowsServiceCmds("Restart")},
+			upgrade:   []string{windowsAgentBinary(windowsAgentInstallPath(service)), "upgrade", version, "-v", "--source-uri", "file:///C:/elastic-agent.zip"},
+			uninstall: [][]string{{windowsAgentBinary(windowsAgentInstallPath(service)), "uninstall", "-f"}},
+			bundle:    `C:\elastic-agent-diagnostics.zip`,
+		},
+		"msi": {
+			attach: AttachElasticAgentMSIPackage,
+			install: [][]string{
+				{"powershell.exe", "New-Item", "-ItemType", "Directory", "-Force", "-Path", `C:\elastic-agent`},
+				{"powershell.exe", "Copy-Item", "-Force", "-Path", `C:\elastic-agent.msi`, "-Destination", `C:\elastic-agent\elastic-agent.msi`},
+			},
+			enroll:    []string{"msiexec.exe", "/i", `C:\elastic-agent\elastic-agent.msi`, "/qn", "/norestart", "/l*v", `C:\elastic-agent\msiexec.log`},
+			restart:   [][]string{windowsServiceCmds("Restart")},
+			upgrade:   []string{windowsAgentBinary(windowsAgentInstallPath(service)), "upgrade", version, "-v", "--source-uri", "file:///C:/elastic-agent.msi"},
+			uninstall: [][]string{{"msiexec.exe", "/x", `C:\elastic-agent\elastic-agent.msi`, "/qn", "/norestart", "/l*v", `C:\elastic-agent\msiexec.log`}},
+			bundle:    `C:\elastic-agent-diagnostics.zip`,
+		},
+	}
+
+	for name, contract := range contracts {
+		contract := contract
+
+		t.Run(name, func(t *testing.T) {
+			stack := cleanup.NewStack(name)
+			defer stack.Finish(ctx)
+			ctx := cleanup.WithStack(ctx, stack)
+
+			host := newFakeHost(t)
+			d := deploytest.New().WithOutput("False", nil, "powershell.exe", "Test-Path")
+			i := contract.attach(d, service)
+			isWindows := i.PkgMetadata().Os == "windows"
+
+			if isWindows {
+				fakeArtifact(t, "elastic-agent."+i.PkgMetadata().FileExtension, "/tmp/elastic-agent")
+			} else {
+				fakeArtifact(t, "elastic-agent", "/tmp/elastic-agent")
+			}
+
+			t.Run("Install", func(t *testing.T) {
+				d.Reset()
+
+				assert.Nil(t, i.Preinstall(ctx))
+				assert.Nil(t, i.Install(ctx))
+				assert.Nil(t, i.Postinstall(ctx))
+				assertCommands(t, contract.install, d.Commands())
+				if !isWindows {
+					assert.ElementsMatch(t, contract.files, d.Files())
+				}
+				assert.Equal(t, contract.dirs, host.dirs)
+				assert.Equal(t, contract.images, host.images)
+			})
+
+			t.Run("Enroll", func(t *testing.T) {
+				d.Reset()
+
+				assert.Nil(t, i.Enroll(ctx, "token", "--tag=contract"))
+
+				cmds := d.Commands()
+				if contract.enroll == nil {
+					assert.Empty(t, cmds)
+					return
+				}
+
+				// the install subcommand registers the uninstall of the agent
+				assert.Equal(t, []string{"agent install " + service.Name}, stack.Pending())
+				assert.Len(t, cmds, 1)
+				assert.Equal(t, contract.enroll, cmds[0][:len(contract.enroll)])
+
+				args := cmds[0][len(contract.enroll):]
+				if name == "msi" {
+					// the MSI package receives the enrollment flags in a single property
+					assert.Len(t, args, 1)
+					assert.Contains(t, args[0], "--enrollment-token=token")
+					assert.Contains(t, args[0], "--tag=contract")
+					return
+				}
+				assert.Equal(t, append(enrollFlags(t, "token"), "--tag=contract"), args)
+			})
+
+			t.Run("Restart", func(t *testing.T) {
+				d.Reset()
+
+				assert.Nil(t, i.Restart(ctx))
+				assertCommands(t, contract.restart, d.Commands())
+			})
+
+			t.Run("Upgrade", func(t *testing.T) {
+				d.Reset()
+
+				assert.Nil(t, i.Upgrade(ctx, common.ElasticAgentVersion))
+				assertCommands(t, [][]string{contract.upgrade}, d.Commands())
+				if isWindows {
+					assert.Equal(t, [][]string{{"/tmp/elastic-agent"}}, d.Files())
+				}
+			})
+
+			t.Run("Diagnostics", func(t *testing.T) {
+				d.Reset()
+
+				bundle, err := i.Diagnostics(ctx, "/tmp/diagnostics")
+				assert.Nil(t, err)
+				assert.Equal(t, "/tmp/diagnostics/elastic-agent-diagnostics.zip", bundle)
+
+				binary := "elastic-agent"
+				if isWindows {
+					binary = windowsAgentBinary(windowsAgentInstallPath(service))
+				}
+				assertCommands(t, [][]string{{binary, "diagnostics", "--file", contract.bundle}}, d.Commands())
+				assert.Equal(t, [][]string{{contract.bundle, "/tmp/diagnostics"}}, d.Copies())
+			})
+
+			t.Run("Uninstall", func(t *testing.T) {
+				d.Reset()
+
+				assert.Nil(t, i.Uninstall(ctx))
+				assertCommands(t, contract.uninstall, d.Commands())
+				assert.Empty(t, stack.Pending())
+			})
+		})
+	}
+}
+
+func Test_InstallerContractErrors(t *testing.T) {
+	ctx := context.Background()
+	fakeArtifact(t, "elastic-agent", "/tmp/elastic-agent")
+
+	d := deploytest.New().
+		WithOutput("", errors.New("uninstall failed"), "elastic-agent", "uninstall").
+		WithOutput("", errors.New("upgrade failed"), "elastic-agent", "upgrade")
+	i := AttachElasticAgentDEBPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+	t.Run("Uninstall errors are reported", func(t *testing.T) {
+		err := i.Uninstall(ctx)
+		assert.ErrorContains(t, err, "uninstall failed")
+	})
+
+	t.Run("Upgrade errors are reported", func(t *testing.T) {
+		err := i.Upgrade(ctx, common.ElasticAgentVersion)
+		assert.ErrorContains(t, err, "upgrade failed")
+	})
+
+	t.Run("Fleet configuration errors are reported", func(t *testing.T) {
+		t.Setenv("ELASTICSEARCH_TIMEOUT", "forever")
+
+		err := i.Enroll(ctx, "token", "")
+		assert.ErrorContains(t, err, "invalid ELASTICSEARCH_TIMEOUT")
+	})
+}
+
+func Test_InstallerContractUpgradeVersion(t *testing.T) {
+	ctx := context.Background()
+	fakeArtifact(t, "elastic-agent", "/tmp/elastic-agent")
+
+	d := deploytest.New()
+	i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+	assert.Nil(t, i.Upgrade(ctx, "8.14.3"))
+	assert.Equal(t, [][]string{{"elastic-agent", "upgrade", "8.14.3", "-v", "--source-uri", "file:///tmp/elastic-agent"}}, d.Commands())
+}
+
+func Test_InstallerContractInstallOptions(t *testing.T) {
+	ctx := context.Background()
+	options := deploy.InstallOptions{
+		BasePath:     "/custom",
+		ProxyURL:     "http://proxy:3128",
+		Tags:         []string{"production"},
+		Unprivileged: true,
+	}
+	service := deploy.NewServiceRequest("elastic-agent").WithInstallOptions(options)
+
+	t.Run("Install command receives the options", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, service)
+
+		assert.Nil(t, i.Enroll(ctx, "token", ""))
+		assert.Equal(t, "/custom/Elastic/Agent", i.PkgMetadata().AgentPath)
+
+		cmds := d.Commands()
+		assert.Len(t, cmds, 1)
+		assert.Equal(t, options.Flags(), cmds[0][len(cmds[0])-len(options.Flags()):])
+	})
+
+	t.Run("Uninstall uses the custom base path", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, service)
+
+		assert.Nil(t, i.Uninstall(ctx))
+		assert.Equal(t, [][]string{{"/custom/Elastic/Agent/elastic-agent", "uninstall", "-f"}}, d.Commands())
+
+		manifest, _ := i.Inspect()
+		assert.Equal(t, "/custom/Elastic/Agent", manifest.WorkDir)
+	})
+
+	t.Run("Windows packages are installed under the custom base path", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent").WithInstallOptions(deploy.InstallOptions{BasePath: `D:\agents`}))
+
+		assert.Nil(t, i.Uninstall(ctx))
+		assert.Equal(t, [][]string{{`D:\agents\Elastic\Agent\elastic-agent.exe`, "uninstall", "-f"}}, d.Commands())
+	})
+
+	t.Run("Enroll command receives the enroll options only", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentRPMPackage(d, deploy.NewServiceRequest("elastic-agent").WithInstallOptions(deploy.InstallOptions{Tags: []string{"production"}}))
+
+		assert.Nil(t, i.Enroll(ctx, "token", ""))
+
+		cmds := d.Commands()
+		assert.Len(t, cmds, 1)
+		assert.Equal(t, "--tag=production", cmds[0][len(cmds[0])-1])
+	})
+
+	t.Run("Enroll command connects to the Fleet Server of the options", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentDEBPackage(d, deploy.NewServiceRequest("elastic-agent").WithInstallOptions(deploy.InstallOptions{
+			CertificateAuthorities: []string{"/fleet-server-ca.pem"},
+			FleetURL:               "https://fleet-server-lb:8220",
+		}))
+
+		assert.Nil(t, i.Enroll(ctx, "token", ""))
+
+		cmds := d.Commands()
+		assert.Len(t, cmds, 1)
+		assert.Equal(t, []string{"elastic-agent", "enroll", "--e", "--force", "--certificate-authorities=/fleet-server-ca.pem", "--enrollment-token=token", "--url", "https://fleet-server-lb:8220"}, cmds[0])
+	})
+
+	t.Run("Docker agents reject the Fleet Server of the options", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentDockerPackage(d, deploy.NewServiceRequest("elastic-agent").WithInstallOptions(deploy.InstallOptions{FleetURL: "https://fleet-server-lb:8220"}))
+
+		assert.Error(t, i.Enroll(ctx, "token", ""))
+	})
+
+	for name, attach := range map[string]func(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator{
+		"deb":    AttachElasticAgentDEBPackage,
+		"rpm":    AttachElasticAgentRPMPackage,
+		"docker": AttachElasticAgentDockerPackage,
+	} {
+		attach := attach
+
+		t.Run("Unsupported options are rejected by "+name, func(t *testing.T) {
+			d := deploytest.New()
+			i := attach(d, service)
+
+			assert.Error(t, i.Enroll(ctx, "token", ""))
+			assert.Empty(t, d.Commands())
+		})
+	}
+}
+
+func assertCommands(t *testing.T, expected [][]string, actual [][]string) {
+	t.Helper()
+
+	if expected == nil {
+		assert.Empty(t, actual)
+		return
+	}
+	assert.Equal(t, expected, actual)
+}
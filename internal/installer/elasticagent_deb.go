@@ -11,7 +11,6 @@ import (
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
-	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
@@ -88,8 +87,17 @@ func (i *elasticAgentDEBPackage) Enroll(ctx context.Context, token string, extra
 	span.Context.SetLabel("arguments", cmds)
 	defer span.End()
 
-	cfg, _ := kibana.NewFleetConfig(token)
-	cmds = append(cmds, cfg.Flags()...)
+	enrollFlags, err := enrollOptionsFlags("deb", i.service)
+	if err != nil {
+		return err
+	}
+
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	cmds = append(cmds, flags...)
+	cmds = append(cmds, enrollFlags...)
 	if extraFlags != "" {
 		cmds = append(cmds, extraFlags)
 	}
@@ -99,6 +107,8 @@ func (i *elasticAgentDEBPackage) Enroll(ctx context.Context, token string, extra
 	if err != nil {
 		return fmt.Errorf("failed to install the agent with subcommand: %v", err)
 	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
 	return nil
 }
 
@@ -158,7 +168,7 @@ func (i *elasticAgentDEBPackage) Preinstall(ctx context.Context) error {
 
 		metadata := i.metadata
 
-		binaryName, binaryPath, err := downloads.FetchElasticArtifactForSnapshots(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
+		binaryName, binaryPath, err := fetchElasticArtifact(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"artifact":        artifact,
@@ -254,10 +264,17 @@ func (i *elasticAgentDEBPackage) Uninstall(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall the agent with subcommand: %v", err)
 	}
+
+	i.forgetUninstalled(ctx)
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentDEBPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrade a DEB package
 func (i *elasticAgentDEBPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
 }
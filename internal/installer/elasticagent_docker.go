@@ -78,6 +78,10 @@ func (i *elasticAgentDockerPackage) Exec(ctx context.Context, args []string) (st
 
 // Enroll will enroll the agent into fleet
 func (i *elasticAgentDockerPackage) Enroll(ctx context.Context, token string, extraFlags string) error {
+	// the container enrolls the agent from its environment, so there is no command to pass the install options to
+	if len(i.service.InstallOptions.Flags()) > 0 || i.service.InstallOptions.HasFleetConnection() {
+		return fmt.Errorf("the docker installer does not support install options")
+	}
 	return nil
 }
 
@@ -108,7 +112,7 @@ func (i *elasticAgentDockerPackage) Preinstall(ctx context.Context) error {
 
 	metadata := i.metadata
 
-	_, binaryPath, err := downloads.FetchElasticArtifact(ctx, artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
+	_, binaryPath, err := fetchElasticArtifact(ctx, downloads.GithubCommitSha1 != "", artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"artifact":        artifact,
@@ -119,13 +123,13 @@ func (i *elasticAgentDockerPackage) Preinstall(ctx context.Context) error {
 		return err
 	}
 
-	err = deploy.LoadImage(binaryPath)
+	err = loadImage(binaryPath)
 	if err != nil {
 		return err
 	}
 
 	// we need to tag the loaded image because its tag relates to the target branch
-	return deploy.TagImage(
+	return tagImage(
 		fmt.Sprintf("docker.elastic.co/beats/%s:%s", artifact, downloads.GetSnapshotVersion(common.BeatVersionBase)),
 		fmt.Sprintf("docker.elastic.co/observability-ci/%s:%s-%s", artifact, downloads.GetSnapshotVersion(common.ElasticAgentVersion), metadata.Arch),
 		// tagging including git commit and snapshot
@@ -197,7 +201,12 @@ func (i *elasticAgentDockerPackage) Uninstall(ctx context.Context) error {
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentDockerPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrades a Docker package
 func (i *elasticAgentDockerPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
 }
@@ -0,0 +1,231 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// elasticAgentMSIPackage implements operations for a MSI installer
+type elasticAgentMSIPackage struct {
+	elasticAgentPackage
+}
+
+// AttachElasticAgentMSIPackage creates an instance for the MSI installer
+func AttachElasticAgentMSIPackage(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator {
+	return &elasticAgentMSIPackage{
+		elasticAgentPackage{
+			service: service,
+			deploy:  d,
+			metadata: deploy.ServiceInstallerMetadata{
+				AgentPath:     windowsAgentInstallPath(service),
+				PackageType:   "msi",
+				Os:            "windows",
+				Arch:          "x86_64",
+				FileExtension: "msi",
+				XPack:         true,
+				Docker:        false,
+			},
+		},
+	}
+}
+
+// msiPath the location of the MSI file in the Windows service environment. It's a well-known location
+// because the MSI file used for the install is needed to uninstall the package too
+func msiPath() string {
+	return windowsPath(windowsAgentWorkingPath, "elastic-agent.msi")
+}
+
+// msiLogPath the location of the verbose logs written by msiexec
+func msiLogPath() string {
+	return windowsPath(windowsAgentWorkingPath, "msiexec.log")
+}
+
+// AddFiles will add files into the service environment, default destination is C:\
+func (i *elasticAgentMSIPackage) AddFiles(ctx context.Context, files []string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Adding files to the Elastic Agent", "elastic-agent.msi.add-files", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("files", files)
+	defer span.End()
+
+	return i.deploy.AddFiles(ctx, deploy.NewServiceRequest(common.FleetProfileName), i.service, files)
+}
+
+// Inspect returns info on package
+func (i *elasticAgentMSIPackage) Inspect() (deploy.ServiceOperatorManifest, error) {
+	return deploy.ServiceOperatorManifest{
+		WorkDir:    i.metadata.AgentPath,
+		CommitFile: windowsPath(i.metadata.AgentPath, ".elastic-agent.active.commit"),
+	}, nil
+}
+
+// Install installs a MSI package
+func (i *elasticAgentMSIPackage) Install(ctx context.Context) error {
+	log.Trace("No MSI install instructions: the MSI package is installed at enrollment time")
+	return nil
+}
+
+// Exec will execute a command within the service environment
+func (i *elasticAgentMSIPackage) Exec(ctx context.Context, args []string) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Executing Elastic Agent command", "elastic-agent.msi.exec", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("arguments", args)
+	defer span.End()
+
+	output, err := i.deploy.ExecIn(ctx, deploy.NewServiceRequest(common.FleetProfileName), i.service, args)
+	return output, err
+}
+
+// Enroll will install the MSI package, enrolling the agent into fleet. The MSI package
+// passes the INSTALLARGS property to the 'elastic-agent install' command
+func (i *elasticAgentMSIPackage) Enroll(ctx context.Context, token string, extraFlags string) error {
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	installArgs := append(flags, i.service.InstallOptions.Flags()...)
+	if extraFlags != "" {
+		installArgs = append(installArgs, extraFlags)
+	}
+
+	cmds := []string{
+		"msiexec.exe", "/i", msiPath(), "/qn", "/norestart", "/l*v", msiLogPath(),
+		fmt.Sprintf(`INSTALLARGS="%s"`, strings.Join(installArgs, " ")),
+	}
+	span, _ := apm.StartSpanOptions(ctx, "Enrolling Elastic Agent with token", "elastic-agent.msi.enroll", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("arguments", cmds)
+	defer span.End()
+
+	_, err = i.Exec(ctx, cmds)
+	if err != nil {
+		return fmt.Errorf("failed to install the agent with msiexec: %v", err)
+	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
+	return nil
+}
+
+// InstallCerts installs the certificates for a MSI package
+func (i *elasticAgentMSIPackage) InstallCerts(ctx context.Context) error {
+	return nil
+}
+
+// Logs prints logs of service, including the logs of the msiexec command
+func (i *elasticAgentMSIPackage) Logs(ctx context.Context) error {
+	err := windowsLog(ctx, "msi", i.metadata.AgentPath, i.Exec)
+	if err != nil {
+		return err
+	}
+
+	logs, err := i.Exec(ctx, []string{"powershell.exe", "Get-Content", "-Path", msiLogPath(), "-Tail", fmt.Sprintf("%d", windowsLogsTail)})
+	if err != nil {
+		return err
+	}
+
+	// print logs as is, including tabs and line breaks
+	fmt.Println(logs)
+	return nil
+}
+
+// Postinstall executes operations after installing a MSI package
+func (i *elasticAgentMSIPackage) Postinstall(ctx context.Context) error {
+	return nil
+}
+
+// Preinstall downloads the MSI package, placing it in the well-known location of the Windows service environment
+func (i *elasticAgentMSIPackage) Preinstall(ctx context.Context) error {
+	span, _ := apm.StartSpanOptions(ctx, "Pre-install operations for the Elastic Agent", "elastic-agent.msi.pre-install", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	artifact := "elastic-agent"
+	metadata := i.metadata
+
+	binaryName, binaryPath, err := fetchElasticArtifact(ctx, downloads.UseElasticAgentCISnapshots(), artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"artifact":        artifact,
+			"version":         i.service.Version,
+			"packageMetadata": metadata,
+			"error":           err,
+		}).Error("Could not download the binary for the agent")
+		return err
+	}
+
+	srcPath, err := windowsArtifactPath(ctx, i, binaryName, binaryPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.Exec(ctx, []string{"powershell.exe", "New-Item", "-ItemType", "Directory", "-Force", "-Path", windowsAgentWorkingPath})
+	if err != nil {
+		return err
+	}
+
+	output, err := i.Exec(ctx, []string{"powershell.exe", "Copy-Item", "-Force", "-Path", srcPath, "-Destination", msiPath()})
+	if err != nil {
+		return err
+	}
+
+	log.WithField("output", output).Tracef("Copied MSI package to %s", msiPath())
+	return nil
+}
+
+// Restart will restart a service
+func (i *elasticAgentMSIPackage) Restart(ctx context.Context) error {
+	return windowsService(ctx, "msi", "Restart", i.Exec)
+}
+
+// Start will start a service
+func (i *elasticAgentMSIPackage) Start(ctx context.Context) error {
+	return windowsService(ctx, "msi", "Start", i.Exec)
+}
+
+// Stop will start a service
+func (i *elasticAgentMSIPackage) Stop(ctx context.Context) error {
+	return windowsService(ctx, "msi", "Stop", i.Exec)
+}
+
+// Uninstall uninstalls a MSI package. The 'elastic-agent uninstall' command is not
+// allowed for agents installed with a MSI package, so msiexec is used instead
+func (i *elasticAgentMSIPackage) Uninstall(ctx context.Context) error {
+	cmds := []string{"msiexec.exe", "/x", msiPath(), "/qn", "/norestart", "/l*v", msiLogPath()}
+	span, _ := apm.StartSpanOptions(ctx, "Uninstalling Elastic Agent", "elastic-agent.msi.uninstall", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("arguments", cmds)
+	defer span.End()
+
+	_, err := i.Exec(ctx, cmds)
+	if err != nil {
+		return fmt.Errorf("failed to uninstall the agent with msiexec: %v", err)
+	}
+
+	i.forgetUninstalled(ctx)
+	return nil
+}
+
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentMSIPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
+// Upgrade upgrades a MSI package
+func (i *elasticAgentMSIPackage) Upgrade(ctx context.Context, version string) error {
+	return doUpgrade(ctx, i, version)
+}
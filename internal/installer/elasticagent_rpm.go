@@ -11,7 +11,6 @@ import (
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
-	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
@@ -93,8 +92,17 @@ func (i *elasticAgentRPMPackage) Enroll(ctx context.Context, token string, extra
 	span.Context.SetLabel("arguments", cmds)
 	defer span.End()
 
-	cfg, _ := kibana.NewFleetConfig(token)
-	cmds = append(cmds, cfg.Flags()...)
+	enrollFlags, err := enrollOptionsFlags("rpm", i.service)
+	if err != nil {
+		return err
+	}
+
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	cmds = append(cmds, flags...)
+	cmds = append(cmds, enrollFlags...)
 	if extraFlags != "" {
 		cmds = append(cmds, extraFlags)
 	}
@@ -104,6 +112,8 @@ func (i *elasticAgentRPMPackage) Enroll(ctx context.Context, token string, extra
 	if err != nil {
 		return fmt.Errorf("failed to install the agent with subcommand: %v", err)
 	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
 	return nil
 }
 
@@ -164,7 +174,7 @@ func (i *elasticAgentRPMPackage) Preinstall(ctx context.Context) error {
 
 		metadata := i.metadata
 
-		binaryName, binaryPath, err := downloads.FetchElasticArtifactForSnapshots(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
+		binaryName, binaryPath, err := fetchElasticArtifact(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, metadata.Docker, metadata.XPack)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"artifact":        artifact,
@@ -259,10 +269,17 @@ func (i *elasticAgentRPMPackage) Uninstall(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall the agent with subcommand: %v", err)
 	}
+
+	i.forgetUninstalled(ctx)
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentRPMPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrades a RPM package
 func (i *elasticAgentRPMPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
 }
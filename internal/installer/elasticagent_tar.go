@@ -7,13 +7,12 @@ package installer
 import (
 	"context"
 	"fmt"
-	"os"
+	"path"
 	"strings"
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/io"
-	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
@@ -37,7 +36,7 @@ func AttachElasticAgentTARPackage(d deploy.Deployment, service deploy.ServiceReq
 			service: service,
 			deploy:  d,
 			metadata: deploy.ServiceInstallerMetadata{
-				AgentPath:     "/opt/Elastic/Agent",
+				AgentPath:     agentInstallPath(service, "/opt"),
 				PackageType:   "tar",
 				Os:            "linux",
 				Arch:          arch,
@@ -95,16 +94,22 @@ func (i *elasticAgentTARPackage) Enroll(ctx context.Context, token string, extra
 	span.Context.SetLabel("arguments", cmds)
 	defer span.End()
 
-	cfg, _ := kibana.NewFleetConfig(token)
-	cmds = append(cmds, cfg.Flags()...)
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	cmds = append(cmds, flags...)
+	cmds = append(cmds, i.service.InstallOptions.Flags()...)
 	if extraFlags != "" {
 		cmds = append(cmds, extraFlags)
 	}
 
-	_, err := i.Exec(ctx, cmds)
+	_, err = i.Exec(ctx, cmds)
 	if err != nil {
 		return fmt.Errorf("failed to install the agent with subcommand: %v", err)
 	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
 	return nil
 }
 
@@ -139,7 +144,7 @@ func (i *elasticAgentTARPackage) Preinstall(ctx context.Context) error {
 
 		found, err := io.Exists(artifact)
 		if found && err == nil {
-			err = os.RemoveAll(artifact)
+			err = removeAll(artifact)
 			if err != nil {
 				log.Fatal("Could not remove artifact directory for reinitialization.")
 			}
@@ -148,7 +153,7 @@ func (i *elasticAgentTARPackage) Preinstall(ctx context.Context) error {
 
 		metadata := i.metadata
 
-		_, binaryPath, err := downloads.FetchElasticArtifactForSnapshots(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
+		_, binaryPath, err := fetchElasticArtifact(ctx, useCISnapshots, artifact, version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"artifact":        artifact,
@@ -164,19 +169,7 @@ func (i *elasticAgentTARPackage) Preinstall(ctx context.Context) error {
 			return err
 		}
 
-		if downloads.IsAlias(version) {
-			v, err := downloads.GetElasticArtifactVersion(version)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"error":   err,
-					"version": version,
-				}).Warn("Failed to get the version, keeping current version")
-			} else {
-				version = v
-			}
-		}
-
-		srcPath := common.GetElasticAgentWorkingPath(fmt.Sprintf("%s-%s-%s-%s", artifact, downloads.GetSnapshotVersion(version), metadata.Os, metadata.Arch))
+		srcPath := common.GetElasticAgentWorkingPath(extractedDirName(artifact, version, metadata))
 		_, _ = i.Exec(ctx, []string{"rm", "-fr", common.GetElasticAgentWorkingPath(artifact)})
 		output, _ := i.Exec(ctx, []string{"mv", "-f", srcPath, common.GetElasticAgentWorkingPath(artifact)})
 		log.WithFields(log.Fields{
@@ -250,7 +243,7 @@ func (i *elasticAgentTARPackage) Stop(ctx context.Context) error {
 
 // Uninstall uninstalls a TAR package
 func (i *elasticAgentTARPackage) Uninstall(ctx context.Context) error {
-	cmds := []string{"/opt/Elastic/Agent/elastic-agent", "uninstall", "-f"}
+	cmds := []string{path.Join(i.metadata.AgentPath, common.ElasticAgentProcessName), "uninstall", "-f"}
 	span, _ := apm.StartSpanOptions(ctx, "Uninstalling Elastic Agent", "elastic-agent.tar.uninstall", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
@@ -260,10 +253,17 @@ func (i *elasticAgentTARPackage) Uninstall(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall the agent with subcommand: %v", err)
 	}
+
+	i.forgetUninstalled(ctx)
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentTARPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrades a TAR package
 func (i *elasticAgentTARPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
 }
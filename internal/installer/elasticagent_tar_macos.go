@@ -7,13 +7,11 @@ package installer
 import (
 	"context"
 	"fmt"
-	"os"
 	"runtime"
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/io"
-	"github.com/elastic/e2e-testing/internal/kibana"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
@@ -37,7 +35,7 @@ func AttachElasticAgentTARDarwinPackage(d deploy.Deployment, service deploy.Serv
 			service: service,
 			deploy:  d,
 			metadata: deploy.ServiceInstallerMetadata{
-				AgentPath:     "/opt/Elastic/Agent",
+				AgentPath:     agentInstallPath(service, "/opt"),
 				PackageType:   "tar",
 				Os:            "darwin",
 				Arch:          arch,
@@ -91,16 +89,22 @@ func (i *elasticAgentTARDarwinPackage) Enroll(ctx context.Context, token string,
 	span.Context.SetLabel("runtime", runtime.GOOS)
 	defer span.End()
 
-	cfg, _ := kibana.NewFleetConfig(token)
-	cmds = append(cmds, cfg.Flags()...)
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	cmds = append(cmds, flags...)
+	cmds = append(cmds, i.service.InstallOptions.Flags()...)
 	if extraFlags != "" {
 		cmds = append(cmds, extraFlags)
 	}
 
-	_, err := i.Exec(ctx, cmds)
+	_, err = i.Exec(ctx, cmds)
 	if err != nil {
 		return fmt.Errorf("failed to install the agent with subcommand: %v", err)
 	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
 	return nil
 }
 
@@ -137,7 +141,7 @@ func (i *elasticAgentTARDarwinPackage) Preinstall(ctx context.Context) error {
 	// Idempotence: so no previous executions interfers with the current execution
 	found, err := io.Exists(common.GetElasticAgentWorkingPath("elastic-agent"))
 	if found && err == nil {
-		err = os.RemoveAll(common.GetElasticAgentWorkingPath("elastic-agent"))
+		err = removeAll(common.GetElasticAgentWorkingPath("elastic-agent"))
 		if err != nil {
 			log.Fatal("Could not remove elastic-agent.")
 		}
@@ -148,7 +152,7 @@ func (i *elasticAgentTARDarwinPackage) Preinstall(ctx context.Context) error {
 
 	metadata := i.metadata
 
-	_, binaryPath, err := downloads.FetchElasticArtifact(ctx, artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
+	_, binaryPath, err := fetchElasticArtifact(ctx, downloads.UseElasticAgentCISnapshots(), artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"artifact":        artifact,
@@ -164,20 +168,8 @@ func (i *elasticAgentTARDarwinPackage) Preinstall(ctx context.Context) error {
 		return err
 	}
 
-	version := common.ElasticAgentVersion
-	if downloads.IsAlias(version) {
-		v, err := downloads.GetElasticArtifactVersion(version)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error":   err,
-				"version": version,
-			}).Warn("Failed to get the version, keeping current version")
-		} else {
-			version = v
-		}
-	}
-
-	srcPath := common.GetElasticAgentWorkingPath(fmt.Sprintf("%s-%s-%s-%s", artifact, downloads.GetSnapshotVersion(version), metadata.Os, metadata.Arch))
+	// the archive of the version of the service is extracted, which is not the version under test when upgrading
+	srcPath := common.GetElasticAgentWorkingPath(extractedDirName(artifact, i.service.Version, metadata))
 	_, _ = i.Exec(ctx, []string{"rm", "-fr", common.GetElasticAgentWorkingPath("elastic-agent")})
 	output, _ := i.Exec(ctx, []string{"mv", "-f", srcPath, common.GetElasticAgentWorkingPath("elastic-agent")})
 	log.WithField("output", output).Trace("Moved elastic-agent")
@@ -240,10 +232,17 @@ func (i *elasticAgentTARDarwinPackage) Uninstall(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall the agent with subcommand: %v", err)
 	}
+
+	i.forgetUninstalled(ctx)
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentTARDarwinPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrades a TAR package
 func (i *elasticAgentTARDarwinPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
 }
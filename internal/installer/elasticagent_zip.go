@@ -15,7 +15,7 @@ import (
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
-	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/process"
 	"github.com/elastic/e2e-testing/pkg/downloads"
 	log "github.com/sirupsen/logrus"
 	"go.elastic.co/apm/v2"
@@ -33,7 +33,7 @@ func AttachElasticAgentZIPPackage(d deploy.Deployment, service deploy.ServiceReq
 			service: service,
 			deploy:  d,
 			metadata: deploy.ServiceInstallerMetadata{
-				AgentPath:     `C:\Program Files\Elastic\Agent`,
+				AgentPath:     windowsAgentInstallPath(service),
 				PackageType:   "zip",
 				Os:            "windows",
 				Arch:          "x86_64",
@@ -45,16 +45,22 @@ func AttachElasticAgentZIPPackage(d deploy.Deployment, service deploy.ServiceReq
 	}
 }
 
-// AddFiles will add files into the service environment, default destination is /
+// AddFiles will add files into the service environment, default destination is C:\
 func (i *elasticAgentZIPPackage) AddFiles(ctx context.Context, files []string) error {
-	return nil
+	span, _ := apm.StartSpanOptions(ctx, "Adding files to the Elastic Agent", "elastic-agent.zip.add-files", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("files", files)
+	defer span.End()
+
+	return i.deploy.AddFiles(ctx, deploy.NewServiceRequest(common.FleetProfileName), i.service, files)
 }
 
 // Inspect returns info on package
 func (i *elasticAgentZIPPackage) Inspect() (deploy.ServiceOperatorManifest, error) {
 	return deploy.ServiceOperatorManifest{
 		WorkDir:    i.metadata.AgentPath,
-		CommitFile: `C:\elastic-agent\.elastic-agent.active.commit`,
+		CommitFile: windowsPath(windowsAgentWorkingPath, ".elastic-agent.active.commit"),
 	}, nil
 }
 
@@ -78,23 +84,29 @@ func (i *elasticAgentZIPPackage) Exec(ctx context.Context, args []string) (strin
 
 // Enroll will enroll the agent into fleet
 func (i *elasticAgentZIPPackage) Enroll(ctx context.Context, token string, extraFlags string) error {
-	cmds := []string{`C:\elastic-agent\elastic-agent.exe`, "install"}
+	cmds := []string{windowsPath(windowsAgentWorkingPath, process.WindowsExecutable(common.ElasticAgentProcessName)), "install"}
 	span, _ := apm.StartSpanOptions(ctx, "Enrolling Elastic Agent with token", "elastic-agent.zip.enroll", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
 	span.Context.SetLabel("arguments", cmds)
 	defer span.End()
 
-	cfg, _ := kibana.NewFleetConfig(token)
-	cmds = append(cmds, cfg.Flags()...)
+	flags, err := fleetFlags(token, i.service)
+	if err != nil {
+		return err
+	}
+	cmds = append(cmds, flags...)
+	cmds = append(cmds, i.service.InstallOptions.Flags()...)
 	if extraFlags != "" {
 		cmds = append(cmds, extraFlags)
 	}
 
-	_, err := i.Exec(ctx, cmds)
+	_, err = i.Exec(ctx, cmds)
 	if err != nil {
 		return fmt.Errorf("failed to install the agent with subcommand: %v", err)
 	}
+
+	i.uninstallOnCleanup(ctx, i.Uninstall)
 	return nil
 }
 
@@ -105,9 +117,7 @@ func (i *elasticAgentZIPPackage) InstallCerts(ctx context.Context) error {
 
 // Logs prints logs of service
 func (i *elasticAgentZIPPackage) Logs(ctx context.Context) error {
-	// TODO: we need to find a way to read Winidows logs for the service
-	// or we could read "C:\Program Files\Elastic\Agent\data\elastic-agent-*\logs\elastic-agent-json.log*"
-	return i.deploy.Logs(ctx, i.service)
+	return windowsLog(ctx, "zip", i.metadata.AgentPath, i.Exec)
 }
 
 // Postinstall executes operations after installing a ZIP package
@@ -125,7 +135,7 @@ func (i *elasticAgentZIPPackage) Preinstall(ctx context.Context) error {
 	artifact := "elastic-agent"
 	metadata := i.metadata
 
-	_, binaryPath, err := downloads.FetchElasticArtifact(ctx, artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
+	binaryName, binaryPath, err := fetchElasticArtifact(ctx, downloads.UseElasticAgentCISnapshots(), artifact, i.service.Version, metadata.Os, metadata.Arch, metadata.FileExtension, false, true)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"artifact":        artifact,
@@ -136,14 +146,14 @@ func (i *elasticAgentZIPPackage) Preinstall(ctx context.Context) error {
 		return err
 	}
 
-	output, err := i.Exec(ctx, []string{"powershell.exe", "Test-Path", `C:\elastic-agent`})
+	output, err := i.Exec(ctx, []string{"powershell.exe", "Test-Path", windowsAgentWorkingPath})
 	log.WithFields(log.Fields{
 		"output": output,
 		"error":  err,
 	}).Trace("Checking for existence of elastic-agent installation directory")
 
 	if !strings.EqualFold(strings.TrimSpace(output), "false") {
-		_, err = i.Exec(ctx, []string{"powershell.exe", "Remove-Item", `C:\elastic-agent`, "-Recurse", "-Force"})
+		_, err = i.Exec(ctx, []string{"powershell.exe", "Remove-Item", windowsAgentWorkingPath, "-Recurse", "-Force"})
 		if err != nil {
 			return err
 		}
@@ -153,7 +163,12 @@ func (i *elasticAgentZIPPackage) Preinstall(ctx context.Context) error {
 		}).Trace("Elastic-agent installation directory existed: was removed")
 	}
 
-	err = extractZIPFile(binaryPath, `C:\`)
+	if common.Provider == "remote" {
+		// the tests run on the Windows host, so the zip file can be extracted in place
+		err = extractZIPFile(binaryPath, `C:\`)
+	} else {
+		err = i.expandArchive(ctx, binaryName, binaryPath)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -161,33 +176,35 @@ func (i *elasticAgentZIPPackage) Preinstall(ctx context.Context) error {
 		return err
 	}
 
-	output, err = i.Exec(ctx, []string{"powershell.exe", "Move-Item", "-Force", "-Path", fmt.Sprintf(`C:\%s-%s-%s-%s`, artifact, downloads.GetSnapshotVersion(common.ElasticAgentVersion), metadata.Os, metadata.Arch), "-Destination", `C:\elastic-agent`})
+	// the archive of the version of the service is extracted, which is not the version under test when upgrading
+	srcPath := windowsPath("C:", extractedDirName(artifact, i.service.Version, metadata))
+	output, err = i.Exec(ctx, []string{"powershell.exe", "Move-Item", "-Force", "-Path", srcPath, "-Destination", windowsAgentWorkingPath})
 	if err != nil {
 		return err
 	}
 
-	log.WithField("output", output).Trace(`Moved elastic-agent to C:\elastic-agent`)
+	log.WithField("output", output).Tracef("Moved elastic-agent to %s", windowsAgentWorkingPath)
 	return nil
 }
 
 // Restart will restart a service
 func (i *elasticAgentZIPPackage) Restart(ctx context.Context) error {
-	return nil
+	return windowsService(ctx, "zip", "Restart", i.Exec)
 }
 
 // Start will start a service
 func (i *elasticAgentZIPPackage) Start(ctx context.Context) error {
-	return nil
+	return windowsService(ctx, "zip", "Start", i.Exec)
 }
 
 // Stop will start a service
 func (i *elasticAgentZIPPackage) Stop(ctx context.Context) error {
-	return nil
+	return windowsService(ctx, "zip", "Stop", i.Exec)
 }
 
 // Uninstall uninstalls a EXE package
 func (i *elasticAgentZIPPackage) Uninstall(ctx context.Context) error {
-	cmds := []string{`C:\Program Files\Elastic\Agent\elastic-agent.exe`, "uninstall", "-f"}
+	cmds := []string{windowsAgentBinary(i.metadata.AgentPath), "uninstall", "-f"}
 	span, _ := apm.StartSpanOptions(ctx, "Uninstalling Elastic Agent", "elastic-agent.zip.uninstall", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
@@ -197,12 +214,30 @@ func (i *elasticAgentZIPPackage) Uninstall(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to uninstall the agent with subcommand: %v", err)
 	}
+
+	i.forgetUninstalled(ctx)
 	return nil
 }
 
+// Diagnostics collects the diagnostics bundle of the agent into a local directory
+func (i *elasticAgentZIPPackage) Diagnostics(ctx context.Context, dst string) (string, error) {
+	return doDiagnostics(ctx, i, i.deploy, i.service, dst)
+}
+
 // Upgrade upgrades a EXE package
 func (i *elasticAgentZIPPackage) Upgrade(ctx context.Context, version string) error {
-	return doUpgrade(ctx, i)
+	return doUpgrade(ctx, i, version)
+}
+
+// expandArchive copies the zip file into the Windows service environment, extracting it at C:\
+func (i *elasticAgentZIPPackage) expandArchive(ctx context.Context, binaryName string, binaryPath string) error {
+	archivePath, err := windowsArtifactPath(ctx, i, binaryName, binaryPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.Exec(ctx, []string{"powershell.exe", "Expand-Archive", "-Force", "-Path", archivePath, "-DestinationPath", `C:\`})
+	return err
 }
 
 func extractZIPFile(src string, target string) error {
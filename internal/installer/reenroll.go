@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// Reenroll enrolls an installed agent again using the 'enroll' command with --force, so that it moves to the
+// policy of the enrollment token without being installed again. The host keeps the agent of its previous
+// enrollment in Fleet, until it becomes inactive
+func Reenroll(ctx context.Context, so deploy.ServiceOperator, service deploy.ServiceRequest, token string) error {
+	pkgMetadata := so.PkgMetadata()
+
+	span, _ := apm.StartSpanOptions(ctx, "Re-enrolling Elastic Agent with token", "elastic-agent."+pkgMetadata.PackageType+".reenroll", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	// the containers enroll when they start, with the token of their environment
+	if pkgMetadata.Docker {
+		return fmt.Errorf("the %s agents cannot be re-enrolled, they must be deployed again", pkgMetadata.PackageType)
+	}
+
+	flags, err := fleetFlags(token, service)
+	if err != nil {
+		return err
+	}
+
+	cmds := append(reenrollCmds(pkgMetadata), flags...)
+	span.Context.SetLabel("arguments", cmds)
+
+	_, err = so.Exec(ctx, cmds)
+	if err != nil {
+		return fmt.Errorf("failed to re-enroll the agent: %v", err)
+	}
+
+	log.WithFields(log.Fields{
+		"installer": pkgMetadata.PackageType,
+	}).Debug("Agent re-enrolled")
+	return nil
+}
+
+// reenrollCmds represents the command of an installed agent to enroll again, before the enrollment flags
+func reenrollCmds(pkgMetadata deploy.ServiceInstallerMetadata) []string {
+	if pkgMetadata.Os == "windows" {
+		return []string{windowsAgentBinary(pkgMetadata.AgentPath), "enroll"}
+	}
+	return []string{"elastic-agent", "enroll"}
+}
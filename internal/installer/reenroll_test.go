@@ -0,0 +1,56 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/deploy/deploytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Reenroll(t *testing.T) {
+	ctx := context.Background()
+	service := deploy.NewServiceRequest("elastic-agent")
+
+	t.Run("Installed agents are enrolled with --force", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, service)
+
+		assert.Nil(t, Reenroll(ctx, i, service, "other-token"))
+		assert.Equal(t, [][]string{
+			append([]string{"elastic-agent", "enroll"}, enrollFlags(t, "other-token")...),
+		}, d.Commands())
+	})
+
+	t.Run("Windows agents are enrolled with their binary", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, service)
+
+		assert.Nil(t, Reenroll(ctx, i, service, "other-token"))
+		assert.Equal(t, [][]string{
+			append([]string{windowsAgentBinary(i.PkgMetadata().AgentPath), "enroll"}, enrollFlags(t, "other-token")...),
+		}, d.Commands())
+	})
+
+	t.Run("Docker agents cannot be re-enrolled", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentDockerPackage(d, service)
+
+		assert.Error(t, Reenroll(ctx, i, service, "other-token"))
+		assert.Empty(t, d.Commands())
+	})
+
+	t.Run("Errors of the enroll command are reported", func(t *testing.T) {
+		d := deploytest.New().WithOutput("", errors.New("fail to enroll: invalid enrollment token"), "elastic-agent", "enroll")
+		i := AttachElasticAgentTARPackage(d, service)
+
+		err := Reenroll(ctx, i, service, "revoked-token")
+		assert.ErrorContains(t, err, "invalid enrollment token")
+	})
+}
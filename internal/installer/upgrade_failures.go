@@ -0,0 +1,235 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// UpgradeFailure represents a failure injected into the upgrade of an elastic-agent package
+type UpgradeFailure string
+
+const (
+	// CorruptedSource the upgrade is served an artifact with random content
+	CorruptedSource UpgradeFailure = "corrupted source"
+	// KilledUpgrade the upgraded agent is killed while the upgrade is being watched, so it never becomes healthy
+	KilledUpgrade UpgradeFailure = "killed upgrade"
+	// UnreachableSource the upgrade is served from a host that does not exist
+	UnreachableSource UpgradeFailure = "unreachable source"
+)
+
+const (
+	// corruptedSourcePath the directory in the service environment where the corrupted artifacts are written
+	corruptedSourcePath = "/tmp/corrupted-source"
+
+	// killedUpgradeAttempts number of times the upgraded agent is killed, one per second, so that the
+	// watcher of the upgrade detects that it's crashing
+	killedUpgradeAttempts = 30
+
+	// unreachableSourceURI a source URI that cannot be resolved, as the .invalid TLD is reserved
+	unreachableSourceURI = "https://artifacts.elastic.invalid/downloads/"
+)
+
+// UpgradeCommandError represents the failure of the 'upgrade' command caused by the injected failure, which is
+// the expected outcome of the upgrade. Any other error of the upgrade with failure means that the failure could
+// not be injected
+type UpgradeCommandError struct {
+	Failure UpgradeFailure
+	Err     error
+}
+
+// Error returns the message of the error, including the injected failure
+func (e *UpgradeCommandError) Error() string {
+	return fmt.Sprintf("the upgrade command failed with a %s: %v", e.Failure, e.Err)
+}
+
+// Unwrap returns the error of the upgrade command
+func (e *UpgradeCommandError) Unwrap() error {
+	return e.Err
+}
+
+// IsUpgradeCommandError returns true if the error is the failure of the 'upgrade' command caused by the injected failure
+func IsUpgradeCommandError(err error) bool {
+	var cmdErr *UpgradeCommandError
+	return errors.As(err, &cmdErr)
+}
+
+// ParseUpgradeFailure returns the upgrade failure represented by a string
+func ParseUpgradeFailure(failure string) (UpgradeFailure, error) {
+	switch f := UpgradeFailure(failure); f {
+	case CorruptedSource, KilledUpgrade, UnreachableSource:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("unsupported upgrade failure %s: use %s, %s or %s", failure, CorruptedSource, KilledUpgrade, UnreachableSource)
+}
+
+// UpgradeWithFailure upgrades an elastic-agent package to a version using the 'upgrade' command, injecting a failure
+// into the upgrade. The error of the command is returned as an UpgradeCommandError, although the upgrade can also fail
+// after the command exits, which is reported by the agent to Fleet
+func UpgradeWithFailure(ctx context.Context, so deploy.ServiceOperator, version string, failure UpgradeFailure) error {
+	span, _ := apm.StartSpanOptions(ctx, "Upgrading Elastic Agent with failure", "elastic-agent."+so.PkgMetadata().PackageType+".upgrade-with-failure", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("failure", failure)
+	span.Context.SetLabel("version", version)
+	defer span.End()
+
+	if version == "" {
+		version = common.ElasticAgentVersion
+	}
+
+	switch failure {
+	case CorruptedSource:
+		return upgradeFromCorruptedSource(ctx, so, version)
+	case KilledUpgrade:
+		err := doUpgrade(ctx, so, version)
+		if err != nil {
+			return err
+		}
+		return killUpgradedAgent(ctx, so)
+	case UnreachableSource:
+		_, err := so.Exec(ctx, upgradeCmds(so.PkgMetadata(), downloads.RemoveCommitFromSnapshot(version), unreachableSourceURI))
+		if err != nil {
+			return &UpgradeCommandError{Failure: failure, Err: err}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported upgrade failure %s", failure)
+}
+
+// upgradeFromCorruptedSource writes an artifact with random content in the service environment,
+// using the name of the expected artifact, and upgrades the agent using it as source
+func upgradeFromCorruptedSource(ctx context.Context, so deploy.ServiceOperator, version string) error {
+	pkgMetadata := so.PkgMetadata()
+	artifactName := downloads.GetArtifactName(common.ElasticAgentServiceName, version, pkgMetadata.Os, pkgMetadata.Arch, pkgMetadata.FileExtension, pkgMetadata.Docker)
+
+	var artifactPath string
+	var cmds []string
+	if pkgMetadata.Os == "windows" {
+		artifactPath = windowsPath(windowsAgentWorkingPath, "corrupted-source", artifactName)
+		cmds = windowsCorruptedArtifactCmds(artifactPath)
+	} else {
+		artifactPath = path.Join(corruptedSourcePath, artifactName)
+		cmds = corruptedArtifactCmds(artifactPath)
+	}
+
+	_, err := so.Exec(ctx, cmds)
+	if err != nil {
+		return fmt.Errorf("could not write the corrupted artifact %s: %w", artifactPath, err)
+	}
+
+	log.WithFields(log.Fields{
+		"artifact": artifactPath,
+		"version":  version,
+	}).Debug("Upgrading the agent from a corrupted artifact")
+
+	_, err = so.Exec(ctx, upgradeCmds(pkgMetadata, downloads.RemoveCommitFromSnapshot(version), sourceURI(pkgMetadata, artifactPath)))
+	if err != nil {
+		return &UpgradeCommandError{Failure: CorruptedSource, Err: err}
+	}
+	return nil
+}
+
+// corruptedArtifactCmds represents the command and arguments to write an artifact with random content
+func corruptedArtifactCmds(artifactPath string) []string {
+	return []string{"sh", "-c", fmt.Sprintf("mkdir -p %s && head -c 1048576 /dev/urandom > %s", path.Dir(artifactPath), artifactPath)}
+}
+
+// windowsCorruptedArtifactCmds represents the command and arguments to write an artifact with random content on Windows
+func windowsCorruptedArtifactCmds(artifactPath string) []string {
+	dir := artifactPath[:strings.LastIndex(artifactPath, `\`)]
+	return []string{
+		"powershell.exe", "New-Item", "-ItemType", "Directory", "-Force", "-Path", fmt.Sprintf("'%s'", dir), "|", "Out-Null", ";",
+		"$bytes", "=", "New-Object", "byte[]", "1048576", ";",
+		"(New-Object", "System.Random).NextBytes($bytes)", ";",
+		"[System.IO.File]::WriteAllBytes(", fmt.Sprintf("'%s'", artifactPath), ",", "$bytes)",
+	}
+}
+
+// killUpgradedAgent waits for the upgrade marker of the agent, which is written before the upgraded agent
+// is started, and then kills the agent repeatedly, so that the watcher of the upgrade rolls it back
+func killUpgradedAgent(ctx context.Context, so deploy.ServiceOperator) error {
+	pkgMetadata := so.PkgMetadata()
+
+	markerCmds := upgradeMarkerCmds(pkgMetadata)
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute
+	exp := utils.GetExponentialBackOff(maxTimeout)
+	retryCount := 1
+
+	markerFn := func() error {
+		output, err := so.Exec(ctx, markerCmds)
+		if err != nil || !strings.EqualFold(strings.TrimSpace(output), "true") {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"output":      output,
+				"retry":       retryCount,
+			}).Trace("The upgrade marker is not present yet")
+			retryCount++
+			return fmt.Errorf("the upgrade marker is not present")
+		}
+		return nil
+	}
+
+	err := backoff.Retry(markerFn, exp)
+	if err != nil {
+		return fmt.Errorf("the upgrade marker was not present after %s: %w", exp.GetElapsedTime(), err)
+	}
+
+	_, err = so.Exec(ctx, killAgentCmds(pkgMetadata, killedUpgradeAttempts))
+	if err != nil {
+		return fmt.Errorf("could not kill the upgraded agent: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"attempts": killedUpgradeAttempts,
+	}).Debug("The upgraded agent was killed")
+	return nil
+}
+
+// upgradeMarkerCmds represents the command and arguments to check if the upgrade marker exists,
+// printing true or false
+func upgradeMarkerCmds(pkgMetadata deploy.ServiceInstallerMetadata) []string {
+	if pkgMetadata.Os == "windows" {
+		return []string{"powershell.exe", "Test-Path", fmt.Sprintf("'%s'", windowsPath(pkgMetadata.AgentPath, "data", ".update-marker"))}
+	}
+
+	marker := path.Join(pkgMetadata.AgentPath, "data", ".update-marker")
+	return []string{"sh", "-c", fmt.Sprintf("test -f %s && echo true || echo false", marker)}
+}
+
+// killAgentCmds represents the command and arguments to kill the agent processes, but the watcher,
+// once per second during the given number of attempts
+func killAgentCmds(pkgMetadata deploy.ServiceInstallerMetadata, attempts int) []string {
+	if pkgMetadata.Os == "windows" {
+		return []string{
+			"powershell.exe", "for", "($i", "=", "0;", "$i", "-lt", fmt.Sprintf("%d;", attempts), "$i++)", "{",
+			"Get-CimInstance", "Win32_Process", "-Filter", "\"Name='elastic-agent.exe'\"", "|",
+			"Where-Object", "{", "$_.CommandLine", "-notlike", "'*watch*'", "}", "|",
+			"ForEach-Object", "{", "Stop-Process", "-Id", "$_.ProcessId", "-Force", "}", ";",
+			"Start-Sleep", "-Seconds", "1", "}",
+		}
+	}
+
+	script := fmt.Sprintf(
+		"for i in $(seq %d); do for pid in $(pgrep -x %s); do ps -o args= -p $pid | grep -q watch || kill -9 $pid; done; sleep 1; done",
+		attempts, common.ElasticAgentProcessName)
+	return []string{"sh", "-c", script}
+}
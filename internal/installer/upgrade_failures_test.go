@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/deploy/deploytest"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseUpgradeFailure(t *testing.T) {
+	failure, err := ParseUpgradeFailure("killed upgrade")
+	assert.Nil(t, err)
+	assert.Equal(t, KilledUpgrade, failure)
+
+	_, err = ParseUpgradeFailure("power outage")
+	assert.Error(t, err)
+}
+
+func Test_UpgradeWithFailure(t *testing.T) {
+	ctx := context.Background()
+	fakeArtifact(t, "elastic-agent", "/tmp/elastic-agent")
+
+	version := downloads.RemoveCommitFromSnapshot(common.ElasticAgentVersion)
+
+	t.Run("Corrupted source is written before the upgrade", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+		metadata := i.PkgMetadata()
+
+		artifactName := downloads.GetArtifactName("elastic-agent", common.ElasticAgentVersion, metadata.Os, metadata.Arch, metadata.FileExtension, false)
+		artifactPath := "/tmp/corrupted-source/" + artifactName
+
+		assert.Nil(t, UpgradeWithFailure(ctx, i, "", CorruptedSource))
+		assert.Equal(t, [][]string{
+			corruptedArtifactCmds(artifactPath),
+			{"elastic-agent", "upgrade", version, "-v", "--source-uri", "file://" + artifactPath},
+		}, d.Commands())
+	})
+
+	t.Run("Unreachable source is used as source URI", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		assert.Nil(t, UpgradeWithFailure(ctx, i, "", UnreachableSource))
+		assert.Equal(t, [][]string{
+			{"elastic-agent", "upgrade", version, "-v", "--source-uri", unreachableSourceURI},
+		}, d.Commands())
+	})
+
+	t.Run("Upgraded agent is killed once the upgrade marker is present", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+		d.WithOutput("true", nil, upgradeMarkerCmds(i.PkgMetadata())...)
+
+		assert.Nil(t, UpgradeWithFailure(ctx, i, "", KilledUpgrade))
+		assert.Equal(t, [][]string{
+			{"elastic-agent", "upgrade", version, "-v", "--source-uri", "file:///tmp/elastic-agent"},
+			{"sh", "-c", "test -f /opt/Elastic/Agent/data/.update-marker && echo true || echo false"},
+			killAgentCmds(i.PkgMetadata(), killedUpgradeAttempts),
+		}, d.Commands())
+	})
+
+	t.Run("Errors writing the corrupted source are reported", func(t *testing.T) {
+		d := deploytest.New().WithOutput("", errors.New("no space left on device"), "sh", "-c")
+		i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := UpgradeWithFailure(ctx, i, "", CorruptedSource)
+		assert.ErrorContains(t, err, "no space left on device")
+		assert.False(t, IsUpgradeCommandError(err))
+		assert.Len(t, d.Commands(), 1)
+	})
+
+	t.Run("Errors of the upgrade command are the expected ones", func(t *testing.T) {
+		d := deploytest.New().WithOutput("", errors.New("could not resolve host"), "elastic-agent", "upgrade")
+		i := AttachElasticAgentTARPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := UpgradeWithFailure(ctx, i, "", UnreachableSource)
+		assert.True(t, IsUpgradeCommandError(err))
+		assert.ErrorContains(t, err, "could not resolve host")
+	})
+}
+
+func Test_UpgradeFailureWindowsCmds(t *testing.T) {
+	metadata := deploy.ServiceInstallerMetadata{AgentPath: `C:\Program Files\Elastic\Agent`, Os: "windows"}
+
+	assert.Equal(t, []string{"powershell.exe", "Test-Path", `'C:\Program Files\Elastic\Agent\data\.update-marker'`}, upgradeMarkerCmds(metadata))
+	assert.Contains(t, killAgentCmds(metadata, 5), "5;")
+	assert.Contains(t, windowsCorruptedArtifactCmds(`C:\elastic-agent\corrupted-source\elastic-agent.zip`), `'C:\elastic-agent\corrupted-source'`)
+}
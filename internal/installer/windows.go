@@ -0,0 +1,149 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/process"
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	// windowsAgentBasePath the default directory under which the elastic-agent is installed on Windows
+	windowsAgentBasePath = `C:\Program Files`
+
+	// windowsAgentWorkingPath the location where the elastic-agent is extracted before the install on Windows
+	windowsAgentWorkingPath = `C:\elastic-agent`
+
+	// windowsServiceName the name of the Windows service registered by the elastic-agent
+	windowsServiceName = "Elastic Agent"
+
+	// windowsLogsTail number of lines to be read from each log file of the elastic-agent
+	windowsLogsTail = 500
+)
+
+// windowsPath joins path elements using the Windows separator, no matter the OS running the tests
+func windowsPath(elems ...string) string {
+	parts := []string{}
+	for i, e := range elems {
+		if i > 0 {
+			e = strings.TrimLeft(e, `\/`)
+		}
+		if i < len(elems)-1 {
+			e = strings.TrimRight(e, `\/`)
+		}
+		if e == "" {
+			continue
+		}
+		parts = append(parts, e)
+	}
+
+	return strings.Join(parts, `\`)
+}
+
+// windowsAgentInstallPath returns the location where the elastic-agent is installed on Windows,
+// honouring the base path of the install options
+func windowsAgentInstallPath(service deploy.ServiceRequest) string {
+	basePath := service.InstallOptions.BasePath
+	if basePath == "" {
+		basePath = windowsAgentBasePath
+	}
+
+	return windowsPath(basePath, "Elastic", "Agent")
+}
+
+// windowsAgentBinary returns the path to the installed elastic-agent binary on Windows
+func windowsAgentBinary(agentPath string) string {
+	return windowsPath(agentPath, process.WindowsExecutable(common.ElasticAgentProcessName))
+}
+
+// windowsFileURI converts a Windows path into a file URI, i.e. C:\foo\bar.zip -> file:///C:/foo/bar.zip
+func windowsFileURI(path string) string {
+	return "file:///" + strings.ReplaceAll(path, `\`, "/")
+}
+
+// windowsArtifactPath makes a downloaded artifact available in the Windows service environment, returning its path there.
+// For remote deployments the tests run on the Windows host, so the artifact is already present at the download path
+func windowsArtifactPath(ctx context.Context, so deploy.ServiceOperator, binaryName string, binaryPath string) (string, error) {
+	if common.Provider == "remote" {
+		return binaryPath, nil
+	}
+
+	err := so.AddFiles(ctx, []string{binaryPath})
+	if err != nil {
+		return "", err
+	}
+
+	return windowsPath("C:", binaryName), nil
+}
+
+// windowsLogCmds represents the command and base arguments to retrieve the logs of the elastic-agent
+// from its log files, as the elastic-agent does not write them to the Windows Event Log
+func windowsLogCmds(agentPath string) []string {
+	logsPath := windowsPath(agentPath, "data", "elastic-agent-*", "logs", "*")
+	return []string{
+		"powershell.exe", "Get-ChildItem", "-Path", fmt.Sprintf("'%s'", logsPath), "-Include", "*.ndjson,*.log", "|",
+		"Get-Content", "-Tail", fmt.Sprintf("%d", windowsLogsTail),
+	}
+}
+
+// windowsEventLogCmds represents the command and base arguments to retrieve the Windows Event Log
+// entries for the Elastic Agent service, emitted by the Service Control Manager
+func windowsEventLogCmds() []string {
+	return []string{
+		"powershell.exe", "Get-WinEvent", "-FilterHashtable", "@{LogName='System';ProviderName='Service Control Manager'}",
+		"-MaxEvents", fmt.Sprintf("%d", windowsLogsTail), "|",
+		"Where-Object", fmt.Sprintf("{ $_.Message -like '*%s*' }", windowsServiceName), "|",
+		"Format-List", "TimeCreated,Id,LevelDisplayName,Message",
+	}
+}
+
+// windowsServiceCmds represents the command and base arguments to operate the elastic-agent Windows service,
+// where action is one of Start, Stop or Restart
+func windowsServiceCmds(action string) []string {
+	return []string{"powershell.exe", action + "-Service", "-Name", fmt.Sprintf("'%s'", windowsServiceName)}
+}
+
+// windowsLog prints the logs of the elastic-agent: the Service Control Manager events for the Windows service
+// and the log files of the agent
+func windowsLog(ctx context.Context, pkgType string, agentPath string, execFn func(ctx context.Context, args []string) (string, error)) error {
+	span, _ := apm.StartSpanOptions(ctx, "Retrieving logs for the Elastic Agent service", "elastic-agent."+pkgType+".log", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	for _, cmds := range [][]string{windowsEventLogCmds(), windowsLogCmds(agentPath)} {
+		logs, err := execFn(ctx, cmds)
+		if err != nil {
+			return err
+		}
+
+		// print logs as is, including tabs and line breaks
+		fmt.Println(logs)
+	}
+
+	return nil
+}
+
+// windowsService operates the elastic-agent Windows service, where action is one of Start, Stop or Restart
+func windowsService(ctx context.Context, pkgType string, action string, execFn func(ctx context.Context, args []string) (string, error)) error {
+	cmds := windowsServiceCmds(action)
+	span, _ := apm.StartSpanOptions(ctx, action+" Elastic Agent service", "elastic-agent."+pkgType+"."+strings.ToLower(action), apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("arguments", cmds)
+	defer span.End()
+
+	_, err := execFn(ctx, cmds)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/deploy/deploytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WindowsPath(t *testing.T) {
+	assert.Equal(t, `C:\Program Files\Elastic\Agent\elastic-agent.exe`, windowsAgentBinary(windowsAgentInstallPath(deploy.NewServiceRequest("elastic-agent"))))
+	assert.Equal(t, `D:\agents\Elastic\Agent`, windowsAgentInstallPath(deploy.NewServiceRequest("elastic-agent").WithInstallOptions(deploy.InstallOptions{BasePath: `D:\agents`})))
+	assert.Equal(t, `C:\elastic-agent.zip`, windowsPath("C:", "elastic-agent.zip"))
+	assert.Equal(t, `C:\elastic-agent\foo`, windowsPath(`C:\elastic-agent\`, `\foo`))
+	assert.Equal(t, "file:///C:/elastic-agent/foo.zip", windowsFileURI(`C:\elastic-agent\foo.zip`))
+}
+
+func Test_UpgradeCmds(t *testing.T) {
+	t.Run("Linux packages use the elastic-agent in the PATH", func(t *testing.T) {
+		cmds := upgradeCmds(deploy.ServiceInstallerMetadata{Os: "linux"}, "8.14.0", "file:///tmp/elastic-agent.tar.gz")
+
+		assert.Equal(t, []string{"elastic-agent", "upgrade", "8.14.0", "-v", "--source-uri", "file:///tmp/elastic-agent.tar.gz"}, cmds)
+	})
+
+	t.Run("Windows packages use the installed executable", func(t *testing.T) {
+		metadata := deploy.ServiceInstallerMetadata{AgentPath: `D:\Elastic\Agent`, Os: "windows", PackageType: "zip"}
+		cmds := upgradeCmds(metadata, "8.14.0", sourceURI(metadata, `C:\elastic-agent.zip`))
+
+		assert.Equal(t, []string{`D:\Elastic\Agent\elastic-agent.exe`, "upgrade", "8.14.0", "-v", "--source-uri", "file:///C:/elastic-agent.zip"}, cmds)
+	})
+}
+
+func Test_WindowsService(t *testing.T) {
+	for _, action := range []string{"Start", "Stop", "Restart"} {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := windowsService(context.Background(), "zip", action, i.Exec)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{{"powershell.exe", action + "-Service", "-Name", "'Elastic Agent'"}}, d.Commands())
+	}
+}
+
+func Test_WindowsLog(t *testing.T) {
+	d := deploytest.New()
+	i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+	err := windowsLog(context.Background(), "zip", i.PkgMetadata().AgentPath, i.Exec)
+	assert.Nil(t, err)
+
+	cmds := d.Commands()
+	assert.Len(t, cmds, 2)
+	assert.Equal(t, "Get-WinEvent", cmds[0][1])
+	assert.Equal(t, "Get-ChildItem", cmds[1][1])
+	assert.Equal(t, `'C:\Program Files\Elastic\Agent\data\elastic-agent-*\logs\*'`, cmds[1][3])
+}
+
+func Test_ZIPPackage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Uninstall uses the installed executable", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := i.Uninstall(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{{windowsAgentBinary(windowsAgentInstallPath(deploy.NewServiceRequest("elastic-agent"))), "uninstall", "-f"}}, d.Commands())
+	})
+
+	t.Run("Enroll uses the extracted executable", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := i.Enroll(ctx, "token", "--tag=windows")
+		assert.Nil(t, err)
+		assert.Len(t, d.Commands(), 1)
+		assert.Equal(t, []string{`C:\elastic-agent\elastic-agent.exe`, "install"}, d.Commands()[0][:2])
+		assert.Contains(t, d.Commands()[0], "--enrollment-token=token")
+		assert.Equal(t, "--tag=windows", d.Commands()[0][len(d.Commands()[0])-1])
+	})
+
+	t.Run("Stop operates the Windows service", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := i.Stop(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{windowsServiceCmds("Stop")}, d.Commands())
+	})
+
+	t.Run("Preinstall moves the directory of the version of the service", func(t *testing.T) {
+		fakeArtifact(t, "elastic-agent.zip", "/tmp/elastic-agent.zip")
+
+		d := deploytest.New()
+		i := AttachElasticAgentZIPPackage(d, deploy.NewServiceRequest("elastic-agent").WithVersion("8.14.3"))
+
+		err := i.Preinstall(ctx)
+		assert.Nil(t, err)
+		cmds := d.Commands()
+		assert.Equal(t, []string{"powershell.exe", "Move-Item", "-Force", "-Path", `C:\elastic-agent-8.14.3-windows-x86_64`, "-Destination", `C:\elastic-agent`}, cmds[len(cmds)-1])
+	})
+}
+
+func Test_MSIPackage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Enroll installs the MSI with the install arguments", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentMSIPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := i.Enroll(ctx, "token", "--tag=windows")
+		assert.Nil(t, err)
+		assert.Len(t, d.Commands(), 1)
+		assert.Equal(t, []string{"msiexec.exe", "/i", `C:\elastic-agent\elastic-agent.msi`, "/qn", "/norestart", "/l*v", `C:\elastic-agent\msiexec.log`}, d.Commands()[0][:7])
+		assert.Contains(t, d.Commands()[0][7], `INSTALLARGS="`)
+		assert.Contains(t, d.Commands()[0][7], "--enrollment-token=token")
+		assert.Contains(t, d.Commands()[0][7], `--tag=windows"`)
+	})
+
+	t.Run("Uninstall removes the MSI", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentMSIPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		err := i.Uninstall(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]string{{"msiexec.exe", "/x", `C:\elastic-agent\elastic-agent.msi`, "/qn", "/norestart", "/l*v", `C:\elastic-agent\msiexec.log`}}, d.Commands())
+	})
+
+	t.Run("Artifacts are copied into the Windows container", func(t *testing.T) {
+		d := deploytest.New()
+		i := AttachElasticAgentMSIPackage(d, deploy.NewServiceRequest("elastic-agent"))
+
+		p, err := windowsArtifactPath(ctx, i, "elastic-agent-8.14.0-windows-x86_64.msi", "/tmp/elastic-agent-8.14.0-windows-x86_64.msi")
+		assert.Nil(t, err)
+		assert.Equal(t, `C:\elastic-agent-8.14.0-windows-x86_64.msi`, p)
+		assert.Equal(t, [][]string{{"/tmp/elastic-agent-8.14.0-windows-x86_64.msi"}}, d.Files())
+	})
+}
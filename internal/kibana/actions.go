@@ -0,0 +1,237 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	// ActionStatusCancelled the action was cancelled before all the agents acknowledged it
+	ActionStatusCancelled = "CANCELLED"
+	// ActionStatusComplete all the agents acknowledged the action
+	ActionStatusComplete = "COMPLETE"
+	// ActionStatusExpired the action expired before all the agents acknowledged it
+	ActionStatusExpired = "EXPIRED"
+	// ActionStatusFailed some agents failed to execute the action
+	ActionStatusFailed = "FAILED"
+	// ActionStatusInProgress the action is being executed by the agents
+	ActionStatusInProgress = "IN_PROGRESS"
+	// ActionStatusRolloutPassed the rollout period of the action passed, but some agents did not acknowledge it
+	ActionStatusRolloutPassed = "ROLLOUT_PASSED"
+)
+
+// AgentAction represents an action sent to an agent, i.e. UNENROLL, UPGRADE, SETTINGS or REQUEST_DIAGNOSTICS
+type AgentAction struct {
+	ID   string      `json:"id,omitempty"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ActionStatus represents the progress of an action across the agents it targets
+type ActionStatus struct {
+	ActionID              string        `json:"actionId"`
+	Type                  string        `json:"type"`
+	Status                string        `json:"status"`
+	Version               string        `json:"version,omitempty"`
+	NbAgentsActionCreated int           `json:"nbAgentsActionCreated"`
+	NbAgentsActioned      int           `json:"nbAgentsActioned"`
+	NbAgentsAck           int           `json:"nbAgentsAck"`
+	NbAgentsFailed        int           `json:"nbAgentsFailed"`
+	CreationTime          string        `json:"creationTime,omitempty"`
+	StartTime             string        `json:"startTime,omitempty"`
+	CompletionTime        string        `json:"completionTime,omitempty"`
+	CancellationTime      string        `json:"cancellationTime,omitempty"`
+	Expiration            string        `json:"expiration,omitempty"`
+	LatestErrors          []ActionError `json:"latestErrors,omitempty"`
+}
+
+// ActionError represents the error of an agent executing an action
+type ActionError struct {
+	AgentID   string `json:"agentId"`
+	Error     string `json:"error"`
+	Hostname  string `json:"hostname,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// IsFinished returns true if the action will not progress anymore
+func (s ActionStatus) IsFinished() bool {
+	return s.Status != ActionStatusInProgress
+}
+
+// ActionFailedError is returned when an action finishes without being acknowledged by all its agents,
+// keeping the errors reported by each agent
+type ActionFailedError struct {
+	Status ActionStatus
+}
+
+func (e *ActionFailedError) Error() string {
+	s := e.Status
+	msg := fmt.Sprintf("the %s action %s is %s: %d of %d agents acknowledged it, %d failed", s.Type, s.ActionID, s.Status, s.NbAgentsAck, s.NbAgentsActionCreated, s.NbAgentsFailed)
+
+	agentErrors := []string{}
+	for _, agentError := range s.LatestErrors {
+		agent := agentError.AgentID
+		if agentError.Hostname != "" {
+			agent = agentError.Hostname + " (" + agent + ")"
+		}
+		agentErrors = append(agentErrors, agent+": "+agentError.Error)
+	}
+	if len(agentErrors) > 0 {
+		msg += " [" + strings.Join(agentErrors, ", ") + "]"
+	}
+
+	return msg
+}
+
+// CreateAgentAction sends an action to an agent, returning the created action
+func (c *Client) CreateAgentAction(ctx context.Context, agentID string, action AgentAction) (AgentAction, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating agent action", "fleet.agent.actions.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("agentID", agentID)
+	span.Context.SetLabel("type", action.Type)
+	defer span.End()
+
+	reqBody := map[string]AgentAction{"action": action}
+
+	var resp struct {
+		Item AgentAction `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agents/%s/actions", FleetAPI, agentID), reqBody, &resp, "could not create agent action")
+	if err != nil {
+		return AgentAction{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"actionID": resp.Item.ID,
+		"agentID":  agentID,
+		"type":     action.Type,
+	}).Debug("Agent action created")
+	return resp.Item, nil
+}
+
+// CancelAction cancels an action, returning the cancel action
+func (c *Client) CancelAction(ctx context.Context, actionID string) (AgentAction, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Cancelling agent action", "fleet.agent.actions.cancel", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("actionID", actionID)
+	defer span.End()
+
+	var resp struct {
+		Item AgentAction `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agents/actions/%s/cancel", FleetAPI, actionID), nil, &resp, "could not cancel agent action")
+	if err != nil {
+		return AgentAction{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// ListActionStatus returns the status of the latest actions
+func (c *Client) ListActionStatus(ctx context.Context) ([]ActionStatus, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing agent actions status", "fleet.agent.actions.status", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Items []ActionStatus `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agents/action_status?perPage=100", FleetAPI), nil, &resp, "could not list agent actions status")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
+}
+
+// GetActionStatus returns the status of an action by its ID
+func (c *Client) GetActionStatus(ctx context.Context, actionID string) (ActionStatus, error) {
+	statuses, err := c.ListActionStatus(ctx)
+	if err != nil {
+		return ActionStatus{}, err
+	}
+
+	for _, status := range statuses {
+		if status.ActionID == actionID {
+			return status, nil
+		}
+	}
+
+	return ActionStatus{}, fmt.Errorf("the status of the action %s was not found", actionID)
+}
+
+// WaitForAction polls the status of an action until all its agents acknowledged it, returning an
+// ActionFailedError with the errors of the agents if it finishes otherwise, or if it's still in
+// progress after the timeout
+func (c *Client) WaitForAction(ctx context.Context, actionID string, maxTimeout time.Duration) (ActionStatus, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Waiting for agent action", "fleet.agent.actions.wait", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("actionID", actionID)
+	defer span.End()
+
+	retryCount := 1
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	var status ActionStatus
+	actionStatusFn := func() error {
+		var err error
+		status, err = c.GetActionStatus(ctx, actionID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"actionID":    actionID,
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"retry":       retryCount,
+			}).Warn("Could not get the status of the action")
+
+			retryCount++
+			return err
+		}
+
+		if status.Status == ActionStatusComplete {
+			log.WithFields(log.Fields{
+				"actionID":    actionID,
+				"agents":      status.NbAgentsAck,
+				"elapsedTime": exp.GetElapsedTime(),
+				"retries":     retryCount,
+				"type":        status.Type,
+			}).Info("Action completed by all the agents")
+			return nil
+		}
+
+		err = &ActionFailedError{Status: status}
+		if status.IsFinished() {
+			return backoff.Permanent(err)
+		}
+
+		log.WithFields(log.Fields{
+			"actionID":    actionID,
+			"acks":        status.NbAgentsAck,
+			"agents":      status.NbAgentsActionCreated,
+			"elapsedTime": exp.GetElapsedTime(),
+			"retry":       retryCount,
+		}).Warn("Action still in progress")
+
+		retryCount++
+		return err
+	}
+
+	err := backoff.Retry(actionStatusFn, exp)
+	return status, err
+}
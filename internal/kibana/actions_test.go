@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForAction(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-actions"})
+	require.NoError(t, err)
+	key, err := client.CreateEnrollmentAPIKey(ctx, kibana.FleetServicePolicy)
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, hostname := range []string{"e2e-host-1", "e2e-host-2"} {
+		id, _, err := s.Enroll(key.APIKey, kibanatest.EnrollRequest{Hostname: hostname, Version: "8.14.3"})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	t.Run("Completed actions", func(t *testing.T) {
+		require.NoError(t, client.ReassignAgent(ctx, ids[0], policy.ID))
+
+		actionID, err := client.BulkReassignAgents(ctx, kibana.AgentsByID(ids...), policy.ID)
+		require.NoError(t, err)
+		for _, id := range ids {
+			s.AckActions(id)
+		}
+
+		status, err := client.WaitForAction(ctx, actionID, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, kibana.ActionStatusComplete, status.Status)
+		assert.Equal(t, 2, status.NbAgentsAck)
+	})
+
+	t.Run("Failed actions return the errors of the agents", func(t *testing.T) {
+		actionID, err := client.BulkUpgradeAgents(ctx, kibana.BulkUpgradeRequest{Agents: kibana.AgentsByID(ids...), Version: "8.15.0"})
+		require.NoError(t, err)
+		s.AckActions(ids[0])
+		s.FailAction(ids[1], actionID, "could not verify the artifact")
+
+		status, err := client.WaitForAction(ctx, actionID, time.Minute)
+		require.Error(t, err)
+		assert.Equal(t, kibana.ActionStatusFailed, status.Status)
+
+		var failed *kibana.ActionFailedError
+		require.True(t, errors.As(err, &failed))
+		assert.Equal(t, 1, failed.Status.NbAgentsFailed)
+		assert.Contains(t, err.Error(), "e2e-host-2 ("+ids[1]+"): could not verify the artifact")
+	})
+}
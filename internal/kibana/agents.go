@@ -8,7 +8,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/elastic/e2e-testing/internal/elasticsearch"
 	"github.com/elastic/e2e-testing/pkg/downloads"
@@ -40,8 +43,110 @@ type Agent struct {
 			} `json:"agent"`
 		} `json:"elastic"`
 	} `json:"local_metadata"`
-	Status  string                   `json:"status"`
-	Outputs map[string]*PolicyOutput `json:"outputs,omitempty"`
+	EnrolledAt       string                   `json:"enrolled_at,omitempty"`
+	LastCheckin      string                   `json:"last_checkin,omitempty"`
+	Status           string                   `json:"status"`
+	Tags             []string                 `json:"tags,omitempty"`
+	Outputs          map[string]*PolicyOutput `json:"outputs,omitempty"`
+	Components       []AgentComponent         `json:"components,omitempty"`
+	UpgradeDetails   *UpgradeDetails          `json:"upgrade_details,omitempty"`
+	UpgradeStartedAt string                   `json:"upgrade_started_at,omitempty"`
+	UpgradedAt       string                   `json:"upgraded_at,omitempty"`
+}
+
+// CheckedInAfter returns true if the last checkin of the agent with Fleet Server happened after the given time
+func (a Agent) CheckedInAfter(t time.Time) bool {
+	checkin, err := time.Parse(time.RFC3339, a.LastCheckin)
+	return err == nil && checkin.After(t)
+}
+
+// RunsPolicy returns true if the agent runs a revision of a policy, at least the given one
+func (a Agent) RunsPolicy(policy Policy) bool {
+	return a.PolicyID == policy.ID && a.PolicyRevision >= policy.Revision
+}
+
+// OutputHealthy returns true if the agent runs the output, with the output units of the components using it
+// reported as healthy. The agents name the components after their input type and their output, i.e. log-<output ID>
+func (a Agent) OutputHealthy(output Output) bool {
+	if o, ok := a.Outputs[output.ID]; !ok || o == nil || o.Type != output.Type {
+		return false
+	}
+
+	units := 0
+	for _, component := range a.Components {
+		if !strings.HasSuffix(component.ID, "-"+output.ID) {
+			continue
+		}
+
+		for _, unit := range component.Units {
+			if unit.Type != "output" {
+				continue
+			}
+			if unit.Status != ComponentStatusHealthy {
+				return false
+			}
+			units++
+		}
+	}
+
+	return units > 0
+}
+
+// UpgradeFailed returns true if the agent reports its last upgrade as failed, or as being rolled back
+func (a Agent) UpgradeFailed() bool {
+	if a.UpgradeDetails == nil {
+		return false
+	}
+
+	return a.UpgradeDetails.State == UpgradeStateFailed || a.UpgradeDetails.State == UpgradeStateRollback
+}
+
+const (
+	// UpgradeStateDownloading the agent is downloading the artifact of the upgrade
+	UpgradeStateDownloading = "UPG_DOWNLOADING"
+	// UpgradeStateFailed the upgrade failed, the failed state and error are in the metadata
+	UpgradeStateFailed = "UPG_FAILED"
+	// UpgradeStateRequested the upgrade was requested to the agent
+	UpgradeStateRequested = "UPG_REQUESTED"
+	// UpgradeStateRollback the upgraded agent was unhealthy, so the previous version is restored
+	UpgradeStateRollback = "UPG_ROLLBACK"
+	// UpgradeStateWatching the upgraded agent is being watched, waiting to be healthy
+	UpgradeStateWatching = "UPG_WATCHING"
+)
+
+// UpgradeDetails represents the progress of an upgrade, as reported by the agent to Fleet
+type UpgradeDetails struct {
+	ActionID      string `json:"action_id"`
+	State         string `json:"state"`
+	TargetVersion string `json:"target_version"`
+	Metadata      struct {
+		DownloadPercent float64 `json:"download_percent,omitempty"`
+		ErrorMsg        string  `json:"error_msg,omitempty"`
+		FailedState     string  `json:"failed_state,omitempty"`
+		RetryErrorMsg   string  `json:"retry_error_msg,omitempty"`
+		RetryUntil      string  `json:"retry_until,omitempty"`
+		ScheduledAt     string  `json:"scheduled_at,omitempty"`
+	} `json:"metadata"`
+}
+
+// ComponentStatusHealthy the status of the healthy components of the agents, and of their units
+const ComponentStatusHealthy = "HEALTHY"
+
+// AgentComponent represents a component run by an agent, i.e. the inputs of a type sending events to an output
+type AgentComponent struct {
+	ID      string               `json:"id"`
+	Type    string               `json:"type"`
+	Status  string               `json:"status"`
+	Message string               `json:"message,omitempty"`
+	Units   []AgentComponentUnit `json:"units,omitempty"`
+}
+
+// AgentComponentUnit represents a unit of a component, being its output or one of its inputs
+type AgentComponentUnit struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"` // input or output
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
 }
 
 // PolicyOutput holds the needed data to manage the output API keys
@@ -58,7 +163,7 @@ type PolicyOutput struct {
 	// API keys to be invalidated on next agent ack
 	ToRetireAPIKeyIds []ToRetireAPIKeyIdsItems `json:"to_retire_api_key_ids,omitempty"`
 
-	// Type is the output type. Currently only Elasticsearch is supported.
+	// Type is the output type: elasticsearch, logstash, kafka or remote_elasticsearch
 	Type string `json:"type"`
 }
 
@@ -98,6 +203,39 @@ func (c *Client) GetAgentByHostnameFromList(ctx context.Context, hostname string
 	return Agent{}, nil
 }
 
+// GetLatestAgentByHostname gets the agent enrolled the latest for a hostname, as the hosts re-enrolled
+// with --force keep the agents of their previous enrollments until these become inactive
+func (c *Client) GetLatestAgentByHostname(ctx context.Context, hostname string) (Agent, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting latest Elastic Agent by hostname", "fleet.agent.get-latest-by-hostname", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	agents, err := c.ListAgents(ctx)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	var latest Agent
+	var latestEnrolledAt time.Time
+	for _, agent := range agents {
+		if agent.LocalMetadata.Host.Name != hostname {
+			continue
+		}
+
+		enrolledAt, _ := time.Parse(time.RFC3339, agent.EnrolledAt)
+		if latest.ID == "" || enrolledAt.After(latestEnrolledAt) {
+			latest = agent
+			latestEnrolledAt = enrolledAt
+		}
+	}
+
+	if latest.ID == "" {
+		return Agent{}, fmt.Errorf("no agent is enrolled for the %s hostname", hostname)
+	}
+	return latest, nil
+}
+
 // GetAgentIDByHostname gets agent id by hostname
 func (c *Client) GetAgentIDByHostname(ctx context.Context, hostname string) (string, error) {
 	agent, err := c.GetAgentByHostnameFromList(ctx, hostname)
@@ -133,6 +271,10 @@ func (c *Client) GetAgentStatusByHostname(ctx context.Context, hostname string)
 		return "", err
 	}
 
+	if statusCode != 200 {
+		return "", newAPIError("could not get agent", statusCode, respBody)
+	}
+
 	var resp struct {
 		Item Agent `json:"item"`
 	}
@@ -169,6 +311,10 @@ func (c *Client) GetAgentByHostname(ctx context.Context, hostname string) (Agent
 		return Agent{}, err
 	}
 
+	if statusCode != 200 {
+		return Agent{}, newAPIError("could not get agent", statusCode, respBody)
+	}
+
 	var resp struct {
 		Item Agent `json:"item"`
 	}
@@ -223,7 +369,8 @@ func (c *Client) GetAgentEvents(ctx context.Context, applicationName string, age
 		},
 	}
 
-	indexName := "logs-elastic_agent-default"
+	// the agent writes its logs to the namespace of its policy, and the query is scoped to the agent
+	indexName := elasticsearch.DataStreamName("logs", "elastic_agent", "*")
 
 	searchResult, err := elasticsearch.Search(ctx, indexName, query)
 	if err != nil {
@@ -295,7 +442,7 @@ func (c *Client) ListAgents(ctx context.Context) ([]Agent, error) {
 			"statusCode": statusCode,
 		}).Error("Could not get Fleet's online agents")
 
-		return nil, err
+		return nil, newAPIError("could not get Fleet's online agents", statusCode, respBody)
 	}
 
 	var resp struct {
@@ -323,9 +470,12 @@ func (c *Client) UnEnrollAgent(ctx context.Context, hostname string) error {
 	}
 
 	reqBody := `{"revoke": true}`
-	statusCode, respBody, _ := c.post(ctx, fmt.Sprintf("%s/agents/%s/unenroll", FleetAPI, agentID), []byte(reqBody))
+	statusCode, respBody, err := c.post(ctx, fmt.Sprintf("%s/agents/%s/unenroll", FleetAPI, agentID), []byte(reqBody))
+	if err != nil {
+		return errors.Wrap(err, "could not unenroll agent")
+	}
 	if statusCode != 200 {
-		return fmt.Errorf("could not unenroll agent; API status code = %d, response body = %s", statusCode, respBody)
+		return newAPIError("could not unenroll agent", statusCode, respBody)
 	}
 	return nil
 }
@@ -346,6 +496,9 @@ func (c *Client) UpgradeAgent(ctx context.Context, hostname string, version stri
 	reqBody := `{"version":"` + version + `"}`
 
 	statusCode, respBody, err := c.post(ctx, fmt.Sprintf("%s/agents/%s/upgrade", FleetAPI, agentID), []byte(reqBody))
+	if err != nil {
+		return errors.Wrap(err, "could not upgrade agent to version")
+	}
 	if statusCode != 200 {
 		log.WithFields(log.Fields{
 			"body":           string(respBody),
@@ -354,8 +507,104 @@ func (c *Client) UpgradeAgent(ctx context.Context, hostname string, version stri
 			"statusCode":     statusCode,
 		}).Error("Could not upgrade agent to version")
 
+		return newAPIError("could not upgrade agent to version", statusCode, respBody)
+	}
+	return nil
+
+}
+
+// ReassignAgent assigns an agent to another policy, which the agent receives in its next checkin
+func (c *Client) ReassignAgent(ctx context.Context, agentID string, policyID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Reassigning Elastic Agent", "fleet.agent.reassign", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("agentID", agentID)
+	span.Context.SetLabel("policyID", policyID)
+	defer span.End()
+
+	reqBody := map[string]string{"policy_id": policyID}
+
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agents/%s/reassign", FleetAPI, agentID), reqBody, nil, "could not reassign agent")
+	if err != nil {
 		return err
 	}
+
+	log.WithFields(log.Fields{
+		"agentID":  agentID,
+		"policyID": policyID,
+	}).Debug("Agent reassigned")
 	return nil
+}
+
+// AgentStatusSummary represents the number of agents in each status, as reported by Fleet
+type AgentStatusSummary struct {
+	Error      int `json:"error"`
+	Inactive   int `json:"inactive"`
+	Offline    int `json:"offline"`
+	Online     int `json:"online"`
+	Other      int `json:"other"`
+	Total      int `json:"total"`
+	Unenrolled int `json:"unenrolled"`
+	Updating   int `json:"updating"`
+}
+
+// GetAgent returns an agent by its ID
+func (c *Client) GetAgent(ctx context.Context, agentID string) (Agent, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Elastic Agent", "fleet.agent.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("agentID", agentID)
+	defer span.End()
+
+	var resp struct {
+		Item Agent `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agents/%s", FleetAPI, agentID), nil, &resp, "could not get agent")
+	if err != nil {
+		return Agent{}, err
+	}
 
+	return resp.Item, nil
+}
+
+// GetAgentStatusSummary returns the number of agents in each status, for the agents in a policy, or for
+// all the agents when the policy ID is empty
+func (c *Client) GetAgentStatusSummary(ctx context.Context, policyID string) (AgentStatusSummary, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Elastic Agents status summary", "fleet.agents.status-summary", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	resourcePath := fmt.Sprintf("%s/agent_status", FleetAPI)
+	if policyID != "" {
+		resourcePath += "?policyId=" + url.QueryEscape(policyID)
+	}
+
+	var resp struct {
+		Results AgentStatusSummary `json:"results"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, resourcePath, nil, &resp, "could not get the agents status summary")
+	if err != nil {
+		return AgentStatusSummary{}, err
+	}
+
+	return resp.Results, nil
+}
+
+// ListAvailableVersions returns the versions the agents can be upgraded to
+func (c *Client) ListAvailableVersions(ctx context.Context) ([]string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing available Elastic Agent versions", "fleet.agents.available-versions", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Items []string `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agents/available_versions", FleetAPI), nil, &resp, "could not list the available agent versions")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
 }
@@ -0,0 +1,123 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/cassette"
+	"github.com/stretchr/testify/assert"
+)
+
+// newReplayClient creates a client replaying the cassette of a name, from the testdata directory. The cassette is
+// inserted into the returned context, which the requests replayed with it must use
+func newReplayClient(t *testing.T, name string) (context.Context, *Client) {
+	c, err := cassette.Load("testdata/cassettes", name)
+	assert.Nil(t, err)
+
+	return cassette.WithCassette(context.Background(), c), &Client{
+		host:       "http://kibana.cassette:5601",
+		httpClient: &http.Client{Transport: cassette.NewReplayTransport()},
+	}
+}
+
+func TestAgentUpgradeDetails(t *testing.T) {
+	t.Run("Agent without upgrade details", func(t *testing.T) {
+		agent := Agent{}
+
+		err := json.Unmarshal([]byte(`{"id":"agent-1","status":"online"}`), &agent)
+		assert.Nil(t, err)
+		assert.Nil(t, agent.UpgradeDetails)
+		assert.False(t, agent.UpgradeFailed())
+	})
+
+	t.Run("Agent with a failed upgrade", func(t *testing.T) {
+		agent := Agent{}
+
+		err := json.Unmarshal([]byte(`{
+			"id": "agent-1",
+			"status": "online",
+			"upgrade_started_at": "2024-06-01T10:00:00.000Z",
+			"upgrade_details": {
+				"action_id": "action-1",
+				"state": "UPG_FAILED",
+				"target_version": "8.15.0",
+				"metadata": {
+					"failed_state": "UPG_DOWNLOADING",
+					"error_msg": "unable to download package"
+				}
+			}
+		}`), &agent)
+		assert.Nil(t, err)
+		assert.True(t, agent.UpgradeFailed())
+		assert.Equal(t, "8.15.0", agent.UpgradeDetails.TargetVersion)
+		assert.Equal(t, UpgradeStateDownloading, agent.UpgradeDetails.Metadata.FailedState)
+		assert.Equal(t, "unable to download package", agent.UpgradeDetails.Metadata.ErrorMsg)
+	})
+
+	t.Run("Agent rolling back an upgrade", func(t *testing.T) {
+		agent := Agent{UpgradeDetails: &UpgradeDetails{State: UpgradeStateRollback}}
+		assert.True(t, agent.UpgradeFailed())
+	})
+
+	t.Run("Agent watching an upgrade", func(t *testing.T) {
+		agent := Agent{UpgradeDetails: &UpgradeDetails{State: UpgradeStateWatching}}
+		assert.False(t, agent.UpgradeFailed())
+	})
+}
+
+func TestGetAgentByHostname(t *testing.T) {
+	ctx, client := newReplayClient(t, "Getting an agent by hostname")
+
+	agent, err := client.GetAgentByHostname(ctx, "e2e-host")
+	assert.Nil(t, err)
+	assert.Equal(t, "e2e-agent", agent.ID)
+	assert.Equal(t, 2, agent.PolicyRevision)
+	assert.Equal(t, UpgradeStateDownloading, agent.UpgradeDetails.State)
+
+	// polling the agent replays its recorded states in order
+	agent, err = client.GetAgent(ctx, "e2e-agent")
+	assert.Nil(t, err)
+	assert.Equal(t, "online", agent.Status)
+	assert.Equal(t, "8.15.0", agent.LocalMetadata.Elastic.Agent.Version)
+	assert.Nil(t, agent.UpgradeDetails)
+
+	_, err = client.GetAgent(ctx, "missing-agent")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestAgentRunsPolicy(t *testing.T) {
+	policy := Policy{ID: "policy-1", Revision: 3}
+
+	assert.True(t, Agent{PolicyID: "policy-1", PolicyRevision: 3}.RunsPolicy(policy))
+	assert.True(t, Agent{PolicyID: "policy-1", PolicyRevision: 4}.RunsPolicy(policy))
+	assert.False(t, Agent{PolicyID: "policy-1", PolicyRevision: 2}.RunsPolicy(policy))
+	assert.False(t, Agent{PolicyID: "policy-2", PolicyRevision: 3}.RunsPolicy(policy))
+}
+
+func TestAgentOutputHealthy(t *testing.T) {
+	output := Output{ID: "output-1", Type: OutputTypeLogstash}
+	component := func(id string, status string) AgentComponent {
+		return AgentComponent{
+			ID:     id,
+			Type:   "log",
+			Status: status,
+			Units: []AgentComponentUnit{
+				{ID: id, Type: "output", Status: status},
+				{ID: id + "-logfile", Type: "input", Status: ComponentStatusHealthy},
+			},
+		}
+	}
+	outputs := map[string]*PolicyOutput{"output-1": {Type: OutputTypeLogstash}}
+
+	assert.True(t, Agent{Outputs: outputs, Components: []AgentComponent{component("log-output-1", ComponentStatusHealthy)}}.OutputHealthy(output))
+	assert.False(t, Agent{Outputs: outputs, Components: []AgentComponent{component("log-output-1", "DEGRADED")}}.OutputHealthy(output))
+	assert.False(t, Agent{Outputs: outputs, Components: []AgentComponent{component("log-default", ComponentStatusHealthy)}}.OutputHealthy(output))
+	assert.False(t, Agent{Outputs: outputs}.OutputHealthy(output), "the output has no components yet")
+	assert.False(t, Agent{Components: []AgentComponent{component("log-output-1", ComponentStatusHealthy)}}.OutputHealthy(output))
+}
@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// AgentSelector selects the agents of a bulk operation, either by their IDs or by a KQL query
+type AgentSelector struct {
+	IDs   []string
+	Query string
+}
+
+// AgentsByID selects the agents with the given IDs
+func AgentsByID(ids ...string) AgentSelector {
+	return AgentSelector{IDs: ids}
+}
+
+// AgentsByQuery selects the agents matching a KQL query, i.e. policy_id:"fleet-server-policy"
+func AgentsByQuery(query string) AgentSelector {
+	return AgentSelector{Query: query}
+}
+
+// MarshalJSON encodes the selector as the list of IDs, or as the KQL query when there are no IDs
+func (s AgentSelector) MarshalJSON() ([]byte, error) {
+	if len(s.IDs) > 0 {
+		return json.Marshal(s.IDs)
+	}
+	return json.Marshal(s.Query)
+}
+
+// MinRolloutDuration is the shortest period of time Fleet accepts to roll out the upgrade of many agents
+const MinRolloutDuration = 10 * time.Minute
+
+// BulkUpgradeRequest represents the upgrade of many agents, optionally rolled out over a period of time
+// of at least MinRolloutDuration
+type BulkUpgradeRequest struct {
+	Agents                 AgentSelector `json:"agents"`
+	Version                string        `json:"version"`
+	SourceURI              string        `json:"source_uri,omitempty"`
+	RolloutDurationSeconds int           `json:"rollout_duration_seconds,omitempty"`
+	StartTime              string        `json:"start_time,omitempty"`
+	Force                  bool          `json:"force,omitempty"`
+}
+
+// bulkActionResponse represents the response of a bulk operation, which creates an action
+type bulkActionResponse struct {
+	ActionID string `json:"actionId"`
+}
+
+// BulkUpgradeAgents upgrades many agents, returning the ID of the upgrade action
+func (c *Client) BulkUpgradeAgents(ctx context.Context, req BulkUpgradeRequest) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Upgrading Elastic Agents in bulk", "fleet.agents.bulk-upgrade", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("version", req.Version)
+	defer span.End()
+
+	req.Version = downloads.RemoveCommitFromSnapshot(req.Version)
+
+	return c.bulkAction(ctx, "bulk_upgrade", req, "could not upgrade agents in bulk")
+}
+
+// BulkReassignAgents reassigns many agents to a policy, returning the ID of the reassign action
+func (c *Client) BulkReassignAgents(ctx context.Context, agents AgentSelector, policyID string) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Reassigning Elastic Agents in bulk", "fleet.agents.bulk-reassign", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("policyID", policyID)
+	defer span.End()
+
+	reqBody := struct {
+		Agents   AgentSelector `json:"agents"`
+		PolicyID string        `json:"policy_id"`
+	}{
+		Agents:   agents,
+		PolicyID: policyID,
+	}
+
+	return c.bulkAction(ctx, "bulk_reassign", reqBody, "could not reassign agents in bulk")
+}
+
+// BulkUnenrollAgents unenrolls many agents, revoking their API keys when revoke is true, and returning
+// the ID of the unenroll action
+func (c *Client) BulkUnenrollAgents(ctx context.Context, agents AgentSelector, revoke bool) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Unenrolling Elastic Agents in bulk", "fleet.agents.bulk-unenroll", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	reqBody := struct {
+		Agents AgentSelector `json:"agents"`
+		Revoke bool          `json:"revoke"`
+	}{
+		Agents: agents,
+		Revoke: revoke,
+	}
+
+	return c.bulkAction(ctx, "bulk_unenroll", reqBody, "could not unenroll agents in bulk")
+}
+
+// BulkUpdateAgentTags adds and removes tags to many agents, returning the ID of the update action
+func (c *Client) BulkUpdateAgentTags(ctx context.Context, agents AgentSelector, tagsToAdd []string, tagsToRemove []string) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating Elastic Agents tags in bulk", "fleet.agents.bulk-update-tags", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	reqBody := struct {
+		Agents       AgentSelector `json:"agents"`
+		TagsToAdd    []string      `json:"tagsToAdd,omitempty"`
+		TagsToRemove []string      `json:"tagsToRemove,omitempty"`
+	}{
+		Agents:       agents,
+		TagsToAdd:    tagsToAdd,
+		TagsToRemove: tagsToRemove,
+	}
+
+	return c.bulkAction(ctx, "bulk_update_agent_tags", reqBody, "could not update agent tags in bulk")
+}
+
+func (c *Client) bulkAction(ctx context.Context, operation string, reqBody interface{}, message string) (string, error) {
+	var resp bulkActionResponse
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agents/%s", FleetAPI, operation), reqBody, &resp, message)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"actionID":  resp.ActionID,
+		"operation": operation,
+	}).Debug("Bulk action created")
+	return resp.ActionID, nil
+}
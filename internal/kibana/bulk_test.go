@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentSelector(t *testing.T) {
+	bytes, err := json.Marshal(AgentsByID("agent-1", "agent-2"))
+	assert.Nil(t, err)
+	assert.Equal(t, `["agent-1","agent-2"]`, string(bytes))
+
+	bytes, err = json.Marshal(AgentsByQuery(`policy_id:"policy-1"`))
+	assert.Nil(t, err)
+	assert.Equal(t, `"policy_id:\"policy-1\""`, string(bytes))
+}
+
+func TestBulkActions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Upgrades are rolled out", func(t *testing.T) {
+		reqBody := map[string]interface{}{}
+		client := newTestClient(t, jsonHandler(t, http.StatusOK, `{"actionId":"action-1"}`, &reqBody))
+
+		actionID, err := client.BulkUpgradeAgents(ctx, BulkUpgradeRequest{
+			Agents:                 AgentsByID("agent-1"),
+			Version:                "8.15.0-SNAPSHOT",
+			RolloutDurationSeconds: 600,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "action-1", actionID)
+		assert.Equal(t, "8.15.0-SNAPSHOT", reqBody["version"])
+		assert.Equal(t, float64(600), reqBody["rollout_duration_seconds"])
+	})
+
+	t.Run("Agents are reassigned by query", func(t *testing.T) {
+		reqBody := map[string]interface{}{}
+		client := newTestClient(t, jsonHandler(t, http.StatusOK, `{"actionId":"action-2"}`, &reqBody))
+
+		actionID, err := client.BulkReassignAgents(ctx, AgentsByQuery("tags:e2e"), "policy-2")
+		assert.Nil(t, err)
+		assert.Equal(t, "action-2", actionID)
+		assert.Equal(t, "tags:e2e", reqBody["agents"])
+		assert.Equal(t, "policy-2", reqBody["policy_id"])
+	})
+
+	t.Run("Action status is found by ID", func(t *testing.T) {
+		client := newTestClient(t, jsonHandler(t, http.StatusOK, `{"items":[
+			{"actionId":"action-1","type":"UPGRADE","status":"IN_PROGRESS","nbAgentsActionCreated":2,"nbAgentsAck":1},
+			{"actionId":"action-2","type":"POLICY_REASSIGN","status":"COMPLETE","nbAgentsActionCreated":2,"nbAgentsAck":2}
+		]}`, nil))
+
+		status, err := client.GetActionStatus(ctx, "action-2")
+		assert.Nil(t, err)
+		assert.True(t, status.IsFinished())
+		assert.Equal(t, 2, status.NbAgentsAck)
+
+		_, err = client.GetActionStatus(ctx, "action-3")
+		assert.Error(t, err)
+	})
+}
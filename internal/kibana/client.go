@@ -7,13 +7,16 @@ package kibana
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Jeffail/gabs/v2"
-	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/cassette"
+	"github.com/elastic/e2e-testing/internal/transport"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -22,9 +25,12 @@ import (
 
 // Client is responsible for exporting dashboards from Kibana.
 type Client struct {
-	host     string
-	username string
-	password string
+	host          string
+	username      string
+	password      string
+	authorization string // Authorization header for API keys and tokens, basic auth is used when empty
+	space         string
+	httpClient    *http.Client
 }
 
 // HTTPHeader representation of a key-value pair to be passed as a HTTP header
@@ -33,19 +39,57 @@ type HTTPHeader struct {
 	value string
 }
 
-// NewClient creates a new instance of the client.
+// NewClient creates a new instance of the client, configured with the KIBANA_* environment variables.
 func NewClient() (*Client, error) {
-	host := getBaseURL()
-	username := shell.GetEnv("KIBANA_USERNAME", "admin")
-	password := shell.GetEnv("KIBANA_PASSWORD", "changeme")
+	cfg, err := NewClientConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientWithConfig(cfg)
+}
+
+// NewClientWithConfig creates a new instance of the client with the given configuration.
+func NewClientWithConfig(cfg ClientConfig) (*Client, error) {
+	t, err := transport.Get(cfg.transportConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
 
 	return &Client{
-		host:     host,
-		username: username,
-		password: password,
+		host:          cfg.Host,
+		username:      cfg.Username,
+		password:      cfg.Password,
+		authorization: cfg.authorization(),
+		space:         cfg.Space,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: cassette.WrapTransport(t),
+		},
 	}, nil
 }
 
+// WithSpace returns a copy of the client for a Kibana space, where the default space has no prefix
+func (c *Client) WithSpace(space string) *Client {
+	spaced := *c
+	spaced.space = space
+	return &spaced
+}
+
+// spacePath prefixes a resource path with the Kibana space of the client
+func (c *Client) spacePath(resourcePath string) string {
+	if c.space == "" || c.space == "default" {
+		return resourcePath
+	}
+
+	return "/s/" + c.space + "/" + strings.TrimPrefix(resourcePath, "/")
+}
+
 func (c *Client) get(ctx context.Context, resourcePath string, headers ...HTTPHeader) (int, []byte, error) {
 	return c.sendRequest(ctx, http.MethodGet, resourcePath, nil, headers...)
 }
@@ -62,6 +106,45 @@ func (c *Client) delete(ctx context.Context, resourcePath string, headers ...HTT
 	return c.sendRequest(ctx, http.MethodDelete, resourcePath, nil, headers...)
 }
 
+// sendJSONRequest sends a request to the Kibana API, encoding the request body as JSON when it's not nil, and
+// decoding the JSON response into resp when it's not nil. Responses with a status code other than 2xx are
+// returned as an APIError, described by the message
+func (c *Client) sendJSONRequest(ctx context.Context, method string, resourcePath string, reqBody interface{}, resp interface{}, message string) error {
+	var body []byte
+	if reqBody != nil {
+		var err error
+		body, err = json.Marshal(reqBody)
+		if err != nil {
+			return errors.Wrapf(err, "%s: could not convert request to JSON", message)
+		}
+	}
+
+	statusCode, respBody, err := c.sendRequest(ctx, method, resourcePath, body)
+	if err != nil {
+		return errors.Wrap(err, message)
+	}
+
+	if statusCode < 200 || statusCode > 299 {
+		log.WithFields(log.Fields{
+			"body":         string(respBody),
+			"method":       method,
+			"resourcePath": resourcePath,
+			"statusCode":   statusCode,
+		}).Debug(message)
+		return newAPIError(message, statusCode, respBody)
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return errors.Wrapf(err, "%s: could not convert response to JSON", message)
+	}
+
+	return nil
+}
+
 func (c *Client) sendRequest(ctx context.Context, method, resourcePath string, body []byte, headers ...HTTPHeader) (int, []byte, error) {
 	span, _ := apm.StartSpanOptions(ctx, "Sending HTTP request", "http.request."+method, apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
@@ -77,7 +160,7 @@ func (c *Client) sendRequest(ctx context.Context, method, resourcePath string, b
 		return 0, nil, errors.Wrapf(err, "could not create base URL from host: %v", c.host)
 	}
 
-	rel, err := url.Parse(resourcePath)
+	rel, err := url.Parse(c.spacePath(resourcePath))
 	if err != nil {
 		return 0, nil, errors.Wrapf(err, "could not create relative URL from resource path: %v", resourcePath)
 	}
@@ -93,12 +176,16 @@ func (c *Client) sendRequest(ctx context.Context, method, resourcePath string, b
 		"headers": headers,
 	}).Trace("Kibana API Query")
 
-	req, err := http.NewRequest(method, u.String(), reqBody)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
 	if err != nil {
 		return 0, nil, errors.Wrapf(err, "could not create %v request to Kibana API resource: %s", method, resourcePath)
 	}
 
-	req.SetBasicAuth(c.username, c.password)
+	if c.authorization != "" {
+		req.Header.Add("Authorization", c.authorization)
+	} else {
+		req.SetBasicAuth(c.username, c.password)
+	}
 	req.Header.Add("content-type", "application/json")
 	req.Header.Add("kbn-xsrf", fmt.Sprintf("e2e-tests-%s", uuid.New().String()))
 
@@ -106,8 +193,12 @@ func (c *Client) sendRequest(ctx context.Context, method, resourcePath string, b
 		req.Header.Add(header.key, header.value)
 	}
 
-	client := http.Client{}
-	resp, err := client.Do(req)
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return 0, nil, errors.Wrap(err, "could not send request to Kibana API")
 	}
@@ -5,11 +5,43 @@
 package kibana
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestClient creates a client for a fake Kibana API served by the handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return &Client{
+		host:     srv.URL,
+		username: "elastic",
+		password: "changeme",
+	}
+}
+
+// jsonHandler responds with a status code and a JSON body, storing the decoded request body in reqBody
+func jsonHandler(t *testing.T, statusCode int, respBody string, reqBody *map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if reqBody != nil {
+			bytes, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.Nil(t, json.Unmarshal(bytes, reqBody))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(respBody))
+	}
+}
+
 func TestGetBaseURL(t *testing.T) {
 	client, _ := NewClient()
 	assert.NotNil(t, client)
@@ -22,3 +54,82 @@ func TestNewClient(t *testing.T) {
 
 	assert.NotNil(t, client)
 }
+
+func TestAPIErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Errors carry the status code and body", func(t *testing.T) {
+		client := newTestClient(t, jsonHandler(t, http.StatusNotFound, `{"message":"Output missing not found"}`, nil))
+
+		_, err := client.GetOutput(ctx, "missing")
+
+		apiErr, ok := err.(*APIError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, `{"message":"Output missing not found"}`, apiErr.Body)
+		assert.True(t, IsNotFound(err))
+		assert.False(t, IsConflict(err))
+	})
+
+	t.Run("Enrollment API keys report unexpected status codes", func(t *testing.T) {
+		client := newTestClient(t, jsonHandler(t, http.StatusBadRequest, `{"message":"policy not found"}`, nil))
+
+		_, err := client.CreateEnrollmentAPIKey(ctx, Policy{ID: "missing"})
+		assert.ErrorContains(t, err, "API status code = 400")
+	})
+
+	t.Run("Policies report unexpected status codes with bodies that are not JSON", func(t *testing.T) {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("Kibana server is not ready yet"))
+		})
+
+		_, err := client.CreatePolicy(ctx)
+
+		apiErr, ok := err.(*APIError)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+		assert.Equal(t, "Kibana server is not ready yet", apiErr.Body)
+	})
+
+	t.Run("Listing agents reports unexpected status codes", func(t *testing.T) {
+		client := newTestClient(t, jsonHandler(t, http.StatusInternalServerError, `{}`, nil))
+
+		_, err := client.ListAgents(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("Connection errors are reported", func(t *testing.T) {
+		client := &Client{host: "http://127.0.0.1:1"}
+
+		err := client.DeleteOutput(ctx, "output-1")
+		assert.ErrorContains(t, err, "could not delete Fleet's output")
+	})
+}
+
+func TestOutputs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Read-only fields are not sent on update", func(t *testing.T) {
+		reqBody := map[string]interface{}{}
+		client := newTestClient(t, jsonHandler(t, http.StatusOK, `{"item":{"id":"logstash-output","name":"Logstash","type":"logstash","hosts":["logstash:5044"]}}`, &reqBody))
+
+		output, err := client.UpdateOutput(ctx, Output{ID: "logstash-output", Name: "Logstash", Type: OutputTypeLogstash, Hosts: []string{"logstash:5044"}, IsPreconfigured: true})
+		assert.Nil(t, err)
+		assert.Equal(t, "logstash-output", output.ID)
+
+		assert.NotContains(t, reqBody, "id")
+		assert.NotContains(t, reqBody, "is_preconfigured")
+		assert.Equal(t, "logstash", reqBody["type"])
+	})
+
+	t.Run("IDs are sent on create", func(t *testing.T) {
+		reqBody := map[string]interface{}{}
+		client := newTestClient(t, jsonHandler(t, http.StatusOK, `{"item":{"id":"kafka-output","name":"Kafka","type":"kafka"}}`, &reqBody))
+
+		_, err := client.CreateOutput(ctx, Output{ID: "kafka-output", Name: "Kafka", Type: OutputTypeKafka, Topic: "e2e"})
+		assert.Nil(t, err)
+		assert.Equal(t, "kafka-output", reqBody["id"])
+		assert.Equal(t, "e2e", reqBody["topic"])
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/transport"
+)
+
+// defaultTimeout the default timeout of the requests to the Kibana API
+const defaultTimeout = 2 * time.Minute
+
+// ClientConfig represents the authentication, TLS and timeout settings of a Kibana client.
+// The credentials are used in order of precedence: API key, token and then basic auth
+type ClientConfig struct {
+	Host     string
+	Username string
+	Password string
+
+	APIKey string // encoded API key, sent as 'Authorization: ApiKey <key>'
+	Token  string // bearer or service account token, sent as 'Authorization: Bearer <token>'
+
+	CACert             string // path to the PEM file of the CA to trust
+	ClientCert         string // path to the PEM file of the client certificate
+	ClientKey          string // path to the PEM file of the client key
+	InsecureSkipVerify bool
+
+	Space   string // Kibana space, prefixing the API paths with /s/<space>
+	Timeout time.Duration
+}
+
+// NewClientConfigFromEnv reads the configuration of the client from the KIBANA_* environment variables
+func NewClientConfigFromEnv() (ClientConfig, error) {
+	timeout := defaultTimeout
+	if t := shell.GetEnv("KIBANA_TIMEOUT", ""); t != "" {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			return ClientConfig{}, fmt.Errorf("invalid KIBANA_TIMEOUT %s: %w", t, err)
+		}
+	}
+
+	return ClientConfig{
+		Host:               getBaseURL(),
+		Username:           shell.GetEnv("KIBANA_USERNAME", "admin"),
+		Password:           shell.GetEnv("KIBANA_PASSWORD", "changeme"),
+		APIKey:             shell.GetEnv("KIBANA_API_KEY", ""),
+		Token:              shell.GetEnv("KIBANA_SERVICE_TOKEN", ""),
+		CACert:             shell.GetEnv("KIBANA_CA_CERT", ""),
+		ClientCert:         shell.GetEnv("KIBANA_CLIENT_CERT", ""),
+		ClientKey:          shell.GetEnv("KIBANA_CLIENT_KEY", ""),
+		InsecureSkipVerify: shell.GetEnvBool("KIBANA_INSECURE_SKIP_VERIFY"),
+		Space:              shell.GetEnv("KIBANA_SPACE", ""),
+		Timeout:            timeout,
+	}, nil
+}
+
+// authorization returns the value of the Authorization header, which is empty for basic auth
+func (cfg ClientConfig) authorization() string {
+	if cfg.APIKey != "" {
+		return "ApiKey " + cfg.APIKey
+	}
+	if cfg.Token != "" {
+		return "Bearer " + cfg.Token
+	}
+	return ""
+}
+
+// transportConfig returns the TLS settings of the HTTP transport of the client
+func (cfg ClientConfig) transportConfig() transport.Config {
+	return transport.Config{
+		Service:            "Kibana",
+		CACert:             cfg.CACert,
+		ClientCert:         cfg.ClientCert,
+		ClientKey:          cfg.ClientKey,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+}
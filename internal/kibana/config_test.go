@@ -0,0 +1,155 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientConfigFromEnv(t *testing.T) {
+	t.Run("Defaults to basic auth", func(t *testing.T) {
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, "admin", cfg.Username)
+		assert.Equal(t, "", cfg.authorization())
+		assert.Equal(t, defaultTimeout, cfg.Timeout)
+	})
+
+	t.Run("API keys take precedence over tokens", func(t *testing.T) {
+		t.Setenv("KIBANA_API_KEY", "a2V5OnNlY3JldA==")
+		t.Setenv("KIBANA_SERVICE_TOKEN", "AAEAAWVsYXN0aWM")
+
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, "ApiKey a2V5OnNlY3JldA==", cfg.authorization())
+	})
+
+	t.Run("Tokens are sent as bearer", func(t *testing.T) {
+		t.Setenv("KIBANA_SERVICE_TOKEN", "AAEAAWVsYXN0aWM")
+
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, "Bearer AAEAAWVsYXN0aWM", cfg.authorization())
+	})
+
+	t.Run("Timeouts are durations", func(t *testing.T) {
+		t.Setenv("KIBANA_TIMEOUT", "30s")
+
+		cfg, err := NewClientConfigFromEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, 30*time.Second, cfg.Timeout)
+
+		t.Setenv("KIBANA_TIMEOUT", "30")
+		_, err = NewClientConfigFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+func TestClientAuthentication(t *testing.T) {
+	ctx := context.Background()
+
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"item":{}}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClientWithConfig(ClientConfig{Host: srv.URL, APIKey: "a2V5OnNlY3JldA=="})
+	assert.Nil(t, err)
+
+	_, err = client.GetSettings(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "ApiKey a2V5OnNlY3JldA==", authorization)
+
+	client, err = NewClientWithConfig(ClientConfig{Host: srv.URL, Username: "elastic", Password: "changeme"})
+	assert.Nil(t, err)
+
+	_, err = client.GetSettings(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ==", authorization)
+}
+
+func TestClientSpaces(t *testing.T) {
+	ctx := context.Background()
+
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClientWithConfig(ClientConfig{Host: srv.URL, Space: "e2e"})
+	assert.Nil(t, err)
+
+	_, err = client.ListOutputs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "/s/e2e/api/fleet/outputs", path)
+
+	_, err = client.WithSpace("default").ListOutputs(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/fleet/outputs", path)
+}
+
+func TestClientTLS(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(caFile, caPEM, 0644))
+
+	t.Run("Unknown CAs are rejected", func(t *testing.T) {
+		client, err := NewClientWithConfig(ClientConfig{Host: srv.URL})
+		assert.Nil(t, err)
+
+		_, err = client.ListProxies(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("Custom CAs are trusted", func(t *testing.T) {
+		client, err := NewClientWithConfig(ClientConfig{Host: srv.URL, CACert: caFile})
+		assert.Nil(t, err)
+
+		_, err = client.ListProxies(ctx)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Verification can be skipped", func(t *testing.T) {
+		client, err := NewClientWithConfig(ClientConfig{Host: srv.URL, InsecureSkipVerify: true})
+		assert.Nil(t, err)
+
+		_, err = client.ListProxies(ctx)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Transports are shared by TLS configuration", func(t *testing.T) {
+		c1, err := NewClientWithConfig(ClientConfig{Host: srv.URL, CACert: caFile})
+		assert.Nil(t, err)
+		c2, err := NewClientWithConfig(ClientConfig{Host: srv.URL, CACert: caFile, APIKey: "key"})
+		assert.Nil(t, err)
+
+		assert.Same(t, c1.httpClient.Transport, c2.httpClient.Transport)
+	})
+
+	t.Run("Client certificates require a key", func(t *testing.T) {
+		_, err := NewClientWithConfig(ClientConfig{Host: srv.URL, ClientCert: caFile})
+		assert.Error(t, err)
+	})
+}
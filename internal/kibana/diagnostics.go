@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// AgentUploadStatusReady the file uploaded by the agent is ready to be downloaded
+const AgentUploadStatusReady = "READY"
+
+// AgentUpload represents a file uploaded by an agent to Fleet, i.e. a diagnostics bundle
+type AgentUpload struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FilePath   string `json:"filePath"`
+	CreateTime string `json:"createTime"`
+	Status     string `json:"status"`
+	ActionID   string `json:"actionId"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RequestDiagnostics sends the action to collect the diagnostics bundle of an agent, which the agent
+// uploads to Fleet. It returns the ID of the action
+func (c *Client) RequestDiagnostics(ctx context.Context, agentID string) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Requesting Elastic Agent diagnostics", "fleet.agent.request-diagnostics", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("agentID", agentID)
+	defer span.End()
+
+	var resp struct {
+		ActionID string `json:"actionId"`
+	}
+
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agents/%s/request_diagnostics", FleetAPI, agentID), map[string]interface{}{}, &resp, "could not request agent diagnostics")
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"actionID": resp.ActionID,
+		"agentID":  agentID,
+	}).Debug("Agent diagnostics requested")
+	return resp.ActionID, nil
+}
+
+// ListAgentUploads lists the files uploaded by an agent, the latest first
+func (c *Client) ListAgentUploads(ctx context.Context, agentID string) ([]AgentUpload, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing Elastic Agent uploads", "fleet.agent.uploads.list", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("agentID", agentID)
+	defer span.End()
+
+	var resp struct {
+		Items []AgentUpload `json:"items"`
+	}
+
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agents/%s/uploads", FleetAPI, agentID), nil, &resp, "could not list agent uploads")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+// DownloadAgentUpload downloads a file uploaded by an agent into the dst directory, returning the path to the file
+func (c *Client) DownloadAgentUpload(ctx context.Context, upload AgentUpload, dst string) (string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Downloading Elastic Agent upload", "fleet.agent.uploads.download", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("uploadID", upload.ID)
+	defer span.End()
+
+	if upload.Status != AgentUploadStatusReady {
+		return "", fmt.Errorf("the upload %s is not ready to be downloaded (status: %s)", upload.Name, upload.Status)
+	}
+
+	statusCode, respBody, err := c.get(ctx, fmt.Sprintf("%s/agents/files/%s/%s", FleetAPI, upload.ID, upload.Name))
+	if err != nil {
+		return "", errors.Wrap(err, "could not download agent upload")
+	}
+
+	if statusCode != http.StatusOK {
+		return "", newAPIError("could not download agent upload", statusCode, respBody)
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dst, filepath.Base(upload.Name))
+	if err := os.WriteFile(target, respBody, 0644); err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"path":     target,
+		"uploadID": upload.ID,
+	}).Debug("Agent upload downloaded")
+	return target, nil
+}
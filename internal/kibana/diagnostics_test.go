@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	key, err := client.CreateEnrollmentAPIKey(ctx, kibana.FleetServicePolicy)
+	require.NoError(t, err)
+	agentID, _, err := s.Enroll(key.APIKey, kibanatest.EnrollRequest{Hostname: "e2e-host", Version: "8.14.3"})
+	require.NoError(t, err)
+
+	actionID, err := client.RequestDiagnostics(ctx, agentID)
+	require.NoError(t, err)
+
+	uploads, err := client.ListAgentUploads(ctx, agentID)
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+
+	s.AckActions(agentID)
+
+	_, err = client.WaitForAction(ctx, actionID, time.Minute)
+	require.NoError(t, err)
+
+	uploads, err = client.ListAgentUploads(ctx, agentID)
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, actionID, uploads[0].ActionID)
+	assert.Equal(t, kibana.AgentUploadStatusReady, uploads[0].Status)
+
+	dst := t.TempDir()
+	bundle, err := client.DownloadAgentUpload(ctx, uploads[0], dst)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, "diagnostics of "+agentID, string(content))
+
+	t.Run("Uploads not ready are not downloaded", func(t *testing.T) {
+		upload := uploads[0]
+		upload.Status = "UPLOADING"
+
+		_, err := client.DownloadAgentUpload(ctx, upload, dst)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown agents are reported", func(t *testing.T) {
+		_, err := client.RequestDiagnostics(ctx, "unknown")
+		assert.True(t, kibana.IsNotFound(err))
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIError represents an unexpected response of the Kibana API, carrying its status code and body
+type APIError struct {
+	Message    string // describes the operation that failed
+	StatusCode int
+	Body       string
+}
+
+// newAPIError creates an API error for a response of the Kibana API
+func newAPIError(message string, statusCode int, body []byte) *APIError {
+	return &APIError{
+		Message:    message,
+		StatusCode: statusCode,
+		Body:       string(body),
+	}
+}
+
+// Error returns the message of the error, including the status code and body of the response
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s; API status code = %d; response body = %s", e.Message, e.StatusCode, e.Body)
+}
+
+// IsNotFound returns true if the error is an API error for a resource that does not exist
+func IsNotFound(err error) bool {
+	return hasStatusCode(err, http.StatusNotFound)
+}
+
+// IsConflict returns true if the error is an API error for a resource that already exists
+func IsConflict(err error) bool {
+	return hasStatusCode(err, http.StatusConflict)
+}
+
+// IsUnauthorized returns true if the error is an API error for invalid or revoked credentials
+func IsUnauthorized(err error) bool {
+	return hasStatusCode(err, http.StatusUnauthorized)
+}
+
+func hasStatusCode(err error, statusCode int) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == statusCode
+	}
+	return false
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/elastic/e2e-testing/internal/elasticsearch"
 	"github.com/elastic/e2e-testing/internal/shell"
@@ -27,29 +28,15 @@ type FleetConfig struct {
 	FleetServerPort          int
 	FleetServerURI           string
 	FleetServerScheme        string
+	CertificateAuthorities   []string // CAs trusted for the connections to Fleet Server, which are insecure when empty
 }
 
 // NewFleetConfig builds a new configuration for the fleet agent, defaulting fleet-server host, ES credentials, URI and port.
 func NewFleetConfig(token string) (*FleetConfig, error) {
-	fleetServer := shell.GetEnv("FLEET_URL", "fleet-server")
-	fleetPort := 8220
-	fleetServerScheme := "http"
-	if fleetServer != "fleet-server" {
-		fleetServer = utils.RemoveQuotes(fleetServer)
-		u, err := url.Parse(fleetServer)
-		if err != nil {
-			log.WithField("error", err).Fatal("Could not parse FLEET_URL")
-		}
-		host, port, err := net.SplitHostPort(u.Host)
-		if err != nil {
-			log.Fatal("Could not determine fleet port from FLEET_URL")
-		}
-		fleetPort, _ = strconv.Atoi(port)
-		fleetServer = host
-		fleetServerScheme = u.Scheme
+	esEndpoint, err := elasticsearch.GetElasticSearchEndpoint()
+	if err != nil {
+		return nil, err
 	}
-
-	esEndpoint := elasticsearch.GetElasticSearchEndpoint()
 	kbEndpoint := GetKibanaEndpoint()
 
 	cfg := &FleetConfig{
@@ -59,9 +46,17 @@ func NewFleetConfig(token string) (*FleetConfig, error) {
 		ElasticsearchURI:         esEndpoint.Host,
 		KibanaPort:               kbEndpoint.Port,
 		KibanaURI:                kbEndpoint.Host,
-		FleetServerPort:          fleetPort,
-		FleetServerURI:           fleetServer,
-		FleetServerScheme:        fleetServerScheme,
+		FleetServerPort:          8220,
+		FleetServerURI:           "fleet-server",
+		FleetServerScheme:        "http",
+	}
+
+	fleetServer := shell.GetEnv("FLEET_URL", "fleet-server")
+	if fleetServer != "fleet-server" {
+		err := cfg.SetFleetServerURL(utils.RemoveQuotes(fleetServer))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse FLEET_URL %s: %w", fleetServer, err)
+		}
 	}
 
 	log.WithFields(log.Fields{
@@ -74,13 +69,40 @@ func NewFleetConfig(token string) (*FleetConfig, error) {
 	return cfg, nil
 }
 
+// SetFleetServerURL makes the agents connect to the Fleet Server at the URL, i.e. https://fleet-server-lb:8220
+func (cfg *FleetConfig) SetFleetServerURL(fleetServerURL string) error {
+	u, err := url.Parse(fleetServerURL)
+	if err != nil {
+		return err
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return fmt.Errorf("could not determine the fleet port from %s: %v", fleetServerURL, err)
+	}
+
+	cfg.FleetServerPort, err = strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid fleet port in %s: %v", fleetServerURL, err)
+	}
+	cfg.FleetServerURI = host
+	cfg.FleetServerScheme = u.Scheme
+	return nil
+}
+
 // Flags bootstrap flags for fleet server
 func (cfg FleetConfig) Flags() []string {
-	flags := []string{
-		"--e", "--force", "--insecure", "--enrollment-token=" + cfg.EnrollmentToken,
-		"--url", cfg.FleetServerURL(),
+	flags := []string{"--e", "--force"}
+
+	// the connections are only verified when the CAs are known
+	if len(cfg.CertificateAuthorities) > 0 {
+		flags = append(flags, "--certificate-authorities="+strings.Join(cfg.CertificateAuthorities, ","))
+	} else {
+		flags = append(flags, "--insecure")
 	}
 
+	flags = append(flags, "--enrollment-token="+cfg.EnrollmentToken, "--url", cfg.FleetServerURL())
+
 	return flags
 }
 
@@ -0,0 +1,122 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// FleetServerHost represents a set of Fleet Server URLs the agents enroll and check in with
+type FleetServerHost struct {
+	ID              string   `json:"id,omitempty"`
+	Name            string   `json:"name"`
+	HostURLs        []string `json:"host_urls"`
+	IsDefault       bool     `json:"is_default"`
+	IsPreconfigured bool     `json:"is_preconfigured,omitempty"`
+	ProxyID         string   `json:"proxy_id,omitempty"`
+}
+
+// fleetServerHostRequest returns the host without its read-only fields, to be written with the Fleet Server hosts API
+func (h FleetServerHost) fleetServerHostRequest() FleetServerHost {
+	h.ID = ""
+	h.IsPreconfigured = false
+	return h
+}
+
+// ListFleetServerHosts returns the Fleet Server hosts
+func (c *Client) ListFleetServerHosts(ctx context.Context) ([]FleetServerHost, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing Fleet Server hosts", "fleet.fleet-server-hosts.list", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Items []FleetServerHost `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/fleet_server_hosts", FleetAPI), nil, &resp, "could not list Fleet Server hosts")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
+}
+
+// GetFleetServerHost returns a Fleet Server host by its ID
+func (c *Client) GetFleetServerHost(ctx context.Context, hostID string) (FleetServerHost, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Fleet Server host", "fleet.fleet-server-hosts.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Item FleetServerHost `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/fleet_server_hosts/%s", FleetAPI, hostID), nil, &resp, "could not get Fleet Server host")
+	if err != nil {
+		return FleetServerHost{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// CreateFleetServerHost creates a Fleet Server host, using its ID when present
+func (c *Client) CreateFleetServerHost(ctx context.Context, host FleetServerHost) (FleetServerHost, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating Fleet Server host", "fleet.fleet-server-hosts.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	reqBody := host.fleetServerHostRequest()
+	reqBody.ID = host.ID
+
+	var resp struct {
+		Item FleetServerHost `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/fleet_server_hosts", FleetAPI), reqBody, &resp, "could not create Fleet Server host")
+	if err != nil {
+		return FleetServerHost{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"id":   resp.Item.ID,
+		"urls": resp.Item.HostURLs,
+	}).Debug("Fleet Server host created")
+	return resp.Item, nil
+}
+
+// UpdateFleetServerHost updates a Fleet Server host by its ID
+func (c *Client) UpdateFleetServerHost(ctx context.Context, host FleetServerHost) (FleetServerHost, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating Fleet Server host", "fleet.fleet-server-hosts.update", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("hostID", host.ID)
+	defer span.End()
+
+	var resp struct {
+		Item FleetServerHost `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPut, fmt.Sprintf("%s/fleet_server_hosts/%s", FleetAPI, host.ID), host.fleetServerHostRequest(), &resp, "could not update Fleet Server host")
+	if err != nil {
+		return FleetServerHost{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// DeleteFleetServerHost deletes a Fleet Server host by its ID
+func (c *Client) DeleteFleetServerHost(ctx context.Context, hostID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting Fleet Server host", "fleet.fleet-server-hosts.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("hostID", hostID)
+	defer span.End()
+
+	return c.sendJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/fleet_server_hosts/%s", FleetAPI, hostID), nil, nil, "could not delete Fleet Server host")
+}
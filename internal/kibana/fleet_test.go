@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFleetConfig_Flags(t *testing.T) {
+	t.Setenv("FLEET_URL", "")
+
+	t.Run("Insecure connections to the default Fleet Server", func(t *testing.T) {
+		cfg, err := NewFleetConfig("token")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"--e", "--force", "--insecure", "--enrollment-token=token", "--url", "http://fleet-server:8220"}, cfg.Flags())
+	})
+
+	t.Run("Verified connections to a custom Fleet Server", func(t *testing.T) {
+		cfg, err := NewFleetConfig("token")
+		require.NoError(t, err)
+
+		require.NoError(t, cfg.SetFleetServerURL("https://fleet-server-lb:8221"))
+		cfg.CertificateAuthorities = []string{"/ca.pem"}
+
+		assert.Equal(t, []string{"--e", "--force", "--certificate-authorities=/ca.pem", "--enrollment-token=token", "--url", "https://fleet-server-lb:8221"}, cfg.Flags())
+	})
+
+	t.Run("URLs without port are rejected", func(t *testing.T) {
+		cfg, err := NewFleetConfig("token")
+		require.NoError(t, err)
+
+		assert.Error(t, cfg.SetFleetServerURL("https://fleet-server-lb"))
+	})
+
+	t.Run("Invalid Fleet Server URLs are reported", func(t *testing.T) {
+		t.Setenv("FLEET_URL", "https://fleet-server-lb")
+
+		_, err := NewFleetConfig("token")
+		assert.ErrorContains(t, err, "could not parse FLEET_URL")
+	})
+
+	t.Run("Invalid Elasticsearch settings are reported", func(t *testing.T) {
+		t.Setenv("ELASTICSEARCH_MAX_RETRIES", "many")
+
+		_, err := NewFleetConfig("token")
+		assert.ErrorContains(t, err, "invalid ELASTICSEARCH_MAX_RETRIES")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -76,7 +77,7 @@ func (c *Client) AddIntegrationToPolicy(ctx context.Context, packageDS PackageDa
 			}).Warn("could not add package to policy because of HTTP code is not 200")
 
 			retryCount++
-			return fmt.Errorf("could not add package to policy; API status code = %d; response body = %s", statusCode, respBody)
+			return newAPIError("could not add package to policy", statusCode, respBody)
 		}
 
 		return nil
@@ -90,6 +91,23 @@ func (c *Client) AddIntegrationToPolicy(ctx context.Context, packageDS PackageDa
 	return nil
 }
 
+// CreatePackagePolicy creates a package policy, returning it with the IDs assigned by Fleet
+func (c *Client) CreatePackagePolicy(ctx context.Context, packageDS PackageDataStream) (PackageDataStream, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating package policy", "fleet.package-policy.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("name", packageDS.Name)
+	defer span.End()
+
+	var resp ItemPackageDataStream
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/package_policies", FleetAPI), packageDS, &resp, "could not create package policy")
+	if err != nil {
+		return PackageDataStream{}, err
+	}
+
+	return resp.PackageDS, nil
+}
+
 // DeleteIntegrationFromPolicy adds an integration to policy
 func (c *Client) DeleteIntegrationFromPolicy(ctx context.Context, packageDS PackageDataStream) error {
 	span, _ := apm.StartSpanOptions(ctx, "Delete integration from policy", "fleet.integration.delete-from-policy", apm.SpanOptions{
@@ -104,7 +122,7 @@ func (c *Client) DeleteIntegrationFromPolicy(ctx context.Context, packageDS Pack
 	}
 
 	if statusCode != 200 {
-		return fmt.Errorf("could not delete integration from policy; API status code = %d; response body = %s", statusCode, respBody)
+		return newAPIError("could not delete integration from policy", statusCode, respBody)
 	}
 	return nil
 }
@@ -133,7 +151,7 @@ func (c *Client) GetIntegrations(ctx context.Context) ([]IntegrationPackage, err
 			"statusCode": statusCode,
 		}).Error("Could not get Fleet's installed integrations")
 
-		return nil, err
+		return nil, newAPIError("could not get Fleet's installed integrations", statusCode, respBody)
 	}
 
 	jsonParsed, err := gabs.ParseJSON(respBody)
@@ -297,7 +315,7 @@ func (c *Client) GetPackagePolicy(ctx context.Context, name string) (PackageData
 	}
 
 	if statusCode != 200 {
-		return PackageDataStream{}, fmt.Errorf("could not retrieve package policy; API status code = %d; response body = %s", statusCode, respBody)
+		return PackageDataStream{}, newAPIError("could not retrieve package policy", statusCode, respBody)
 	}
 
 	var item *ItemPackageDataStream
@@ -326,7 +344,7 @@ func (c *Client) GetMetadataFromSecurityApp(ctx context.Context) ([]SecurityEndp
 	}).Trace("Endpoint Metadata Response")
 
 	if statusCode != 200 {
-		return []SecurityEndpoint{}, fmt.Errorf("could not get endpoint metadata; API status code = %d; response body = %s", statusCode, respBody)
+		return []SecurityEndpoint{}, newAPIError("could not get endpoint metadata", statusCode, respBody)
 	}
 
 	var resp struct {
@@ -340,8 +358,9 @@ func (c *Client) GetMetadataFromSecurityApp(ctx context.Context) ([]SecurityEndp
 	return resp.Hosts, nil
 }
 
-// InstallIntegrationAssets sends a POST request to Fleet installing the assets for an integration
-func (c *Client) InstallIntegrationAssets(ctx context.Context, integration IntegrationPackage) (string, error) {
+// InstallIntegrationAssets sends a POST request to Fleet installing the assets for an integration, returning the
+// assets installed in Elasticsearch and Kibana
+func (c *Client) InstallIntegrationAssets(ctx context.Context, integration IntegrationPackage) ([]InstalledAsset, error) {
 	span, _ := apm.StartSpanOptions(ctx, "Installing assets for integration", "fleet.package.install-assets", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
@@ -350,24 +369,22 @@ func (c *Client) InstallIntegrationAssets(ctx context.Context, integration Integ
 	reqBody := `{}`
 	statusCode, respBody, err := c.post(ctx, fmt.Sprintf("%s/epm/packages/%s/%s", FleetAPI, integration.Name, integration.Version), []byte(reqBody))
 	if err != nil {
-		return "", errors.Wrap(err, "could not install integration assets")
+		return nil, errors.Wrap(err, "could not install integration assets")
 	}
 
 	if statusCode != 200 {
-		return "", fmt.Errorf("could not install integration assets; API status code = %d; response body = %s", statusCode, respBody)
+		return nil, newAPIError("could not install integration assets", statusCode, respBody)
 	}
 
 	var resp struct {
-		Items struct {
-			ID string `json:"id"`
-		} `json:"items"`
+		Items []InstalledAsset `json:"items"`
 	}
 
 	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", errors.Wrap(err, "Unable to convert install integration assets to JSON")
+		return nil, errors.Wrap(err, "Unable to convert install integration assets to JSON")
 	}
 
-	return resp.Items.ID, nil
+	return resp.Items, nil
 }
 
 // IsAgentListedInSecurityApp retrieves the hosts from Endpoint to check if a hostname
@@ -472,7 +489,7 @@ func (c *Client) UpdateIntegrationPackagePolicy(ctx context.Context, packageDS P
 	}
 
 	if statusCode != 200 {
-		return "", fmt.Errorf("could not update package ; API status code = %d; response body = %s", statusCode, respBody)
+		return "", newAPIError("could not update package", statusCode, respBody)
 	}
 	var resp struct {
 		Item struct {
@@ -0,0 +1,373 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/google/uuid"
+)
+
+// action represents an action sent to many agents, keeping the agents which did not acknowledge it yet
+type action struct {
+	status  kibana.ActionStatus
+	pending map[string]bool
+}
+
+// AckActions acknowledges the pending actions of an agent, as the agent would do after a checkin.
+// It returns the acknowledged actions
+func (s *Server) AckActions(agentID string) []kibana.AgentAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[agentID]
+	if !ok {
+		return nil
+	}
+
+	acked := append([]kibana.AgentAction{}, a.actions...)
+	for _, act := range acked {
+		s.ackAction(a, act.ID, "")
+	}
+	return acked
+}
+
+// FailAction makes an agent acknowledge an action with an error, as the agent would do
+// when it cannot execute it, i.e. a failed upgrade
+func (s *Server) FailAction(agentID string, actionID string, message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[agentID]
+	if !ok {
+		return false
+	}
+	return s.ackAction(a, actionID, message)
+}
+
+// sendAction sends the same action to the agents, tracking its status. Actions without agents are complete
+func (s *Server) sendAction(actionType string, data interface{}, agents []*agent) kibana.AgentAction {
+	act := kibana.AgentAction{ID: uuid.NewString(), Type: actionType, Data: data}
+
+	tracked := &action{
+		status: kibana.ActionStatus{
+			ActionID:              act.ID,
+			Type:                  actionType,
+			Status:                kibana.ActionStatusInProgress,
+			NbAgentsActionCreated: len(agents),
+			NbAgentsActioned:      len(agents),
+			CreationTime:          time.Now().UTC().Format(time.RFC3339),
+		},
+		pending: map[string]bool{},
+	}
+	tracked.status.StartTime = tracked.status.CreationTime
+
+	for _, a := range agents {
+		a.actions = append(a.actions, act)
+		tracked.pending[a.ID] = true
+	}
+
+	s.track(act.ID)
+	s.actions[act.ID] = tracked
+	s.completeAction(tracked)
+
+	return act
+}
+
+// sendCompletedAction tracks an action which Fleet applies to the agents by itself, i.e. updating their tags
+func (s *Server) sendCompletedAction(actionType string, agents []*agent) string {
+	act := s.sendAction(actionType, nil, nil)
+
+	tracked := s.actions[act.ID]
+	tracked.status.NbAgentsActionCreated = len(agents)
+	tracked.status.NbAgentsActioned = len(agents)
+	tracked.status.NbAgentsAck = len(agents)
+
+	return act.ID
+}
+
+// ackAction applies an action acknowledged by an agent, or records its error
+func (s *Server) ackAction(a *agent, actionID string, message string) bool {
+	for i, act := range a.actions {
+		if act.ID != actionID {
+			continue
+		}
+
+		a.actions = append(a.actions[:i], a.actions[i+1:]...)
+		if message == "" {
+			s.applyAction(a, act)
+		} else {
+			s.failAction(a, act, message)
+		}
+
+		if a.active && len(a.actions) == 0 && len(a.script) == 0 {
+			a.Status = StatusOnline
+		}
+
+		tracked, ok := s.actions[actionID]
+		if !ok {
+			// policy changes are not tracked by Fleet
+			return true
+		}
+
+		delete(tracked.pending, a.ID)
+		if message == "" {
+			tracked.status.NbAgentsAck++
+		} else {
+			tracked.status.NbAgentsFailed++
+			tracked.status.LatestErrors = append(tracked.status.LatestErrors, kibana.ActionError{
+				AgentID:   a.ID,
+				Error:     message,
+				Hostname:  a.LocalMetadata.Host.HostName,
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+			})
+		}
+		s.completeAction(tracked)
+		return true
+	}
+
+	return false
+}
+
+// completeAction finishes an action when no agents are pending
+func (s *Server) completeAction(tracked *action) {
+	if len(tracked.pending) > 0 {
+		return
+	}
+
+	tracked.status.Status = kibana.ActionStatusComplete
+	if tracked.status.NbAgentsFailed > 0 {
+		tracked.status.Status = kibana.ActionStatusFailed
+	}
+	tracked.status.CompletionTime = time.Now().UTC().Format(time.RFC3339)
+}
+
+func (s *Server) failAction(a *agent, act kibana.AgentAction, message string) {
+	if act.Type == "UPGRADE" && a.UpgradeDetails != nil {
+		a.UpgradeDetails.Metadata.FailedState = a.UpgradeDetails.State
+		a.UpgradeDetails.Metadata.ErrorMsg = message
+		a.UpgradeDetails.State = kibana.UpgradeStateFailed
+	}
+}
+
+// selectAgents returns the active agents of a bulk request, selected by their IDs or by a KQL query
+func (s *Server) selectAgents(raw json.RawMessage) ([]*agent, error) {
+	var ids []string
+	if err := json.Unmarshal(raw, &ids); err == nil {
+		agents := []*agent{}
+		for _, id := range ids {
+			a, ok := s.agents[id]
+			if !ok || !a.active {
+				return nil, fmt.Errorf("Agent %s not found", id)
+			}
+			agents = append(agents, a)
+		}
+		return agents, nil
+	}
+
+	var query string
+	if err := json.Unmarshal(raw, &query); err != nil {
+		return nil, fmt.Errorf("agents must be a list of IDs or a KQL query")
+	}
+
+	// only the queries by policy and by tag are supported, i.e. policy_id:"policy-1" or tags:e2e
+	field, value, ok := strings.Cut(query, ":")
+	if !ok || (field != "policy_id" && field != "tags") {
+		return nil, fmt.Errorf("the query %s is not supported", query)
+	}
+	value = strings.Trim(value, `"`)
+
+	agents := []*agent{}
+	for _, id := range s.sortedIDs(s.activeAgentIDs()) {
+		a := s.agents[id]
+		if (field == "policy_id" && a.PolicyID == value) || (field == "tags" && hasTag(a.Tags, value)) {
+			agents = append(agents, a)
+		}
+	}
+	return agents, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// actionStatus serves the status of the actions, the latest first
+func (s *Server) actionStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for id := range s.actions {
+		ids = append(ids, id)
+	}
+
+	ids = s.sortedIDs(ids)
+	items := []kibana.ActionStatus{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		items = append(items, s.actions[ids[i]].status)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) bulkUpgrade(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Agents                 json.RawMessage `json:"agents"`
+		Version                string          `json:"version"`
+		SourceURI              string          `json:"source_uri"`
+		RolloutDurationSeconds int             `json:"rollout_duration_seconds"`
+		StartTime              string          `json:"start_time"`
+		Force                  bool            `json:"force"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RolloutDurationSeconds > 0 && req.RolloutDurationSeconds < int(kibana.MinRolloutDuration.Seconds()) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[request body.rollout_duration_seconds]: Value must be equal to or greater than [%d].", int(kibana.MinRolloutDuration.Seconds())))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents, err := s.selectAgents(req.Agents)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the agents already running the version are not upgradeable, unless forced
+	upgradeable := []*agent{}
+	for _, a := range agents {
+		if req.Force || a.LocalMetadata.Elastic.Agent.Version != req.Version {
+			upgradeable = append(upgradeable, a)
+		}
+	}
+
+	act := s.sendAction("UPGRADE", map[string]interface{}{"version": req.Version, "source_uri": req.SourceURI}, upgradeable)
+	for _, a := range upgradeable {
+		requestUpgrade(a, act.ID, req.Version)
+	}
+
+	status := &s.actions[act.ID].status
+	status.Version = req.Version
+	if req.StartTime != "" {
+		status.StartTime = req.StartTime
+	}
+	if req.RolloutDurationSeconds > 0 {
+		start, err := time.Parse(time.RFC3339, status.StartTime)
+		if err == nil {
+			status.Expiration = start.Add(time.Duration(req.RolloutDurationSeconds) * time.Second).Format(time.RFC3339)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"actionId": act.ID})
+}
+
+func (s *Server) bulkReassign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Agents   json.RawMessage `json:"agents"`
+		PolicyID string          `json:"policy_id"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[req.PolicyID]; !ok {
+		writeError(w, http.StatusNotFound, "Agent policy "+req.PolicyID+" not found")
+		return
+	}
+
+	agents, err := s.selectAgents(req.Agents)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	act := s.reassign(agents, req.PolicyID)
+	writeJSON(w, http.StatusOK, map[string]string{"actionId": act.ID})
+}
+
+func (s *Server) bulkUnenroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Agents json.RawMessage `json:"agents"`
+		Revoke bool            `json:"revoke"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents, err := s.selectAgents(req.Agents)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var actionID string
+	if req.Revoke {
+		for _, a := range agents {
+			revoke(a)
+		}
+		actionID = s.sendCompletedAction("UNENROLL", agents)
+	} else {
+		actionID = s.unenroll(agents).ID
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"actionId": actionID})
+}
+
+func (s *Server) bulkUpdateTags(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Agents       json.RawMessage `json:"agents"`
+		TagsToAdd    []string        `json:"tagsToAdd"`
+		TagsToRemove []string        `json:"tagsToRemove"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents, err := s.selectAgents(req.Agents)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, a := range agents {
+		tags := []string{}
+		for _, tag := range a.Tags {
+			if !hasTag(req.TagsToRemove, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		for _, tag := range req.TagsToAdd {
+			if !hasTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		a.Tags = tags
+	}
+
+	actionID := s.sendCompletedAction("UPDATE_TAGS", agents)
+	writeJSON(w, http.StatusOK, map[string]string{"actionId": actionID})
+}
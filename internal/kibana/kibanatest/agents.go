@@ -0,0 +1,484 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/google/uuid"
+)
+
+const (
+	// StatusOffline the agent did not check in for a while
+	StatusOffline = "offline"
+	// StatusOnline the agent checked in and is healthy
+	StatusOnline = "online"
+	// StatusUnenrolled the agent was unenrolled, being inactive
+	StatusUnenrolled = "unenrolled"
+	// StatusUnenrolling the agent has an unenroll action which was not acknowledged yet
+	StatusUnenrolling = "unenrolling"
+	// StatusUpdating the agent has a policy change or an upgrade which was not acknowledged yet
+	StatusUpdating = "updating"
+)
+
+// EnrollRequest represents the metadata an agent sends to Fleet Server when enrolling
+type EnrollRequest struct {
+	Hostname string
+	Platform string
+	Version  string
+}
+
+// Enroll enrolls an agent with an enrollment API key, as the agent would do against Fleet Server.
+// It returns the ID and access API key of the agent, or an error if the key is unknown or revoked
+func (s *Server) Enroll(enrollmentKey string, req EnrollRequest) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enrollAgent(enrollmentKey, req)
+}
+
+func (s *Server) enrollAgent(enrollmentKey string, req EnrollRequest) (string, string, error) {
+	var key *kibana.EnrollmentAPIKey
+	for _, k := range s.enrollmentKeys {
+		if k.APIKey == enrollmentKey {
+			key = k
+			break
+		}
+	}
+
+	if key == nil || !key.Active {
+		return "", "", &kibana.APIError{
+			Message:    "could not enroll agent",
+			StatusCode: http.StatusUnauthorized,
+			Body:       `{"statusCode":401,"error":"ErrInvalidToken","message":"enrollment API key is invalid or revoked"}`,
+		}
+	}
+
+	// Elasticsearch rejects the expired API keys, although Fleet keeps them as active
+	if expiresAt, ok := s.keyExpirations[key.ID]; ok && time.Now().After(expiresAt) {
+		return "", "", &kibana.APIError{
+			Message:    "could not enroll agent",
+			StatusCode: http.StatusUnauthorized,
+			Body:       `{"statusCode":401,"error":"ErrInvalidToken","message":"enrollment API key is expired"}`,
+		}
+	}
+
+	policy, ok := s.policies[key.PolicyID]
+	if !ok {
+		return "", "", &kibana.APIError{
+			Message:    "could not enroll agent",
+			StatusCode: http.StatusNotFound,
+			Body:       `{"statusCode":404,"error":"ErrAgentPolicyNotFound","message":"agent policy ` + key.PolicyID + ` not found"}`,
+		}
+	}
+
+	a := &agent{
+		accessAPIKey: strings.ReplaceAll(uuid.NewString(), "-", ""),
+		active:       true,
+	}
+	a.ID = s.nextID("agent")
+	a.PolicyID = policy.ID
+	a.Status = StatusUpdating
+	a.EnrolledAt = time.Now().UTC().Format(time.RFC3339Nano)
+	a.LocalMetadata.Host.Name = req.Hostname
+	a.LocalMetadata.Host.HostName = req.Hostname
+	a.LocalMetadata.OS.Platform = req.Platform
+	a.LocalMetadata.Elastic.Agent.Version = req.Version
+	a.actions = []kibana.AgentAction{
+		{
+			ID:   uuid.NewString(),
+			Type: "POLICY_CHANGE",
+			Data: map[string]interface{}{"policy": map[string]interface{}{"id": policy.ID, "revision": policy.Revision}},
+		},
+	}
+	s.agents[a.ID] = a
+
+	return a.ID, a.accessAPIKey, nil
+}
+
+// Agent returns an agent by ID, including the inactive ones
+func (s *Server) Agent(id string) (kibana.Agent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[id]
+	if !ok {
+		return kibana.Agent{}, false
+	}
+	return a.Agent, true
+}
+
+// Agents returns the active agents, in enrollment order
+func (s *Server) Agents() []kibana.Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.agentList()
+}
+
+func (s *Server) agentList() []kibana.Agent {
+	items := []kibana.Agent{}
+	for _, id := range s.sortedIDs(s.activeAgentIDs()) {
+		items = append(items, s.agents[id].Agent)
+	}
+	return items
+}
+
+func (s *Server) activeAgentIDs() []string {
+	ids := []string{}
+	for id, a := range s.agents {
+		if a.active {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SetAgentStatus sets the status of an agent, i.e. to simulate an offline agent.
+// It replaces the scripted statuses of the agent
+func (s *Server) SetAgentStatus(id string, status string) bool {
+	return s.ScriptAgentStatus(id, status)
+}
+
+// ScriptAgentStatus makes an agent go through the statuses, one each time it's read by ID,
+// staying in the last one. It's meant to test the steps polling for an agent status
+func (s *Server) ScriptAgentStatus(id string, statuses ...string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[id]
+	if !ok || len(statuses) == 0 {
+		return false
+	}
+
+	a.Status = statuses[0]
+	a.script = statuses[1:]
+	return true
+}
+
+// PendingActions returns the actions that were not acknowledged by an agent yet
+func (s *Server) PendingActions(id string) []kibana.AgentAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[id]
+	if !ok {
+		return nil
+	}
+	return append([]kibana.AgentAction{}, a.actions...)
+}
+
+func (s *Server) listAgents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	space := spaceOf(r)
+	items := []kibana.Agent{}
+	for _, a := range s.agentList() {
+		if s.policyInSpace(a.PolicyID, space) {
+			items = append(items, a)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "list": items, "total": len(items), "page": 1, "perPage": 20})
+}
+
+func (s *Server) getAgent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Agent "+r.PathValue("id")+" not found")
+		return
+	}
+
+	item := a.Agent
+	if len(a.script) > 0 {
+		a.Status = a.script[0]
+		a.script = a.script[1:]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": item})
+}
+
+func (s *Server) unenrollAgent(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Revoke bool `json:"revoke"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok || !a.active {
+		writeError(w, http.StatusNotFound, "Agent "+r.PathValue("id")+" not found")
+		return
+	}
+
+	if req.Revoke {
+		revoke(a)
+	} else {
+		s.unenroll([]*agent{a})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) upgradeAgent(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version   string `json:"version"`
+		SourceURI string `json:"source_uri"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok || !a.active {
+		writeError(w, http.StatusNotFound, "Agent "+r.PathValue("id")+" not found")
+		return
+	}
+
+	if a.LocalMetadata.Elastic.Agent.Version == req.Version {
+		writeError(w, http.StatusBadRequest, "Agent "+a.ID+" is not upgradeable: agent is already running version "+req.Version)
+		return
+	}
+
+	act := s.sendAction("UPGRADE", map[string]interface{}{"version": req.Version, "source_uri": req.SourceURI}, []*agent{a})
+	requestUpgrade(a, act.ID, req.Version)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) reassignAgent(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PolicyID string `json:"policy_id"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok || !a.active {
+		writeError(w, http.StatusNotFound, "Agent "+r.PathValue("id")+" not found")
+		return
+	}
+
+	if _, ok := s.policies[req.PolicyID]; !ok {
+		writeError(w, http.StatusNotFound, "Agent policy "+req.PolicyID+" not found")
+		return
+	}
+
+	s.reassign([]*agent{a}, req.PolicyID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+// reassign assigns the agents to a policy, which they apply when acknowledging the action
+func (s *Server) reassign(agents []*agent, policyID string) kibana.AgentAction {
+	for _, a := range agents {
+		a.PolicyID = policyID
+		a.PolicyRevision = 0
+		a.Status = StatusUpdating
+	}
+
+	return s.sendAction("POLICY_REASSIGN", map[string]interface{}{"policy_id": policyID}, agents)
+}
+
+// unenroll sends the unenroll action to the agents, which become inactive when acknowledging it
+func (s *Server) unenroll(agents []*agent) kibana.AgentAction {
+	for _, a := range agents {
+		a.Status = StatusUnenrolling
+	}
+
+	return s.sendAction("UNENROLL", nil, agents)
+}
+
+// revoke invalidates the API keys of the agent right away, so it cannot check in anymore
+func revoke(a *agent) {
+	a.active = false
+	a.Status = StatusUnenrolled
+	a.actions = nil
+}
+
+// requestUpgrade sets the upgrade details of an agent receiving an upgrade action
+func requestUpgrade(a *agent, actionID string, version string) {
+	a.Status = StatusUpdating
+	a.UpgradeStartedAt = time.Now().UTC().Format(time.RFC3339)
+	a.UpgradeDetails = &kibana.UpgradeDetails{
+		ActionID:      actionID,
+		State:         kibana.UpgradeStateRequested,
+		TargetVersion: version,
+	}
+}
+
+// enroll serves the Fleet Server enroll API, authenticated with the enrollment API key
+func (s *Server) enroll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type     string `json:"type"`
+		Metadata struct {
+			Local struct {
+				Host struct {
+					Hostname string `json:"hostname"`
+				} `json:"host"`
+				OS struct {
+					Platform string `json:"platform"`
+				} `json:"os"`
+				Elastic struct {
+					Agent struct {
+						Version string `json:"version"`
+					} `json:"agent"`
+				} `json:"elastic"`
+			} `json:"local"`
+		} `json:"metadata"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	local := req.Metadata.Local
+	id, accessAPIKey, err := s.enrollAgent(apiKey(r), EnrollRequest{
+		Hostname: local.Host.Hostname,
+		Platform: local.OS.Platform,
+		Version:  local.Elastic.Agent.Version,
+	})
+	if err != nil {
+		apiErr := err.(*kibana.APIError)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(apiErr.StatusCode)
+		_, _ = w.Write([]byte(apiErr.Body))
+		return
+	}
+
+	a := s.agents[id]
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action": "created",
+		"item": map[string]interface{}{
+			"id":             id,
+			"active":         true,
+			"policy_id":      a.PolicyID,
+			"type":           req.Type,
+			"access_api_key": accessAPIKey,
+		},
+	})
+}
+
+// authorizedAgent returns the agent of the request, authenticated with its access API key
+func (s *Server) authorizedAgent(w http.ResponseWriter, r *http.Request) (*agent, bool) {
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok || !a.active || a.accessAPIKey != apiKey(r) {
+		writeError(w, http.StatusUnauthorized, "ErrAPIKeyNotEnabled")
+		return nil, false
+	}
+	return a, true
+}
+
+// checkin serves the Fleet Server checkin API, delivering the pending actions to the agent
+func (s *Server) checkin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.authorizedAgent(w, r)
+	if !ok {
+		return
+	}
+
+	a.LastCheckin = time.Now().UTC().Format(time.RFC3339Nano)
+	if len(a.actions) == 0 && len(a.script) == 0 {
+		a.Status = StatusOnline
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action":    "checkin",
+		"ack_token": uuid.NewString(),
+		"actions":   append([]kibana.AgentAction{}, a.actions...),
+	})
+}
+
+// ack serves the Fleet Server acks API, applying the acknowledged actions to the agent
+func (s *Server) ack(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Events []struct {
+			ActionID string `json:"action_id"`
+			Error    string `json:"error"`
+		} `json:"events"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.authorizedAgent(w, r)
+	if !ok {
+		return
+	}
+
+	for _, event := range req.Events {
+		s.ackAction(a, event.ActionID, event.Error)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"action": "acks", "errors": false})
+}
+
+// runOutput makes the agent run the data output of the policy, with a healthy component sending its events
+func (s *Server) runOutput(a *agent, p *kibana.Policy) {
+	key, output := s.agentOutput(p)
+	a.Outputs = map[string]*kibana.PolicyOutput{
+		key: {Type: output.Type},
+	}
+
+	componentID := "filestream-" + key
+	a.Components = []kibana.AgentComponent{
+		{
+			ID:     componentID,
+			Type:   "filestream",
+			Status: kibana.ComponentStatusHealthy,
+			Units: []kibana.AgentComponentUnit{
+				{ID: componentID, Type: "output", Status: kibana.ComponentStatusHealthy},
+				{ID: componentID + "-" + p.ID, Type: "input", Status: kibana.ComponentStatusHealthy},
+			},
+		},
+	}
+}
+
+func (s *Server) applyAction(a *agent, action kibana.AgentAction) {
+	data, _ := action.Data.(map[string]interface{})
+
+	switch action.Type {
+	case "POLICY_CHANGE", "POLICY_REASSIGN":
+		if p, ok := s.policies[a.PolicyID]; ok {
+			a.PolicyRevision = p.Revision
+			s.runOutput(a, p)
+		}
+	case "UNENROLL":
+		a.active = false
+		a.Status = StatusUnenrolled
+	case "UPGRADE":
+		if version, ok := data["version"].(string); ok {
+			a.LocalMetadata.Elastic.Agent.Version = version
+		}
+		a.UpgradeDetails = nil
+		a.UpgradedAt = time.Now().UTC().Format(time.RFC3339)
+	case "REQUEST_DIAGNOSTICS":
+		s.uploadDiagnostics(a, action.ID)
+	}
+}
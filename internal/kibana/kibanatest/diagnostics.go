@@ -0,0 +1,92 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/google/uuid"
+)
+
+// upload represents a file uploaded by an agent
+type upload struct {
+	kibana.AgentUpload
+	agentID string
+	content []byte
+}
+
+// uploadDiagnostics uploads the diagnostics bundle of an agent, as the agent would do when it acknowledges
+// the action requesting it
+func (s *Server) uploadDiagnostics(a *agent, actionID string) {
+	id := uuid.NewString()
+	s.track(id)
+
+	name := fmt.Sprintf("elastic-agent-diagnostics-%s-%s.zip", a.LocalMetadata.Host.HostName, id)
+	s.uploads[id] = &upload{
+		AgentUpload: kibana.AgentUpload{
+			ID:         id,
+			Name:       name,
+			FilePath:   fmt.Sprintf("%s/agents/files/%s/%s", kibana.FleetAPI, id, name),
+			CreateTime: time.Now().UTC().Format(time.RFC3339),
+			Status:     kibana.AgentUploadStatusReady,
+			ActionID:   actionID,
+		},
+		agentID: a.ID,
+		content: []byte("diagnostics of " + a.ID),
+	}
+}
+
+func (s *Server) requestDiagnostics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.agents[r.PathValue("id")]
+	if !ok || !a.active {
+		writeError(w, http.StatusNotFound, "Agent "+r.PathValue("id")+" not found")
+		return
+	}
+
+	act := s.sendAction("REQUEST_DIAGNOSTICS", map[string]interface{}{}, []*agent{a})
+	writeJSON(w, http.StatusOK, map[string]string{"actionId": act.ID})
+}
+
+// listUploads serves the files uploaded by an agent, the latest first
+func (s *Server) listUploads(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for id, u := range s.uploads {
+		if u.agentID == r.PathValue("id") {
+			ids = append(ids, id)
+		}
+	}
+
+	ids = s.sortedIDs(ids)
+	items := []kibana.AgentUpload{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		items = append(items, s.uploads[ids[i]].AgentUpload)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) downloadUpload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[r.PathValue("id")]
+	if !ok || u.Name != r.PathValue("name") {
+		writeError(w, http.StatusNotFound, "File "+r.PathValue("id")+" not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(u.content)
+}
@@ -0,0 +1,201 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+)
+
+// defaultOutput the default output of the fake, as preconfigured by the Fleet profile
+var defaultOutput = kibana.Output{
+	ID:                  "fleet-default-output",
+	Name:                "default",
+	Type:                kibana.OutputTypeElasticsearch,
+	Hosts:               []string{"http://elasticsearch:9200"},
+	IsDefault:           true,
+	IsDefaultMonitoring: true,
+	IsPreconfigured:     true,
+}
+
+// Outputs returns the outputs, in creation order
+func (s *Server) Outputs() []kibana.Output {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.outputList()
+}
+
+// SetOutputHealth sets the health of an output, as the agents and Fleet Server report it, i.e. HEALTHY or DEGRADED
+func (s *Server) SetOutputHealth(outputID string, state string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outputHealth[outputID] = kibana.OutputHealth{State: state, Message: message, Timestamp: time.Now().UTC().Format(time.RFC3339)}
+}
+
+// agentOutput returns the key of the data output of a policy in the agents running it, with the output.
+// The default output is keyed as default, the others by their ID
+func (s *Server) agentOutput(p *kibana.Policy) (string, kibana.Output) {
+	if o, ok := s.outputs[p.DataOutputID]; ok && !o.IsDefault {
+		return o.ID, *o
+	}
+
+	for _, o := range s.outputs {
+		if o.IsDefault {
+			return "default", *o
+		}
+	}
+	return "default", defaultOutput
+}
+
+func (s *Server) outputList() []kibana.Output {
+	ids := []string{}
+	for id := range s.outputs {
+		ids = append(ids, id)
+	}
+
+	items := []kibana.Output{}
+	for _, id := range s.sortedIDs(ids) {
+		items = append(items, *s.outputs[id])
+	}
+	return items
+}
+
+func (s *Server) listOutputs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.outputList()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "total": len(items)})
+}
+
+func (s *Server) getOutputHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.outputs[r.PathValue("id")]; !ok {
+		writeError(w, http.StatusNotFound, "Output "+r.PathValue("id")+" not found")
+		return
+	}
+
+	// the outputs without reported health have an empty state
+	writeJSON(w, http.StatusOK, s.outputHealth[r.PathValue("id")])
+}
+
+func (s *Server) createOutput(w http.ResponseWriter, r *http.Request) {
+	var o kibana.Output
+	if !decodeJSON(w, r, &o) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o.Name == "" || o.Type == "" {
+		writeError(w, http.StatusBadRequest, "[request body]: name and type are required")
+		return
+	}
+	if o.Type == kibana.OutputTypeKafka && o.Topic == "" {
+		writeError(w, http.StatusBadRequest, "[request body.topic]: a topic is required for kafka outputs")
+		return
+	}
+	for _, existing := range s.outputs {
+		if existing.Name == o.Name || (o.ID != "" && existing.ID == o.ID) {
+			writeError(w, http.StatusConflict, "Output "+o.Name+" already exists")
+			return
+		}
+	}
+
+	if o.ID == "" {
+		o.ID = s.nextID("output")
+	} else {
+		s.track(o.ID)
+	}
+	s.outputs[o.ID] = &o
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": o})
+}
+
+func (s *Server) getOutput(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.outputs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Output "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": o})
+}
+
+func (s *Server) updateOutput(w http.ResponseWriter, r *http.Request) {
+	var update kibana.Output
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.outputs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Output "+r.PathValue("id")+" not found")
+		return
+	}
+	if o.IsPreconfigured {
+		writeError(w, http.StatusBadRequest, "Preconfigured output "+o.ID+" cannot be updated outside of kibana config file.")
+		return
+	}
+
+	update.ID = o.ID
+	*o = update
+
+	// the policies using the output get a new revision with the new settings
+	for _, p := range s.policies {
+		if p.DataOutputID == o.ID || p.MonitoringOutputID == o.ID {
+			s.bumpRevision(p.ID)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": o})
+}
+
+func (s *Server) deleteOutput(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.outputs[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Output "+r.PathValue("id")+" not found")
+		return
+	}
+	if o.IsPreconfigured || o.IsDefault {
+		writeError(w, http.StatusBadRequest, "Output "+o.ID+" cannot be deleted")
+		return
+	}
+
+	// the policies using the output fall back to the default one
+	for _, p := range s.policies {
+		changed := false
+		if p.DataOutputID == o.ID {
+			p.DataOutputID = ""
+			changed = true
+		}
+		if p.MonitoringOutputID == o.ID {
+			p.MonitoringOutputID = ""
+			changed = true
+		}
+		if changed {
+			s.bumpRevision(p.ID)
+		}
+	}
+
+	delete(s.outputs, o.ID)
+	writeJSON(w, http.StatusOK, map[string]string{"id": o.ID})
+}
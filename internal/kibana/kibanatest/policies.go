@@ -0,0 +1,480 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/google/uuid"
+)
+
+// Policies returns the agent policies, in creation order
+func (s *Server) Policies() []kibana.Policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.policyList()
+}
+
+func (s *Server) policyList() []kibana.Policy {
+	ids := []string{}
+	for id := range s.policies {
+		ids = append(ids, id)
+	}
+
+	items := []kibana.Policy{}
+	for _, id := range s.sortedIDs(ids) {
+		p := *s.policies[id]
+		p.AgentsCount = 0
+		for _, a := range s.agents {
+			if a.active && a.PolicyID == id {
+				p.AgentsCount++
+			}
+		}
+		items = append(items, p)
+	}
+	return items
+}
+
+func (s *Server) listPolicies(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	space := spaceOf(r)
+	items := []kibana.Policy{}
+	for _, p := range s.policyList() {
+		if s.policyInSpace(p.ID, space) {
+			items = append(items, p)
+		}
+	}
+
+	page, perPage, start, end := pageOf(r, len(items))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items[start:end], "total": len(items), "page": page, "perPage": perPage})
+}
+
+func (s *Server) createPolicy(w http.ResponseWriter, r *http.Request) {
+	var p kibana.Policy
+	if !decodeJSON(w, r, &p) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.Name == "" {
+		writeError(w, http.StatusBadRequest, "[request body.name]: expected value of type [string] but got [undefined]")
+		return
+	}
+	for _, existing := range s.policies {
+		if existing.Name == p.Name {
+			writeError(w, http.StatusConflict, "An agent policy with name '"+p.Name+"' already exists")
+			return
+		}
+	}
+
+	p.ID = s.nextID("policy")
+	p.Revision = 1
+	p.Status = "active"
+	p.SpaceIDs = nil
+	if s.spaceAware {
+		p.SpaceIDs = []string{spaceOf(r)}
+	}
+	s.policies[p.ID] = &p
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": p})
+}
+
+func (s *Server) getPolicy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.policies[r.PathValue("id")]
+	if !ok || !s.policyInSpace(p.ID, spaceOf(r)) {
+		writeError(w, http.StatusNotFound, "Agent policy "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": p})
+}
+
+func (s *Server) updatePolicy(w http.ResponseWriter, r *http.Request) {
+	var update kibana.Policy
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.policies[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Agent policy "+r.PathValue("id")+" not found")
+		return
+	}
+
+	update.ID = p.ID
+	update.Revision = p.Revision
+	update.IsDefault = p.IsDefault
+	update.IsDefaultFleetServer = p.IsDefaultFleetServer
+	update.IsManaged = p.IsManaged
+	update.Status = p.Status
+	update.SpaceIDs = p.SpaceIDs
+	*p = update
+	s.bumpRevision(p.ID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": p})
+}
+
+func (s *Server) deletePolicy(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentPolicyID string `json:"agentPolicyId"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[req.AgentPolicyID]; !ok {
+		writeError(w, http.StatusNotFound, "Agent policy "+req.AgentPolicyID+" not found")
+		return
+	}
+
+	for _, a := range s.agents {
+		if a.active && a.PolicyID == req.AgentPolicyID {
+			writeError(w, http.StatusBadRequest, "Cannot delete an agent policy that is assigned to any active or pending agents")
+			return
+		}
+	}
+
+	delete(s.policies, req.AgentPolicyID)
+	writeJSON(w, http.StatusOK, map[string]string{"id": req.AgentPolicyID})
+}
+
+func (s *Server) listPackages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := append([]kibana.IntegrationPackage{}, s.packages...)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) getPackage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, version := r.PathValue("name"), r.PathValue("version")
+	prefix := path.Join(name, version) + "/"
+
+	assets := []string{}
+	for key := range s.packageFiles {
+		if strings.HasPrefix(key, prefix) {
+			assets = append(assets, "/package/"+key)
+		}
+	}
+	sort.Strings(assets)
+
+	for _, pkg := range s.packages {
+		if pkg.Name == name && pkg.Version == version {
+			item := map[string]interface{}{"name": name, "version": version, "title": pkg.Title, "assets": assets, "status": "not_installed"}
+			if installation, ok := s.installations[path.Join(name, version)]; ok && installation.Status == kibana.PackageInstalled {
+				item["status"] = installation.Status
+				item["installationInfo"] = map[string]interface{}{"installed_es": installation.Elasticsearch, "installed_kibana": installation.Kibana}
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"item": item})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("%s@%s not found", name, version))
+}
+
+func (s *Server) installPackage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installation, ok := s.installations[path.Join(r.PathValue("name"), r.PathValue("version"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s@%s not found", r.PathValue("name"), r.PathValue("version")))
+		return
+	}
+	installation.Status = kibana.PackageInstalled
+
+	items := append(append([]kibana.InstalledAsset{}, installation.Elasticsearch...), installation.Kibana...)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) uninstallPackage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installation, ok := s.installations[path.Join(r.PathValue("name"), r.PathValue("version"))]
+	if !ok || installation.Status != kibana.PackageInstalled {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s is not installed", r.PathValue("name")))
+		return
+	}
+	installation.Status = "not_installed"
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": installation.Kibana})
+}
+
+// getSavedObject returns the saved objects installed by the packages
+func (s *Server) getSavedObject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, installation := range s.installations {
+		if installation.Status != kibana.PackageInstalled {
+			continue
+		}
+		for _, asset := range installation.Kibana {
+			if asset.Type == r.PathValue("type") && asset.ID == r.PathValue("id") {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"id": asset.ID, "type": asset.Type})
+				return
+			}
+		}
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("Saved object [%s/%s] not found", r.PathValue("type"), r.PathValue("id")))
+}
+
+func (s *Server) getPackageFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.packageFiles[path.Join(r.PathValue("name"), r.PathValue("version"), r.PathValue("path"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	_, _ = w.Write(content)
+}
+
+func (s *Server) listPackagePolicies(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for id := range s.packagePolicies {
+		ids = append(ids, id)
+	}
+
+	items := []kibana.PackageDataStream{}
+	for _, id := range s.sortedIDs(ids) {
+		items = append(items, *s.packagePolicies[id])
+	}
+
+	page, perPage, start, end := pageOf(r, len(items))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items[start:end], "total": len(items), "page": page, "perPage": perPage})
+}
+
+func (s *Server) createPackagePolicy(w http.ResponseWriter, r *http.Request) {
+	var pp kibana.PackageDataStream
+	if !decodeJSON(w, r, &pp) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[pp.PolicyID]; !ok {
+		writeError(w, http.StatusNotFound, "Agent policy "+pp.PolicyID+" not found")
+		return
+	}
+
+	for _, existing := range s.packagePolicies {
+		if existing.Name == pp.Name {
+			writeError(w, http.StatusConflict, "An integration policy with the name "+pp.Name+" already exists")
+			return
+		}
+	}
+
+	pp.ID = s.nextID("package-policy")
+	for i := range pp.Inputs {
+		for j := range pp.Inputs[i].Streams {
+			if pp.Inputs[i].Streams[j].ID == "" {
+				pp.Inputs[i].Streams[j].ID = pp.Inputs[i].Type + "-" + pp.Inputs[i].Streams[j].DS.Dataset + "-" + uuid.NewString()
+			}
+		}
+	}
+	s.packagePolicies[pp.ID] = &pp
+	s.bumpRevision(pp.PolicyID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": pp})
+}
+
+func (s *Server) getPackagePolicy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pp, ok := s.packagePolicies[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Package policy "+r.PathValue("id")+" not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": pp})
+}
+
+func (s *Server) updatePackagePolicy(w http.ResponseWriter, r *http.Request) {
+	var update kibana.PackageDataStream
+	if !decodeJSON(w, r, &update) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pp, ok := s.packagePolicies[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Package policy "+r.PathValue("id")+" not found")
+		return
+	}
+
+	update.ID = pp.ID
+	*pp = update
+	s.bumpRevision(pp.PolicyID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"item": pp})
+}
+
+func (s *Server) deletePackagePolicies(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PackagePolicyIDs []string `json:"packagePolicyIds"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []map[string]interface{}{}
+	for _, id := range req.PackagePolicyIDs {
+		pp, ok := s.packagePolicies[id]
+		if !ok {
+			results = append(results, map[string]interface{}{"id": id, "success": false, "body": map[string]string{"message": "Package policy " + id + " not found"}})
+			continue
+		}
+
+		delete(s.packagePolicies, id)
+		s.bumpRevision(pp.PolicyID)
+		results = append(results, map[string]interface{}{"id": id, "name": pp.Name, "success": true})
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// EnrollmentKeys returns the enrollment API keys, including the revoked ones
+func (s *Server) EnrollmentKeys() []kibana.EnrollmentAPIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enrollmentKeyList()
+}
+
+func (s *Server) enrollmentKeyList() []kibana.EnrollmentAPIKey {
+	ids := []string{}
+	for id := range s.enrollmentKeys {
+		ids = append(ids, id)
+	}
+
+	items := []kibana.EnrollmentAPIKey{}
+	for _, id := range s.sortedIDs(ids) {
+		items = append(items, *s.enrollmentKeys[id])
+	}
+	return items
+}
+
+func (s *Server) listEnrollmentKeys(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// only the kuery filtering by policy is supported, i.e. policy_id:"policy-1"
+	policyID := strings.Trim(strings.TrimPrefix(r.URL.Query().Get("kuery"), "policy_id:"), `"`)
+
+	space := spaceOf(r)
+	items := []kibana.EnrollmentAPIKey{}
+	for _, key := range s.enrollmentKeyList() {
+		if (policyID == "" || key.PolicyID == policyID) && s.policyInSpace(key.PolicyID, space) {
+			items = append(items, key)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "list": items, "total": len(items)})
+}
+
+func (s *Server) createEnrollmentKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Expiration string `json:"expiration"`
+		Name       string `json:"name"`
+		PolicyID   string `json:"policy_id"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.policyInSpace(req.PolicyID, spaceOf(r)) {
+		writeError(w, http.StatusBadRequest, "Agent policy "+req.PolicyID+" not found")
+		return
+	}
+
+	var expiration time.Duration
+	if req.Expiration != "" {
+		var err error
+		expiration, err = time.ParseDuration(req.Expiration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expiration "+req.Expiration)
+			return
+		}
+	}
+
+	id := s.nextID("enrollment-key")
+	name := id
+	if req.Name != "" {
+		name = req.Name + " (" + id + ")"
+	}
+
+	key := &kibana.EnrollmentAPIKey{
+		Active:   true,
+		APIKey:   strings.ReplaceAll(uuid.NewString(), "-", ""),
+		APIKeyID: uuid.NewString(),
+		ID:       id,
+		Name:     name,
+		PolicyID: req.PolicyID,
+	}
+	s.enrollmentKeys[id] = key
+	if expiration > 0 {
+		s.keyExpirations[id] = time.Now().Add(expiration)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"action": "created", "item": key})
+}
+
+func (s *Server) deleteEnrollmentKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.enrollmentKeys[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Enrollment API key "+r.PathValue("id")+" not found")
+		return
+	}
+
+	// Fleet invalidates the key, keeping it as inactive
+	key.Active = false
+	writeJSON(w, http.StatusOK, map[string]string{"action": "deleted"})
+}
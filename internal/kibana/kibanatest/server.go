@@ -0,0 +1,298 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package kibanatest provides an in-process fake of the Kibana Fleet API and of the Fleet Server
+// enrollment and checkin APIs, keeping its state in memory, so that the code using a kibana.Client
+// can be tested without running the stack. The requests prefixed with a Kibana space are served
+// as the unprefixed ones, scoping the policies by space once Fleet is space aware.
+package kibanatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/google/uuid"
+)
+
+// Server is a fake Kibana and Fleet Server. It's safe for concurrent use
+type Server struct {
+	URL string // base URL of the fake, to be used as the Kibana host
+
+	mu              sync.Mutex
+	srv             *httptest.Server
+	actions         map[string]*action
+	agents          map[string]*agent
+	enrollmentKeys  map[string]*kibana.EnrollmentAPIKey
+	installations   map[string]*kibana.PackageInstallation // by package name and version, i.e. system/1.20.4
+	outputs         map[string]*kibana.Output
+	outputHealth    map[string]kibana.OutputHealth
+	packageFiles    map[string][]byte // by package name, version and path, i.e. system/1.20.4/manifest.yml
+	packagePolicies map[string]*kibana.PackageDataStream
+	packages        []kibana.IntegrationPackage
+	keyExpirations  map[string]time.Time // by enrollment API key ID, for the keys which expire
+	policies        map[string]*kibana.Policy
+	spaceAware      bool // Fleet keeps the policies per space
+	spaces          map[string]kibana.Space
+	uploads         map[string]*upload
+	seq             int // keeps the creation order of the resources
+	created         map[string]int
+}
+
+// agent represents the state of an enrolled agent
+type agent struct {
+	kibana.Agent
+	accessAPIKey string
+	active       bool
+	actions      []kibana.AgentAction // pending actions, delivered on checkin
+	script       []string             // scripted statuses, consumed when the agent is read
+}
+
+// NewServer starts a fake with the Fleet Server policy and the default output, which is stopped when the test finishes
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		actions:         map[string]*action{},
+		agents:          map[string]*agent{},
+		enrollmentKeys:  map[string]*kibana.EnrollmentAPIKey{},
+		outputs:         map[string]*kibana.Output{},
+		outputHealth:    map[string]kibana.OutputHealth{},
+		packageFiles:    map[string][]byte{},
+		installations:   map[string]*kibana.PackageInstallation{},
+		packagePolicies: map[string]*kibana.PackageDataStream{},
+		keyExpirations:  map[string]time.Time{},
+		policies:        map[string]*kibana.Policy{},
+		spaces:          map[string]kibana.Space{},
+		uploads:         map[string]*upload{},
+		created:         map[string]int{},
+	}
+
+	fleetServerPolicy := kibana.FleetServicePolicy
+	fleetServerPolicy.Namespace = "default"
+	fleetServerPolicy.Revision = 1
+	s.addPolicy(&fleetServerPolicy)
+
+	output := defaultOutput
+	s.track(output.ID)
+	s.outputs[output.ID] = &output
+
+	s.srv = httptest.NewServer(s.routes())
+	s.URL = s.srv.URL
+	t.Cleanup(s.srv.Close)
+
+	return s
+}
+
+// AddPackage makes a package available in the integrations of the fake
+func (s *Server) AddPackage(name string, title string, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.packages = append(s.packages, kibana.IntegrationPackage{Name: name, Title: title, Version: version})
+}
+
+// AddPackageFile adds a file to a version of a package, by its path relative to the root of the package
+func (s *Server) AddPackageFile(name string, version string, filePath string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.packageFiles[path.Join(name, version, filePath)] = content
+}
+
+// AddPackageAssets sets the assets a version of a package installs in Elasticsearch and Kibana, which are reported
+// once the package is installed
+func (s *Server) AddPackageAssets(name string, version string, es []kibana.InstalledAsset, kb []kibana.InstalledAsset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.installations[path.Join(name, version)] = &kibana.PackageInstallation{Status: "not_installed", Elasticsearch: es, Kibana: kb}
+}
+
+// NewClient creates a Kibana client for the fake
+func (s *Server) NewClient() (*kibana.Client, error) {
+	return kibana.NewClientWithConfig(kibana.ClientConfig{
+		Host:     s.URL,
+		Username: "elastic",
+		Password: "changeme",
+		Timeout:  10 * time.Second,
+	})
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": map[string]interface{}{"overall": map[string]string{"level": "available"}}})
+	})
+	mux.HandleFunc("POST /api/fleet/setup", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"isInitialized": true, "nonFatalErrors": []string{}})
+	})
+	mux.HandleFunc("GET /api/fleet/agents/setup", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"isReady": true, "missing_requirements": []string{}})
+	})
+
+	mux.HandleFunc("GET /api/fleet/agent_policies", s.listPolicies)
+	mux.HandleFunc("POST /api/fleet/agent_policies", s.createPolicy)
+	mux.HandleFunc("GET /api/fleet/agent_policies/{id}", s.getPolicy)
+	mux.HandleFunc("PUT /api/fleet/agent_policies/{id}", s.updatePolicy)
+	mux.HandleFunc("POST /api/fleet/agent_policies/delete", s.deletePolicy)
+
+	mux.HandleFunc("GET /api/fleet/outputs", s.listOutputs)
+	mux.HandleFunc("POST /api/fleet/outputs", s.createOutput)
+	mux.HandleFunc("GET /api/fleet/outputs/{id}", s.getOutput)
+	mux.HandleFunc("PUT /api/fleet/outputs/{id}", s.updateOutput)
+	mux.HandleFunc("DELETE /api/fleet/outputs/{id}", s.deleteOutput)
+	mux.HandleFunc("GET /api/fleet/outputs/{id}/health", s.getOutputHealth)
+
+	mux.HandleFunc("GET /api/fleet/epm/packages", s.listPackages)
+	mux.HandleFunc("GET /api/fleet/epm/packages/{name}/{version}", s.getPackage)
+	mux.HandleFunc("POST /api/fleet/epm/packages/{name}/{version}", s.installPackage)
+	mux.HandleFunc("DELETE /api/fleet/epm/packages/{name}/{version}", s.uninstallPackage)
+	mux.HandleFunc("GET /api/fleet/epm/packages/{name}/{version}/{path...}", s.getPackageFile)
+	mux.HandleFunc("GET /api/saved_objects/{type}/{id}", s.getSavedObject)
+
+	mux.HandleFunc("GET /api/fleet/package_policies", s.listPackagePolicies)
+	mux.HandleFunc("POST /api/fleet/package_policies", s.createPackagePolicy)
+	mux.HandleFunc("GET /api/fleet/package_policies/{id}", s.getPackagePolicy)
+	mux.HandleFunc("PUT /api/fleet/package_policies/{id}", s.updatePackagePolicy)
+	mux.HandleFunc("POST /api/fleet/package_policies/delete", s.deletePackagePolicies)
+
+	mux.HandleFunc("GET /api/fleet/enrollment_api_keys", s.listEnrollmentKeys)
+	mux.HandleFunc("POST /api/fleet/enrollment_api_keys", s.createEnrollmentKey)
+	mux.HandleFunc("DELETE /api/fleet/enrollment_api_keys/{id}", s.deleteEnrollmentKey)
+	mux.HandleFunc("POST /api/fleet/service_tokens", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, kibana.ServiceToken{Name: "token-" + uuid.NewString(), Value: uuid.NewString()})
+	})
+
+	mux.HandleFunc("GET /api/fleet/agents", s.listAgents)
+	mux.HandleFunc("GET /api/fleet/agents/{id}", s.getAgent)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/unenroll", s.unenrollAgent)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/upgrade", s.upgradeAgent)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/reassign", s.reassignAgent)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/request_diagnostics", s.requestDiagnostics)
+	mux.HandleFunc("GET /api/fleet/agents/{id}/uploads", s.listUploads)
+	mux.HandleFunc("GET /api/fleet/agents/files/{id}/{name}", s.downloadUpload)
+
+	mux.HandleFunc("GET /api/fleet/agents/action_status", s.actionStatus)
+	mux.HandleFunc("POST /api/fleet/agents/bulk_upgrade", s.bulkUpgrade)
+	mux.HandleFunc("POST /api/fleet/agents/bulk_reassign", s.bulkReassign)
+	mux.HandleFunc("POST /api/fleet/agents/bulk_unenroll", s.bulkUnenroll)
+	mux.HandleFunc("POST /api/fleet/agents/bulk_update_agent_tags", s.bulkUpdateTags)
+
+	mux.HandleFunc("POST /api/fleet/agents/enroll", s.enroll)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/checkin", s.checkin)
+	mux.HandleFunc("POST /api/fleet/agents/{id}/acks", s.ack)
+
+	mux.HandleFunc("POST /api/spaces/space", s.createSpace)
+	mux.HandleFunc("DELETE /api/spaces/space/{id}", s.deleteSpace)
+	mux.HandleFunc("POST /internal/fleet/enable_space_awareness", s.enableSpaceAwareness)
+
+	return withSpaces(mux)
+}
+
+// nextID returns an ID for a new resource, keeping its creation order
+func (s *Server) nextID(prefix string) string {
+	id := fmt.Sprintf("%s-%d", prefix, s.seq+1)
+	s.track(id)
+	return id
+}
+
+// sortedIDs returns the IDs sorted by creation order
+func (s *Server) sortedIDs(ids []string) []string {
+	sort.Slice(ids, func(i, j int) bool {
+		return s.created[ids[i]] < s.created[ids[j]]
+	})
+	return ids
+}
+
+// track keeps the creation order of a resource with a given ID
+func (s *Server) track(id string) {
+	s.seq++
+	s.created[id] = s.seq
+}
+
+func (s *Server) addPolicy(p *kibana.Policy) {
+	s.track(p.ID)
+	s.policies[p.ID] = p
+}
+
+// bumpRevision increases the revision of a policy, sending the new revision to its agents
+func (s *Server) bumpRevision(policyID string) {
+	p, ok := s.policies[policyID]
+	if !ok {
+		return
+	}
+
+	p.Revision++
+	p.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	for _, a := range s.agents {
+		if a.active && a.PolicyID == policyID {
+			a.actions = append(a.actions, kibana.AgentAction{
+				ID:   uuid.NewString(),
+				Type: "POLICY_CHANGE",
+				Data: map[string]interface{}{"policy": map[string]interface{}{"id": policyID, "revision": p.Revision}},
+			})
+		}
+	}
+}
+
+// pageOf returns the bounds of the page of a list requested with the page and perPage query parameters, which
+// default to the first page of 20 items, as in the Fleet API
+func pageOf(r *http.Request, total int) (page int, perPage int, start int, end int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err = strconv.Atoi(r.URL.Query().Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = 20
+	}
+
+	start = (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end = start + perPage
+	if end > total {
+		end = total
+	}
+	return page, perPage, start, end
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error with the format of the Kibana API
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"statusCode": statusCode,
+		"error":      http.StatusText(statusCode),
+		"message":    message,
+	})
+}
+
+// apiKey returns the API key of the Authorization header
+func apiKey(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "ApiKey ")
+}
@@ -0,0 +1,481 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T) (*Server, *kibana.Client) {
+	s := NewServer(t)
+
+	client, err := s.NewClient()
+	require.NoError(t, err)
+
+	return s, client
+}
+
+// fleetServerRequest sends a request to the Fleet Server API of the fake, as the agent would do
+func fleetServerRequest(t *testing.T, s *Server, path string, key string, body interface{}, resp interface{}) int {
+	reqBody, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+path, bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "ApiKey "+key)
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer r.Body.Close()
+
+	if resp != nil {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(resp))
+	}
+	return r.StatusCode
+}
+
+func TestServer_Setup(t *testing.T) {
+	ctx := context.Background()
+	_, client := newClient(t)
+
+	require.NoError(t, client.RecreateFleet(ctx))
+	require.NoError(t, client.WaitForFleet(ctx))
+
+	policies, err := client.ListPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, kibana.FleetServicePolicy.ID, policies[0].ID)
+	assert.True(t, policies[0].IsDefaultFleetServer)
+}
+
+func TestServer_Policies(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, policy.ID)
+	assert.Equal(t, "default", policy.Namespace)
+	assert.Equal(t, 1, policy.Revision)
+
+	_, err = client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	assert.True(t, kibana.IsConflict(err))
+
+	policy.Description = "updated"
+	updated, err := client.UpdatePolicy(ctx, policy)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", updated.Description)
+	assert.Equal(t, 2, updated.Revision)
+
+	require.NoError(t, client.DeletePolicy(ctx, policy.ID))
+	assert.Len(t, s.Policies(), 1)
+
+	_, err = client.GetPolicy(ctx, policy.ID)
+	assert.True(t, kibana.IsNotFound(err))
+
+	scoped, err := client.CreatePolicyInNamespace(ctx, "e2e1")
+	require.NoError(t, err)
+	assert.Equal(t, "e2e1", scoped.Namespace)
+	assert.Equal(t, []string{"logs", "metrics"}, scoped.MonitoringEnabled)
+}
+
+func TestServer_RevokedEnrollmentKey(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+
+	key, err := client.CreateEnrollmentAPIKey(ctx, policy)
+	require.NoError(t, err)
+	assert.True(t, key.Active)
+
+	require.NoError(t, client.DeleteEnrollmentAPIKey(ctx, key.ID))
+
+	keys, err := client.ListEnrollmentAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.False(t, keys[0].Active)
+
+	statusCode := fleetServerRequest(t, s, "/api/fleet/agents/enroll", key.APIKey, map[string]interface{}{"type": "PERMANENT"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	_, _, err = s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	assert.True(t, kibana.IsUnauthorized(err))
+	assert.Empty(t, s.Agents())
+}
+
+func TestServer_ExpiringEnrollmentKey(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+
+	key, err := client.CreateEnrollmentAPIKeyWithOptions(ctx, policy, kibana.EnrollmentAPIKeyOptions{Name: "expiring", Expiration: time.Second})
+	require.NoError(t, err)
+	assert.Contains(t, key.Name, "expiring")
+
+	_, _, err = s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	require.NoError(t, err)
+
+	// the key is still active in Fleet once expired, but it cannot be used
+	s.mu.Lock()
+	s.keyExpirations[key.ID] = time.Now().Add(-time.Second)
+	s.mu.Unlock()
+
+	_, _, err = s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host-2"})
+	assert.True(t, kibana.IsUnauthorized(err))
+	assert.Len(t, s.Agents(), 1)
+
+	keys, err := client.ListPolicyEnrollmentAPIKeys(ctx, policy.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, keys[0].Active)
+}
+
+func TestServer_EnrollmentKeysOfPolicy(t *testing.T) {
+	ctx := context.Background()
+	_, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+	other, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-other-policy"})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.CreateEnrollmentAPIKey(ctx, policy)
+		require.NoError(t, err)
+	}
+	_, err = client.CreateEnrollmentAPIKey(ctx, other)
+	require.NoError(t, err)
+
+	keys, err := client.ListPolicyEnrollmentAPIKeys(ctx, policy.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	for _, k := range keys {
+		assert.Equal(t, policy.ID, k.PolicyID)
+	}
+
+	all, err := client.ListEnrollmentAPIKeys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
+
+func TestServer_Spaces(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	_, err := client.CreateSpace(ctx, kibana.Space{ID: "e2e", Name: "E2E"})
+	require.NoError(t, err)
+	_, err = client.CreateSpace(ctx, kibana.Space{ID: "e2e", Name: "E2E"})
+	assert.True(t, kibana.IsConflict(err))
+
+	spaced := client.WithSpace("e2e")
+
+	t.Run("Policies are shared across spaces unless Fleet is space aware", func(t *testing.T) {
+		policy, err := spaced.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-shared-policy"})
+		require.NoError(t, err)
+		assert.Empty(t, policy.SpaceIDs)
+
+		_, err = client.GetPolicy(ctx, policy.ID)
+		assert.NoError(t, err)
+	})
+
+	require.NoError(t, client.EnableFleetSpaceAwareness(ctx))
+
+	policy, err := spaced.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-space-policy"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e2e"}, policy.SpaceIDs)
+
+	_, err = client.GetPolicy(ctx, policy.ID)
+	assert.True(t, kibana.IsNotFound(err))
+	_, err = client.CreateEnrollmentAPIKey(ctx, policy)
+	assert.Error(t, err)
+
+	key, err := spaced.CreateEnrollmentAPIKey(ctx, policy)
+	require.NoError(t, err)
+	_, _, err = s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	require.NoError(t, err)
+
+	agents, err := client.ListAgents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+
+	agent, err := spaced.GetLatestAgentByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, policy.ID, agent.PolicyID)
+
+	keys, err := client.ListEnrollmentAPIKeys(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	require.NoError(t, client.DeleteSpace(ctx, "e2e"))
+	assert.Empty(t, s.Spaces())
+}
+
+func TestServer_ForcedReenrollment(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+	other, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-other-policy"})
+	require.NoError(t, err)
+
+	key, err := client.CreateEnrollmentAPIKey(ctx, policy)
+	require.NoError(t, err)
+	otherKey, err := client.CreateEnrollmentAPIKey(ctx, other)
+	require.NoError(t, err)
+
+	_, _, err = s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	id, _, err := s.Enroll(otherKey.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	require.NoError(t, err)
+
+	// the host keeps the agent of its previous enrollment
+	assert.Len(t, s.Agents(), 2)
+
+	agent, err := client.GetLatestAgentByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, id, agent.ID)
+	assert.Equal(t, other.ID, agent.PolicyID)
+
+	_, err = client.GetLatestAgentByHostname(ctx, "unknown-host")
+	assert.Error(t, err)
+}
+
+func TestServer_EnrollAndCheckin(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-policy"})
+	require.NoError(t, err)
+	key, err := client.CreateEnrollmentAPIKey(ctx, policy)
+	require.NoError(t, err)
+
+	var enrolled struct {
+		Item struct {
+			ID           string `json:"id"`
+			PolicyID     string `json:"policy_id"`
+			AccessAPIKey string `json:"access_api_key"`
+		} `json:"item"`
+	}
+	statusCode := fleetServerRequest(t, s, "/api/fleet/agents/enroll", key.APIKey, map[string]interface{}{
+		"type": "PERMANENT",
+		"metadata": map[string]interface{}{
+			"local": map[string]interface{}{
+				"host":    map[string]interface{}{"hostname": "e2e-host"},
+				"elastic": map[string]interface{}{"agent": map[string]interface{}{"version": "8.14.3"}},
+			},
+		},
+	}, &enrolled)
+	require.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, policy.ID, enrolled.Item.PolicyID)
+
+	status, err := client.GetAgentStatusByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, StatusUpdating, status)
+
+	beforeCheckin := time.Now().Add(-time.Second)
+
+	var checkin struct {
+		Actions []kibana.AgentAction `json:"actions"`
+	}
+	checkinPath := "/api/fleet/agents/" + enrolled.Item.ID + "/checkin"
+	statusCode = fleetServerRequest(t, s, checkinPath, enrolled.Item.AccessAPIKey, map[string]interface{}{}, &checkin)
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Len(t, checkin.Actions, 1)
+	assert.Equal(t, "POLICY_CHANGE", checkin.Actions[0].Type)
+
+	statusCode = fleetServerRequest(t, s, checkinPath, "wrong-key", map[string]interface{}{}, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+
+	ackPath := "/api/fleet/agents/" + enrolled.Item.ID + "/acks"
+	statusCode = fleetServerRequest(t, s, ackPath, enrolled.Item.AccessAPIKey, map[string]interface{}{
+		"events": []map[string]string{{"action_id": checkin.Actions[0].ID}},
+	}, nil)
+	require.Equal(t, http.StatusOK, statusCode)
+
+	agent, err := client.GetAgentByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, StatusOnline, agent.Status)
+	assert.Equal(t, policy.ID, agent.PolicyID)
+	assert.Equal(t, 1, agent.PolicyRevision)
+	assert.True(t, agent.CheckedInAfter(beforeCheckin))
+	assert.False(t, agent.CheckedInAfter(time.Now().Add(time.Minute)))
+}
+
+func TestServer_ScriptedStatus(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	key, err := client.CreateEnrollmentAPIKey(ctx, kibana.FleetServicePolicy)
+	require.NoError(t, err)
+	id, _, err := s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host"})
+	require.NoError(t, err)
+
+	require.True(t, s.ScriptAgentStatus(id, StatusUpdating, StatusOffline, StatusOnline))
+
+	for _, expected := range []string{StatusUpdating, StatusOffline, StatusOnline, StatusOnline} {
+		status, err := client.GetAgentStatusByHostname(ctx, "e2e-host")
+		require.NoError(t, err)
+		assert.Equal(t, expected, status)
+	}
+
+	require.True(t, s.SetAgentStatus(id, StatusOffline))
+	status, err := client.GetAgentStatusByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, StatusOffline, status)
+
+	assert.False(t, s.SetAgentStatus("missing-agent", StatusOnline))
+}
+
+func TestServer_UpgradeAndUnenroll(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	key, err := client.CreateEnrollmentAPIKey(ctx, kibana.FleetServicePolicy)
+	require.NoError(t, err)
+	id, accessAPIKey, err := s.Enroll(key.APIKey, EnrollRequest{Hostname: "e2e-host", Version: "8.14.3"})
+	require.NoError(t, err)
+
+	err = client.UpgradeAgent(ctx, "e2e-host", "8.14.3")
+	assert.Error(t, err)
+
+	require.NoError(t, client.UpgradeAgent(ctx, "e2e-host", "8.15.0"))
+
+	agent, err := client.GetAgentByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	require.NotNil(t, agent.UpgradeDetails)
+	assert.Equal(t, kibana.UpgradeStateRequested, agent.UpgradeDetails.State)
+	assert.Equal(t, "8.15.0", agent.UpgradeDetails.TargetVersion)
+
+	events := []map[string]string{}
+	for _, action := range s.PendingActions(id) {
+		events = append(events, map[string]string{"action_id": action.ID})
+	}
+	statusCode := fleetServerRequest(t, s, "/api/fleet/agents/"+id+"/acks", accessAPIKey, map[string]interface{}{"events": events}, nil)
+	require.Equal(t, http.StatusOK, statusCode)
+
+	agent, err = client.GetAgentByHostname(ctx, "e2e-host")
+	require.NoError(t, err)
+	assert.Equal(t, "8.15.0", agent.LocalMetadata.Elastic.Agent.Version)
+	assert.Nil(t, agent.UpgradeDetails)
+	assert.NotEmpty(t, agent.UpgradedAt)
+
+	require.NoError(t, client.UnEnrollAgent(ctx, "e2e-host"))
+
+	agents, err := client.ListAgents(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+
+	unenrolled, ok := s.Agent(id)
+	require.True(t, ok)
+	assert.Equal(t, StatusUnenrolled, unenrolled.Status)
+
+	statusCode = fleetServerRequest(t, s, "/api/fleet/agents/"+id+"/checkin", accessAPIKey, map[string]interface{}{}, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+}
+
+func TestServer_BulkActions(t *testing.T) {
+	ctx := context.Background()
+	s, client := newClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-bulk"})
+	require.NoError(t, err)
+	key, err := client.CreateEnrollmentAPIKey(ctx, kibana.FleetServicePolicy)
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, hostname := range []string{"e2e-host-1", "e2e-host-2"} {
+		id, _, err := s.Enroll(key.APIKey, EnrollRequest{Hostname: hostname, Version: "8.14.3"})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	actionID, err := client.BulkUpdateAgentTags(ctx, kibana.AgentsByID(ids[0]), []string{"e2e"}, nil)
+	require.NoError(t, err)
+	status, err := client.GetActionStatus(ctx, actionID)
+	require.NoError(t, err)
+	assert.Equal(t, kibana.ActionStatusComplete, status.Status)
+
+	actionID, err = client.BulkReassignAgents(ctx, kibana.AgentsByQuery("tags:e2e"), policy.ID)
+	require.NoError(t, err)
+
+	status, err = client.GetActionStatus(ctx, actionID)
+	require.NoError(t, err)
+	assert.Equal(t, kibana.ActionStatusInProgress, status.Status)
+	assert.Equal(t, 1, status.NbAgentsActionCreated)
+
+	s.AckActions(ids[0])
+
+	status, err = client.GetActionStatus(ctx, actionID)
+	require.NoError(t, err)
+	assert.Equal(t, kibana.ActionStatusComplete, status.Status)
+	assert.Equal(t, 1, status.NbAgentsAck)
+
+	agent, ok := s.Agent(ids[0])
+	require.True(t, ok)
+	assert.Equal(t, policy.ID, agent.PolicyID)
+	assert.Equal(t, policy.Revision, agent.PolicyRevision)
+
+	t.Run("Rollouts shorter than the minimum are rejected", func(t *testing.T) {
+		_, err := client.BulkUpgradeAgents(ctx, kibana.BulkUpgradeRequest{
+			Agents:                 kibana.AgentsByID(ids...),
+			Version:                "8.15.0",
+			RolloutDurationSeconds: 60,
+		})
+		assert.ErrorContains(t, err, "rollout_duration_seconds")
+	})
+
+	t.Run("Failed upgrades are reported per agent", func(t *testing.T) {
+		actionID, err := client.BulkUpgradeAgents(ctx, kibana.BulkUpgradeRequest{
+			Agents:                 kibana.AgentsByID(ids...),
+			Version:                "8.15.0",
+			RolloutDurationSeconds: 600,
+		})
+		require.NoError(t, err)
+
+		s.AckActions(ids[0])
+		require.True(t, s.FailAction(ids[1], actionID, "could not download the artifact"))
+
+		status, err := client.GetActionStatus(ctx, actionID)
+		require.NoError(t, err)
+		assert.Equal(t, kibana.ActionStatusFailed, status.Status)
+		assert.Equal(t, 1, status.NbAgentsAck)
+		assert.Equal(t, 1, status.NbAgentsFailed)
+		assert.NotEmpty(t, status.Expiration)
+		require.Len(t, status.LatestErrors, 1)
+		assert.Equal(t, "e2e-host-2", status.LatestErrors[0].Hostname)
+
+		failed, ok := s.Agent(ids[1])
+		require.True(t, ok)
+		assert.True(t, failed.UpgradeFailed())
+	})
+
+	t.Run("Agents are unenrolled by policy", func(t *testing.T) {
+		actionID, err := client.BulkUnenrollAgents(ctx, kibana.AgentsByQuery(`policy_id:"`+kibana.FleetServicePolicy.ID+`"`), false)
+		require.NoError(t, err)
+
+		s.AckActions(ids[1])
+
+		status, err := client.GetActionStatus(ctx, actionID)
+		require.NoError(t, err)
+		assert.Equal(t, kibana.ActionStatusComplete, status.Status)
+		assert.Len(t, s.Agents(), 1)
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+)
+
+// defaultSpace is the space of the requests without a space prefix
+const defaultSpace = "default"
+
+type spaceKey struct{}
+
+// withSpaces serves the requests prefixed with /s/<space> as the unprefixed ones, keeping the space in their context
+func withSpaces(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		space := defaultSpace
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/s/"); ok {
+			space, rest, _ = strings.Cut(rest, "/")
+
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath = ""
+			r = r2
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), spaceKey{}, space)))
+	})
+}
+
+// spaceOf returns the space of a request
+func spaceOf(r *http.Request) string {
+	space, ok := r.Context().Value(spaceKey{}).(string)
+	if !ok {
+		return defaultSpace
+	}
+	return space
+}
+
+// policyInSpace returns true if a policy is visible from a space. The policies are shared across spaces
+// unless Fleet is space aware
+func (s *Server) policyInSpace(policyID string, space string) bool {
+	p, ok := s.policies[policyID]
+	if !ok {
+		return false
+	}
+
+	if !s.spaceAware {
+		return true
+	}
+
+	spaceIDs := p.SpaceIDs
+	if len(spaceIDs) == 0 {
+		spaceIDs = []string{defaultSpace}
+	}
+	for _, id := range spaceIDs {
+		if id == space {
+			return true
+		}
+	}
+	return false
+}
+
+// Spaces returns the Kibana spaces created in the fake, besides the default one
+func (s *Server) Spaces() []kibana.Space {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for id := range s.spaces {
+		ids = append(ids, id)
+	}
+
+	items := []kibana.Space{}
+	for _, id := range s.sortedIDs(ids) {
+		items = append(items, s.spaces[id])
+	}
+	return items
+}
+
+func (s *Server) createSpace(w http.ResponseWriter, r *http.Request) {
+	var space kibana.Space
+	if !decodeJSON(w, r, &space) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.spaces[space.ID]; ok || space.ID == defaultSpace {
+		writeError(w, http.StatusConflict, "A space with the identifier "+space.ID+" already exists.")
+		return
+	}
+
+	s.track(space.ID)
+	s.spaces[space.ID] = space
+	writeJSON(w, http.StatusOK, space)
+}
+
+func (s *Server) deleteSpace(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.spaces[id]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	delete(s.spaces, id)
+
+	// the saved objects of the space are deleted with it
+	for policyID, p := range s.policies {
+		if len(p.SpaceIDs) == 1 && p.SpaceIDs[0] == id {
+			delete(s.policies, policyID)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) enableSpaceAwareness(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-elastic-internal-origin") == "" {
+		writeError(w, http.StatusBadRequest, "uri [/internal/fleet/enable_space_awareness] with method [post] exists but is not available with the current configuration")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spaceAware = true
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
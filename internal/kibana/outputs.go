@@ -0,0 +1,242 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+const (
+	// OutputTypeElasticsearch the agents send the events to Elasticsearch
+	OutputTypeElasticsearch = "elasticsearch"
+	// OutputTypeKafka the agents send the events to Kafka
+	OutputTypeKafka = "kafka"
+	// OutputTypeLogstash the agents send the events to Logstash
+	OutputTypeLogstash = "logstash"
+	// OutputTypeRemoteElasticsearch the agents send the events to a remote Elasticsearch, using a service token
+	OutputTypeRemoteElasticsearch = "remote_elasticsearch"
+)
+
+// Output represents an output of Fleet, where the agents send the events
+type Output struct {
+	ID                   string     `json:"id,omitempty"`
+	Name                 string     `json:"name"`
+	Type                 string     `json:"type"`
+	Hosts                []string   `json:"hosts,omitempty"`
+	IsDefault            bool       `json:"is_default"`
+	IsDefaultMonitoring  bool       `json:"is_default_monitoring"`
+	IsPreconfigured      bool       `json:"is_preconfigured,omitempty"`
+	CASHA256             string     `json:"ca_sha256,omitempty"`
+	CATrustedFingerprint string     `json:"ca_trusted_fingerprint,omitempty"`
+	ConfigYAML           string     `json:"config_yaml,omitempty"`
+	ProxyID              string     `json:"proxy_id,omitempty"`
+	SSL                  *OutputSSL `json:"ssl,omitempty"`
+
+	// kafka outputs
+	Topic       string `json:"topic,omitempty"`
+	Compression string `json:"compression,omitempty"`
+	AuthType    string `json:"auth_type,omitempty"`
+	ClientID    string `json:"client_id,omitempty"`
+
+	// remote_elasticsearch outputs
+	ServiceToken string `json:"service_token,omitempty"`
+}
+
+// OutputSSL represents the TLS configuration of an output
+type OutputSSL struct {
+	Certificate            string   `json:"certificate,omitempty"`
+	CertificateAuthorities []string `json:"certificate_authorities,omitempty"`
+	Key                    string   `json:"key,omitempty"`
+}
+
+// NewElasticsearchOutput creates an output sending the events to Elasticsearch hosts
+func NewElasticsearchOutput(name string, hosts ...string) Output {
+	return Output{Name: name, Type: OutputTypeElasticsearch, Hosts: hosts}
+}
+
+// NewLogstashOutput creates an output sending the events to Logstash hosts, i.e. logstash:5044
+func NewLogstashOutput(name string, hosts ...string) Output {
+	return Output{Name: name, Type: OutputTypeLogstash, Hosts: hosts}
+}
+
+// NewKafkaOutput creates an output sending the events to a topic of Kafka brokers, without authentication
+func NewKafkaOutput(name string, topic string, hosts ...string) Output {
+	return Output{
+		Name:        name,
+		Type:        OutputTypeKafka,
+		Hosts:       hosts,
+		Topic:       topic,
+		AuthType:    "none",
+		Compression: "none",
+		ClientID:    "Elastic",
+	}
+}
+
+// NewRemoteElasticsearchOutput creates an output sending the events to a remote Elasticsearch, authenticated
+// with a service token of the fleet-server-remote service account
+func NewRemoteElasticsearchOutput(name string, serviceToken string, hosts ...string) Output {
+	return Output{Name: name, Type: OutputTypeRemoteElasticsearch, Hosts: hosts, ServiceToken: serviceToken}
+}
+
+// outputRequest returns the output without its read-only fields, to be written with the outputs API
+func (o Output) outputRequest() Output {
+	o.ID = ""
+	o.IsPreconfigured = false
+	return o
+}
+
+// ListOutputs returns the outputs of Fleet
+func (c *Client) ListOutputs(ctx context.Context) ([]Output, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing Fleet outputs", "fleet.outputs.list", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Items []Output `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/outputs", FleetAPI), nil, &resp, "could not list Fleet's outputs")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
+}
+
+// GetOutput returns an output by its ID
+func (c *Client) GetOutput(ctx context.Context, outputID string) (Output, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Fleet output", "fleet.outputs.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Item Output `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/outputs/%s", FleetAPI, outputID), nil, &resp, "could not get Fleet's output")
+	if err != nil {
+		return Output{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// CreateOutput creates an output, using its ID when present
+func (c *Client) CreateOutput(ctx context.Context, output Output) (Output, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating Fleet output", "fleet.outputs.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("type", output.Type)
+	defer span.End()
+
+	reqBody := output.outputRequest()
+	reqBody.ID = output.ID
+
+	var resp struct {
+		Item Output `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/outputs", FleetAPI), reqBody, &resp, "could not create Fleet's output")
+	if err != nil {
+		return Output{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"id":   resp.Item.ID,
+		"name": resp.Item.Name,
+		"type": resp.Item.Type,
+	}).Debug("Fleet output created")
+	return resp.Item, nil
+}
+
+// UpdateOutput updates an output by its ID
+func (c *Client) UpdateOutput(ctx context.Context, output Output) (Output, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating Fleet output", "fleet.outputs.update", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("outputID", output.ID)
+	defer span.End()
+
+	var resp struct {
+		Item Output `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPut, fmt.Sprintf("%s/outputs/%s", FleetAPI, output.ID), output.outputRequest(), &resp, "could not update Fleet's output")
+	if err != nil {
+		return Output{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// OutputHealth represents the health of an output, as reported to Fleet, i.e. for the remote Elasticsearch outputs.
+// The state is empty when it was not reported yet
+type OutputHealth struct {
+	State     string `json:"state"` // HEALTHY or DEGRADED
+	Message   string `json:"message,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// GetOutputHealth returns the last reported health of an output
+func (c *Client) GetOutputHealth(ctx context.Context, outputID string) (OutputHealth, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Fleet output health", "fleet.outputs.health", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("outputID", outputID)
+	defer span.End()
+
+	var health OutputHealth
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/outputs/%s/health", FleetAPI, outputID), nil, &health, "could not get the health of Fleet's output")
+	if err != nil {
+		return OutputHealth{}, err
+	}
+
+	return health, nil
+}
+
+// DeleteOutput deletes an output by its ID
+func (c *Client) DeleteOutput(ctx context.Context, outputID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting Fleet output", "fleet.outputs.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("outputID", outputID)
+	defer span.End()
+
+	return c.sendJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/outputs/%s", FleetAPI, outputID), nil, nil, "could not delete Fleet's output")
+}
+
+// AssignOutputsToPolicy sets the outputs of the data and of the monitoring of an agent policy,
+// using the default outputs for the empty IDs. It returns the policy with its new revision
+func (c *Client) AssignOutputsToPolicy(ctx context.Context, policyID string, dataOutputID string, monitoringOutputID string) (Policy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Assigning Fleet outputs to policy", "fleet.outputs.assign", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("policyID", policyID)
+	defer span.End()
+
+	policy, err := c.GetPolicy(ctx, policyID)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	policy.DataOutputID = dataOutputID
+	policy.MonitoringOutputID = monitoringOutputID
+
+	policy, err = c.UpdatePolicy(ctx, policy)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"dataOutputID":       dataOutputID,
+		"monitoringOutputID": monitoringOutputID,
+		"policyID":           policyID,
+		"revision":           policy.Revision,
+	}).Debug("Fleet outputs assigned to policy")
+	return policy, nil
+}
@@ -0,0 +1,123 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOutputs(t *testing.T) {
+	kafka := kibana.NewKafkaOutput("kafka", "e2e-events", "redpanda:9092")
+	assert.Equal(t, kibana.OutputTypeKafka, kafka.Type)
+	assert.Equal(t, "e2e-events", kafka.Topic)
+	assert.Equal(t, "none", kafka.AuthType)
+	assert.Equal(t, []string{"redpanda:9092"}, kafka.Hosts)
+
+	remote := kibana.NewRemoteElasticsearchOutput("remote", "service-token", "https://remote:9200")
+	assert.Equal(t, kibana.OutputTypeRemoteElasticsearch, remote.Type)
+	assert.Equal(t, "service-token", remote.ServiceToken)
+
+	assert.Equal(t, kibana.OutputTypeLogstash, kibana.NewLogstashOutput("logstash", "logstash:5044").Type)
+	assert.Equal(t, kibana.OutputTypeElasticsearch, kibana.NewElasticsearchOutput("es", "http://elasticsearch:9200").Type)
+}
+
+func TestAssignOutputsToPolicy(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-outputs"})
+	require.NoError(t, err)
+
+	logstash, err := client.CreateOutput(ctx, kibana.NewLogstashOutput("logstash", "logstash:5044"))
+	require.NoError(t, err)
+	kafka, err := client.CreateOutput(ctx, kibana.NewKafkaOutput("kafka", "e2e-events", "redpanda:9092"))
+	require.NoError(t, err)
+
+	updated, err := client.AssignOutputsToPolicy(ctx, policy.ID, logstash.ID, kafka.ID)
+	require.NoError(t, err)
+	assert.Equal(t, logstash.ID, updated.DataOutputID)
+	assert.Equal(t, kafka.ID, updated.MonitoringOutputID)
+	assert.Equal(t, policy.Revision+1, updated.Revision)
+
+	t.Run("Empty IDs restore the default outputs", func(t *testing.T) {
+		restored, err := client.AssignOutputsToPolicy(ctx, policy.ID, logstash.ID, "")
+		require.NoError(t, err)
+		assert.Equal(t, logstash.ID, restored.DataOutputID)
+		assert.Empty(t, restored.MonitoringOutputID)
+	})
+
+	t.Run("Deleted outputs are replaced by the default ones", func(t *testing.T) {
+		require.NoError(t, client.DeleteOutput(ctx, logstash.ID))
+
+		p, err := client.GetPolicy(ctx, policy.ID)
+		require.NoError(t, err)
+		assert.Empty(t, p.DataOutputID)
+		assert.Len(t, s.Outputs(), 2)
+	})
+
+	t.Run("The default output cannot be deleted", func(t *testing.T) {
+		outputs, err := client.ListOutputs(ctx)
+		require.NoError(t, err)
+		require.True(t, outputs[0].IsDefault)
+
+		err = client.DeleteOutput(ctx, outputs[0].ID)
+		assert.Error(t, err)
+	})
+}
+
+func TestAgentRunsTheOutput(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	policy, err := client.CreateAgentPolicy(ctx, kibana.Policy{Name: "e2e-outputs"})
+	require.NoError(t, err)
+	key, err := client.CreateEnrollmentAPIKey(ctx, policy)
+	require.NoError(t, err)
+	agentID, _, err := s.Enroll(key.APIKey, kibanatest.EnrollRequest{Hostname: "e2e-host", Version: "8.14.3"})
+	require.NoError(t, err)
+	s.AckActions(agentID)
+
+	remote, err := client.CreateOutput(ctx, kibana.NewRemoteElasticsearchOutput("remote", "service-token", "http://elasticsearch:9200"))
+	require.NoError(t, err)
+
+	agent, err := client.GetAgent(ctx, agentID)
+	require.NoError(t, err)
+	assert.False(t, agent.OutputHealthy(remote), "the agent runs the default output until the policy changes")
+
+	_, err = client.AssignOutputsToPolicy(ctx, policy.ID, remote.ID, "")
+	require.NoError(t, err)
+	s.AckActions(agentID)
+
+	agent, err = client.GetAgent(ctx, agentID)
+	require.NoError(t, err)
+	assert.True(t, agent.OutputHealthy(remote))
+
+	t.Run("An output of another type is not the one of the agent", func(t *testing.T) {
+		other := remote
+		other.Type = kibana.OutputTypeElasticsearch
+		assert.False(t, agent.OutputHealthy(other))
+	})
+
+	t.Run("The health of the output is the reported one", func(t *testing.T) {
+		health, err := client.GetOutputHealth(ctx, remote.ID)
+		require.NoError(t, err)
+		assert.Empty(t, health.State)
+
+		s.SetOutputHealth(remote.ID, "DEGRADED", "remote cluster unreachable")
+		health, err = client.GetOutputHealth(ctx, remote.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "DEGRADED", health.State)
+		assert.Equal(t, "remote cluster unreachable", health.Message)
+
+		_, err = client.GetOutputHealth(ctx, "missing-output")
+		assert.True(t, kibana.IsNotFound(err))
+	})
+}
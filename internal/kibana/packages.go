@@ -0,0 +1,191 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.elastic.co/apm/v2"
+)
+
+// GetPackageAssets returns the paths of the files of a package, relative to the root of the package,
+// i.e. data_stream/cpu/fields/fields.yml
+func (c *Client) GetPackageAssets(ctx context.Context, pkg IntegrationPackage) ([]string, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting package assets", "fleet.package.assets", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("package", pkg.Name)
+	span.Context.SetLabel("version", pkg.Version)
+	defer span.End()
+
+	var resp struct {
+		Item struct {
+			Assets []string `json:"assets"`
+		} `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/epm/packages/%s/%s", FleetAPI, pkg.Name, pkg.Version), nil, &resp, "could not get package info")
+	if err != nil {
+		return nil, err
+	}
+
+	// the registry lists the assets with their full path, i.e. /package/system/1.20.4/manifest.yml
+	prefix := fmt.Sprintf("/package/%s/%s/", pkg.Name, pkg.Version)
+
+	assets := []string{}
+	for _, asset := range resp.Item.Assets {
+		assets = append(assets, strings.TrimPrefix(asset, prefix))
+	}
+	sort.Strings(assets)
+
+	return assets, nil
+}
+
+// GetPackageFile returns the content of a file of a package, by its path relative to the root of the package
+func (c *Client) GetPackageFile(ctx context.Context, pkg IntegrationPackage, filePath string) ([]byte, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting package file", "fleet.package.file", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("package", pkg.Name)
+	span.Context.SetLabel("file", filePath)
+	defer span.End()
+
+	statusCode, respBody, err := c.get(ctx, fmt.Sprintf("%s/epm/packages/%s/%s/%s", FleetAPI, pkg.Name, pkg.Version, filePath))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get package file")
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, newAPIError("could not get package file "+filePath, statusCode, respBody)
+	}
+
+	return respBody, nil
+}
+
+// GetPackageDataStreamFields returns the content of the files defining the fields of a data stream of a package,
+// i.e. cpu for the system package, by their path
+func (c *Client) GetPackageDataStreamFields(ctx context.Context, pkg IntegrationPackage, dataStream string) (map[string][]byte, error) {
+	assets, err := c.GetPackageAssets(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	dir := path.Join("data_stream", dataStream, "fields")
+	for _, asset := range assets {
+		if path.Dir(asset) != dir || path.Ext(asset) != ".yml" {
+			continue
+		}
+
+		content, err := c.GetPackageFile(ctx, pkg, asset)
+		if err != nil {
+			return nil, err
+		}
+		files[asset] = content
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("the %s data stream of the %s package does not define fields", dataStream, pkg.Name)
+	}
+
+	return files, nil
+}
+
+// PackageInstalled the status of a package whose assets are installed
+const PackageInstalled = "installed"
+
+// InstalledAsset represents an asset installed by a package, i.e. an index template in Elasticsearch or a dashboard in Kibana
+type InstalledAsset struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// PackageInstallation represents the status of a package, with the assets it installed in Elasticsearch and Kibana
+type PackageInstallation struct {
+	Status        string           `json:"status"`
+	Elasticsearch []InstalledAsset `json:"installed_es"`
+	Kibana        []InstalledAsset `json:"installed_kibana"`
+}
+
+// GetPackageInstallation returns the status of a version of a package, and the assets it installed
+func (c *Client) GetPackageInstallation(ctx context.Context, pkg IntegrationPackage) (PackageInstallation, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting package installation", "fleet.package.installation", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("package", pkg.Name)
+	span.Context.SetLabel("version", pkg.Version)
+	defer span.End()
+
+	type installedAssets struct {
+		Elasticsearch []InstalledAsset `json:"installed_es"`
+		Kibana        []InstalledAsset `json:"installed_kibana"`
+	}
+
+	var resp struct {
+		Item struct {
+			Status           string           `json:"status"`
+			InstallationInfo *installedAssets `json:"installationInfo"`
+			SavedObject      *struct {
+				Attributes installedAssets `json:"attributes"`
+			} `json:"savedObject"`
+		} `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/epm/packages/%s/%s", FleetAPI, pkg.Name, pkg.Version), nil, &resp, "could not get package info")
+	if err != nil {
+		return PackageInstallation{}, err
+	}
+
+	installation := PackageInstallation{Status: resp.Item.Status, Elasticsearch: []InstalledAsset{}, Kibana: []InstalledAsset{}}
+
+	// Kibana 8.13 moved the assets of the installation out of its saved object
+	var assets *installedAssets
+	if resp.Item.InstallationInfo != nil {
+		assets = resp.Item.InstallationInfo
+	} else if resp.Item.SavedObject != nil {
+		assets = &resp.Item.SavedObject.Attributes
+	}
+	if assets != nil && installation.Status == PackageInstalled {
+		installation.Elasticsearch = append(installation.Elasticsearch, assets.Elasticsearch...)
+		installation.Kibana = append(installation.Kibana, assets.Kibana...)
+	}
+
+	return installation, nil
+}
+
+// UninstallIntegrationAssets uninstalls a version of a package, removing the assets it installed
+func (c *Client) UninstallIntegrationAssets(ctx context.Context, pkg IntegrationPackage) error {
+	span, _ := apm.StartSpanOptions(ctx, "Uninstalling assets for integration", "fleet.package.uninstall-assets", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("package", pkg.Name)
+	span.Context.SetLabel("version", pkg.Version)
+	defer span.End()
+
+	return c.sendJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/epm/packages/%s/%s", FleetAPI, pkg.Name, pkg.Version), nil, nil, "could not uninstall integration assets")
+}
+
+// SavedObjectExists returns true if a Kibana saved object exists, by its type, i.e. dashboard, and its ID
+func (c *Client) SavedObjectExists(ctx context.Context, objectType string, id string) (bool, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Checking saved object", "kibana.saved-objects.exists", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("type", objectType)
+	span.Context.SetLabel("id", id)
+	defer span.End()
+
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s/%s", SavedObjectsAPI, objectType, id), nil, nil, "could not get saved object")
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPackageDataStreamFields(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	s.AddPackageFile("system", "1.55.0", "manifest.yml", []byte("name: system"))
+	s.AddPackageFile("system", "1.55.0", "data_stream/cpu/manifest.yml", []byte("title: CPU"))
+	s.AddPackageFile("system", "1.55.0", "data_stream/cpu/fields/base-fields.yml", []byte("- name: '@timestamp'"))
+	s.AddPackageFile("system", "1.55.0", "data_stream/cpu/fields/fields.yml", []byte("- name: system.cpu"))
+	s.AddPackageFile("system", "1.55.0", "data_stream/memory/fields/fields.yml", []byte("- name: system.memory"))
+
+	system, err := client.GetIntegrationByPackageName(ctx, "system")
+	require.NoError(t, err)
+
+	assets, err := client.GetPackageAssets(ctx, system)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"data_stream/cpu/fields/base-fields.yml",
+		"data_stream/cpu/fields/fields.yml",
+		"data_stream/cpu/manifest.yml",
+		"data_stream/memory/fields/fields.yml",
+		"manifest.yml",
+	}, assets)
+
+	files, err := client.GetPackageDataStreamFields(ctx, system, "cpu")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"data_stream/cpu/fields/base-fields.yml": []byte("- name: '@timestamp'"),
+		"data_stream/cpu/fields/fields.yml":      []byte("- name: system.cpu"),
+	}, files)
+
+	t.Run("Data stream without fields", func(t *testing.T) {
+		_, err := client.GetPackageDataStreamFields(ctx, system, "load")
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing package version", func(t *testing.T) {
+		_, err := client.GetPackageAssets(ctx, kibana.IntegrationPackage{Name: "system", Version: "0.0.1"})
+		assert.True(t, kibana.IsNotFound(err))
+	})
+}
+
+func TestPackageInstallation(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	es := []kibana.InstalledAsset{
+		{ID: "metrics-system.cpu", Type: "index_template"},
+		{ID: "metrics-system.cpu@package", Type: "component_template"},
+	}
+	kb := []kibana.InstalledAsset{{ID: "system-overview", Type: "dashboard"}}
+	s.AddPackageAssets("system", "1.55.0", es, kb)
+
+	system, err := client.GetIntegrationByPackageName(ctx, "system")
+	require.NoError(t, err)
+
+	installation, err := client.GetPackageInstallation(ctx, system)
+	require.NoError(t, err)
+	assert.Equal(t, "not_installed", installation.Status)
+	assert.Empty(t, installation.Elasticsearch)
+
+	installed, err := client.InstallIntegrationAssets(ctx, system)
+	require.NoError(t, err)
+	assert.Len(t, installed, 3)
+
+	installation, err = client.GetPackageInstallation(ctx, system)
+	require.NoError(t, err)
+	assert.Equal(t, kibana.PackageInstalled, installation.Status)
+	assert.Equal(t, es, installation.Elasticsearch)
+	assert.Equal(t, kb, installation.Kibana)
+
+	exists, err := client.SavedObjectExists(ctx, "dashboard", "system-overview")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, client.UninstallIntegrationAssets(ctx, system))
+
+	exists, err = client.SavedObjectExists(ctx, "dashboard", "system-overview")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	installation, err = client.GetPackageInstallation(ctx, system)
+	require.NoError(t, err)
+	assert.Equal(t, "not_installed", installation.Status)
+	assert.Empty(t, installation.Kibana)
+}
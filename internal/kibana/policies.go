@@ -6,17 +6,20 @@ package kibana
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 
-	"github.com/Jeffail/gabs/v2"
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"go.elastic.co/apm/v2"
 )
 
+// listPerPage number of items requested per page when listing the policies and package policies
+const listPerPage = 100
+
 // FleetServicePolicy these values comes from the kibana.config.yml file at Fleet's profile dir
 var FleetServicePolicy = Policy{
 	ID:                   "fleet-server-policy",
@@ -27,15 +30,76 @@ var FleetServicePolicy = Policy{
 
 // Policy represents an Ingest Manager policy.
 type Policy struct {
-	ID                   string `json:"id,omitempty"`
-	Name                 string `json:"name"`
-	Description          string `json:"description"`
-	Namespace            string `json:"namespace"`
-	IsDefault            bool   `json:"is_default"`
-	IsManaged            bool   `json:"is_managed"`
-	IsDefaultFleetServer bool   `json:"is_default_fleet_server"`
-	AgentsCount          int    `json:"agents"` // Number of agents connected to Policy
-	Status               string `json:"status"`
+	ID                   string         `json:"id,omitempty"`
+	Name                 string         `json:"name"`
+	Description          string         `json:"description"`
+	Namespace            string         `json:"namespace"`
+	IsDefault            bool           `json:"is_default"`
+	IsManaged            bool           `json:"is_managed"`
+	IsDefaultFleetServer bool           `json:"is_default_fleet_server"`
+	AgentsCount          int            `json:"agents"` // Number of agents connected to Policy
+	Status               string         `json:"status"`
+	Revision             int            `json:"revision,omitempty"`
+	MonitoringEnabled    []string       `json:"monitoring_enabled,omitempty"`
+	DataOutputID         string         `json:"data_output_id,omitempty"`
+	MonitoringOutputID   string         `json:"monitoring_output_id,omitempty"`
+	FleetServerHostID    string         `json:"fleet_server_host_id,omitempty"`
+	InactivityTimeout    int            `json:"inactivity_timeout,omitempty"`
+	AgentFeatures        []AgentFeature `json:"agent_features,omitempty"`
+	UpdatedAt            string         `json:"updated_at,omitempty"`
+	SpaceIDs             []string       `json:"space_ids,omitempty"` // spaces of the policy, when Fleet is space aware
+}
+
+// AgentFeature represents a feature of the agents enabled or disabled in a policy, i.e. fqdn
+type AgentFeature struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// policyRequest represents the fields of a policy that can be written with the agent policies API
+type policyRequest struct {
+	Name               string         `json:"name"`
+	Description        string         `json:"description"`
+	Namespace          string         `json:"namespace"`
+	MonitoringEnabled  []string       `json:"monitoring_enabled"`
+	DataOutputID       *string        `json:"data_output_id"`       // null for the default output
+	MonitoringOutputID *string        `json:"monitoring_output_id"` // null for the default output
+	FleetServerHostID  string         `json:"fleet_server_host_id,omitempty"`
+	InactivityTimeout  int            `json:"inactivity_timeout,omitempty"`
+	AgentFeatures      []AgentFeature `json:"agent_features,omitempty"`
+}
+
+func newPolicyRequest(policy Policy) policyRequest {
+	namespace := policy.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// an empty list disables the monitoring, so that updates can turn it off
+	monitoringEnabled := policy.MonitoringEnabled
+	if monitoringEnabled == nil {
+		monitoringEnabled = []string{}
+	}
+
+	return policyRequest{
+		Name:               policy.Name,
+		Description:        policy.Description,
+		Namespace:          namespace,
+		MonitoringEnabled:  monitoringEnabled,
+		DataOutputID:       outputID(policy.DataOutputID),
+		MonitoringOutputID: outputID(policy.MonitoringOutputID),
+		FleetServerHostID:  policy.FleetServerHostID,
+		InactivityTimeout:  policy.InactivityTimeout,
+		AgentFeatures:      policy.AgentFeatures,
+	}
+}
+
+// outputID returns the ID of an output of a policy, nil for the default output
+func outputID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
 }
 
 // GetDefaultPolicy gets the default policy or optionally the default fleet policy
@@ -63,41 +127,29 @@ func (c *Client) GetDefaultPolicy(ctx context.Context, fleetServer bool) (Policy
 	return Policy{}, errors.New("Could not obtain default policy")
 }
 
-// ListPolicies returns the list of policies
+// ListPolicies returns the list of policies, requesting all the pages of the list
 func (c *Client) ListPolicies(ctx context.Context) ([]Policy, error) {
 	span, _ := apm.StartSpanOptions(ctx, "Listing Elastic Agent policies", "fleet.agent-policies.list", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
 	defer span.End()
 
-	statusCode, respBody, err := c.get(ctx, fmt.Sprintf("%s/agent_policies", FleetAPI))
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  string(respBody),
-			"error": err,
-		}).Error("Could not get Fleet's policies")
-		return nil, err
-	}
-
-	if statusCode != 200 {
-		log.WithFields(log.Fields{
-			"error":      err,
-			"body":       string(respBody),
-			"statusCode": statusCode,
-		}).Error("Could not get Fleet's policies")
-
-		return nil, err
-	}
+	policies := []Policy{}
+	for page := 1; ; page++ {
+		var resp struct {
+			Items []Policy `json:"items"`
+			Total int      `json:"total"`
+		}
+		err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agent_policies?page=%d&perPage=%d", FleetAPI, page, listPerPage), nil, &resp, "could not get Fleet's policies")
+		if err != nil {
+			return nil, err
+		}
 
-	var resp struct {
-		Items []Policy `json:"items"`
-	}
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return nil, errors.Wrap(err, "Unable to convert list of policies to JSON")
+		policies = append(policies, resp.Items...)
+		if len(resp.Items) == 0 || len(policies) >= resp.Total {
+			return policies, nil
+		}
 	}
-
-	return resp.Items, nil
 }
 
 // DeleteAllPolicies deletes all policies except fleet_server and system
@@ -129,66 +181,122 @@ func (c *Client) DeleteAllPolicies(ctx context.Context) {
 	}
 }
 
-// CreatePolicy creates a new policy for agent to utilize
+// CreatePolicy creates a new policy for agent to utilize, writing to the default namespace
 func (c *Client) CreatePolicy(ctx context.Context) (Policy, error) {
-	span, _ := apm.StartSpanOptions(ctx, "Creating agent policy", "fleet.package-policies.create", apm.SpanOptions{
-		Parent: apm.SpanFromContext(ctx).TraceContext(),
-	})
-	defer span.End()
+	return c.CreatePolicyInNamespace(ctx, "default")
+}
 
+// CreatePolicyInNamespace creates a new test policy whose agents write their data, and their monitoring data,
+// to the data streams of a namespace, i.e. logs-*-<namespace>
+func (c *Client) CreatePolicyInNamespace(ctx context.Context, namespace string) (Policy, error) {
 	policyUUID := uuid.New().String()
 
-	reqBody := `{
-		"description": "Test policy ` + policyUUID + `",
-		"namespace": "default",
-		"monitoring_enabled": ["logs", "metrics"],
-		"name": "test-policy-` + policyUUID + `"
-	}`
-
-	statusCode, respBody, _ := c.post(ctx, fmt.Sprintf("%s/agent_policies", FleetAPI), []byte(reqBody))
+	return c.CreateAgentPolicy(ctx, Policy{
+		Name:              "test-policy-" + policyUUID,
+		Description:       "Test policy " + policyUUID,
+		Namespace:         namespace,
+		MonitoringEnabled: []string{"logs", "metrics"},
+	})
+}
 
-	jsonParsed, err := gabs.ParseJSON(respBody)
+// GetPolicy returns an agent policy by its ID
+func (c *Client) GetPolicy(ctx context.Context, policyID string) (Policy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting agent policy", "fleet.agent-policies.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
 
+	var resp struct {
+		Item Policy `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/agent_policies/%s", FleetAPI, policyID), nil, &resp, "could not get Fleet's policy")
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": jsonParsed,
-		}).Error("Could not parse get response into JSON")
 		return Policy{}, err
 	}
 
-	log.WithFields(log.Fields{
-		"status":   statusCode,
-		"err":      err,
-		"reqBody":  reqBody,
-		"respBody": jsonParsed,
-	}).Trace("Policy creation result")
+	return resp.Item, nil
+}
 
-	if statusCode != 200 {
-		return Policy{}, fmt.Errorf("Could not create Fleet's policy, unhandled server error (%d)", statusCode)
-	}
+// CreateAgentPolicy creates an agent policy with the writable fields of a policy, defaulting the namespace
+func (c *Client) CreateAgentPolicy(ctx context.Context, policy Policy) (Policy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating agent policy", "fleet.agent-policies.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("name", policy.Name)
+	defer span.End()
 
+	var resp struct {
+		Item Policy `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agent_policies", FleetAPI), newPolicyRequest(policy), &resp, "could not create Fleet's policy")
 	if err != nil {
-		return Policy{}, errors.Wrap(err, "Could not create Fleet's policy")
+		return Policy{}, err
 	}
 
+	c.deletePolicyOnCleanup(ctx, resp.Item)
+	return resp.Item, nil
+}
+
+// UpdatePolicy updates the writable fields of an agent policy, returning the policy with its new revision
+func (c *Client) UpdatePolicy(ctx context.Context, policy Policy) (Policy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating agent policy", "fleet.agent-policies.update", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("policyID", policy.ID)
+	defer span.End()
+
 	var resp struct {
 		Item Policy `json:"item"`
 	}
-
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return Policy{}, errors.Wrap(err, "Unable to convert list of new policy to JSON")
+	err := c.sendJSONRequest(ctx, http.MethodPut, fmt.Sprintf("%s/agent_policies/%s", FleetAPI, policy.ID), newPolicyRequest(policy), &resp, "could not update Fleet's policy")
+	if err != nil {
+		return Policy{}, err
 	}
 
 	return resp.Item, nil
 }
 
+// DeletePolicy deletes an agent policy, which must not have agents enrolled
+func (c *Client) DeletePolicy(ctx context.Context, policyID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting agent policy", "fleet.agent-policies.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("policyID", policyID)
+	defer span.End()
+
+	reqBody := map[string]string{"agentPolicyId": policyID}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/agent_policies/delete", FleetAPI), reqBody, nil, "could not delete Fleet's policy")
+	if err != nil {
+		return err
+	}
+
+	cleanup.Forget(ctx, policyResource(policyID))
+	return nil
+}
+
+// deletePolicyOnCleanup registers the deletion of a policy created by a scenario, which is already deleted
+// if the scenario deleted its space
+func (c *Client) deletePolicyOnCleanup(ctx context.Context, policy Policy) {
+	cleanup.Register(ctx, policyResource(policy.ID), func(ctx context.Context) error {
+		err := c.DeletePolicy(ctx, policy.ID)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// policyResource returns the name of a policy in the clean up stack of a scenario
+func policyResource(policyID string) string {
+	return "agent policy " + policyID
+}
+
 // Var represents a single variable at the package or
 // data stream level, encapsulating the data type of the
 // variable and it's value.
 type Var struct {
-	Value interface{} `json:"value"`
-	Type  string      `json:"type"`
+	Value interface{} `json:"value" yaml:"value"`
+	Type  string      `json:"type" yaml:"type"`
 }
 
 // Vars is a collection of variables either at the package or
@@ -226,6 +334,7 @@ type PackageDataStream struct {
 	PolicyID    string             `json:"policy_id"`
 	Enabled     bool               `json:"enabled"`
 	OutputID    string             `json:"output_id"`
+	Vars        Vars               `json:"vars,omitempty"`
 	Inputs      []Input            `json:"inputs"`
 	Package     IntegrationPackage `json:"package"`
 }
@@ -238,40 +347,27 @@ type Stream struct {
 	Vars    Vars       `json:"vars,omitempty"`
 }
 
-// ListPackagePolicies return list of package policies
+// ListPackagePolicies return list of package policies, requesting all the pages of the list
 func (c *Client) ListPackagePolicies(ctx context.Context) ([]PackageDataStream, error) {
 	span, _ := apm.StartSpanOptions(ctx, "Listing package policies", "fleet.package-policies.items", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
 	defer span.End()
 
-	statusCode, respBody, err := c.get(ctx, fmt.Sprintf("%s/package_policies", FleetAPI))
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  string(respBody),
-			"error": err,
-		}).Error("Could not get Fleet's package policies")
-		return nil, err
-	}
-
-	if statusCode != 200 {
-		log.WithFields(log.Fields{
-			"body":       string(respBody),
-			"error":      err,
-			"statusCode": statusCode,
-		}).Error("Could not get Fleet's package policies")
-
-		return nil, err
-	}
-
-	var resp struct {
-		Items []PackageDataStream `json:"items"`
-	}
+	packagePolicies := []PackageDataStream{}
+	for page := 1; ; page++ {
+		var resp struct {
+			Items []PackageDataStream `json:"items"`
+			Total int                 `json:"total"`
+		}
+		err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/package_policies?page=%d&perPage=%d", FleetAPI, page, listPerPage), nil, &resp, "could not get Fleet's package policies")
+		if err != nil {
+			return nil, err
+		}
 
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return nil, errors.Wrap(err, "Unable to convert list of package policies to JSON")
+		packagePolicies = append(packagePolicies, resp.Items...)
+		if len(resp.Items) == 0 || len(packagePolicies) >= resp.Total {
+			return packagePolicies, nil
+		}
 	}
-
-	return resp.Items, nil
 }
@@ -0,0 +1,643 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// MonitoringLogs the agents of the policy ship their own logs
+	MonitoringLogs = "logs"
+	// MonitoringMetrics the agents of the policy ship their own metrics
+	MonitoringMetrics = "metrics"
+)
+
+// PolicySpec represents an agent policy and its package policies as code. It can be built with
+// a PolicyBuilder, or loaded from a YAML fixture, and then applied with the Client
+type PolicySpec struct {
+	Name               string              `yaml:"name"`
+	Description        string              `yaml:"description,omitempty"`
+	Namespace          string              `yaml:"namespace,omitempty"`
+	Monitoring         []string            `yaml:"monitoring,omitempty"` // logs and/or metrics, none when empty
+	DataOutputID       string              `yaml:"data_output_id,omitempty"`
+	MonitoringOutputID string              `yaml:"monitoring_output_id,omitempty"`
+	FleetServerHostID  string              `yaml:"fleet_server_host_id,omitempty"`
+	InactivityTimeout  int                 `yaml:"inactivity_timeout,omitempty"` // in seconds
+	AgentFeatures      map[string]bool     `yaml:"agent_features,omitempty"`
+	PackagePolicies    []PackagePolicySpec `yaml:"package_policies,omitempty"`
+}
+
+// PackagePolicySpec represents a package policy of an agent policy, with its enabled inputs and streams
+type PackagePolicySpec struct {
+	Name        string      `yaml:"name,omitempty"` // defaults to <policy name>-<package>
+	Description string      `yaml:"description,omitempty"`
+	Namespace   string      `yaml:"namespace,omitempty"` // defaults to the namespace of the agent policy
+	Package     string      `yaml:"package"`
+	Version     string      `yaml:"version,omitempty"` // defaults to the version known by Fleet
+	OutputID    string      `yaml:"output_id,omitempty"`
+	Vars        Vars        `yaml:"vars,omitempty"`
+	Inputs      []InputSpec `yaml:"inputs,omitempty"`
+}
+
+// InputSpec represents an enabled input of a package policy
+type InputSpec struct {
+	Type    string       `yaml:"type"`
+	Vars    Vars         `yaml:"vars,omitempty"`
+	Streams []StreamSpec `yaml:"streams,omitempty"`
+}
+
+// StreamSpec represents an enabled stream of an input, by its data stream
+type StreamSpec struct {
+	Type    string `yaml:"type"` // logs, metrics, traces or synthetics
+	Dataset string `yaml:"dataset"`
+	Vars    Vars   `yaml:"vars,omitempty"`
+}
+
+// NamedVar represents a typed variable of a package policy, an input or a stream
+type NamedVar struct {
+	Name string
+	Var
+}
+
+// TextVar creates a variable of the text type
+func TextVar(name string, value string) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "text", Value: value}}
+}
+
+// TextListVar creates a variable of the text type with multiple values, i.e. paths
+func TextListVar(name string, values ...string) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "text", Value: values}}
+}
+
+// BoolVar creates a variable of the bool type
+func BoolVar(name string, value bool) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "bool", Value: value}}
+}
+
+// IntegerVar creates a variable of the integer type
+func IntegerVar(name string, value int) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "integer", Value: value}}
+}
+
+// YAMLVar creates a variable of the yaml type, i.e. processors
+func YAMLVar(name string, value string) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "yaml", Value: value}}
+}
+
+// DurationVar creates a variable of the text type with a duration, i.e. the period of a metric
+func DurationVar(name string, value time.Duration) NamedVar {
+	return NamedVar{Name: name, Var: Var{Type: "text", Value: value.String()}}
+}
+
+func newVars(vars []NamedVar) Vars {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	result := Vars{}
+	for _, v := range vars {
+		result[v.Name] = v.Var
+	}
+	return result
+}
+
+// NewInput creates the spec of an input with its variables
+func NewInput(inputType string, vars ...NamedVar) InputSpec {
+	return InputSpec{Type: inputType, Vars: newVars(vars)}
+}
+
+// WithStream adds a stream to the input, for a data stream
+func (i InputSpec) WithStream(dataStreamType string, dataset string, vars ...NamedVar) InputSpec {
+	i.Streams = append(append([]StreamSpec{}, i.Streams...), StreamSpec{
+		Type:    dataStreamType,
+		Dataset: dataset,
+		Vars:    newVars(vars),
+	})
+	return i
+}
+
+// NewPackagePolicy creates the spec of a package policy for a package, with its package-level variables
+func NewPackagePolicy(packageName string, vars ...NamedVar) PackagePolicySpec {
+	return PackagePolicySpec{Package: packageName, Vars: newVars(vars)}
+}
+
+// Named sets the name of the package policy
+func (pp PackagePolicySpec) Named(name string) PackagePolicySpec {
+	pp.Name = name
+	return pp
+}
+
+// WithVersion pins the version of the package
+func (pp PackagePolicySpec) WithVersion(version string) PackagePolicySpec {
+	pp.Version = version
+	return pp
+}
+
+// WithOutput sends the data of the package policy to an output
+func (pp PackagePolicySpec) WithOutput(outputID string) PackagePolicySpec {
+	pp.OutputID = outputID
+	return pp
+}
+
+// WithInputs adds enabled inputs to the package policy
+func (pp PackagePolicySpec) WithInputs(inputs ...InputSpec) PackagePolicySpec {
+	pp.Inputs = append(append([]InputSpec{}, pp.Inputs...), inputs...)
+	return pp
+}
+
+// PolicyBuilder builds the spec of an agent policy with a fluent API. The policy is created
+// in the default namespace, with the logs and metrics of the agents being monitored
+type PolicyBuilder struct {
+	spec PolicySpec
+}
+
+// NewPolicyBuilder creates a builder for the agent policy with a name
+func NewPolicyBuilder(name string) *PolicyBuilder {
+	return &PolicyBuilder{
+		spec: PolicySpec{
+			Name:       name,
+			Namespace:  "default",
+			Monitoring: []string{MonitoringLogs, MonitoringMetrics},
+		},
+	}
+}
+
+// Description sets the description of the policy
+func (b *PolicyBuilder) Description(description string) *PolicyBuilder {
+	b.spec.Description = description
+	return b
+}
+
+// Namespace sets the namespace of the data streams of the policy
+func (b *PolicyBuilder) Namespace(namespace string) *PolicyBuilder {
+	b.spec.Namespace = namespace
+	return b
+}
+
+// Monitoring sets what the agents of the policy monitor about themselves, nothing if empty
+func (b *PolicyBuilder) Monitoring(monitoring ...string) *PolicyBuilder {
+	b.spec.Monitoring = monitoring
+	return b
+}
+
+// DataOutput sends the data of the integrations to an output
+func (b *PolicyBuilder) DataOutput(outputID string) *PolicyBuilder {
+	b.spec.DataOutputID = outputID
+	return b
+}
+
+// MonitoringOutput sends the monitoring data of the agents to an output
+func (b *PolicyBuilder) MonitoringOutput(outputID string) *PolicyBuilder {
+	b.spec.MonitoringOutputID = outputID
+	return b
+}
+
+// FleetServerHost makes the agents of the policy connect to a Fleet Server host
+func (b *PolicyBuilder) FleetServerHost(hostID string) *PolicyBuilder {
+	b.spec.FleetServerHostID = hostID
+	return b
+}
+
+// InactivityTimeout sets the time after which the agents not checking in become inactive
+func (b *PolicyBuilder) InactivityTimeout(timeout time.Duration) *PolicyBuilder {
+	b.spec.InactivityTimeout = int(timeout.Seconds())
+	return b
+}
+
+// AgentFeature enables or disables a feature of the agents, i.e. fqdn
+func (b *PolicyBuilder) AgentFeature(name string, enabled bool) *PolicyBuilder {
+	if b.spec.AgentFeatures == nil {
+		b.spec.AgentFeatures = map[string]bool{}
+	}
+	b.spec.AgentFeatures[name] = enabled
+	return b
+}
+
+// PackagePolicy adds a package policy to the policy
+func (b *PolicyBuilder) PackagePolicy(pp PackagePolicySpec) *PolicyBuilder {
+	b.spec.PackagePolicies = append(b.spec.PackagePolicies, pp)
+	return b
+}
+
+// Build returns the spec of the policy
+func (b *PolicyBuilder) Build() PolicySpec {
+	return b.spec
+}
+
+// LoadPolicySpec reads the spec of a policy from a YAML fixture
+func LoadPolicySpec(path string) (PolicySpec, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return PolicySpec{}, fmt.Errorf("could not read policy fixture %s: %w", path, err)
+	}
+
+	var spec PolicySpec
+	err = yaml.UnmarshalStrict(bytes, &spec)
+	if err != nil {
+		return PolicySpec{}, fmt.Errorf("could not parse policy fixture %s: %w", path, err)
+	}
+
+	if spec.Name == "" {
+		return PolicySpec{}, fmt.Errorf("the policy fixture %s has no name", path)
+	}
+
+	for i, pp := range spec.PackagePolicies {
+		if pp.Package == "" {
+			return PolicySpec{}, fmt.Errorf("the package policy %d of the policy fixture %s has no package", i, path)
+		}
+
+		normalizeVars(pp.Vars)
+		for _, input := range pp.Inputs {
+			normalizeVars(input.Vars)
+			for _, stream := range input.Streams {
+				normalizeVars(stream.Vars)
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+// Save writes the spec of the policy to a YAML fixture, creating its directory if needed
+func (spec PolicySpec) Save(path string) error {
+	bytes, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create the directory of the policy fixture %s: %w", path, err)
+	}
+
+	err = os.WriteFile(path, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write policy fixture %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// toPolicy returns the agent policy of the spec, to be created or updated
+func (spec PolicySpec) toPolicy() Policy {
+	namespace := spec.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	features := []AgentFeature{}
+	for name, enabled := range spec.AgentFeatures {
+		features = append(features, AgentFeature{Name: name, Enabled: enabled})
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].Name < features[j].Name
+	})
+
+	monitoring := append([]string{}, spec.Monitoring...)
+	sort.Strings(monitoring)
+
+	return Policy{
+		Name:               spec.Name,
+		Description:        spec.Description,
+		Namespace:          namespace,
+		MonitoringEnabled:  monitoring,
+		DataOutputID:       spec.DataOutputID,
+		MonitoringOutputID: spec.MonitoringOutputID,
+		FleetServerHostID:  spec.FleetServerHostID,
+		InactivityTimeout:  spec.InactivityTimeout,
+		AgentFeatures:      features,
+	}
+}
+
+// packagePolicyName returns the name of a package policy of the spec
+func (spec PolicySpec) packagePolicyName(pp PackagePolicySpec) string {
+	if pp.Name != "" {
+		return pp.Name
+	}
+	return spec.Name + "-" + pp.Package
+}
+
+// BuildInputs returns the enabled inputs of the package policy, to be sent to Fleet
+func (pp PackagePolicySpec) BuildInputs() []Input {
+	return pp.toInputs(nil)
+}
+
+// toInputs returns the inputs of the package policy, reusing the IDs of the existing streams
+func (pp PackagePolicySpec) toInputs(existing []Input) []Input {
+	streamIDs := map[string]string{}
+	for _, input := range existing {
+		for _, stream := range input.Streams {
+			streamIDs[input.Type+"|"+stream.DS.Dataset] = stream.ID
+		}
+	}
+
+	inputs := []Input{}
+	for _, in := range pp.Inputs {
+		input := Input{
+			Type:    in.Type,
+			Enabled: true,
+			Streams: []Stream{},
+			Vars:    in.Vars,
+		}
+
+		for _, s := range in.Streams {
+			id, ok := streamIDs[in.Type+"|"+s.Dataset]
+			if !ok {
+				id = in.Type + "-" + s.Dataset
+			}
+
+			input.Streams = append(input.Streams, Stream{
+				ID:      id,
+				Enabled: true,
+				DS:      DataStream{Type: s.Type, Dataset: s.Dataset},
+				Vars:    s.Vars,
+			})
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs
+}
+
+// normalizeVars converts the maps parsed from YAML, keyed by interface{}, into maps that can be sent as JSON
+func normalizeVars(vars Vars) {
+	for name, v := range vars {
+		v.Value = normalizeYAML(v.Value)
+		vars[name] = v
+	}
+}
+
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+
+	return value
+}
+
+// ApplyPolicy creates or updates the agent policy of a spec, found by name, and its package policies,
+// so that applying the same spec again changes nothing. The package policies of the agent policy
+// which are not in the spec are deleted
+func (c *Client) ApplyPolicy(ctx context.Context, spec PolicySpec) (Policy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Applying agent policy", "fleet.agent-policies.apply", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("name", spec.Name)
+	defer span.End()
+
+	policies, err := c.ListPolicies(ctx)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	desired := spec.toPolicy()
+
+	var policy Policy
+	found := false
+	for _, p := range policies {
+		if p.Name == spec.Name {
+			policy = p
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		policy, err = c.CreateAgentPolicy(ctx, desired)
+		if err != nil {
+			return Policy{}, err
+		}
+		log.WithFields(log.Fields{
+			"name":     policy.Name,
+			"policyID": policy.ID,
+		}).Debug("Agent policy created")
+	} else if !samePolicy(policy, desired) {
+		desired.ID = policy.ID
+		policy, err = c.UpdatePolicy(ctx, desired)
+		if err != nil {
+			return Policy{}, err
+		}
+		log.WithFields(log.Fields{
+			"name":     policy.Name,
+			"policyID": policy.ID,
+			"revision": policy.Revision,
+		}).Debug("Agent policy updated")
+	}
+
+	packagePolicies, err := c.ListPackagePolicies(ctx)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	existing := map[string]PackageDataStream{}
+	for _, pp := range packagePolicies {
+		if pp.PolicyID == policy.ID {
+			existing[pp.Name] = pp
+		}
+	}
+
+	for _, pp := range spec.PackagePolicies {
+		name := spec.packagePolicyName(pp)
+		current, ok := existing[name]
+		delete(existing, name)
+
+		err = c.applyPackagePolicy(ctx, spec, policy, pp, current, ok)
+		if err != nil {
+			return Policy{}, err
+		}
+	}
+
+	for _, pp := range existing {
+		err = c.DeleteIntegrationFromPolicy(ctx, pp)
+		if err != nil {
+			return Policy{}, err
+		}
+		log.WithFields(log.Fields{
+			"name":     pp.Name,
+			"policyID": policy.ID,
+		}).Debug("Package policy not in the spec deleted")
+	}
+
+	// the package policies bump the revision of the agent policy
+	return c.GetPolicy(ctx, policy.ID)
+}
+
+func (c *Client) applyPackagePolicy(ctx context.Context, spec PolicySpec, policy Policy, pp PackagePolicySpec, current PackageDataStream, exists bool) error {
+	integration, err := c.GetIntegrationByPackageName(ctx, pp.Package)
+	if err != nil {
+		return err
+	}
+	if pp.Version != "" {
+		integration.Version = pp.Version
+	}
+
+	namespace := pp.Namespace
+	if namespace == "" {
+		namespace = policy.Namespace
+	}
+
+	desired := PackageDataStream{
+		Name:        spec.packagePolicyName(pp),
+		Description: pp.Description,
+		Namespace:   namespace,
+		PolicyID:    policy.ID,
+		Enabled:     true,
+		OutputID:    pp.OutputID,
+		Vars:        pp.Vars,
+		Package:     integration,
+		Inputs:      pp.toInputs(current.Inputs),
+	}
+
+	if !exists {
+		created, err := c.CreatePackagePolicy(ctx, desired)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"name":            created.Name,
+			"packagePolicyID": created.ID,
+			"policyID":        policy.ID,
+		}).Debug("Package policy created")
+		return nil
+	}
+
+	if samePackagePolicy(current, desired) {
+		return nil
+	}
+
+	desired.ID = current.ID
+	_, err = c.UpdateIntegrationPackagePolicy(ctx, desired)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"name":            desired.Name,
+		"packagePolicyID": desired.ID,
+		"policyID":        policy.ID,
+	}).Debug("Package policy updated")
+	return nil
+}
+
+// samePolicy returns true if the policy has the settings of the desired one
+func samePolicy(current Policy, desired Policy) bool {
+	monitoring := append([]string{}, current.MonitoringEnabled...)
+	sort.Strings(monitoring)
+
+	features := map[string]bool{}
+	for _, f := range current.AgentFeatures {
+		features[f.Name] = f.Enabled
+	}
+	for _, f := range desired.AgentFeatures {
+		enabled, ok := features[f.Name]
+		if !ok || enabled != f.Enabled {
+			return false
+		}
+	}
+
+	return current.Description == desired.Description &&
+		current.Namespace == desired.Namespace &&
+		strings.Join(monitoring, ",") == strings.Join(desired.MonitoringEnabled, ",") &&
+		current.DataOutputID == desired.DataOutputID &&
+		current.MonitoringOutputID == desired.MonitoringOutputID &&
+		current.FleetServerHostID == desired.FleetServerHostID &&
+		current.InactivityTimeout == desired.InactivityTimeout &&
+		len(current.AgentFeatures) == len(desired.AgentFeatures)
+}
+
+// samePackagePolicy returns true if the package policy has the settings, the enabled inputs and streams,
+// and the variables of the desired one. The variables not in the desired package policy are ignored,
+// as Fleet fills them with the defaults of the package
+func samePackagePolicy(current PackageDataStream, desired PackageDataStream) bool {
+	if current.Namespace != desired.Namespace || current.OutputID != desired.OutputID ||
+		current.Package.Version != desired.Package.Version || current.Description != desired.Description {
+		return false
+	}
+
+	if !containsVars(current.Vars, desired.Vars) {
+		return false
+	}
+
+	enabled := map[string]Vars{}
+	for _, input := range current.Inputs {
+		if !input.Enabled {
+			continue
+		}
+
+		enabled[input.Type] = input.Vars
+		for _, stream := range input.Streams {
+			if stream.Enabled {
+				enabled[input.Type+"|"+stream.DS.Dataset] = stream.Vars
+			}
+		}
+	}
+
+	count := 0
+	for _, input := range desired.Inputs {
+		vars, ok := enabled[input.Type]
+		if !ok || !containsVars(vars, input.Vars) {
+			return false
+		}
+		count++
+
+		for _, stream := range input.Streams {
+			vars, ok := enabled[input.Type+"|"+stream.DS.Dataset]
+			if !ok || !containsVars(vars, stream.Vars) {
+				return false
+			}
+			count++
+		}
+	}
+
+	return count == len(enabled)
+}
+
+// containsVars returns true if the variables have the values of the desired ones, compared as JSON
+// so that numbers parsed from a response match the numbers of the spec
+func containsVars(vars Vars, desired Vars) bool {
+	for name, d := range desired {
+		v, ok := vars[name]
+		if !ok {
+			return false
+		}
+
+		value, err := json.Marshal(v.Value)
+		if err != nil {
+			return false
+		}
+		desiredValue, err := json.Marshal(d.Value)
+		if err != nil {
+			return false
+		}
+
+		if string(value) != string(desiredValue) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,190 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func linuxMemoryPolicy() kibana.PolicySpec {
+	return kibana.NewPolicyBuilder("e2e-linux-memory").
+		Description("Linux memory metrics").
+		Namespace("e2e").
+		Monitoring(kibana.MonitoringLogs).
+		InactivityTimeout(336*time.Hour).
+		AgentFeature("fqdn", true).
+		PackagePolicy(kibana.NewPackagePolicy("linux").WithInputs(
+			kibana.NewInput("linux/metrics").WithStream("metrics", "linux.memory", kibana.TextVar("period", "1s")),
+		)).
+		PackagePolicy(kibana.NewPackagePolicy("system").Named("e2e-system-logs").WithInputs(
+			kibana.NewInput("logfile").WithStream("logs", "system.syslog",
+				kibana.TextListVar("paths", "/var/log/messages*", "/var/log/syslog*"),
+				kibana.NamedVar{Name: "processors", Var: kibana.Var{Type: "yaml", Value: map[string]interface{}{
+					"add_fields": map[string]interface{}{"target": "e2e"},
+				}}},
+			),
+		)).
+		Build()
+}
+
+// assertSameSpec compares the specs as YAML, as the lists parsed from a fixture are not typed
+func assertSameSpec(t *testing.T, expected kibana.PolicySpec, actual kibana.PolicySpec) {
+	expectedYAML, err := yaml.Marshal(expected)
+	require.NoError(t, err)
+	actualYAML, err := yaml.Marshal(actual)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(expectedYAML), string(actualYAML))
+}
+
+func newFakeClient(t *testing.T) (*kibanatest.Server, *kibana.Client) {
+	s := kibanatest.NewServer(t)
+	s.AddPackage("linux", "Linux Metrics", "0.6.8")
+	s.AddPackage("system", "System", "1.55.0")
+
+	client, err := s.NewClient()
+	require.NoError(t, err)
+
+	return s, client
+}
+
+func TestPolicyBuilder(t *testing.T) {
+	spec := kibana.NewPolicyBuilder("e2e-policy").Build()
+
+	assert.Equal(t, "e2e-policy", spec.Name)
+	assert.Equal(t, "default", spec.Namespace)
+	assert.Equal(t, []string{kibana.MonitoringLogs, kibana.MonitoringMetrics}, spec.Monitoring)
+	assert.Empty(t, spec.PackagePolicies)
+
+	input := kibana.NewInput("linux/metrics")
+	withStream := input.WithStream("metrics", "linux.memory", kibana.DurationVar("period", 10*time.Second))
+	assert.Empty(t, input.Streams, "the input must not be modified")
+	require.Len(t, withStream.Streams, 1)
+	assert.Equal(t, kibana.Var{Type: "text", Value: "10s"}, withStream.Streams[0].Vars["period"])
+
+	pp := kibana.NewPackagePolicy("apm", kibana.BoolVar("enabled", true), kibana.IntegerVar("port", 8200))
+	assert.Equal(t, kibana.Var{Type: "bool", Value: true}, pp.Vars["enabled"])
+	assert.Equal(t, kibana.Var{Type: "integer", Value: 8200}, pp.Vars["port"])
+}
+
+func TestPolicySpec_Fixtures(t *testing.T) {
+	loaded, err := kibana.LoadPolicySpec(filepath.Join("testdata", "policies", "linux_memory.yml"))
+	require.NoError(t, err)
+	assertSameSpec(t, linuxMemoryPolicy(), loaded)
+
+	path := filepath.Join(t.TempDir(), "policies", "saved.yml")
+	require.NoError(t, loaded.Save(path))
+
+	saved, err := kibana.LoadPolicySpec(path)
+	require.NoError(t, err)
+	assertSameSpec(t, loaded, saved)
+
+	_, err = kibana.LoadPolicySpec(filepath.Join("testdata", "policies", "missing.yml"))
+	assert.Error(t, err)
+}
+
+func TestApplyPolicy(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	spec := linuxMemoryPolicy()
+
+	policy, err := client.ApplyPolicy(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, "e2e", policy.Namespace)
+	assert.Equal(t, []string{kibana.MonitoringLogs}, policy.MonitoringEnabled)
+	assert.Equal(t, 1209600, policy.InactivityTimeout)
+	assert.Equal(t, []kibana.AgentFeature{{Name: "fqdn", Enabled: true}}, policy.AgentFeatures)
+	// created, plus one revision per package policy
+	assert.Equal(t, 3, policy.Revision)
+
+	packagePolicies, err := client.ListPackagePolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, packagePolicies, 2)
+	assert.Equal(t, "e2e-linux-memory-linux", packagePolicies[0].Name)
+	assert.Equal(t, "0.6.8", packagePolicies[0].Package.Version)
+	assert.Equal(t, "e2e", packagePolicies[0].Namespace)
+	assert.Equal(t, "e2e-system-logs", packagePolicies[1].Name)
+
+	t.Run("Applying the same spec again changes nothing", func(t *testing.T) {
+		reapplied, err := client.ApplyPolicy(ctx, spec)
+		require.NoError(t, err)
+		assert.Equal(t, policy.ID, reapplied.ID)
+		assert.Equal(t, policy.Revision, reapplied.Revision)
+		assert.Len(t, s.Policies(), 2)
+	})
+
+	linuxID := packagePolicies[0].ID
+
+	t.Run("Applying a changed spec updates the policy", func(t *testing.T) {
+		changed := spec
+		changed.Monitoring = nil
+		changed.PackagePolicies = []kibana.PackagePolicySpec{
+			kibana.NewPackagePolicy("linux").WithInputs(
+				kibana.NewInput("linux/metrics").WithStream("metrics", "linux.memory", kibana.TextVar("period", "10s")),
+			),
+		}
+
+		updated, err := client.ApplyPolicy(ctx, changed)
+		require.NoError(t, err)
+		assert.Equal(t, policy.ID, updated.ID)
+		assert.Empty(t, updated.MonitoringEnabled)
+		// the policy, the linux package policy and the deleted system package policy
+		assert.Equal(t, policy.Revision+3, updated.Revision)
+
+		packagePolicies, err := client.ListPackagePolicies(ctx)
+		require.NoError(t, err)
+		require.Len(t, packagePolicies, 1)
+		assert.Equal(t, linuxID, packagePolicies[0].ID)
+		stream := packagePolicies[0].Inputs[0].Streams[0]
+		assert.Equal(t, "10s", stream.Vars["period"].Value)
+	})
+
+	t.Run("Applying a spec with an unknown package fails", func(t *testing.T) {
+		unknown := kibana.NewPolicyBuilder("e2e-unknown").PackagePolicy(kibana.NewPackagePolicy("unknown")).Build()
+
+		_, err := client.ApplyPolicy(ctx, unknown)
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyPolicy_MoreThanOnePage(t *testing.T) {
+	ctx := context.Background()
+	s, client := newFakeClient(t)
+
+	// the Fleet API lists 20 items per page by default, so the policy is applied after more than a page of others
+	for i := 0; i < 25; i++ {
+		other := kibana.NewPolicyBuilder(fmt.Sprintf("e2e-other-%d", i)).
+			PackagePolicy(kibana.NewPackagePolicy("linux")).
+			Build()
+
+		_, err := client.ApplyPolicy(ctx, other)
+		require.NoError(t, err)
+	}
+
+	spec := linuxMemoryPolicy()
+	policy, err := client.ApplyPolicy(ctx, spec)
+	require.NoError(t, err)
+
+	reapplied, err := client.ApplyPolicy(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, policy.ID, reapplied.ID)
+	assert.Equal(t, policy.Revision, reapplied.Revision)
+	assert.Len(t, s.Policies(), 27)
+
+	packagePolicies, err := client.ListPackagePolicies(ctx)
+	require.NoError(t, err)
+	assert.Len(t, packagePolicies, 27)
+}
@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.elastic.co/apm/v2"
+)
+
+// Proxy represents a proxy the agents use to reach the outputs and the Fleet Server hosts
+type Proxy struct {
+	ID                     string            `json:"id,omitempty"`
+	Name                   string            `json:"name"`
+	URL                    string            `json:"url"`
+	Certificate            string            `json:"certificate,omitempty"`
+	CertificateAuthorities string            `json:"certificate_authorities,omitempty"`
+	CertificateKey         string            `json:"certificate_key,omitempty"`
+	ProxyHeaders           map[string]string `json:"proxy_headers,omitempty"`
+	IsPreconfigured        bool              `json:"is_preconfigured,omitempty"`
+}
+
+// proxyRequest returns the proxy without its read-only fields, to be written with the proxies API
+func (p Proxy) proxyRequest() Proxy {
+	p.ID = ""
+	p.IsPreconfigured = false
+	return p
+}
+
+// ListProxies returns the proxies of Fleet
+func (c *Client) ListProxies(ctx context.Context) ([]Proxy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing Fleet proxies", "fleet.proxies.list", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Items []Proxy `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/proxies", FleetAPI), nil, &resp, "could not list Fleet's proxies")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
+}
+
+// CreateProxy creates a proxy, using its ID when present
+func (c *Client) CreateProxy(ctx context.Context, proxy Proxy) (Proxy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating Fleet proxy", "fleet.proxies.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	reqBody := proxy.proxyRequest()
+	reqBody.ID = proxy.ID
+
+	var resp struct {
+		Item Proxy `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/proxies", FleetAPI), reqBody, &resp, "could not create Fleet's proxy")
+	if err != nil {
+		return Proxy{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// UpdateProxy updates a proxy by its ID
+func (c *Client) UpdateProxy(ctx context.Context, proxy Proxy) (Proxy, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating Fleet proxy", "fleet.proxies.update", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("proxyID", proxy.ID)
+	defer span.End()
+
+	var resp struct {
+		Item Proxy `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPut, fmt.Sprintf("%s/proxies/%s", FleetAPI, proxy.ID), proxy.proxyRequest(), &resp, "could not update Fleet's proxy")
+	if err != nil {
+		return Proxy{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// DeleteProxy deletes a proxy by its ID
+func (c *Client) DeleteProxy(ctx context.Context, proxyID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting Fleet proxy", "fleet.proxies.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("proxyID", proxyID)
+	defer span.End()
+
+	return c.sendJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/proxies/%s", FleetAPI, proxyID), nil, nil, "could not delete Fleet's proxy")
+}
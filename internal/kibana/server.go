@@ -8,10 +8,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
 	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -28,36 +31,60 @@ type EnrollmentAPIKey struct {
 	PolicyID string `json:"policy_id"`
 }
 
+// EnrollmentAPIKeyOptions represents the optional settings of an enrollment api key
+type EnrollmentAPIKeyOptions struct {
+	Name       string        // name of the key, which Fleet suffixes with the ID of the key
+	Expiration time.Duration // lifetime of the key, which never expires when zero
+}
+
 // CreateEnrollmentAPIKey creates an enrollment api key
 func (c *Client) CreateEnrollmentAPIKey(ctx context.Context, policy Policy) (EnrollmentAPIKey, error) {
+	return c.CreateEnrollmentAPIKeyWithOptions(ctx, policy, EnrollmentAPIKeyOptions{})
+}
+
+// CreateEnrollmentAPIKeyWithOptions creates an enrollment api key for a policy, named and expiring as the options say
+func (c *Client) CreateEnrollmentAPIKeyWithOptions(ctx context.Context, policy Policy, opts EnrollmentAPIKeyOptions) (EnrollmentAPIKey, error) {
 	span, _ := apm.StartSpanOptions(ctx, "Creating enrollment API Key", "fleet.api-key.create", apm.SpanOptions{
 		Parent: apm.SpanFromContext(ctx).TraceContext(),
 	})
+	span.Context.SetLabel("policyID", policy.ID)
 	defer span.End()
 
-	reqBody := `{"policy_id": "` + policy.ID + `"}`
-	statusCode, respBody, _ := c.post(ctx, fmt.Sprintf("%s/enrollment_api_keys", FleetAPI), []byte(reqBody))
-	if statusCode != 200 {
-		jsonParsed, err := gabs.ParseJSON(respBody)
-		log.WithFields(log.Fields{
-			"body":       jsonParsed,
-			"reqBody":    string(reqBody),
-			"error":      err,
-			"statusCode": statusCode,
-		}).Error("Could not create enrollment api key")
-
-		return EnrollmentAPIKey{}, err
+	reqBody := map[string]string{"policy_id": policy.ID}
+	if opts.Name != "" {
+		reqBody["name"] = opts.Name
+	}
+	if opts.Expiration > 0 {
+		// the expiration is passed on to the Elasticsearch API key, which uses time units
+		reqBody["expiration"] = fmt.Sprintf("%ds", int64(opts.Expiration.Seconds()))
 	}
 
 	var resp struct {
 		Enrollment EnrollmentAPIKey `json:"item"`
 	}
-
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return EnrollmentAPIKey{}, errors.Wrap(err, "Unable to convert enrollment response to JSON")
+	err := c.sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/enrollment_api_keys", FleetAPI), reqBody, &resp, "could not create enrollment api key")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"reqBody": reqBody,
+		}).Error("Could not create enrollment api key")
+		return EnrollmentAPIKey{}, err
 	}
 
-	return resp.Enrollment, nil
+	key := resp.Enrollment
+	cleanup.Register(ctx, enrollmentAPIKeyResource(key.ID), func(ctx context.Context) error {
+		err := c.DeleteEnrollmentAPIKey(ctx, key.ID)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	return key, nil
+}
+
+// enrollmentAPIKeyResource returns the name of an enrollment api key in the clean up stack of a scenario
+func enrollmentAPIKeyResource(enrollmentID string) string {
+	return "enrollment token " + enrollmentID
 }
 
 // ServiceToken struct for holding service token
@@ -74,7 +101,10 @@ func (c *Client) CreateServiceToken(ctx context.Context) (ServiceToken, error) {
 	defer span.End()
 
 	reqBody := `{}`
-	statusCode, respBody, _ := c.post(ctx, fmt.Sprintf("%s/service_tokens", FleetAPI), []byte(reqBody))
+	statusCode, respBody, err := c.post(ctx, fmt.Sprintf("%s/service_tokens", FleetAPI), []byte(reqBody))
+	if err != nil {
+		return ServiceToken{}, errors.Wrap(err, "could not create service token")
+	}
 	if statusCode != 200 {
 		jsonParsed, err := gabs.ParseJSON(respBody)
 		log.WithFields(log.Fields{
@@ -84,7 +114,7 @@ func (c *Client) CreateServiceToken(ctx context.Context) (ServiceToken, error) {
 			"statusCode": statusCode,
 		}).Error("Could not create service token")
 
-		return ServiceToken{}, err
+		return ServiceToken{}, newAPIError("could not create service token", statusCode, respBody)
 	}
 
 	var resp ServiceToken
@@ -120,8 +150,10 @@ func (c *Client) DeleteEnrollmentAPIKey(ctx context.Context, enrollmentID string
 			"statusCode": statusCode,
 		}).Error("Could not delete enrollment key")
 
-		return err
+		return newAPIError("could not delete enrollment key", statusCode, respBody)
 	}
+
+	cleanup.Forget(ctx, enrollmentAPIKeyResource(enrollmentID))
 	return nil
 }
 
@@ -149,7 +181,7 @@ func (c *Client) GetDataStreams(ctx context.Context) (*gabs.Container, error) {
 			"statusCode": statusCode,
 		}).Error("Could not get Fleet data streams api")
 
-		return &gabs.Container{}, err
+		return &gabs.Container{}, newAPIError("could not get Fleet data streams", statusCode, respBody)
 	}
 
 	jsonParsed, err := gabs.ParseJSON(respBody)
@@ -195,7 +227,7 @@ func (c *Client) ListEnrollmentAPIKeys(ctx context.Context) ([]EnrollmentAPIKey,
 			"statusCode": statusCode,
 		}).Error("Could not get enrollment apis")
 
-		return []EnrollmentAPIKey{}, err
+		return []EnrollmentAPIKey{}, newAPIError("could not get enrollment apis", statusCode, respBody)
 	}
 
 	var resp struct {
@@ -210,6 +242,29 @@ func (c *Client) ListEnrollmentAPIKeys(ctx context.Context) ([]EnrollmentAPIKey,
 
 }
 
+// ListPolicyEnrollmentAPIKeys lists the enrollment api keys of a policy, including the revoked ones
+func (c *Client) ListPolicyEnrollmentAPIKeys(ctx context.Context, policyID string) ([]EnrollmentAPIKey, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Listing enrollment API Keys of policy", "fleet.api-keys.list-by-policy", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("policyID", policyID)
+	defer span.End()
+
+	query := url.Values{}
+	query.Set("kuery", fmt.Sprintf("policy_id:%q", policyID))
+	query.Set("perPage", "100")
+
+	var resp struct {
+		Items []EnrollmentAPIKey `json:"items"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/enrollment_api_keys?%s", FleetAPI, query.Encode()), nil, &resp, "could not list enrollment apis of policy")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Items, nil
+}
+
 // RecreateFleet this will force recreate the fleet configuration
 func (c *Client) RecreateFleet(ctx context.Context) error {
 	waitForFleet := func() error {
@@ -244,7 +299,7 @@ func (c *Client) RecreateFleet(ctx context.Context) error {
 				"statusCode": statusCode,
 				"body":       jsonResponse,
 			}).Warn("Fleet not ready")
-			return errors.New("Fleet not ready")
+			return newAPIError("fleet not ready", statusCode, respBody)
 		}
 
 		log.WithFields(log.Fields{
@@ -284,7 +339,7 @@ func (c *Client) WaitForFleet(ctx context.Context) error {
 			log.WithFields(log.Fields{
 				"statusCode": statusCode,
 			}).Warn("Fleet not ready")
-			return err
+			return newAPIError("fleet not ready", statusCode, respBody)
 		}
 
 		jsonResponse, err := gabs.ParseJSON(respBody)
@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.elastic.co/apm/v2"
+)
+
+// Settings represents the global settings of Fleet
+type Settings struct {
+	ID                            string `json:"id,omitempty"`
+	AdditionalYAMLConfig          string `json:"additional_yaml_config,omitempty"`
+	HasSeenAddDataNotice          bool   `json:"has_seen_add_data_notice,omitempty"`
+	PrereleaseIntegrationsEnabled bool   `json:"prerelease_integrations_enabled"`
+}
+
+// GetSettings returns the global settings of Fleet
+func (c *Client) GetSettings(ctx context.Context) (Settings, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting Fleet settings", "fleet.settings.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	var resp struct {
+		Item Settings `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodGet, fmt.Sprintf("%s/settings", FleetAPI), nil, &resp, "could not get Fleet's settings")
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return resp.Item, nil
+}
+
+// UpdateSettings updates the global settings of Fleet
+func (c *Client) UpdateSettings(ctx context.Context, settings Settings) (Settings, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Updating Fleet settings", "fleet.settings.update", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	// the ID of the settings is read-only
+	settings.ID = ""
+
+	var resp struct {
+		Item Settings `json:"item"`
+	}
+	err := c.sendJSONRequest(ctx, http.MethodPut, fmt.Sprintf("%s/settings", FleetAPI), settings, &resp, "could not update Fleet's settings")
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return resp.Item, nil
+}
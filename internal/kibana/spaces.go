@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.elastic.co/apm/v2"
+)
+
+// Space represents a Kibana space
+type Space struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// CreateSpace creates a Kibana space
+func (c *Client) CreateSpace(ctx context.Context, space Space) (Space, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Creating Kibana space", "kibana.spaces.create", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("spaceID", space.ID)
+	defer span.End()
+
+	var resp Space
+	err := c.WithSpace("").sendJSONRequest(ctx, http.MethodPost, fmt.Sprintf("%s/space", SpacesAPI), space, &resp, "could not create Kibana space")
+	if err != nil {
+		return Space{}, err
+	}
+
+	return resp, nil
+}
+
+// DeleteSpace deletes a Kibana space, including its saved objects, such as the agent policies created in it
+func (c *Client) DeleteSpace(ctx context.Context, spaceID string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Deleting Kibana space", "kibana.spaces.delete", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("spaceID", spaceID)
+	defer span.End()
+
+	return c.WithSpace("").sendJSONRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/space/%s", SpacesAPI, spaceID), nil, nil, "could not delete Kibana space")
+}
+
+// EnableFleetSpaceAwareness makes Fleet keep the agent policies, enrollment api keys and agents per space,
+// instead of sharing them across spaces. Enabling it more than once has no effect, but it cannot be disabled
+// afterwards: it migrates the Fleet saved objects of the whole deployment
+func (c *Client) EnableFleetSpaceAwareness(ctx context.Context) error {
+	span, _ := apm.StartSpanOptions(ctx, "Enabling Fleet space awareness", "fleet.space-awareness.enable", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	defer span.End()
+
+	// it's an internal API, so Kibana requires the internal origin and the version of the API
+	statusCode, respBody, err := c.WithSpace("").post(ctx, "/internal/fleet/enable_space_awareness", []byte("{}"),
+		HTTPHeader{key: "elastic-api-version", value: "1"},
+		HTTPHeader{key: "x-elastic-internal-origin", value: "e2e-testing"},
+	)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusOK {
+		return newAPIError("could not enable Fleet space awareness", statusCode, respBody)
+	}
+
+	return nil
+}
@@ -25,6 +25,12 @@ const (
 
 	// EndpointAPI is the endpoint API
 	EndpointAPI = "/api/endpoint"
+
+	// SpacesAPI is the prefix for the Kibana spaces, which are not scoped by a space themselves
+	SpacesAPI = "/api/spaces"
+
+	// SavedObjectsAPI is the prefix for the Kibana saved objects, i.e. the dashboards installed by the packages
+	SavedObjectsAPI = "/api/saved_objects"
 )
 
 // Endpoint - Kibana endpoint information
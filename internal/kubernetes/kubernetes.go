@@ -5,6 +5,7 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"go.elastic.co/apm/v2"
 
+	"github.com/elastic/e2e-testing/internal/cleanup"
 	"github.com/elastic/e2e-testing/internal/shell"
 	"github.com/elastic/e2e-testing/internal/utils"
 )
@@ -36,7 +38,8 @@ func (c Control) WithConfig(config string) Control {
 	return c
 }
 
-// WithNamespace namespace setter
+// WithNamespace namespace setter, creating a namespace if none is passed. The created namespace is deleted
+// by the clean up stack of the scenario
 func (c Control) WithNamespace(ctx context.Context, namespace string) Control {
 	if namespace == "" {
 		namespace = "test-" + uuid.New().String()
@@ -52,6 +55,10 @@ func (c Control) WithNamespace(ctx context.Context, namespace string) Control {
 	}
 	c.NamespaceUID = uid
 	c.Namespace = namespace
+
+	if c.createdNamespace {
+		cleanup.Register(ctx, namespaceResource(namespace), c.Cleanup)
+	}
 	return c
 }
 
@@ -85,10 +92,50 @@ func (c Control) Cleanup(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("failed to delete namespace %s: %v: %s", c.Namespace, err, output)
 		}
+		cleanup.Forget(ctx, namespaceResource(c.Namespace))
 	}
 	return nil
 }
 
+// Apply applies a manifest, registering its deletion in the clean up stack of the scenario, so that the cluster
+// scoped resources, which are not deleted with the namespace, are deleted too. The name identifies the manifest
+func (c Control) Apply(ctx context.Context, name string, manifest []byte) (string, error) {
+	output, err := c.RunWithStdin(ctx, bytes.NewReader(manifest), "apply", "-f", "-")
+	if err != nil {
+		return output, err
+	}
+
+	cleanup.Register(ctx, manifestResource(name), func(ctx context.Context) error {
+		output, err := c.RunWithStdin(ctx, bytes.NewReader(manifest), "delete", "--ignore-not-found", "-f", "-")
+		if err != nil {
+			return fmt.Errorf("failed to delete manifest %s: %v: %s", name, err, output)
+		}
+		return nil
+	})
+	return output, nil
+}
+
+// Delete deletes the resources of a manifest applied with Apply
+func (c Control) Delete(ctx context.Context, name string, manifest []byte) (string, error) {
+	output, err := c.RunWithStdin(ctx, bytes.NewReader(manifest), "delete", "-f", "-")
+	if err != nil {
+		return output, err
+	}
+
+	cleanup.Forget(ctx, manifestResource(name))
+	return output, nil
+}
+
+// namespaceResource returns the name of a namespace in the clean up stack, i.e. kubernetes namespace test-1234
+func namespaceResource(namespace string) string {
+	return "kubernetes namespace " + namespace
+}
+
+// manifestResource returns the name of a manifest in the clean up stack, i.e. kubernetes manifest filebeat
+func manifestResource(name string) string {
+	return "kubernetes manifest " + name
+}
+
 // Run ability to run kubectl commands
 func (c Control) Run(ctx context.Context, runArgs ...string) (output string, err error) {
 	return c.RunWithStdin(ctx, nil, runArgs...)
@@ -82,7 +82,7 @@ func CheckState(ctx context.Context, deployer deploy.Deployment, service deploy.
 	timeout := time.Duration(utils.TimeoutFactor) * time.Minute
 
 	if runtime.GOOS == "windows" {
-		process = fmt.Sprintf("%s.exe", process)
+		process = WindowsExecutable(process)
 	}
 
 	actionOpts := actionOpt{
@@ -122,6 +122,12 @@ func CheckState(ctx context.Context, deployer deploy.Deployment, service deploy.
 // Run executes the command
 func (a *actionWait) Run(ctx context.Context) (string, error) {
 	if a.service.IsContainer {
+		manifest, err := a.deploy.GetServiceManifest(ctx, a.service)
+		if err == nil && strings.EqualFold(manifest.Platform, "windows") {
+			// Windows containers do not provide pgrep, so we need to list the tasks instead
+			return runInWindowsContainer(ctx, a)
+		}
+
 		// when we run the tests in a container, we need to execute the command inside the container
 		return runInContainer(ctx, a)
 	}
@@ -403,3 +409,92 @@ func runInContainer(ctx context.Context, a *actionWait) (string, error) {
 
 	return "", nil
 }
+
+// WindowsExecutable returns the name of a Windows executable, adding the .exe extension if not present
+func WindowsExecutable(process string) string {
+	if strings.HasSuffix(strings.ToLower(process), ".exe") {
+		return process
+	}
+
+	return fmt.Sprintf("%s.exe", process)
+}
+
+// windowsTasklistCmds represents the command and arguments to list the running tasks for a process,
+// using the CSV format without headers, one line per task
+func windowsTasklistCmds(process string) []string {
+	return []string{"tasklist", "/NH", "/FO", "CSV", "/FI", fmt.Sprintf("IMAGENAME eq %s", WindowsExecutable(process))}
+}
+
+// countWindowsTasks counts the tasks for a process in the output of the tasklist command.
+// When there are no tasks, tasklist prints an informational message instead of the CSV lines
+func countWindowsTasks(output string, process string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), strings.ToLower(`"`+WindowsExecutable(process)+`"`)) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// runInWindowsContainer executes tasklist in the target Windows container defined by the service of the actionWait.
+// Windows does not expose the state of a task in the same way as ps does, so a listed task is considered as started
+func runInWindowsContainer(ctx context.Context, a *actionWait) (string, error) {
+	exp := utils.GetExponentialBackOff(a.opts.MaxTimeout)
+	retryCount := 1
+
+	processStatus := func() error {
+		cmds := windowsTasklistCmds(a.opts.Process)
+		output, err := a.deploy.ExecIn(ctx, deploy.NewServiceRequest(common.FleetProfileName), a.service, cmds)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"cmds":        cmds,
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"service":     a.service,
+				"process":     a.opts.Process,
+				"retry":       retryCount,
+			}).Warn("Could not list the tasks in the Windows container")
+
+			retryCount++
+
+			return err
+		}
+
+		count := countWindowsTasks(output, a.opts.Process)
+		if count == a.opts.Occurrences {
+			log.WithFields(log.Fields{
+				"desiredOccurrences": a.opts.Occurrences,
+				"desiredState":       a.opts.DesiredState,
+				"service":            a.service,
+				"occurrences":        count,
+				"process":            a.opts.Process,
+			}).Infof("Process desired state checked")
+
+			return nil
+		}
+
+		err = fmt.Errorf("%s process is not running in the Windows container with the desired number of occurrences (%d) yet, found %d", a.opts.Process, a.opts.Occurrences, count)
+		log.WithFields(log.Fields{
+			"desiredOccurrences": a.opts.Occurrences,
+			"desiredState":       a.opts.DesiredState,
+			"elapsedTime":        exp.GetElapsedTime(),
+			"service":            a.service,
+			"occurrences":        count,
+			"process":            a.opts.Process,
+			"retry":              retryCount,
+		}).Warn(err.Error())
+
+		retryCount++
+
+		return err
+	}
+
+	err := backoff.Retry(processStatus, exp)
+	if err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
@@ -0,0 +1,35 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WindowsExecutable(t *testing.T) {
+	assert.Equal(t, "elastic-agent.exe", WindowsExecutable("elastic-agent"))
+	assert.Equal(t, "elastic-agent.EXE", WindowsExecutable("elastic-agent.EXE"))
+}
+
+func Test_WindowsTasklist(t *testing.T) {
+	t.Run("Tasklist command filters by executable name", func(t *testing.T) {
+		assert.Equal(t, []string{"tasklist", "/NH", "/FO", "CSV", "/FI", "IMAGENAME eq elastic-agent.exe"}, windowsTasklistCmds("elastic-agent"))
+		assert.Equal(t, []string{"tasklist", "/NH", "/FO", "CSV", "/FI", "IMAGENAME eq elastic-agent.exe"}, windowsTasklistCmds("elastic-agent.exe"))
+	})
+
+	t.Run("Tasks are counted from the CSV output", func(t *testing.T) {
+		output := "\"elastic-agent.exe\",\"4312\",\"Services\",\"0\",\"45,300 K\"\r\n\"elastic-agent.exe\",\"5120\",\"Services\",\"0\",\"98,104 K\"\r\n"
+
+		assert.Equal(t, 2, countWindowsTasks(output, "elastic-agent"))
+	})
+
+	t.Run("No tasks are counted when the process is not running", func(t *testing.T) {
+		output := "INFO: No tasks are running which match the specified criteria.\r\n"
+
+		assert.Equal(t, 0, countWindowsTasks(output, "elastic-agent"))
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package report
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cucumberMimeType is the mime type of the embedding listing the versions and the artifacts of a scenario
+const cucumberMimeType = "text/plain"
+
+type cucumberFeature struct {
+	URI         string            `json:"uri"`
+	ID          string            `json:"id"`
+	Keyword     string            `json:"keyword"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Line        int64             `json:"line"`
+	Tags        []cucumberTag     `json:"tags,omitempty"`
+	Elements    []cucumberElement `json:"elements"`
+}
+
+type cucumberTag struct {
+	Name string `json:"name"`
+}
+
+type cucumberElement struct {
+	ID          string         `json:"id"`
+	Keyword     string         `json:"keyword"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Line        int64          `json:"line"`
+	Type        string         `json:"type"`
+	Tags        []cucumberTag  `json:"tags,omitempty"`
+	Steps       []cucumberStep `json:"steps"`
+}
+
+type cucumberStep struct {
+	Keyword    string              `json:"keyword"`
+	Name       string              `json:"name"`
+	Line       int64               `json:"line"`
+	Result     cucumberResult      `json:"result"`
+	Embeddings []cucumberEmbedding `json:"embeddings,omitempty"`
+}
+
+type cucumberResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error_message,omitempty"`
+	Duration int64  `json:"duration,omitempty"` // in nanoseconds
+}
+
+type cucumberEmbedding struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+// writeCucumber writes the cucumber JSON report of a suite. The versions and the artifacts of each scenario are
+// embedded into its failed step, or its last step when it did not fail
+func writeCucumber(s *suite, path string) error {
+	features := make([]cucumberFeature, 0, len(s.Features))
+	for _, f := range s.Features {
+		cf := cucumberFeature{
+			URI:         f.URI,
+			ID:          cucumberID(f.Name),
+			Keyword:     f.Keyword,
+			Name:        f.Name,
+			Description: f.Description,
+			Line:        f.Line,
+			Tags:        cucumberTags(f.Tags),
+			Elements:    make([]cucumberElement, 0, len(f.Scenarios)),
+		}
+
+		for _, sc := range f.Scenarios {
+			element := cucumberElement{
+				ID:      fmt.Sprintf("%s;%s;%d", cf.ID, cucumberID(sc.Name), sc.Line),
+				Keyword: sc.Keyword,
+				Name:    sc.Name,
+				Line:    sc.Line,
+				Type:    "scenario",
+				Tags:    cucumberTags(sc.Tags),
+				Steps:   make([]cucumberStep, 0, len(sc.Steps)),
+			}
+
+			for _, step := range sc.Steps {
+				element.Steps = append(element.Steps, cucumberStep{
+					Keyword: step.Keyword,
+					Name:    step.Text,
+					Line:    step.Line,
+					Result: cucumberResult{
+						Status:   step.Status,
+						Error:    step.Error,
+						Duration: step.Duration.Nanoseconds(),
+					},
+				})
+			}
+
+			if n := len(element.Steps); n > 0 {
+				i := n - 1
+				if failure := sc.Failure(); failure != nil {
+					for j, step := range sc.Steps {
+						if step == failure {
+							i = j
+						}
+					}
+				}
+				element.Steps[i].Embeddings = append(element.Steps[i].Embeddings, cucumberEmbedding{
+					MimeType: cucumberMimeType,
+					Data:     base64.StdEncoding.EncodeToString([]byte(summary(s.Versions, sc.Artifacts))),
+				})
+			}
+
+			cf.Elements = append(cf.Elements, element)
+		}
+
+		features = append(features, cf)
+	}
+
+	content, err := json.MarshalIndent(features, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// summary lists the versions and the artifacts of a scenario
+func summary(versions []Property, artifacts []Artifact) string {
+	var sb strings.Builder
+
+	sb.WriteString("Versions:\n")
+	for _, p := range versions {
+		fmt.Fprintf(&sb, "  - %s: %s\n", p.Name, p.Value)
+	}
+	if len(artifacts) > 0 {
+		sb.WriteString("Artifacts:\n")
+		for _, a := range artifacts {
+			fmt.Fprintf(&sb, "  - %s: %s\n", a.Kind, a.Path)
+		}
+	}
+	return sb.String()
+}
+
+func cucumberTags(tags []string) []cucumberTag {
+	cts := make([]cucumberTag, 0, len(tags))
+	for _, tag := range tags {
+		cts = append(cts, cucumberTag{Name: tag})
+	}
+	return cts
+}
+
+// cucumberID returns the ID of a feature or a scenario, as godog names them in its cucumber reports
+func cucumberID(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
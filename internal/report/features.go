@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package report
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cucumber/gherkin-go/v19"
+	"github.com/cucumber/messages-go/v16"
+	log "github.com/sirupsen/logrus"
+)
+
+// feature represents a feature file and the recorded runs of its scenarios. godog does not expose the
+// keywords and lines of the scenarios and steps, so the feature file is parsed again to describe them
+type feature struct {
+	URI         string
+	Keyword     string
+	Name        string
+	Description string
+	Line        int64
+	Tags        []string
+	Scenarios   []*Scenario
+
+	pickles map[string]*messages.Pickle // by name and steps
+	nodes   map[string]interface{}      // scenarios, steps and examples rows of the document, by ID
+}
+
+// loadFeature parses a feature file, falling back to name the feature after its file when it cannot be parsed
+func loadFeature(uri string) *feature {
+	f := &feature{
+		URI:     uri,
+		Keyword: "Feature",
+		Name:    uri,
+		pickles: map[string]*messages.Pickle{},
+		nodes:   map[string]interface{}{},
+	}
+
+	file, err := os.Open(uri)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"feature": uri,
+		}).Debug("Could not read the feature file, the report will not describe its keywords")
+		return f
+	}
+	defer file.Close()
+
+	// godog shares the IDs across its features, so the pickles are matched by name and steps instead
+	newID := (&messages.Incrementing{}).NewId
+	doc, err := gherkin.ParseGherkinDocument(file, newID)
+	if err != nil || doc.Feature == nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"feature": uri,
+		}).Debug("Could not parse the feature file, the report will not describe its keywords")
+		return f
+	}
+
+	f.Keyword = doc.Feature.Keyword
+	f.Name = doc.Feature.Name
+	f.Description = strings.TrimSpace(doc.Feature.Description)
+	f.Line = doc.Feature.Location.Line
+	for _, tag := range doc.Feature.Tags {
+		f.Tags = append(f.Tags, tag.Name)
+	}
+
+	for _, child := range doc.Feature.Children {
+		f.index(child.Background, child.Scenario)
+		if child.Rule != nil {
+			for _, ruleChild := range child.Rule.Children {
+				f.index(ruleChild.Background, ruleChild.Scenario)
+			}
+		}
+	}
+
+	for _, pickle := range gherkin.Pickles(*doc, uri, newID) {
+		key := pickleKey(pickle.Name, pickle.Steps)
+		if _, ok := f.pickles[key]; !ok {
+			f.pickles[key] = pickle
+		}
+	}
+
+	return f
+}
+
+// index indexes the nodes of a background or a scenario by ID
+func (f *feature) index(background *messages.Background, scenario *messages.Scenario) {
+	if background != nil {
+		for _, step := range background.Steps {
+			f.nodes[step.Id] = step
+		}
+	}
+	if scenario == nil {
+		return
+	}
+
+	f.nodes[scenario.Id] = scenario
+	for _, step := range scenario.Steps {
+		f.nodes[step.Id] = step
+	}
+	for _, examples := range scenario.Examples {
+		for _, row := range examples.TableBody {
+			f.nodes[row.Id] = row
+		}
+	}
+}
+
+// describe sets the keywords and lines of a scenario and its steps, the line of a scenario outline being the
+// one of its example
+func (f *feature) describe(s *Scenario) {
+	pickle, ok := f.pickles[pickleKey(s.pickle.Name, s.pickle.Steps)]
+	if !ok {
+		return
+	}
+
+	for _, id := range pickle.AstNodeIds {
+		switch node := f.nodes[id].(type) {
+		case *messages.Scenario:
+			s.Keyword = node.Keyword
+			s.Line = node.Location.Line
+		case *messages.TableRow:
+			s.Line = node.Location.Line
+		}
+	}
+
+	for i, step := range pickle.Steps {
+		if i >= len(s.Steps) || len(step.AstNodeIds) == 0 {
+			break
+		}
+		if node, ok := f.nodes[step.AstNodeIds[0]].(*messages.Step); ok {
+			s.Steps[i].Keyword = node.Keyword
+			s.Steps[i].Line = node.Location.Line
+		}
+	}
+}
+
+// count returns the number of scenarios of the feature with a status
+func (f *feature) count(status string) int {
+	count := 0
+	for _, s := range f.Scenarios {
+		if s.Status() == status {
+			count++
+		}
+	}
+	return count
+}
+
+// pickleKey identifies a pickle by its name and the text of its steps
+func pickleKey(name string, steps []*messages.PickleStep) string {
+	texts := []string{name}
+	for _, step := range steps {
+		texts = append(texts, step.Text)
+	}
+	return strings.Join(texts, "\n")
+}
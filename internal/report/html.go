@@ -0,0 +1,178 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package report
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type htmlReport struct {
+	Name      string
+	Timestamp string
+	Duration  time.Duration
+	Versions  []Property
+	Totals    []htmlTotal
+	Features  []htmlFeature
+}
+
+type htmlTotal struct {
+	Status string
+	Count  int
+}
+
+type htmlFeature struct {
+	Name        string
+	URI         string
+	Description string
+	Scenarios   []htmlScenario
+}
+
+type htmlScenario struct {
+	Keyword   string
+	Name      string
+	Line      int64
+	Tags      []string
+	Status    string
+	Duration  time.Duration
+	Steps     []*Step
+	Artifacts []htmlArtifact
+}
+
+type htmlArtifact struct {
+	Kind Kind
+	Path string
+	Link string
+}
+
+// writeHTML writes the HTML report of a suite, a single file with inline styles. The artifacts are linked
+// relative to the report, so the report and the artifacts can be archived together
+func writeHTML(s *suite, path string) error {
+	report := htmlReport{
+		Name:      s.Name,
+		Timestamp: s.Timestamp.UTC().Format(time.RFC1123),
+		Duration:  s.Duration.Round(time.Millisecond),
+		Versions:  s.Versions,
+	}
+	for _, status := range []string{Passed, Failed, Undefined, Pending, Skipped} {
+		report.Totals = append(report.Totals, htmlTotal{Status: status, Count: s.count(status)})
+	}
+
+	for _, f := range s.Features {
+		hf := htmlFeature{Name: f.Name, URI: f.URI, Description: f.Description}
+		for _, sc := range f.Scenarios {
+			hs := htmlScenario{
+				Keyword:  sc.Keyword,
+				Name:     sc.Name,
+				Line:     sc.Line,
+				Tags:     sc.Tags,
+				Status:   sc.Status(),
+				Duration: sc.Duration.Round(time.Millisecond),
+				Steps:    sc.Steps,
+			}
+			for _, a := range sc.Artifacts {
+				hs.Artifacts = append(hs.Artifacts, htmlArtifact{Kind: a.Kind, Path: a.Path, Link: artifactLink(path, a.Path)})
+			}
+			hf.Scenarios = append(hf.Scenarios, hs)
+		}
+		report.Features = append(report.Features, hf)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return htmlTemplate.Execute(file, report)
+}
+
+// artifactLink returns the link to an artifact relative to the report, or its absolute path when it's not
+// possible, i.e. in another drive
+func artifactLink(report string, artifact string) string {
+	abs, err := filepath.Abs(artifact)
+	if err != nil {
+		return filepath.ToSlash(artifact)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(report))
+	if err == nil {
+		if rel, err := filepath.Rel(dir, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return "file://" + filepath.ToSlash(abs)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} test report</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #343741; }
+  h1, h2 { font-weight: 500; }
+  table { border-collapse: collapse; margin-bottom: 1em; }
+  th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #d3dae6; vertical-align: top; }
+  details { margin: 0.5em 0; border: 1px solid #d3dae6; border-radius: 4px; padding: 0.5em 1em; }
+  summary { cursor: pointer; }
+  pre { white-space: pre-wrap; margin: 0; }
+  .tag { font-size: 0.85em; color: #69707d; margin-right: 0.5em; }
+  .status { font-weight: 600; text-transform: uppercase; font-size: 0.85em; }
+  .passed { color: #017d73; }
+  .failed { color: #bd271e; }
+  .undefined, .pending { color: #b36200; }
+  .skipped { color: #69707d; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Started on {{.Timestamp}}, took {{duration .Duration}}.</p>
+<table>
+  <tr>{{range .Totals}}<th class="{{.Status}}">{{.Status}}</th>{{end}}</tr>
+  <tr>{{range .Totals}}<td>{{.Count}}</td>{{end}}</tr>
+</table>
+<h2>Versions</h2>
+<table>
+{{- range .Versions}}
+  <tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- range .Features}}
+<h2>{{.Name}}</h2>
+<p><code>{{.URI}}</code></p>
+{{- if .Description}}
+<pre>{{.Description}}</pre>
+{{- end}}
+{{- range .Scenarios}}
+<details{{if ne .Status "passed"}} open{{end}}>
+  <summary><span class="status {{.Status}}">{{.Status}}</span> {{.Keyword}}: {{.Name}} ({{duration .Duration}}){{range .Tags}} <span class="tag">{{.}}</span>{{end}}</summary>
+  <table>
+  {{- range .Steps}}
+    <tr>
+      <td>{{.Line}}</td>
+      <td>{{.Keyword}}{{.Text}}{{if .Error}}<pre class="{{.Status}}">{{.Error}}</pre>{{end}}</td>
+      <td class="status {{.Status}}">{{.Status}}</td>
+      <td>{{duration .Duration}}</td>
+    </tr>
+  {{- end}}
+  </table>
+  {{- if .Artifacts}}
+  <ul>
+  {{- range .Artifacts}}
+    <li>{{.Kind}}: <a href="{{.Link}}">{{.Path}}</a></li>
+  {{- end}}
+  </ul>
+  {{- end}}
+</details>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
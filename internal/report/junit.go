@@ -0,0 +1,151 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Properties []junitProperty  `xml:"properties>property"`
+	TestCases  []*junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitFailure `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Content string `xml:",cdata"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+// writeJUnit writes the JUnit XML report of a suite, with a test suite per feature, having the versions as
+// properties, and a test case per scenario, listing its steps and its artifacts as attachments in its output
+func writeJUnit(s *suite, path string) error {
+	report := &junitTestSuites{
+		Name:     s.Name,
+		Failures: s.count(Failed),
+		Errors:   s.count(Undefined) + s.count(Pending),
+		Skipped:  s.count(Skipped),
+		Time:     seconds(s.Duration),
+	}
+
+	properties := make([]junitProperty, 0, len(s.Versions))
+	for _, p := range s.Versions {
+		properties = append(properties, junitProperty{Name: p.Name, Value: p.Value})
+	}
+
+	for _, f := range s.Features {
+		ts := &junitTestSuite{
+			Name:       f.Name,
+			Tests:      len(f.Scenarios),
+			Failures:   f.count(Failed),
+			Errors:     f.count(Undefined) + f.count(Pending),
+			Skipped:    f.count(Skipped),
+			Properties: properties,
+		}
+
+		var duration time.Duration
+		for _, sc := range f.Scenarios {
+			duration += sc.Duration
+			ts.TestCases = append(ts.TestCases, junitCase(f, sc))
+		}
+		ts.Time = seconds(duration)
+		if len(f.Scenarios) > 0 {
+			ts.Timestamp = f.Scenarios[0].Start.UTC().Format(time.RFC3339)
+		}
+
+		report.Tests += ts.Tests
+		report.Suites = append(report.Suites, ts)
+	}
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), content...), 0644)
+}
+
+// junitCase returns the test case of a scenario. The artifacts are attached with the [[ATTACHMENT|path]]
+// notation of the Jenkins JUnit attachments plugin, which requires absolute paths
+func junitCase(f *feature, s *Scenario) *junitTestCase {
+	tc := &junitTestCase{
+		Name:      s.Name,
+		ClassName: f.Name,
+		Time:      seconds(s.Duration),
+	}
+
+	var out strings.Builder
+	for _, step := range s.Steps {
+		fmt.Fprintf(&out, "%s%s ... %s in %s\n", step.Keyword, step.Text, step.Status, step.Duration.Round(time.Millisecond))
+	}
+	for _, a := range s.Artifacts {
+		path, err := filepath.Abs(a.Path)
+		if err != nil {
+			path = a.Path
+		}
+		fmt.Fprintf(&out, "[[ATTACHMENT|%s]]\n", path)
+	}
+	tc.SystemOut = &junitOutput{Content: out.String()}
+
+	switch s.Status() {
+	case Failed:
+		step := s.Failure()
+		tc.Failure = &junitFailure{Message: "Step " + step.Text + ": " + step.Error, Type: Failed, Content: step.Error}
+	case Undefined, Pending:
+		step := s.Failure()
+		tc.Error = &junitFailure{Message: "Step " + step.Text + " is " + step.Status, Type: step.Status}
+	case Skipped:
+		tc.Skipped = &junitFailure{Message: "All steps are skipped"}
+	}
+
+	return tc
+}
+
+// seconds formats a duration in seconds, as JUnit expects the times
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
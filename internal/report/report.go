@@ -0,0 +1,385 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package report records the scenarios of a test suite, with the results and timings of their steps and the
+// artifacts collected for them, i.e. the logs of the services, the diagnostics bundles and the samples of the
+// resources, writing them once the suite finishes as JUnit XML for CI, cucumber JSON and a self-contained
+// HTML report, together with the versions the suite ran with.
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/diagnostics"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status of a step or a scenario, as named by the cucumber JSON format
+const (
+	Passed    = "passed"
+	Failed    = "failed"
+	Skipped   = "skipped"
+	Undefined = "undefined"
+	Pending   = "pending"
+)
+
+// Kind is the kind of an artifact collected for a scenario
+type Kind string
+
+const (
+	// Logs are the logs of a service, i.e. kibana.log
+	Logs Kind = "logs"
+	// Diagnostics are the diagnostics bundles, i.e. the one of the agent
+	Diagnostics Kind = "diagnostics"
+	// Samples are samples of the resources of the scenario, i.e. its agent policy or the pods of a namespace
+	Samples Kind = "samples"
+)
+
+// Artifact represents a file collected for a scenario
+type Artifact struct {
+	Kind Kind
+	Path string
+}
+
+// Step represents the run of a step of a scenario
+type Step struct {
+	Keyword  string
+	Text     string
+	Line     int64
+	Status   string
+	Error    string
+	Start    time.Time
+	Duration time.Duration
+
+	scenario *Scenario
+}
+
+// Scenario represents the run of a scenario, or of an example of a scenario outline
+type Scenario struct {
+	URI       string
+	Keyword   string
+	Name      string
+	Line      int64
+	Tags      []string
+	Start     time.Time
+	Duration  time.Duration
+	Steps     []*Step
+	Artifacts []Artifact
+
+	pickle   *godog.Scenario
+	recorder *Recorder
+}
+
+// Status returns the status of the scenario, failed when any of its steps failed, undefined or pending when
+// any of its steps is, and skipped when none of its steps ran
+func (s *Scenario) Status() string {
+	status := Skipped
+	for _, step := range s.Steps {
+		switch step.Status {
+		case Failed:
+			return Failed
+		case Undefined, Pending:
+			status = step.Status
+		case Passed:
+			if status == Skipped {
+				status = Passed
+			}
+		}
+	}
+	return status
+}
+
+// Failure returns the step which failed the scenario, nil if it passed or was skipped
+func (s *Scenario) Failure() *Step {
+	for _, step := range s.Steps {
+		if step.Status == Failed || step.Status == Undefined || step.Status == Pending {
+			return step
+		}
+	}
+	return nil
+}
+
+// Property represents a name and value pair describing the run of a suite, i.e. the version of the stack
+type Property struct {
+	Name  string
+	Value string
+}
+
+// Versions returns the versions the suite runs with. They are resolved by common.InitVersions, so the reports
+// must be written after it
+func Versions() []Property {
+	properties := []Property{
+		{Name: "stack.version", Value: common.StackVersion},
+		{Name: "kibana.version", Value: common.KibanaVersion},
+		{Name: "elastic-agent.version", Value: common.ElasticAgentVersion},
+		{Name: "beat.version", Value: common.BeatVersion},
+		{Name: "beat.version.base", Value: common.BeatVersionBase},
+		{Name: "provider", Value: common.Provider},
+	}
+	if downloads.GithubCommitSha1 != "" {
+		properties = append(properties,
+			Property{Name: "github.repository", Value: downloads.GithubRepository},
+			Property{Name: "github.commit", Value: downloads.GithubCommitSha1},
+		)
+	}
+	return properties
+}
+
+// Recorder records the scenarios of a suite. It's safe for concurrent use, so the scenarios can run concurrently
+type Recorder struct {
+	suite     string
+	mu        sync.Mutex
+	scenarios []*Scenario
+	steps     map[string]*Step // by pickle step ID
+}
+
+// NewRecorder creates the recorder of the scenarios of a suite
+func NewRecorder(suite string) *Recorder {
+	return &Recorder{
+		suite: suite,
+		steps: map[string]*Step{},
+	}
+}
+
+// Register registers the hooks recording the scenarios of the context. It must be called before registering
+// the other hooks of the suite, so that they find the scenario in their context to attach artifacts to it
+func (r *Recorder) Register(ctx *godog.ScenarioContext) {
+	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		return context.WithValue(ctx, scenarioKey{}, r.start(sc)), nil
+	})
+
+	ctx.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		if s, ok := ctx.Value(scenarioKey{}).(*Scenario); ok {
+			r.mu.Lock()
+			s.Duration = time.Since(s.Start)
+			r.mu.Unlock()
+		}
+		return ctx, nil
+	})
+
+	ctx.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if s, ok := r.steps[step.Id]; ok {
+			s.Start = time.Now()
+		}
+		return ctx, nil
+	})
+
+	// the hooks run for every step, the ones skipped after a failure included, even when the scenario finished
+	ctx.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		s, ok := r.steps[step.Id]
+		if !ok {
+			return ctx, nil
+		}
+
+		s.Status = stepStatus(status, err)
+		if err != nil {
+			s.Error = err.Error()
+		}
+		if !s.Start.IsZero() {
+			s.Duration = time.Since(s.Start)
+		}
+		s.scenario.Duration = time.Since(s.scenario.Start)
+		return ctx, nil
+	})
+}
+
+// start records the start of a scenario, with all its steps skipped until they run
+func (r *Recorder) start(sc *godog.Scenario) *Scenario {
+	s := &Scenario{
+		URI:      sc.Uri,
+		Keyword:  "Scenario",
+		Name:     sc.Name,
+		Start:    time.Now(),
+		pickle:   sc,
+		recorder: r,
+	}
+	for _, tag := range sc.Tags {
+		s.Tags = append(s.Tags, tag.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, step := range sc.Steps {
+		st := &Step{Keyword: "* ", Text: step.Text, Status: Skipped, scenario: s}
+		s.Steps = append(s.Steps, st)
+		r.steps[step.Id] = st
+	}
+	r.scenarios = append(r.scenarios, s)
+
+	return s
+}
+
+// stepStatus returns the status of a step from its error, as godog passes the status of the steps which
+// returned an error to the hooks before updating it
+func stepStatus(status godog.StepResultStatus, err error) string {
+	switch {
+	case err == nil:
+		return status.String()
+	case errors.Is(err, godog.ErrUndefined):
+		return Undefined
+	case errors.Is(err, godog.ErrPending):
+		return Pending
+	default:
+		return Failed
+	}
+}
+
+// scenarioKey is the key of the recorded scenario in its context
+type scenarioKey struct{}
+
+// Attach records artifacts collected for the scenario of the context, i.e. the logs of a service. The reports
+// link them, so they must be kept with the reports
+func Attach(ctx context.Context, kind Kind, paths ...string) {
+	s, ok := ctx.Value(scenarioKey{}).(*Scenario)
+	if !ok {
+		return
+	}
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	for _, path := range paths {
+		s.Artifacts = append(s.Artifacts, Artifact{Kind: kind, Path: path})
+	}
+}
+
+// suite represents the scenarios of a suite grouped by feature, as written to the reports
+type suite struct {
+	Name      string
+	Versions  []Property
+	Features  []*feature
+	Timestamp time.Time
+	Duration  time.Duration
+}
+
+// count returns the number of scenarios of the suite with a status
+func (s *suite) count(status string) int {
+	count := 0
+	for _, f := range s.Features {
+		count += f.count(status)
+	}
+	return count
+}
+
+// snapshot groups the recorded scenarios by feature, in the order of their feature files, describing them with
+// the keywords and lines of their feature files
+func (r *Recorder) snapshot() *suite {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &suite{Name: r.suite, Versions: Versions()}
+	features := map[string]*feature{}
+	for _, sc := range r.scenarios {
+		f, ok := features[sc.URI]
+		if !ok {
+			f = loadFeature(sc.URI)
+			features[sc.URI] = f
+			s.Features = append(s.Features, f)
+		}
+		f.describe(sc)
+		f.Scenarios = append(f.Scenarios, sc)
+
+		if s.Timestamp.IsZero() || sc.Start.Before(s.Timestamp) {
+			s.Timestamp = sc.Start
+		}
+		if end := sc.Start.Add(sc.Duration).Sub(s.Timestamp); end > s.Duration {
+			s.Duration = end
+		}
+	}
+
+	sort.SliceStable(s.Features, func(i, j int) bool { return s.Features[i].URI < s.Features[j].URI })
+	return s
+}
+
+// Write writes the JUnit XML, cucumber JSON and HTML reports of the recorded scenarios, adding the .xml,
+// .json and .html extensions to the base path. Nothing is written when no scenario ran, i.e. when listing
+// the step definitions
+func (r *Recorder) Write(base string) error {
+	s := r.snapshot()
+	if len(s.Features) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return err
+	}
+
+	writers := map[string]func(*suite, string) error{
+		".xml":  writeJUnit,
+		".json": writeCucumber,
+		".html": writeHTML,
+	}
+
+	var errs []string
+	for _, ext := range []string{".xml", ".json", ".html"} {
+		if err := writers[ext](s, base+ext); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", base+ext, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not write the reports: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Base returns the path of the reports of a suite, without extension. They are written to the reports directory
+// next to the first cucumber report of the godog format, keeping its name, i.e. outputs/reports/TEST-fleet for
+// cucumber:outputs/TEST-fleet.json, or to the outputs/reports directory of the repository otherwise, named after
+// the suite. The REPORTS_DIR env var overrides the directory
+func Base(suite string, format string) string {
+	dir := filepath.Join("..", "..", "..", "outputs", "reports")
+	name := "TEST-" + suite
+	if reports := diagnostics.CucumberReports(format); len(reports) > 0 {
+		dir = filepath.Join(filepath.Dir(reports[0]), "reports")
+		name = strings.TrimSuffix(filepath.Base(reports[0]), ".json")
+	}
+
+	return filepath.Join(shell.GetEnv("REPORTS_DIR", dir), name)
+}
+
+// WriteAll writes the reports of a suite once it finishes: the artifacts of the collector are attached to the
+// cucumber reports of the godog format, and the JUnit XML, cucumber JSON and HTML reports of the recorder are
+// written next to them, as Base describes. The errors are logged, so the reports never change the result of
+// the suite. The collector is optional, i.e. for suites without diagnostics
+func WriteAll(recorder *Recorder, collector *diagnostics.Collector, suite string, format string) {
+	if collector != nil {
+		for _, cucumberReport := range diagnostics.CucumberReports(format) {
+			err := collector.AttachToCucumberReport(cucumberReport)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":  err,
+					"report": cucumberReport,
+				}).Warn("Could not attach the diagnostics to the cucumber report")
+			}
+		}
+	}
+
+	base := Base(suite, format)
+	err := recorder.Write(base)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"report": base,
+		}).Warn("Could not write the reports of the suite")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package report
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/diagnostics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runSuite runs the features of the testdata directory, recording them. The logs of a service cannot be
+// collected, failing the scenario once attached
+func runSuite(t *testing.T, logs string) *Recorder {
+	recorder := NewRecorder("report")
+
+	godog.TestSuite{
+		Name: "report",
+		ScenarioInitializer: func(ctx *godog.ScenarioContext) {
+			recorder.Register(ctx)
+
+			ctx.Step(`^a deployed stack$`, func() error { return nil })
+			ctx.Step(`^the agent is installed$`, func() error { return nil })
+			ctx.Step(`^the agent is online$`, func() error { return nil })
+			ctx.Step(`^the logs of "([^"]*)" are collected$`, func(ctx context.Context, service string) error {
+				Attach(ctx, Logs, logs)
+				return fmt.Errorf("%s is not available", service)
+			})
+		},
+		Options: &godog.Options{
+			Format:      "progress",
+			Output:      io.Discard,
+			Paths:       []string{filepath.Join("testdata", "features")},
+			Concurrency: 1,
+		},
+	}.Run()
+
+	return recorder
+}
+
+func TestRecorder_Write(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "diagnostics", "kibana.log")
+	base := filepath.Join(dir, "reports", "TEST-report")
+
+	recorder := runSuite(t, logs)
+	require.NoError(t, recorder.Write(base))
+
+	t.Run("JUnit", func(t *testing.T) {
+		content, err := os.ReadFile(base + ".xml")
+		require.NoError(t, err)
+
+		var report junitTestSuites
+		require.NoError(t, xml.Unmarshal(content, &report))
+		assert.Equal(t, 3, report.Tests)
+		assert.Equal(t, 1, report.Failures)
+		assert.Equal(t, 1, report.Errors)
+
+		require.Len(t, report.Suites, 1)
+		suite := report.Suites[0]
+		assert.Equal(t, "Reporting the scenarios", suite.Name)
+		assert.Contains(t, suite.Properties, junitProperty{Name: "stack.version", Value: common.StackVersion})
+
+		require.Len(t, suite.TestCases, 3)
+		failed := suite.TestCases[1]
+		assert.Equal(t, "Collecting the logs of a service", failed.Name)
+		require.NotNil(t, failed.Failure)
+		assert.Contains(t, failed.Failure.Message, "kibana is not available")
+		assert.Contains(t, failed.SystemOut.Content, `Then the logs of "kibana" are collected ... failed`)
+		assert.Contains(t, failed.SystemOut.Content, "And the agent is online ... skipped")
+		assert.Contains(t, failed.SystemOut.Content, "[[ATTACHMENT|"+logs+"]]")
+
+		require.NotNil(t, suite.TestCases[2].Error)
+		assert.Equal(t, Undefined, suite.TestCases[2].Error.Type)
+	})
+
+	t.Run("Cucumber", func(t *testing.T) {
+		content, err := os.ReadFile(base + ".json")
+		require.NoError(t, err)
+
+		var features []cucumberFeature
+		require.NoError(t, json.Unmarshal(content, &features))
+		require.Len(t, features, 1)
+		assert.Equal(t, "Reporting the scenarios", features[0].Name)
+		assert.Equal(t, []cucumberTag{{Name: "@report"}}, features[0].Tags)
+
+		require.Len(t, features[0].Elements, 3)
+		outline := features[0].Elements[1]
+		assert.Equal(t, "Scenario Outline", outline.Keyword)
+		assert.Equal(t, int64(18), outline.Line, "the line of an outline is the one of its example")
+
+		require.Len(t, outline.Steps, 4)
+		assert.Equal(t, "Given ", outline.Steps[0].Keyword)
+		assert.Equal(t, int64(6), outline.Steps[0].Line)
+		assert.Equal(t, Passed, outline.Steps[1].Result.Status)
+		assert.Equal(t, Failed, outline.Steps[2].Result.Status)
+		assert.Equal(t, "kibana is not available", outline.Steps[2].Result.Error)
+		assert.Equal(t, Skipped, outline.Steps[3].Result.Status)
+
+		require.Len(t, outline.Steps[2].Embeddings, 1)
+		data, err := base64.StdEncoding.DecodeString(outline.Steps[2].Embeddings[0].Data)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "stack.version: "+common.StackVersion)
+		assert.Contains(t, string(data), "logs: "+logs)
+
+		assert.Equal(t, Undefined, features[0].Elements[2].Steps[1].Result.Status)
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		content, err := os.ReadFile(base + ".html")
+		require.NoError(t, err)
+
+		assert.Contains(t, string(content), "Collecting the logs of a service")
+		assert.Contains(t, string(content), `<a href="../diagnostics/kibana.log">`)
+		assert.Contains(t, string(content), "kibana is not available")
+	})
+}
+
+func TestRecorder_WriteWithoutScenarios(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "TEST-report")
+
+	require.NoError(t, NewRecorder("report").Write(base))
+	assert.NoFileExists(t, base+".xml")
+}
+
+func TestWriteAll(t *testing.T) {
+	dir := t.TempDir()
+	cucumberReport := filepath.Join(dir, "TEST-report.json")
+	format := "progress,cucumber:" + cucumberReport
+
+	// the cucumber report of godog, listing the failed scenario
+	recorder := runSuite(t, filepath.Join(dir, "kibana.log"))
+	require.NoError(t, recorder.Write(filepath.Join(dir, "godog")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "godog.json"), cucumberReport))
+
+	collector := diagnostics.NewCollector(filepath.Join(dir, "diagnostics"))
+	uri := filepath.Join("testdata", "features", "report.feature")
+	scenarioDir, err := collector.ScenarioDir(uri, "Collecting the logs of a service")
+	require.NoError(t, err)
+	collector.Add(uri, "Collecting the logs of a service", filepath.Join(scenarioDir, "kibana.log"))
+
+	WriteAll(recorder, collector, "report", format)
+
+	content, err := os.ReadFile(cucumberReport)
+	require.NoError(t, err)
+
+	var features []cucumberFeature
+	require.NoError(t, json.Unmarshal(content, &features))
+	embeddings := features[0].Elements[1].Steps[2].Embeddings
+	require.Len(t, embeddings, 2, "the diagnostics are embedded after the versions and artifacts of the scenario")
+	data, err := base64.StdEncoding.DecodeString(embeddings[1].Data)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Diagnostics: "+scenarioDir)
+
+	for _, ext := range []string{".xml", ".json", ".html"} {
+		assert.FileExists(t, filepath.Join(dir, "reports", "TEST-report"+ext))
+	}
+
+	t.Run("Suites without diagnostics", func(t *testing.T) {
+		t.Setenv("REPORTS_DIR", filepath.Join(dir, "without-diagnostics"))
+
+		WriteAll(recorder, nil, "report", "progress")
+		assert.FileExists(t, filepath.Join(dir, "without-diagnostics", "TEST-report.xml"))
+	})
+}
+
+func TestBase(t *testing.T) {
+	assert.Equal(t, filepath.Join("outputs", "reports", "TEST-fleet_amd64"), Base("fleet", "pretty,cucumber:outputs/TEST-fleet_amd64.json,junit:outputs/TEST-fleet_amd64.xml"))
+	assert.Equal(t, filepath.Join("..", "..", "..", "outputs", "reports", "TEST-fleet"), Base("fleet", "pretty"))
+
+	t.Setenv("REPORTS_DIR", "reports")
+	assert.Equal(t, filepath.Join("reports", "TEST-fleet"), Base("fleet", "pretty"))
+}
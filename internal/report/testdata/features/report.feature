@@ -0,0 +1,22 @@
+@report
+Feature: Reporting the scenarios
+  The reports describe the steps of the scenarios and link their artifacts
+
+Background:
+  Given a deployed stack
+
+Scenario: Installing the agent
+  When the agent is installed
+  Then the agent is online
+
+Scenario Outline: Collecting the logs of a service
+  When the agent is installed
+  Then the logs of "<service>" are collected
+    And the agent is online
+Examples:
+  | service |
+  | kibana  |
+
+Scenario: Running an unknown step
+  When the agent is upgraded
+  Then the agent is online
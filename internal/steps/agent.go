@@ -0,0 +1,329 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/cleanup"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/installer"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// attachInstaller attaches the installer of the agents to a deployment. It's declared as a variable so that
+// tests are able to replace it, not installing the agents in the host
+var attachInstaller = installer.Attach
+
+// ErrEnrollment is wrapped by the errors of the agents which could not enroll in Fleet, i.e. with a revoked token
+var ErrEnrollment = errors.New("the agent could not be enrolled in Fleet")
+
+// AgentState represents the agent deployed by a scenario, which is uninstalled by its clean up stack
+type AgentState struct {
+	Service       deploy.ServiceRequest
+	InstallerType string
+	Hostname      string
+	Installed     bool
+}
+
+// agentKey is the key of the AgentState in the context of a scenario
+type agentKey struct{}
+
+// AgentFromContext returns the agent deployed by the scenario
+func AgentFromContext(ctx context.Context) (*AgentState, bool) {
+	state, ok := ctx.Value(agentKey{}).(*AgentState)
+	return state, ok
+}
+
+// AgentHooks let a suite deploy the agents of the steps with its own options and policies, and check its own
+// state once the agents are listed in Fleet. A suite deploying the agents records them in the AgentState
+type AgentHooks struct {
+	Deploy func(ctx context.Context, installerType string) error // deploys an agent, wrapping its enrollment errors with ErrEnrollment
+	Listed func(ctx context.Context, status string) error        // runs once the agent is in the status in Fleet
+}
+
+// Agent the steps to deploy an agent enrolled in the policy of the scenario, and to manage its lifecycle.
+// The Fleet policies steps must be registered too, to create the policy, unless the suite deploys the agents
+type Agent struct {
+	deployer deploy.Deployment
+	profile  deploy.ServiceRequest
+	client   *kibana.Client
+	hooks    AgentHooks
+}
+
+// NewAgent creates the agent lifecycle steps, deploying the agents in the services of a profile, i.e. fleet
+func NewAgent(deployer deploy.Deployment, profile string, client *kibana.Client) *Agent {
+	return &Agent{
+		deployer: deployer,
+		profile:  deploy.NewServiceRequest(profile),
+		client:   client,
+	}
+}
+
+// WithHooks sets the hooks of the suite, replacing the deployment of the agents
+func (a *Agent) WithHooks(hooks AgentHooks) *Agent {
+	a.hooks = hooks
+	return a
+}
+
+// Name returns the name of the group
+func (a *Agent) Name() string {
+	return "agent lifecycle"
+}
+
+// Register adds the agent lifecycle steps to a scenario
+func (a *Agent) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		return context.WithValue(ctx, agentKey{}, &AgentState{}), nil
+	})
+
+	sc.Step(`^an agent is deployed to Fleet with "([^"]*)" installer$`, a.anAgentIsDeployedToFleetWithInstaller)
+	sc.Step(`^the agent is (started|stopped|restarted|uninstalled)$`, a.theAgentIsInState)
+	sc.Step(`^the agent is listed in Fleet as "([^"]*)"$`, a.theAgentIsListedInFleetAs)
+	sc.Step(`^an attempt to enroll a new agent fails$`, a.anAttemptToEnrollANewAgentFails)
+}
+
+// anAgentIsDeployedToFleetWithInstaller deploys an agent, installing it with an installer, i.e. tar, and
+// enrolling it in the policy of the scenario
+func (a *Agent) anAgentIsDeployedToFleetWithInstaller(ctx context.Context, installerType string) error {
+	state, ok := AgentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(a.Name())
+	}
+
+	if a.hooks.Deploy != nil {
+		return a.hooks.Deploy(ctx, installerType)
+	}
+
+	fleet, ok := FleetFromContext(ctx)
+	if !ok || fleet.EnrollmentToken.APIKey == "" {
+		return fmt.Errorf("the scenario does not have a policy to enroll the agent in")
+	}
+
+	agentService := deploy.NewServiceRequest(common.ElasticAgentServiceName).WithVersion(common.ElasticAgentVersion)
+	err := a.deployer.Add(ctx, a.profile, []deploy.ServiceRequest{agentService}, common.ProfileEnv)
+	if err != nil {
+		return err
+	}
+	state.Service = agentService
+	state.InstallerType = installerType
+
+	// registered between the service and the install, the agent is un-enrolled once uninstalled
+	if !cleanup.Register(ctx, "agent enrollment "+agentService.Name, a.unenrollAgent) {
+		return errNotRegistered("clean up")
+	}
+
+	agentInstaller, err := attachInstaller(ctx, a.deployer, agentService, installerType)
+	if err != nil {
+		return err
+	}
+
+	err = agentInstaller.Preinstall(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = agentInstaller.Install(ctx)
+	if err != nil {
+		return err
+	}
+	state.Installed = true
+
+	err = agentInstaller.Enroll(ctx, fleet.EnrollmentToken.APIKey, "")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEnrollment, err)
+	}
+
+	err = agentInstaller.Postinstall(ctx)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := a.deployer.GetServiceManifest(ctx, agentService)
+	if err != nil {
+		return err
+	}
+	state.Hostname = manifest.Hostname
+
+	log.WithFields(log.Fields{
+		"hostname":  state.Hostname,
+		"installer": installerType,
+		"policyID":  fleet.Policy.ID,
+	}).Info("Agent deployed to Fleet")
+	return nil
+}
+
+// anAttemptToEnrollANewAgentFails replaces the agent deployed by the scenario with a new one, installed with the
+// same installer, checking that it cannot enroll with the token of the scenario, i.e. once revoked
+func (a *Agent) anAttemptToEnrollANewAgentFails(ctx context.Context) error {
+	state, ok := AgentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(a.Name())
+	}
+	if state.InstallerType == "" {
+		return fmt.Errorf("the scenario did not deploy an agent")
+	}
+
+	if state.Installed {
+		err := a.theAgentIsInState(ctx, "uninstalled")
+		if err != nil {
+			return err
+		}
+	}
+
+	err := a.anAgentIsDeployedToFleetWithInstaller(ctx, state.InstallerType)
+	if err == nil {
+		return fmt.Errorf("the agent was enrolled although the token was revoked")
+	}
+	if !errors.Is(err, ErrEnrollment) {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"error": err,
+	}).Debug("As expected, the agent could not be enrolled with a revoked token")
+	return nil
+}
+
+// theAgentIsInState starts, stops, restarts or uninstalls the agent deployed by the scenario
+func (a *Agent) theAgentIsInState(ctx context.Context, action string) error {
+	state, ok := AgentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(a.Name())
+	}
+	if !state.Installed {
+		return fmt.Errorf("the scenario did not deploy an agent")
+	}
+
+	agentInstaller, err := attachInstaller(ctx, a.deployer, state.Service, state.InstallerType)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "started":
+		return agentInstaller.Start(ctx)
+	case "stopped":
+		return agentInstaller.Stop(ctx)
+	case "restarted":
+		return agentInstaller.Restart(ctx)
+	}
+
+	err = agentInstaller.Uninstall(ctx)
+	if err != nil {
+		return err
+	}
+	state.Installed = false
+	return nil
+}
+
+// theAgentIsListedInFleetAs waits for the agent deployed by the scenario to be in a status in Fleet
+func (a *Agent) theAgentIsListedInFleetAs(ctx context.Context, desiredStatus string) error {
+	state, ok := AgentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(a.Name())
+	}
+	if state.Hostname == "" {
+		return fmt.Errorf("the scenario did not deploy an agent")
+	}
+
+	err := WaitForAgentStatus(ctx, a.client, desiredStatus, state.Hostname)
+	if err != nil || a.hooks.Listed == nil {
+		return err
+	}
+
+	return a.hooks.Listed(ctx, desiredStatus)
+}
+
+// unenrollAgent un-enrolls the agent deployed by the scenario, if it was enrolled
+func (a *Agent) unenrollAgent(ctx context.Context) error {
+	state, ok := AgentFromContext(ctx)
+	if !ok || state.Hostname == "" {
+		return nil
+	}
+
+	// the agents notify Fleet when they are uninstalled, so they are not listed anymore
+	agentID, err := a.client.GetAgentIDByHostname(ctx, state.Hostname)
+	if err != nil || agentID == "" {
+		return err
+	}
+
+	return a.client.UnEnrollAgent(ctx, state.Hostname)
+}
+
+// WaitForAgentStatus waits for the agent of a host to be in a status in Fleet. The agents which are not
+// listed in Fleet are considered offline or inactive
+func WaitForAgentStatus(ctx context.Context, client *kibana.Client, desiredStatus string, hostname string) error {
+	log.Tracef("Checking if agent is listed in Fleet as %s", desiredStatus)
+
+	maxTimeout := time.Duration(utils.TimeoutFactor) * time.Minute * 2
+	retryCount := 1
+
+	exp := utils.GetExponentialBackOff(maxTimeout)
+
+	agentOnlineFn := func() error {
+		agentID, err := client.GetAgentIDByHostname(ctx, hostname)
+		if err != nil {
+			retryCount++
+			return err
+		}
+
+		if agentID == "" {
+			// the agent is not listed in Fleet
+			if desiredStatus == "offline" || desiredStatus == "inactive" {
+				log.WithFields(log.Fields{
+					"elapsedTime": exp.GetElapsedTime(),
+					"hostname":    hostname,
+					"retries":     retryCount,
+					"status":      desiredStatus,
+				}).Info("The Agent is not present in Fleet, as expected")
+				return nil
+			}
+
+			retryCount++
+			return fmt.Errorf("the agent is not present in Fleet in the '%s' status, but it should", desiredStatus)
+		}
+
+		agentStatus, err := client.GetAgentStatusByHostname(ctx, hostname)
+		isAgentInStatus := strings.EqualFold(agentStatus, desiredStatus)
+		if err != nil || !isAgentInStatus {
+			if err == nil {
+				err = fmt.Errorf("the Agent is not in the %s status yet", desiredStatus)
+			}
+
+			log.WithFields(log.Fields{
+				"agentID":         agentID,
+				"isAgentInStatus": isAgentInStatus,
+				"elapsedTime":     exp.GetElapsedTime(),
+				"hostname":        hostname,
+				"retry":           retryCount,
+				"status":          desiredStatus,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
+		log.WithFields(log.Fields{
+			"isAgentInStatus": isAgentInStatus,
+			"elapsedTime":     exp.GetElapsedTime(),
+			"hostname":        hostname,
+			"retries":         retryCount,
+			"status":          desiredStatus,
+		}).Info("The Agent is in the desired status")
+		return nil
+	}
+
+	return backoff.Retry(agentOnlineFn, exp)
+}
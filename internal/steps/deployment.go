@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+)
+
+// DeploymentState represents the services deployed by a scenario, which are removed by its clean up stack
+type DeploymentState struct {
+	Services []deploy.ServiceRequest
+}
+
+// service returns the service deployed by the scenario with a name
+func (s *DeploymentState) service(name string) (deploy.ServiceRequest, bool) {
+	for _, srv := range s.Services {
+		if srv.Name == name {
+			return srv, true
+		}
+	}
+	return deploy.ServiceRequest{}, false
+}
+
+// deploymentKey is the key of the DeploymentState in the context of a scenario
+type deploymentKey struct{}
+
+// DeploymentFromContext returns the services deployed by the scenario
+func DeploymentFromContext(ctx context.Context) (*DeploymentState, bool) {
+	state, ok := ctx.Value(deploymentKey{}).(*DeploymentState)
+	return state, ok
+}
+
+// Deployment the steps to deploy, start, stop and remove the services of a profile
+type Deployment struct {
+	deployer deploy.Deployment
+	profile  deploy.ServiceRequest
+}
+
+// NewDeployment creates the deployment steps for the services of a profile, i.e. fleet
+func NewDeployment(deployer deploy.Deployment, profile string) *Deployment {
+	return &Deployment{
+		deployer: deployer,
+		profile:  deploy.NewServiceRequest(profile),
+	}
+}
+
+// Name returns the name of the group
+func (d *Deployment) Name() string {
+	return "deployment"
+}
+
+// Register adds the deployment steps to a scenario
+func (d *Deployment) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		return context.WithValue(ctx, deploymentKey{}, &DeploymentState{}), nil
+	})
+
+	sc.Step(`^the "([^"]*)" service is deployed$`, d.theServiceIsDeployed)
+	sc.Step(`^the "([^"]*)" service is (started|stopped)$`, d.theServiceIsInState)
+	sc.Step(`^the "([^"]*)" service is removed$`, d.theServiceIsRemoved)
+}
+
+// theServiceIsDeployed adds a service to the profile, with the environment of the profile
+func (d *Deployment) theServiceIsDeployed(ctx context.Context, name string) error {
+	state, ok := DeploymentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(d.Name())
+	}
+
+	srv := deploy.NewServiceRequest(name)
+	err := d.deployer.Add(ctx, d.profile, []deploy.ServiceRequest{srv}, common.ProfileEnv)
+	if err != nil {
+		return err
+	}
+
+	state.Services = append(state.Services, srv)
+	return nil
+}
+
+// theServiceIsInState starts or stops a service deployed by the scenario
+func (d *Deployment) theServiceIsInState(ctx context.Context, name string, action string) error {
+	state, ok := DeploymentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(d.Name())
+	}
+
+	srv, ok := state.service(name)
+	if !ok {
+		return fmt.Errorf("the %s service was not deployed by the scenario", name)
+	}
+
+	if action == "started" {
+		return d.deployer.Start(ctx, srv)
+	}
+	return d.deployer.Stop(ctx, srv)
+}
+
+// theServiceIsRemoved removes a service deployed by the scenario
+func (d *Deployment) theServiceIsRemoved(ctx context.Context, name string) error {
+	state, ok := DeploymentFromContext(ctx)
+	if !ok {
+		return errNotRegistered(d.Name())
+	}
+
+	srv, ok := state.service(name)
+	if !ok {
+		return fmt.Errorf("the %s service was not deployed by the scenario", name)
+	}
+
+	err := d.deployer.Remove(ctx, d.profile, []deploy.ServiceRequest{srv}, common.ProfileEnv)
+	if err != nil {
+		return err
+	}
+
+	services := []deploy.ServiceRequest{}
+	for _, s := range state.Services {
+		if s.Name != name {
+			services = append(services, s)
+		}
+	}
+	state.Services = services
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/cleanup"
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// the ways of cleaning up the data streams of a scenario, set with the DATA_STREAM_CLEANUP environment variable
+const (
+	dataStreamCleanupDelete   = "delete"
+	dataStreamCleanupRollover = "rollover"
+	dataStreamCleanupNone     = "none"
+)
+
+// ElasticsearchState represents the data of a scenario, which is searched from the start of the scenario
+// and removed after it
+type ElasticsearchState struct {
+	Since time.Time
+}
+
+// elasticsearchKey is the key of the ElasticsearchState in the context of a scenario
+type elasticsearchKey struct{}
+
+// ElasticsearchFromContext returns the data of the scenario
+func ElasticsearchFromContext(ctx context.Context) (*ElasticsearchState, bool) {
+	state, ok := ctx.Value(elasticsearchKey{}).(*ElasticsearchState)
+	return state, ok
+}
+
+// ElasticsearchData the steps to check the events of the data streams of the scenario. When the scenario
+// deploys an agent, only the events of its host are considered
+type ElasticsearchData struct {
+	timeout time.Duration
+}
+
+// NewElasticsearchData creates the Elasticsearch data steps, waiting for the events for a time
+func NewElasticsearchData(timeout time.Duration) *ElasticsearchData {
+	return &ElasticsearchData{
+		timeout: timeout,
+	}
+}
+
+// Name returns the name of the group
+func (e *ElasticsearchData) Name() string {
+	return "elasticsearch data"
+}
+
+// Register adds the Elasticsearch data steps to a scenario
+func (e *ElasticsearchData) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		// registered before any other resource of the scenario, the data streams are removed the last
+		if !cleanup.Register(ctx, "data streams "+NamespaceFromContext(ctx), e.removeDataStreams) {
+			return ctx, errNotRegistered("clean up")
+		}
+		return context.WithValue(ctx, elasticsearchKey{}, &ElasticsearchState{Since: time.Now()}), nil
+	})
+
+	sc.Step(`^there are events in the "([^"]*)" data stream$`, e.thereAreEventsInTheDataStream)
+	sc.Step(`^there are at least "(\d+)" events in the "([^"]*)" data stream$`, e.thereAreAtLeastEventsInTheDataStream)
+	sc.Step(`^there are no new events in the "([^"]*)" data stream during "([^"]*)"$`, e.thereAreNoNewEventsInTheDataStreamDuring)
+}
+
+// thereAreEventsInTheDataStream waits for events in a data stream, i.e. logs-generic, since the start of the scenario
+func (e *ElasticsearchData) thereAreEventsInTheDataStream(ctx context.Context, dataStream string) error {
+	return e.thereAreAtLeastEventsInTheDataStream(ctx, 1, dataStream)
+}
+
+// thereAreAtLeastEventsInTheDataStream waits for a number of events in a data stream since the start of the scenario
+func (e *ElasticsearchData) thereAreAtLeastEventsInTheDataStream(ctx context.Context, count int, dataStream string) error {
+	state, ok := ElasticsearchFromContext(ctx)
+	if !ok {
+		return errNotRegistered(e.Name())
+	}
+
+	query := e.hostQuery(ctx).Since(state.Since).SortBy(elasticsearch.TimestampField, elasticsearch.Descending)
+	_, err := elasticsearch.WaitForNumberOfHits(ctx, dataStreamName(ctx, dataStream), query.Build(), count, e.timeout)
+	return err
+}
+
+// thereAreNoNewEventsInTheDataStreamDuring checks no events arrive to a data stream for a period of time, i.e. 30s
+func (e *ElasticsearchData) thereAreNoNewEventsInTheDataStreamDuring(ctx context.Context, dataStream string, period string) error {
+	duration, err := time.ParseDuration(period)
+	if err != nil {
+		return fmt.Errorf("the %s period is not a duration: %w", period, err)
+	}
+
+	from := time.Now()
+	err = utils.Sleep(duration)
+	if err != nil {
+		return err
+	}
+
+	index := dataStreamName(ctx, dataStream)
+	result, err := elasticsearch.Search(ctx, index, e.hostQuery(ctx).Within(from, time.Now()).Build())
+	if err != nil {
+		return err
+	}
+
+	if hits := result.Hits(); len(hits) > 0 {
+		return fmt.Errorf("there are %d new events in the %s data stream during %s", len(hits), index, duration)
+	}
+	return nil
+}
+
+// hostQuery returns a query for the events of the agent of the scenario, or for all the events if the
+// scenario did not deploy one
+func (e *ElasticsearchData) hostQuery(ctx context.Context) *elasticsearch.QueryBuilder {
+	query := elasticsearch.NewQuery()
+	if agent, ok := AgentFromContext(ctx); ok && agent.Hostname != "" {
+		query = query.Filter(elasticsearch.Term("host.name", agent.Hostname))
+	}
+	return query
+}
+
+// removeDataStreams deletes, or rolls over, the data streams of the namespace of the scenario, so that the next
+// scenarios do not find its data
+func (e *ElasticsearchData) removeDataStreams(ctx context.Context) error {
+	namespace := NamespaceFromContext(ctx)
+	if namespace == elasticsearch.DefaultNamespace {
+		return nil
+	}
+
+	patterns := elasticsearch.NamespacePatterns(namespace)
+
+	var err error
+	mode := shell.GetEnv("DATA_STREAM_CLEANUP", dataStreamCleanupDelete)
+	switch mode {
+	case dataStreamCleanupDelete:
+		err = elasticsearch.DeleteDataStreams(ctx, patterns...)
+	case dataStreamCleanupRollover:
+		_, err = elasticsearch.RolloverDataStreams(ctx, patterns...)
+	case dataStreamCleanupNone:
+		return nil
+	default:
+		log.WithField("mode", mode).Warn("Unknown data stream clean up mode, the data streams are kept")
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not %s the data streams of the %s namespace: %w", mode, namespace, err)
+	}
+
+	log.WithFields(log.Fields{
+		"mode":      mode,
+		"namespace": namespace,
+	}).Debug("Data streams of the scenario cleaned up")
+	return nil
+}
+
+// dataStreamName returns the name of a data stream in the namespace of the scenario, unless the name
+// includes a namespace, i.e. logs-generic or logs-generic-default
+func dataStreamName(ctx context.Context, dataStream string) string {
+	if strings.Count(dataStream, "-") < 2 {
+		return dataStream + "-" + NamespaceFromContext(ctx)
+	}
+	return dataStream
+}
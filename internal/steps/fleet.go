@@ -0,0 +1,218 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// revokedTokenDelay is the time Fleet takes to reject a revoked enrollment token, multiplied by the timeout
+// factor. It's declared as a variable so that tests are able to replace it, not waiting for the fake Fleet
+var revokedTokenDelay = 20 * time.Second
+
+// FleetState represents the agent policy of a scenario, with the token to enroll agents in it and
+// the package policies added by the scenario
+type FleetState struct {
+	Policy          kibana.Policy
+	EnrollmentToken kibana.EnrollmentAPIKey
+	PackagePolicies []kibana.PackageDataStream
+}
+
+// fleetKey is the key of the FleetState in the context of a scenario
+type fleetKey struct{}
+
+// WithFleet returns a copy of the context with the agent policy of the scenario, so that a suite keeping
+// its own policy shares it with the Fleet policy steps
+func WithFleet(ctx context.Context, state *FleetState) context.Context {
+	return context.WithValue(ctx, fleetKey{}, state)
+}
+
+// FleetFromContext returns the agent policy of the scenario
+func FleetFromContext(ctx context.Context) (*FleetState, bool) {
+	state, ok := ctx.Value(fleetKey{}).(*FleetState)
+	return state, ok
+}
+
+// FleetPolicies the steps to create the agent policy of a scenario and add integrations to it. The
+// policy is created in the namespace of the scenario, and deleted by its clean up stack
+type FleetPolicies struct {
+	client          *kibana.Client
+	fixturesDir     string
+	packagePolicies map[string]kibana.PackagePolicySpec
+}
+
+// NewFleetPolicies creates the Fleet policy steps, loading the policies applied by the scenarios from
+// the YAML fixtures of a directory, i.e. testresources/policies
+func NewFleetPolicies(client *kibana.Client, fixturesDir string) *FleetPolicies {
+	return &FleetPolicies{
+		client:          client,
+		fixturesDir:     fixturesDir,
+		packagePolicies: map[string]kibana.PackagePolicySpec{},
+	}
+}
+
+// WithPackagePolicy sets the inputs enabled when an integration is added to the policy, by package
+func (f *FleetPolicies) WithPackagePolicy(spec kibana.PackagePolicySpec) *FleetPolicies {
+	f.packagePolicies[spec.Package] = spec
+	return f
+}
+
+// Name returns the name of the group
+func (f *FleetPolicies) Name() string {
+	return "fleet policies"
+}
+
+// Register adds the Fleet policy steps to a scenario
+func (f *FleetPolicies) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		// the policy of the suite is kept, if it created one before
+		if _, ok := FleetFromContext(ctx); ok {
+			return ctx, nil
+		}
+		return WithFleet(ctx, &FleetState{}), nil
+	})
+
+	sc.Step(`^a policy is created for the scenario$`, f.aPolicyIsCreatedForTheScenario)
+	sc.Step(`^the "([^"]*)" agent policy is applied to the scenario$`, f.theAgentPolicyIsAppliedToTheScenario)
+	sc.Step(`^the "([^"]*)" integration is added to the policy$`, f.theIntegrationIsAddedToThePolicy)
+	sc.Step(`^the "([^"]*)" integration is in the policy$`, f.theIntegrationIsInThePolicy)
+	sc.Step(`^the enrollment token is revoked$`, f.theEnrollmentTokenIsRevoked)
+}
+
+// aPolicyIsCreatedForTheScenario creates an agent policy in the namespace of the scenario
+func (f *FleetPolicies) aPolicyIsCreatedForTheScenario(ctx context.Context) error {
+	state, ok := FleetFromContext(ctx)
+	if !ok {
+		return errNotRegistered(f.Name())
+	}
+
+	policy, err := f.client.CreatePolicyInNamespace(ctx, NamespaceFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return f.usePolicy(ctx, state, policy)
+}
+
+// theAgentPolicyIsAppliedToTheScenario applies the agent policy of a fixture, in the namespace of the
+// scenario unless the fixture sets one
+func (f *FleetPolicies) theAgentPolicyIsAppliedToTheScenario(ctx context.Context, fixture string) error {
+	state, ok := FleetFromContext(ctx)
+	if !ok {
+		return errNotRegistered(f.Name())
+	}
+
+	spec, err := kibana.LoadPolicySpec(filepath.Join(f.fixturesDir, fixture+".yml"))
+	if err != nil {
+		return err
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = NamespaceFromContext(ctx)
+	}
+
+	policy, err := f.client.ApplyPolicy(ctx, spec)
+	if err != nil {
+		return err
+	}
+
+	return f.usePolicy(ctx, state, policy)
+}
+
+// theIntegrationIsAddedToThePolicy adds the latest version of a package to the policy of the scenario
+func (f *FleetPolicies) theIntegrationIsAddedToThePolicy(ctx context.Context, packageName string) error {
+	state, ok := FleetFromContext(ctx)
+	if !ok {
+		return errNotRegistered(f.Name())
+	}
+	if state.Policy.ID == "" {
+		return fmt.Errorf("the scenario does not have a policy to add the %s integration to", packageName)
+	}
+
+	integration, err := f.client.GetIntegrationByPackageName(ctx, packageName)
+	if err != nil {
+		return err
+	}
+
+	inputs := []kibana.Input{}
+	if spec, ok := f.packagePolicies[packageName]; ok {
+		inputs = spec.BuildInputs()
+	}
+
+	packagePolicy, err := f.client.CreatePackagePolicy(ctx, kibana.PackageDataStream{
+		Name:        fmt.Sprintf("%s-%s", integration.Name, uuid.New().String()),
+		Description: integration.Title,
+		Namespace:   NamespaceFromContext(ctx),
+		PolicyID:    state.Policy.ID,
+		Enabled:     true,
+		Package:     integration,
+		Inputs:      inputs,
+	})
+	if err != nil {
+		return err
+	}
+
+	state.PackagePolicies = append(state.PackagePolicies, packagePolicy)
+	return nil
+}
+
+// theIntegrationIsInThePolicy checks a package is in the policy of the scenario
+func (f *FleetPolicies) theIntegrationIsInThePolicy(ctx context.Context, packageName string) error {
+	state, ok := FleetFromContext(ctx)
+	if !ok {
+		return errNotRegistered(f.Name())
+	}
+
+	_, err := f.client.GetIntegrationFromAgentPolicy(ctx, packageName, state.Policy)
+	return err
+}
+
+// theEnrollmentTokenIsRevoked revokes the token the agents of the scenario enroll with
+func (f *FleetPolicies) theEnrollmentTokenIsRevoked(ctx context.Context) error {
+	state, ok := FleetFromContext(ctx)
+	if !ok {
+		return errNotRegistered(f.Name())
+	}
+	if state.EnrollmentToken.ID == "" {
+		return fmt.Errorf("the scenario does not have an enrollment token to revoke")
+	}
+
+	err := f.client.DeleteEnrollmentAPIKey(ctx, state.EnrollmentToken.ID)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"tokenID": state.EnrollmentToken.ID,
+	}).Debug("Enrollment token revoked")
+
+	// FIXME: Remove once https://github.com/elastic/kibana/issues/105078 is addressed
+	return utils.Sleep(time.Duration(utils.TimeoutFactor) * revokedTokenDelay)
+}
+
+// usePolicy makes the agents of the scenario enroll in a policy, with a new enrollment token
+func (f *FleetPolicies) usePolicy(ctx context.Context, state *FleetState, policy kibana.Policy) error {
+	enrollmentKey, err := f.client.CreateEnrollmentAPIKey(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"namespace": policy.Namespace,
+		"policyID":  policy.ID,
+	}).Debug("Using the agent policy in the scenario")
+
+	state.Policy = policy
+	state.EnrollmentToken = enrollmentKey
+	return nil
+}
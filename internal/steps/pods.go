@@ -0,0 +1,614 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/kubernetes"
+	"github.com/elastic/e2e-testing/internal/utils"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm/v2"
+)
+
+// podsWaitTimeout is the time to wait for the pods to run and for their events, multiplied by the timeout factor
+const podsWaitTimeout = 300 * time.Second
+
+// beatVersions the versions of the images of the beats by pod, so that the images are loaded once in the cluster
+// by the concurrent scenarios
+var beatVersions = struct {
+	mu    sync.Mutex
+	items map[string]string
+}{
+	items: map[string]string{},
+}
+
+// PodsState represents the namespace of the cluster where the scenario deploys its pods, which is deleted by its
+// clean up stack
+type PodsState struct {
+	Kubectl kubernetes.Control
+}
+
+// podsKey is the key of the PodsState in the context of a scenario
+type podsKey struct{}
+
+// PodsFromContext returns the namespace of the pods of the scenario
+func PodsFromContext(ctx context.Context) (*PodsState, bool) {
+	state, ok := ctx.Value(podsKey{}).(*PodsState)
+	return state, ok
+}
+
+// Pods the steps to deploy the pods of templates in a namespace of a Kubernetes cluster, and to check the events
+// collected by the beats running in them
+type Pods struct {
+	cluster      *kubernetes.Cluster
+	templatesDir string
+}
+
+// NewPods creates the pods steps, deploying the templates of a directory, i.e. testdata/templates, in the cluster.
+// A template is named after its pod, i.e. a-pod.yml.tmpl
+func NewPods(cluster *kubernetes.Cluster, templatesDir string) *Pods {
+	return &Pods{
+		cluster:      cluster,
+		templatesDir: templatesDir,
+	}
+}
+
+// Name returns the name of the group
+func (p *Pods) Name() string {
+	return "kubernetes pods"
+}
+
+// Register adds the pods steps to a scenario, which runs in its own namespace of the cluster
+func (p *Pods) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		kubectl := p.cluster.Kubectl().WithNamespace(ctx, "")
+		if kubectl.Namespace != "" {
+			log.Debugf("Running scenario %s in namespace: %s", s.Name, kubectl.Namespace)
+		}
+
+		return context.WithValue(ctx, podsKey{}, &PodsState{Kubectl: kubectl}), nil
+	})
+
+	sc.Step(`^"([^"]*)" have passed$`, waitDuration)
+
+	sc.Step(`^"([^"]*)" is ([a-z]*)$`, func(ctx context.Context, name, state string) error {
+		return p.resourceIs(ctx, name, state)
+	})
+	sc.Step(`^"([^"]*)" is ([a-z]*) with "([^"]*)"$`, func(ctx context.Context, name, state, option string) error {
+		return p.resourceIs(ctx, name, state, option)
+	})
+	sc.Step(`^"([^"]*)" is ([a-z]*) with "([^"]*)" and "([^"]*)"$`, func(ctx context.Context, name, state, option1, option2 string) error {
+		return p.resourceIs(ctx, name, state, option1, option2)
+	})
+
+	sc.Step(`^"([^"]*)" collects events with "([^"]*:[^"]*)"$`, p.collectsEventsWith)
+	sc.Step(`^"([^"]*)" does not collect events with "([^"]*)" during "([^"]*)"$`, p.doesNotCollectEvents)
+	sc.Step(`^an ephemeral container is started in "([^"]*)"$`, p.startEphemeralContainerIn)
+}
+
+// kubectl returns the client of the namespace of the scenario
+func (p *Pods) kubectl(ctx context.Context) (kubernetes.Control, error) {
+	state, ok := PodsFromContext(ctx)
+	if !ok {
+		return kubernetes.Control{}, errNotRegistered(p.Name())
+	}
+	return state.Kubectl, nil
+}
+
+func (p *Pods) executeTemplateFor(ctx context.Context, podName string, writer io.Writer, options []string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Executing template for pod", "pod.template.execute", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("pod", podName)
+	span.Context.SetLabel("options", options)
+	defer span.End()
+
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(p.templatesDir, sanitizeName(podName)+".yml.tmpl")
+
+	err = p.configureDockerImage(ctx, podName)
+	if err != nil {
+		return err
+	}
+
+	usedOptions := make(map[string]bool)
+	funcs := template.FuncMap{
+		"option": func(o string) bool {
+			usedOptions[o] = true
+			for _, option := range options {
+				if o == option {
+					return true
+				}
+			}
+			return false
+		},
+		"beats_namespace": func() string {
+			return deploy.GetDockerNamespaceEnvVarForRepository(podName, "beats")
+		},
+		"beats_version": func() string {
+			beatVersions.mu.Lock()
+			defer beatVersions.mu.Unlock()
+			return beatVersions.items[podName]
+		},
+		"namespace": func() string {
+			return kubectl.Namespace
+		},
+		// Can be used to add owner references so cluster-level resources
+		// are removed when removing the namespace.
+		"namespace_uid": func() string {
+			return kubectl.NamespaceUID
+		},
+	}
+
+	t, err := template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+	if os.IsNotExist(err) {
+		log.Debugf("template %s does not exist", path)
+		return godog.ErrPending
+	}
+	if err != nil {
+		return fmt.Errorf("parsing template %s: %w", path, err)
+	}
+
+	err = t.ExecuteTemplate(writer, filepath.Base(path), nil)
+	if err != nil {
+		return fmt.Errorf("executing template %s: %w", path, err)
+	}
+
+	for _, option := range options {
+		if _, used := usedOptions[option]; !used {
+			log.Debugf("option '%s' is not used in template for '%s'", option, podName)
+			return godog.ErrPending
+		}
+	}
+
+	return nil
+}
+
+func (p *Pods) configureDockerImage(ctx context.Context, podName string) error {
+	namespace := "beats"
+
+	if podName != "filebeat" && podName != "heartbeat" && podName != "metricbeat" && podName != "elastic-agent" && podName != "elasticsearch" {
+		log.Debugf("Not processing custom binaries for pod: %s. Only [elasticsearch, filebeat, heartbeat, metricbeat, elastic-agent] will be processed", podName)
+		return nil
+	}
+
+	span, _ := apm.StartSpanOptions(ctx, "Configuring Docker image", "pod.docker-image.configure", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("pod", podName)
+	defer span.End()
+
+	// we are caching the versions by pod to avoid downloading and loading/tagging the Docker image multiple times
+	beatVersions.mu.Lock()
+	defer beatVersions.mu.Unlock()
+	if beatVersions.items[podName] != "" {
+		log.Tracef("The beat version was already loaded: %s", beatVersions.items[podName])
+		return nil
+	}
+
+	v := common.BeatVersion
+	if strings.EqualFold(podName, "elastic-agent") {
+		v = common.ElasticAgentVersion
+	}
+	beatVersion := downloads.GetSnapshotVersion(v) + "-amd64"
+
+	ciSnapshotsFn := downloads.UseBeatsCISnapshots
+	if strings.EqualFold(podName, "elastic-agent") {
+		ciSnapshotsFn = downloads.UseElasticAgentCISnapshots
+	} else if strings.EqualFold(podName, "elasticsearch") {
+		// never process elasticsearch artifacts from CI artifacts
+		ciSnapshotsFn = func() bool { return false }
+	}
+
+	if ciSnapshotsFn() {
+		log.Debugf("Configuring Docker image for %s", podName)
+
+		_, imagePath, err := downloads.FetchElasticArtifact(ctx, podName, v, "linux", "amd64", "tar.gz", true, true)
+		if err != nil {
+			return err
+		}
+
+		// load the TAR file into the docker host as a Docker image
+		err = deploy.LoadImage(imagePath)
+		if err != nil {
+			return err
+		}
+
+		if podName == "elasticsearch" {
+			namespace = "elasticsearch"
+		}
+		err = deploy.TagImage(
+			"docker.elastic.co/"+namespace+"/"+podName+":"+downloads.GetSnapshotVersion(common.BeatVersionBase),
+			"docker.elastic.co/observability-ci/"+podName+":"+beatVersion,
+		)
+		if err != nil {
+			return err
+		}
+		// load PR image into kind
+		err = p.cluster.LoadImage(ctx, "docker.elastic.co/observability-ci/"+podName+":"+beatVersion)
+		if err != nil {
+			return err
+		}
+
+	}
+
+	log.Tracef("Caching beat version '%s' for %s", beatVersion, podName)
+	beatVersions.items[podName] = beatVersion
+
+	return nil
+}
+
+func (p *Pods) isDeleted(ctx context.Context, podName string, options []string) error {
+	var buf bytes.Buffer
+	err := p.executeTemplateFor(ctx, podName, &buf, options)
+	if err != nil {
+		return err
+	}
+
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = kubectl.Delete(ctx, podName, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to delete '%s': %w", podName, err)
+	}
+	return nil
+}
+
+func (p *Pods) isDeployed(ctx context.Context, podName string, options []string) error {
+	var buf bytes.Buffer
+	err := p.executeTemplateFor(ctx, podName, &buf, options)
+	if err != nil {
+		return err
+	}
+
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = kubectl.Apply(ctx, podName, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to deploy '%s': %w", podName, err)
+	}
+	return nil
+}
+
+func (p *Pods) isRunning(ctx context.Context, podName string, options []string) error {
+	err := p.isDeployed(ctx, podName, options)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, podsWaitTimeout*time.Duration(utils.TimeoutFactor))
+	defer cancel()
+
+	_, err = p.getPodInstances(waitCtx, podName)
+	if err != nil {
+		return fmt.Errorf("waiting for instance of '%s': %w", podName, err)
+	}
+	return nil
+}
+
+func (p *Pods) resourceIs(ctx context.Context, podName string, state string, options ...string) error {
+	span, _ := apm.StartSpanOptions(ctx, "Checking resource state", "pod.state.check", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("options", options)
+	span.Context.SetLabel("pod", podName)
+	span.Context.SetLabel("state", state)
+	defer span.End()
+
+	switch state {
+	case "running":
+		return p.isRunning(ctx, podName, options)
+	case "deployed":
+		return p.isDeployed(ctx, podName, options)
+	case "deleted":
+		return p.isDeleted(ctx, podName, options)
+	default:
+		return godog.ErrPending
+	}
+}
+
+func (p *Pods) startEphemeralContainerIn(ctx context.Context, podName string) error {
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return err
+	}
+
+	podName = sanitizeName(podName)
+	// https://kubernetes.io/docs/tasks/debug/debug-application/debug-running-pod/#ephemeral-container-example
+	// example: kubectl debug -it #{podName} -c ephemeral-container --image=busybox:1.28 -- /bin/sh -c "echo Hi from an ephemeral container"
+	_, err = kubectl.Run(
+		ctx,
+		"debug",
+		"-it",
+		podName,
+		"-c",
+		"ephemeral-container",
+		"--image=busybox:1.28",
+		"--",
+		"/bin/sh", "-c",
+		"echo Hi from an ephemeral container")
+	if err != nil {
+		return fmt.Errorf("failed to create ephemeral container: %w. Is EphemeralContainers feature flag enabled in the cluster?", err)
+	}
+	return nil
+}
+
+func (p *Pods) collectsEventsWith(ctx context.Context, podName string, condition string) error {
+	_, _, ok := splitCondition(condition)
+	if !ok {
+		return fmt.Errorf("invalid condition '%s'", condition)
+	}
+
+	return p.waitForEventsCondition(ctx, podName, func(ctx context.Context, localPath string) (bool, error) {
+		ok, err := containsEventsWith(ctx, localPath, condition)
+		if ok {
+			return true, nil
+		}
+		if err != nil {
+			log.Debugf("Error checking if %v contains %v: %v", localPath, condition, err)
+		}
+		return false, nil
+	})
+}
+
+func (p *Pods) doesNotCollectEvents(ctx context.Context, podName, condition, duration string) error {
+	_, _, ok := splitCondition(condition)
+	if !ok {
+		return fmt.Errorf("invalid condition '%s'", condition)
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s: %w", d, err)
+	}
+
+	return p.waitForEventsCondition(ctx, podName, func(ctx context.Context, localPath string) (bool, error) {
+		events, err := readEventsWith(ctx, localPath, condition)
+		if err != nil {
+			return false, err
+		}
+		// No events ever received, so condition satisfied.
+		if len(events) == 0 {
+			return true, nil
+		}
+
+		lastEvent := events[len(events)-1]
+		lastTimestamp, ok := lastEvent["@timestamp"].(string)
+		if !ok {
+			return false, fmt.Errorf("event %v doesn't contain a @timestamp", lastEvent)
+		}
+		t, err := time.Parse(time.RFC3339, lastTimestamp)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse @timestamp %s: %w", lastTimestamp, err)
+		}
+		if sinceLast := time.Now().Sub(t); sinceLast <= d {
+			// Condition cannot be satisfied until the duration has passed after the last
+			// event. So wait till then.
+			select {
+			case <-ctx.Done():
+			case <-time.After(d - sinceLast):
+			}
+			return false, nil
+		}
+
+		return true, nil
+	})
+}
+
+func (p *Pods) waitForEventsCondition(ctx context.Context, podName string, conditionFn func(ctx context.Context, localPath string) (bool, error)) error {
+	span, _ := apm.StartSpanOptions(ctx, "Waiting for events conditions", "pod.events.waitForCondition", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("pod", podName)
+	defer span.End()
+
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, podsWaitTimeout*time.Duration(utils.TimeoutFactor))
+	defer cancel()
+
+	instances, err := p.getPodInstances(ctx, podName)
+	if err != nil {
+		return fmt.Errorf("failed to get pod name: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(os.TempDir(), "test-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	containerPath := fmt.Sprintf("%s/%s:/tmp/beats-events", kubectl.Namespace, instances[0])
+	localPath := filepath.Join(tmpDir, "events")
+	exp := backoff.WithContext(backoff.NewConstantBackOff(10*time.Second), ctx)
+	return backoff.Retry(func() error {
+		err := copyEvents(ctx, kubectl, containerPath, localPath)
+		if err != nil {
+			return fmt.Errorf("failed to copy events from %s: %w", containerPath, err)
+		}
+		ok, err := conditionFn(ctx, localPath)
+		if err != nil {
+			return fmt.Errorf("events condition failed: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("events do not satisfy condition")
+		}
+		return nil
+	}, exp)
+}
+
+func copyEvents(ctx context.Context, kubectl kubernetes.Control, containerPath string, localPath string) error {
+	today := time.Now().Format("20060102")
+	paths := []string{
+		containerPath,
+
+		// Format used since 8.0.
+		containerPath + "-" + today + ".ndjson",
+	}
+
+	var err error
+	var output string
+	for _, containerPath := range paths {
+		// This command always succeeds, so check if the local path has been created.
+		os.Remove(localPath)
+		output, _ = kubectl.Run(ctx, "cp", "--no-preserve", containerPath, localPath)
+		if _, err = os.Stat(localPath); os.IsNotExist(err) {
+			continue
+		}
+		return nil
+	}
+	log.Debugf("Failed to copy events from %s to %s: %s", containerPath, localPath, output)
+	return err
+}
+
+func (p *Pods) getPodInstances(ctx context.Context, podName string) (instances []string, err error) {
+	span, _ := apm.StartSpanOptions(ctx, "Getting pod instances", "pod.instances.get", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("pod", podName)
+	defer span.End()
+
+	kubectl, err := p.kubectl(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	app := sanitizeName(podName)
+	ticker := backoff.WithContext(backoff.NewConstantBackOff(10*time.Second), ctx)
+	err = backoff.Retry(func() error {
+		output, err := kubectl.Run(ctx, "get", "pods",
+			"-l", "k8s-app="+app,
+			"--template", `{{range .items}}{{ if eq .status.phase "Running" }}{{.metadata.name}}{{"\n"}}{{ end }}{{end}}`)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			return fmt.Errorf("no running pods with label k8s-app=%s found", app)
+		}
+		instances = strings.Split(strings.TrimSpace(output), "\n")
+		return nil
+	}, ticker)
+	return
+}
+
+func splitCondition(c string) (key string, value string, ok bool) {
+	fields := strings.SplitN(c, ":", 2)
+	if len(fields) != 2 || len(fields[0]) == 0 {
+		return
+	}
+
+	return fields[0], fields[1], true
+}
+
+func flattenMap(m map[string]interface{}) map[string]interface{} {
+	flattened := make(map[string]interface{})
+	for k, v := range m {
+		switch child := v.(type) {
+		case map[string]interface{}:
+			childMap := flattenMap(child)
+			for ck, cv := range childMap {
+				flattened[k+"."+ck] = cv
+			}
+		default:
+			flattened[k] = v
+		}
+	}
+	return flattened
+}
+
+func containsEventsWith(ctx context.Context, path string, condition string) (bool, error) {
+	events, err := readEventsWith(ctx, path, condition)
+	if err != nil {
+		return false, err
+	}
+	return len(events) > 0, nil
+}
+
+func readEventsWith(ctx context.Context, path string, condition string) ([]map[string]interface{}, error) {
+	span, _ := apm.StartSpanOptions(ctx, "Reading events", "kubernetes.events.read", apm.SpanOptions{
+		Parent: apm.SpanFromContext(ctx).TraceContext(),
+	})
+	span.Context.SetLabel("condition", condition)
+	span.Context.SetLabel("path", path)
+	defer span.End()
+
+	key, value, ok := splitCondition(condition)
+	if !ok {
+		return nil, fmt.Errorf("invalid condition '%s'", condition)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var events []map[string]interface{}
+	decoder := json.NewDecoder(f)
+	for decoder.More() {
+		var event map[string]interface{}
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding event: %w", err)
+		}
+
+		event = flattenMap(event)
+		if v, ok := event[key]; ok && fmt.Sprint(v) == value {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func sanitizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
+
+func waitDuration(ctx context.Context, duration string) error {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s: %w", d, err)
+	}
+
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/process"
+)
+
+// ProcessesState represents the states of the processes checked by a scenario, by service and process
+type ProcessesState struct {
+	States map[string]string
+}
+
+// processesKey is the key of the ProcessesState in the context of a scenario
+type processesKey struct{}
+
+// ProcessesFromContext returns the states of the processes checked by the scenario
+func ProcessesFromContext(ctx context.Context) (*ProcessesState, bool) {
+	state, ok := ctx.Value(processesKey{}).(*ProcessesState)
+	return state, ok
+}
+
+// ProcessState returns the last state of a process of a service checked by the scenario
+func (s *ProcessesState) ProcessState(service string, pr string) (string, bool) {
+	state, ok := s.States[service+"/"+pr]
+	return state, ok
+}
+
+// Processes the steps to check the state of the processes of the services. The host of the scenario is
+// the service of the agent deployed by it
+type Processes struct {
+	deployer deploy.Deployment
+}
+
+// NewProcesses creates the process steps, running the checks with a deployer
+func NewProcesses(deployer deploy.Deployment) *Processes {
+	return &Processes{
+		deployer: deployer,
+	}
+}
+
+// Name returns the name of the group
+func (p *Processes) Name() string {
+	return "processes"
+}
+
+// Register adds the process steps to a scenario
+func (p *Processes) Register(sc *godog.ScenarioContext) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		return context.WithValue(ctx, processesKey{}, &ProcessesState{States: map[string]string{}}), nil
+	})
+
+	sc.Step(`^the "([^"]*)" process is in the "([^"]*)" state on the host$`, p.theProcessIsInTheStateOnTheHost)
+	sc.Step(`^the "([^"]*)" process is in the "([^"]*)" state on the "([^"]*)" service$`, p.theProcessIsInTheStateOnTheService)
+	sc.Step(`^there are "(\d+)" instances of the "([^"]*)" process in the "([^"]*)" state on the "([^"]*)" service$`, p.thereAreInstancesOfTheProcessInTheState)
+}
+
+// theProcessIsInTheStateOnTheHost checks the state of a process in the service of the agent of the scenario
+func (p *Processes) theProcessIsInTheStateOnTheHost(ctx context.Context, pr string, state string) error {
+	agent, ok := AgentFromContext(ctx)
+	if !ok || agent.Service.Name == "" {
+		return fmt.Errorf("the scenario did not deploy an agent to check the %s process", pr)
+	}
+
+	return p.checkState(ctx, agent.Service, pr, state, expectedInstances(state))
+}
+
+// theProcessIsInTheStateOnTheService checks the state of a process in a service
+func (p *Processes) theProcessIsInTheStateOnTheService(ctx context.Context, pr string, state string, service string) error {
+	return p.checkState(ctx, deploy.NewServiceRequest(service), pr, state, expectedInstances(state))
+}
+
+// thereAreInstancesOfTheProcessInTheState checks the number of instances of a process in a state in a service
+func (p *Processes) thereAreInstancesOfTheProcessInTheState(ctx context.Context, count int, pr string, state string, service string) error {
+	return p.checkState(ctx, deploy.NewServiceRequest(service), pr, state, count)
+}
+
+// checkState waits for a process of a service to be in a state, recording it in the scenario
+func (p *Processes) checkState(ctx context.Context, service deploy.ServiceRequest, pr string, state string, count int) error {
+	processes, ok := ProcessesFromContext(ctx)
+	if !ok {
+		return errNotRegistered(p.Name())
+	}
+
+	err := process.CheckState(ctx, p.deployer, service, pr, state, count)
+	if err != nil {
+		return err
+	}
+
+	processes.States[service.Name+"/"+pr] = state
+	return nil
+}
+
+// expectedInstances returns the instances of a process expected in a state, none when it's stopped
+func expectedInstances(state string) int {
+	if state == "uninstalled" || state == "stopped" {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package steps provides groups of Gherkin steps shared by the test suites, i.e. to deploy services,
+// manage the lifecycle of the agents or check the data in Elasticsearch. A suite registers the groups
+// it needs in its scenarios, and each group keeps the state of the scenario in its context.
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/internal/cleanup"
+	"github.com/elastic/e2e-testing/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// namespacePrefix is the prefix of the data stream namespaces of the scenarios
+const namespacePrefix = "e2e"
+
+// Group represents a set of steps registered in the scenarios of a suite. The state of the group is
+// created before each scenario, kept in the context of the scenario, and cleaned up after it
+type Group interface {
+	Name() string                       // name of the group, i.e. deployment
+	Register(sc *godog.ScenarioContext) // adds the hooks and the steps of the group to the scenario
+}
+
+// namespaceKey is the key of the data stream namespace of a scenario in its context
+type namespaceKey struct{}
+
+// Register adds the groups of steps to a scenario, which runs in its own data stream namespace. The resources
+// created by the steps register their removal in the clean up stack of the scenario, which runs once the
+// scenario finishes, the last created first
+func Register(sc *godog.ScenarioContext, groups ...Group) {
+	sc.Before(func(ctx context.Context, s *godog.Scenario) (context.Context, error) {
+		namespace := elasticsearch.NewNamespace(namespacePrefix)
+
+		log.WithFields(log.Fields{
+			"namespace": namespace,
+			"scenario":  s.Name,
+		}).Trace("Scenario namespace created")
+
+		ctx = WithNamespace(ctx, namespace)
+		return cleanup.WithStack(ctx, cleanup.NewStack(s.Name)), nil
+	})
+	sc.After(func(ctx context.Context, s *godog.Scenario, err error) (context.Context, error) {
+		if stack, ok := cleanup.FromContext(ctx); ok {
+			stack.Finish(ctx)
+		}
+		return ctx, nil
+	})
+
+	for _, g := range groups {
+		log.WithField("group", g.Name()).Trace("Registering steps")
+		g.Register(sc)
+	}
+}
+
+// WithNamespace returns a copy of the context with the data stream namespace of the scenario
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NamespaceFromContext returns the data stream namespace of the scenario, the default one if the
+// scenario does not have its own
+func NamespaceFromContext(ctx context.Context) string {
+	namespace, ok := ctx.Value(namespaceKey{}).(string)
+	if !ok || namespace == "" {
+		return elasticsearch.DefaultNamespace
+	}
+	return namespace
+}
+
+// errNotRegistered returns the error of a step whose group has no state in the context of the scenario
+func errNotRegistered(group string) error {
+	return fmt.Errorf("the %s steps are not registered in the scenario", group)
+}
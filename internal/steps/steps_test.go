@@ -0,0 +1,275 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastic/e2e-testing/internal/cleanup"
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/deploy/deploytest"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "default", NamespaceFromContext(ctx))
+
+	ctx = WithNamespace(ctx, "e2e1a2b3c")
+	assert.Equal(t, "e2e1a2b3c", NamespaceFromContext(ctx))
+
+	assert.Equal(t, "logs-generic-e2e1a2b3c", dataStreamName(ctx, "logs-generic"))
+	assert.Equal(t, "logs-generic-default", dataStreamName(ctx, "logs-generic-default"))
+}
+
+func TestFleetPolicies(t *testing.T) {
+	s := kibanatest.NewServer(t)
+	s.AddPackage("system", "System", "1.55.0")
+
+	client, err := s.NewClient()
+	require.NoError(t, err)
+
+	f := NewFleetPolicies(client, "testdata")
+
+	stack := cleanup.NewStack("Creating a policy")
+	ctx := cleanup.WithStack(WithNamespace(context.Background(), "e2e1a2b3c"), stack)
+	assert.NotNil(t, f.aPolicyIsCreatedForTheScenario(ctx), "the state of the group is not in the context")
+
+	ctx = context.WithValue(ctx, fleetKey{}, &FleetState{})
+	assert.NotNil(t, f.theIntegrationIsAddedToThePolicy(ctx, "system"), "the scenario does not have a policy")
+
+	require.NoError(t, f.aPolicyIsCreatedForTheScenario(ctx))
+	require.NoError(t, f.theIntegrationIsAddedToThePolicy(ctx, "system"))
+	require.NoError(t, f.theIntegrationIsInThePolicy(ctx, "system"))
+
+	state, ok := FleetFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "e2e1a2b3c", state.Policy.Namespace)
+	assert.NotEmpty(t, state.EnrollmentToken.APIKey)
+	assert.Len(t, state.PackagePolicies, 1)
+	assert.Equal(t, "e2e1a2b3c", state.PackagePolicies[0].Namespace)
+
+	// the policy and the token register their deletion, the last created first
+	assert.Equal(t, []string{"enrollment token " + state.EnrollmentToken.ID, "agent policy " + state.Policy.ID}, stack.Pending())
+
+	summary := stack.Finish(ctx)
+	assert.Empty(t, summary.Failed)
+	assert.Len(t, summary.Removed, 2)
+	for _, p := range s.Policies() {
+		assert.NotEqual(t, state.Policy.ID, p.ID)
+	}
+	for _, k := range s.EnrollmentKeys() {
+		if k.ID == state.EnrollmentToken.ID {
+			assert.False(t, k.Active, "the enrollment token is revoked")
+		}
+	}
+}
+
+func TestProcessesState(t *testing.T) {
+	state := &ProcessesState{States: map[string]string{"elastic-agent/filebeat": "started"}}
+
+	st, ok := state.ProcessState("elastic-agent", "filebeat")
+	assert.True(t, ok)
+	assert.Equal(t, "started", st)
+
+	_, ok = state.ProcessState("elastic-agent", "metricbeat")
+	assert.False(t, ok)
+
+	assert.Equal(t, 0, expectedInstances("stopped"))
+	assert.Equal(t, 0, expectedInstances("uninstalled"))
+	assert.Equal(t, 1, expectedInstances("started"))
+}
+
+// fakeInstaller installs the agent in the fake Fleet Server: it enrolls with the token, acknowledging the policy,
+// goes offline when stopped and is unenrolled when uninstalled. The operations the steps do not use are not implemented
+type fakeInstaller struct {
+	deploy.ServiceOperator
+
+	fleet    *kibanatest.Server
+	client   *kibana.Client
+	hostname string
+	agentID  string
+}
+
+// newFakeInstaller replaces the installers of the agents for the duration of a test
+func newFakeInstaller(t *testing.T, fleet *kibanatest.Server, client *kibana.Client, hostname string) *fakeInstaller {
+	i := &fakeInstaller{fleet: fleet, client: client, hostname: hostname}
+
+	original := attachInstaller
+	t.Cleanup(func() { attachInstaller = original })
+	attachInstaller = func(ctx context.Context, d deploy.Deployment, service deploy.ServiceRequest, installType string) (deploy.ServiceOperator, error) {
+		return i, nil
+	}
+
+	return i
+}
+
+func (i *fakeInstaller) Preinstall(ctx context.Context) error  { return nil }
+func (i *fakeInstaller) Install(ctx context.Context) error     { return nil }
+func (i *fakeInstaller) Postinstall(ctx context.Context) error { return nil }
+
+func (i *fakeInstaller) Uninstall(ctx context.Context) error {
+	return i.client.UnEnrollAgent(ctx, i.hostname)
+}
+
+func (i *fakeInstaller) Enroll(ctx context.Context, token string, extraFlags string) error {
+	id, _, err := i.fleet.Enroll(token, kibanatest.EnrollRequest{Hostname: i.hostname, Version: common.ElasticAgentVersion})
+	if err != nil {
+		return err
+	}
+
+	i.agentID = id
+	i.fleet.AckActions(id)
+	return nil
+}
+
+func (i *fakeInstaller) Stop(ctx context.Context) error {
+	if !i.fleet.SetAgentStatus(i.agentID, kibanatest.StatusOffline) {
+		return errors.New("the agent is not enrolled")
+	}
+	return nil
+}
+
+// newAgentScenario creates the context of a scenario with the Fleet policies and the agent lifecycle steps,
+// and a policy to enroll the agents in
+func newAgentScenario(t *testing.T, client *kibana.Client) (context.Context, *FleetPolicies, *Agent) {
+	f := NewFleetPolicies(client, "testdata")
+	a := NewAgent(deploytest.New(), common.FleetProfileName, client)
+
+	original := revokedTokenDelay
+	t.Cleanup(func() { revokedTokenDelay = original })
+	revokedTokenDelay = 0
+
+	stack := cleanup.NewStack(t.Name())
+	ctx := cleanup.WithStack(WithNamespace(context.Background(), "e2e1a2b3c"), stack)
+	ctx = context.WithValue(ctx, fleetKey{}, &FleetState{})
+	ctx = context.WithValue(ctx, agentKey{}, &AgentState{})
+	t.Cleanup(func() {
+		assert.Empty(t, stack.Finish(ctx).Failed, "the resources of the scenario are removed")
+	})
+
+	require.NoError(t, f.aPolicyIsCreatedForTheScenario(ctx))
+	return ctx, f, a
+}
+
+func TestAgent_RevokedEnrollmentToken(t *testing.T) {
+	s := kibanatest.NewServer(t)
+	client, err := s.NewClient()
+	require.NoError(t, err)
+	newFakeInstaller(t, s, client, "deploytest")
+
+	ctx, f, a := newAgentScenario(t, client)
+	assert.NotNil(t, a.anAttemptToEnrollANewAgentFails(ctx), "the scenario did not deploy an agent")
+
+	require.NoError(t, a.anAgentIsDeployedToFleetWithInstaller(ctx, "tar"))
+	require.NoError(t, a.theAgentIsListedInFleetAs(ctx, "online"))
+
+	err = a.anAttemptToEnrollANewAgentFails(ctx)
+	assert.EqualError(t, err, "the agent was enrolled although the token was revoked")
+
+	require.NoError(t, f.theEnrollmentTokenIsRevoked(ctx))
+	require.NoError(t, a.anAttemptToEnrollANewAgentFails(ctx))
+
+	state, _ := FleetFromContext(ctx)
+	for _, k := range s.EnrollmentKeys() {
+		if k.ID == state.EnrollmentToken.ID {
+			assert.False(t, k.Active, "the enrollment token is revoked")
+		}
+	}
+}
+
+func TestAgent_OfflineAgent(t *testing.T) {
+	s := kibanatest.NewServer(t)
+	client, err := s.NewClient()
+	require.NoError(t, err)
+	newFakeInstaller(t, s, client, "deploytest")
+
+	ctx, _, a := newAgentScenario(t, client)
+	assert.NotNil(t, a.theAgentIsListedInFleetAs(ctx, "online"), "the scenario did not deploy an agent")
+
+	require.NoError(t, a.anAgentIsDeployedToFleetWithInstaller(ctx, "tar"))
+	require.NoError(t, a.theAgentIsListedInFleetAs(ctx, "online"))
+
+	require.NoError(t, a.theAgentIsInState(ctx, "stopped"))
+	require.NoError(t, a.theAgentIsListedInFleetAs(ctx, "offline"))
+
+	t.Run("An uninstalled agent is not listed, as an offline one", func(t *testing.T) {
+		require.NoError(t, a.theAgentIsInState(ctx, "uninstalled"))
+		assert.Empty(t, s.Agents())
+		assert.NoError(t, a.theAgentIsListedInFleetAs(ctx, "offline"))
+	})
+}
+
+func TestAgent_Hooks(t *testing.T) {
+	s := kibanatest.NewServer(t)
+	client, err := s.NewClient()
+	require.NoError(t, err)
+	i := newFakeInstaller(t, s, client, "deploytest")
+
+	ctx, f, a := newAgentScenario(t, client)
+
+	var listed []string
+	a.WithHooks(AgentHooks{
+		// the suite deploys the agent with its own options, recording it in the state of the steps
+		Deploy: func(ctx context.Context, installerType string) error {
+			state, _ := AgentFromContext(ctx)
+			state.Service = deploy.NewServiceRequest(common.ElasticAgentServiceName)
+			state.InstallerType = installerType
+			state.Installed = true
+
+			fleet, _ := FleetFromContext(ctx)
+			err := i.Enroll(ctx, fleet.EnrollmentToken.APIKey, "")
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrEnrollment, err)
+			}
+			state.Hostname = i.hostname
+			return nil
+		},
+		Listed: func(ctx context.Context, status string) error {
+			listed = append(listed, status)
+			return nil
+		},
+	})
+
+	require.NoError(t, a.anAgentIsDeployedToFleetWithInstaller(ctx, "tar"))
+	require.NoError(t, a.theAgentIsListedInFleetAs(ctx, "online"))
+	assert.Equal(t, []string{"online"}, listed)
+
+	require.NoError(t, f.theEnrollmentTokenIsRevoked(ctx))
+	assert.NoError(t, a.anAttemptToEnrollANewAgentFails(ctx), "the enrollment errors of the suite are recognised")
+}
+
+func TestReadEventsWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events")
+	events := `{"@timestamp":"2022-06-01T10:00:00Z","kubernetes":{"pod":{"name":"a-pod"}}}
+{"@timestamp":"2022-06-01T10:00:01Z","kubernetes":{"pod":{"name":"redis"}}}
+{"@timestamp":"2022-06-01T10:00:02Z","kubernetes":{"pod":{"name":"a-pod"}},"url":{"port":10250}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(events), 0644))
+
+	found, err := readEventsWith(context.Background(), path, "kubernetes.pod.name:a-pod")
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	ok, err := containsEventsWith(context.Background(), path, "url.port:10250")
+	require.NoError(t, err)
+	assert.True(t, ok, "the numbers are compared as text")
+
+	ok, err = containsEventsWith(context.Background(), path, "kubernetes.pod.name:a-failing-pod")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = readEventsWith(context.Background(), path, ":a-pod")
+	assert.EqualError(t, err, "invalid condition ':a-pod'")
+}
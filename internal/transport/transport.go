@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package transport creates the HTTP transports of the clients of the Elastic Stack APIs, configuring their TLS
+// settings, and shares them between the clients so that they reuse the pooled connections.
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// transports the HTTP transports shared by the clients, by configuration
+var transports = struct {
+	mu    sync.Mutex
+	items map[Config]*http.Transport
+}{
+	items: map[Config]*http.Transport{},
+}
+
+// Config represents the TLS and timeout settings of the transport of a service, i.e. Elasticsearch or Kibana
+type Config struct {
+	Service string // name of the service in the errors and logs
+
+	CACert             string // path to the PEM file of the CA to trust
+	CAFingerprint      string // hex SHA-256 fingerprint of a certificate of the chain to trust, instead of a CA
+	ClientCert         string // path to the PEM file of the client certificate
+	ClientKey          string // path to the PEM file of the client key
+	InsecureSkipVerify bool
+
+	ResponseHeaderTimeout time.Duration // time to wait for the headers of a response, unlimited when zero
+}
+
+// Validate returns an error describing the first invalid TLS setting, without reading the certificates
+func (cfg Config) Validate() error {
+	if cfg.CACert != "" && cfg.CAFingerprint != "" {
+		return fmt.Errorf("only one of the %s CA and CA fingerprint can be set", cfg.Service)
+	}
+	if cfg.CAFingerprint != "" {
+		if _, err := cfg.fingerprint(); err != nil {
+			return err
+		}
+	}
+	if (cfg.ClientCert == "") != (cfg.ClientKey == "") {
+		return fmt.Errorf("both the %s client certificate and key are required", cfg.Service)
+	}
+
+	return nil
+}
+
+// Get returns the shared HTTP transport for the configuration, creating it if needed
+func Get(cfg Config) (*http.Transport, error) {
+	transports.mu.Lock()
+	defer transports.mu.Unlock()
+
+	if t, ok := transports.items[cfg]; ok {
+		return t, nil
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	transports.items[cfg] = t
+
+	log.WithFields(log.Fields{
+		"caCert":             cfg.CACert,
+		"caFingerprint":      cfg.CAFingerprint,
+		"clientCert":         cfg.ClientCert,
+		"insecureSkipVerify": cfg.InsecureSkipVerify,
+	}).Tracef("%s HTTP transport created", cfg.Service)
+	return t, nil
+}
+
+// TLSConfig returns the TLS configuration, reading the CA and the client certificate
+func (cfg Config) TLSConfig() (*tls.Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // #nosec G402 only enabled on purpose, for self-signed stacks
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the %s CA %s: %w", cfg.Service, cfg.CACert, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("the %s CA %s does not contain PEM certificates", cfg.Service, cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CAFingerprint != "" {
+		fingerprint, err := cfg.fingerprint()
+		if err != nil {
+			return nil, err
+		}
+
+		// the chain is trusted when any of its certificates matches, as the Elasticsearch clients do,
+		// so the verification of the chain against the CAs of the host is skipped
+		tlsConfig.InsecureSkipVerify = true // #nosec G402 the chain is verified by its fingerprint
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				sum := sha256.Sum256(cert.Raw)
+				if hex.EncodeToString(sum[:]) == fingerprint {
+					return nil
+				}
+			}
+			return fmt.Errorf("none of the certificates of %s matches the CA fingerprint %s", cfg.Service, cfg.CAFingerprint)
+		}
+	}
+
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the %s client certificate %s: %w", cfg.Service, cfg.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// fingerprint returns the CA fingerprint in lowercase hex, without the colons of the openssl format
+func (cfg Config) fingerprint() (string, error) {
+	fingerprint := strings.ToLower(strings.ReplaceAll(cfg.CAFingerprint, ":", ""))
+
+	decoded, err := hex.DecodeString(fingerprint)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid %s CA fingerprint %s: a hex SHA-256 fingerprint is required", cfg.Service, cfg.CAFingerprint)
+	}
+
+	return fingerprint, nil
+}
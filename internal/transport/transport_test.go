@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	fingerprint := hex.EncodeToString(make([]byte, sha256.Size))
+
+	assert.Nil(t, Config{Service: "Kibana"}.Validate())
+	assert.Nil(t, Config{Service: "Elasticsearch", CAFingerprint: fingerprint}.Validate())
+
+	err := Config{Service: "Elasticsearch", CACert: "/ca.pem", CAFingerprint: fingerprint}.Validate()
+	assert.EqualError(t, err, "only one of the Elasticsearch CA and CA fingerprint can be set")
+
+	err = Config{Service: "Elasticsearch", CAFingerprint: "AB:CD"}.Validate()
+	assert.ErrorContains(t, err, "invalid Elasticsearch CA fingerprint AB:CD")
+
+	err = Config{Service: "Kibana", ClientCert: "/client.pem"}.Validate()
+	assert.EqualError(t, err, "both the Kibana client certificate and key are required")
+}
+
+func TestGet(t *testing.T) {
+	t1, err := Get(Config{Service: "Elasticsearch", ResponseHeaderTimeout: time.Minute})
+	assert.Nil(t, err)
+	t2, err := Get(Config{Service: "Elasticsearch", ResponseHeaderTimeout: time.Minute})
+	assert.Nil(t, err)
+	assert.Same(t, t1, t2)
+	assert.Equal(t, time.Minute, t1.ResponseHeaderTimeout)
+
+	t3, err := Get(Config{Service: "Elasticsearch", InsecureSkipVerify: true})
+	assert.Nil(t, err)
+	assert.NotSame(t, t1, t3)
+	assert.True(t, t3.TLSClientConfig.InsecureSkipVerify)
+
+	_, err = Get(Config{Service: "Kibana", CACert: "/missing/ca.pem"})
+	assert.ErrorContains(t, err, "could not read the Kibana CA /missing/ca.pem")
+}
@@ -0,0 +1,327 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package upgrade
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/shell"
+	"github.com/elastic/e2e-testing/pkg/downloads"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MethodFleet the agent is upgraded by Fleet, using the upgrade action
+	MethodFleet = "fleet"
+	// MethodLocal the agent is upgraded on the host, using the 'elastic-agent upgrade' command
+	MethodLocal = "local"
+)
+
+// unsupportedInstallers the installers that do not support upgrading the agent, as the
+// package manager of the OS owns the installed files
+var unsupportedInstallers = map[string]bool{
+	"deb":    true,
+	"docker": true,
+	"rpm":    true,
+}
+
+// Scenario represents the upgrade of an agent installed with an installer, from a version to another
+type Scenario struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Installer string `json:"installer"`
+	Method    string `json:"method"`
+}
+
+// Name returns the name of the scenario, which is unique in the matrix
+func (s Scenario) Name() string {
+	return fmt.Sprintf(`Upgrading a "%s" agent from "%s" to "%s" using "%s"`, s.Installer, s.From, s.To, s.Method)
+}
+
+// IsSupported returns false if the installer of the scenario does not support upgrading the agent
+func (s Scenario) IsSupported() bool {
+	return !unsupportedInstallers[s.Installer]
+}
+
+// Matrix represents the combinations of versions, installers and methods to upgrade the agent
+type Matrix struct {
+	From       []string // versions or version expressions to upgrade from
+	To         []string // versions or version expressions to upgrade to
+	Installers []string // installers used to deploy the agent, i.e. tar, zip
+	Methods    []string // methods used to upgrade the agent: fleet or local
+}
+
+// NewMatrixFromEnv creates a matrix from the UPGRADE_MATRIX_* environment variables, which are comma-separated lists.
+// The matrix mode is only enabled when UPGRADE_MATRIX_FROM is not empty, otherwise false is returned
+func NewMatrixFromEnv() (Matrix, bool) {
+	from := splitList(shell.GetEnv("UPGRADE_MATRIX_FROM", ""))
+	if len(from) == 0 {
+		return Matrix{}, false
+	}
+
+	return Matrix{
+		From:       from,
+		To:         splitList(shell.GetEnv("UPGRADE_MATRIX_TO", "latest")),
+		Installers: splitList(shell.GetEnv("UPGRADE_MATRIX_INSTALLERS", "tar")),
+		Methods:    splitList(shell.GetEnv("UPGRADE_MATRIX_METHODS", MethodFleet+","+MethodLocal)),
+	}, true
+}
+
+// Resolve returns a matrix where the version expressions have been resolved to concrete versions
+func (m Matrix) Resolve(r Resolver) (Matrix, error) {
+	from, err := r.ResolveAll(m.From)
+	if err != nil {
+		return Matrix{}, err
+	}
+
+	to, err := r.ResolveAll(m.To)
+	if err != nil {
+		return Matrix{}, err
+	}
+
+	for _, method := range m.Methods {
+		if method != MethodFleet && method != MethodLocal {
+			return Matrix{}, fmt.Errorf("unsupported upgrade method %s: use %s or %s", method, MethodFleet, MethodLocal)
+		}
+	}
+
+	return Matrix{
+		From:       from,
+		To:         to,
+		Installers: m.Installers,
+		Methods:    m.Methods,
+	}, nil
+}
+
+// Scenarios returns the scenarios of the matrix, discarding the downgrades
+func (m Matrix) Scenarios() []Scenario {
+	scenarios := []Scenario{}
+
+	for _, from := range m.From {
+		for _, to := range m.To {
+			if downloads.CompareVersions(from, to) > 0 {
+				log.WithFields(log.Fields{
+					"from": from,
+					"to":   to,
+				}).Debug("Discarding downgrade from the upgrade matrix")
+				continue
+			}
+
+			for _, installer := range m.Installers {
+				for _, method := range m.Methods {
+					scenarios = append(scenarios, Scenario{From: from, To: to, Installer: installer, Method: method})
+				}
+			}
+		}
+	}
+
+	return scenarios
+}
+
+// Feature returns the Gherkin feature running the supported scenarios of the matrix
+func (m Matrix) Feature() string {
+	var sb strings.Builder
+
+	sb.WriteString("@upgrade_matrix\n")
+	sb.WriteString("Feature: Upgrade Agent matrix\n")
+	sb.WriteString("  Scenarios generated from the upgrade matrix, upgrading the Agent across versions and installers.\n")
+
+	for _, s := range m.Scenarios() {
+		if !s.IsSupported() {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "\n  Scenario: %s\n", s.Name())
+		fmt.Fprintf(&sb, "    Given a \"%s\" stale agent is deployed to Fleet with \"%s\" installer\n", s.From, s.Installer)
+		sb.WriteString("    And the agent is listed in Fleet as \"online\"\n")
+		sb.WriteString("    And certs are installed\n")
+		sb.WriteString("    And the \"elastic-agent\" process is \"restarted\" on the host\n")
+		fmt.Fprintf(&sb, "    When agent is upgraded to \"%s\" version using \"%s\"\n", s.To, s.Method)
+		fmt.Fprintf(&sb, "    Then agent is in \"%s\" version\n", s.To)
+	}
+
+	return sb.String()
+}
+
+// WriteFeature writes the Gherkin feature of the matrix to a directory, returning the path to the feature file
+func (m Matrix) WriteFeature(dir string) (string, error) {
+	featureFile := filepath.Join(dir, "upgrade_matrix.feature")
+
+	err := os.WriteFile(featureFile, []byte(m.Feature()), 0644)
+	if err != nil {
+		return "", fmt.Errorf("could not write the upgrade matrix feature to %s: %w", featureFile, err)
+	}
+
+	log.WithFields(log.Fields{
+		"feature":   featureFile,
+		"scenarios": len(m.Scenarios()),
+	}).Info("Upgrade matrix feature generated")
+	return featureFile, nil
+}
+
+// Resolver resolves version expressions into concrete versions
+type Resolver struct {
+	Latest   string                       // version used for the "latest" expression
+	Alias    func(string) (string, error) // resolves an alias, i.e. 7.17, into its latest version
+	Versions func() ([]string, error)     // lists the available versions
+}
+
+// NewResolver creates a resolver using Elastic's artifacts API, where latest is the version for the "latest" expression
+func NewResolver(latest string) Resolver {
+	return Resolver{
+		Latest:   latest,
+		Alias:    downloads.GetElasticArtifactVersion,
+		Versions: downloads.GetElasticArtifactVersions,
+	}
+}
+
+// ResolveAll resolves a list of version expressions, removing the duplicated versions
+func (r Resolver) ResolveAll(exprs []string) ([]string, error) {
+	versions := []string{}
+	seen := map[string]bool{}
+
+	for _, expr := range exprs {
+		resolved, err := r.Resolve(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range resolved {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, nil
+}
+
+// Resolve resolves a version expression, which can be:
+//   - latest: the version under test
+//   - an alias, i.e. 7.17 or 8.14-SNAPSHOT: the latest version for the alias
+//   - a major wildcard, i.e. 8.x: the latest released minor for the major
+//   - a range of minors, i.e. 8.12..8.14: the latest version for each minor in the range
+//   - a version, i.e. 8.13.4: used as is
+func (r Resolver) Resolve(expr string) ([]string, error) {
+	expr = strings.TrimSpace(expr)
+
+	switch {
+	case expr == "latest":
+		return []string{r.Latest}, nil
+	case strings.Contains(expr, ".."):
+		return r.resolveRange(expr)
+	case strings.HasSuffix(expr, ".x"):
+		return r.resolveMajor(expr)
+	case downloads.IsAlias(expr):
+		v, err := r.Alias(expr)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve version alias %s: %w", expr, err)
+		}
+		return []string{v}, nil
+	}
+
+	return []string{expr}, nil
+}
+
+// resolveMajor resolves a major wildcard, i.e. 8.x, into the latest version of the latest released minor for the major
+func (r Resolver) resolveMajor(expr string) ([]string, error) {
+	major, err := strconv.Atoi(strings.TrimSuffix(expr, ".x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid major wildcard %s: %w", expr, err)
+	}
+
+	versions, err := r.Versions()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the versions to resolve %s: %w", expr, err)
+	}
+
+	latestMinor := -1
+	for _, v := range versions {
+		if strings.HasSuffix(v, "-SNAPSHOT") {
+			continue
+		}
+
+		vMajor, vMinor, err := parseMinor(v)
+		if err != nil || vMajor != major {
+			continue
+		}
+		if vMinor > latestMinor {
+			latestMinor = vMinor
+		}
+	}
+
+	if latestMinor < 0 {
+		return nil, fmt.Errorf("there are no released versions for %s", expr)
+	}
+
+	return r.Resolve(fmt.Sprintf("%d.%d", major, latestMinor))
+}
+
+// resolveRange resolves a range of minors of the same major, i.e. 8.12..8.14, into the latest version for each minor
+func (r Resolver) resolveRange(expr string) ([]string, error) {
+	bounds := strings.SplitN(expr, "..", 2)
+
+	fromMajor, fromMinor, err := parseMinor(bounds[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %s: %w", expr, err)
+	}
+
+	toMajor, toMinor, err := parseMinor(bounds[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %s: %w", expr, err)
+	}
+
+	if fromMajor != toMajor || fromMinor > toMinor {
+		return nil, fmt.Errorf("invalid range %s: the bounds must be ascending minors of the same major", expr)
+	}
+
+	versions := []string{}
+	for minor := fromMinor; minor <= toMinor; minor++ {
+		resolved, err := r.Resolve(fmt.Sprintf("%d.%d", fromMajor, minor))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, resolved...)
+	}
+
+	return versions, nil
+}
+
+// parseMinor returns the major and minor of a version, i.e. 8.12 or 8.12.1
+func parseMinor(version string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("%s is not a major.minor version", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return major, minor, nil
+}
+
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,174 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package upgrade
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testResolver = Resolver{
+	Latest: "8.15.0-SNAPSHOT",
+	Alias: func(alias string) (string, error) {
+		aliases := map[string]string{
+			"7.17": "7.17.22",
+			"8.12": "8.12.2",
+			"8.13": "8.13.4",
+			"8.14": "8.14.3",
+		}
+		if v, ok := aliases[alias]; ok {
+			return v, nil
+		}
+		return "", errors.New("unknown alias")
+	},
+	Versions: func() ([]string, error) {
+		return []string{"7.17.22", "8.13.4", "8.14.3", "8.15.0-SNAPSHOT"}, nil
+	},
+}
+
+func Test_Resolve(t *testing.T) {
+	t.Run("Latest is the version under test", func(t *testing.T) {
+		versions, err := testResolver.Resolve("latest")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"8.15.0-SNAPSHOT"}, versions)
+	})
+
+	t.Run("Aliases are resolved", func(t *testing.T) {
+		versions, err := testResolver.Resolve("7.17")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"7.17.22"}, versions)
+	})
+
+	t.Run("Major wildcards are resolved to the latest released minor", func(t *testing.T) {
+		versions, err := testResolver.Resolve("8.x")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"8.14.3"}, versions)
+	})
+
+	t.Run("Ranges are resolved for each minor", func(t *testing.T) {
+		versions, err := testResolver.Resolve("8.12..8.14")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"8.12.2", "8.13.4", "8.14.3"}, versions)
+	})
+
+	t.Run("Versions are used as is", func(t *testing.T) {
+		versions, err := testResolver.Resolve("8.13.0")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"8.13.0"}, versions)
+	})
+
+	t.Run("Ranges across majors are rejected", func(t *testing.T) {
+		_, err := testResolver.Resolve("7.17..8.1")
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown aliases are reported", func(t *testing.T) {
+		_, err := testResolver.Resolve("6.8")
+		assert.Error(t, err)
+	})
+
+	t.Run("Duplicated versions are removed", func(t *testing.T) {
+		versions, err := testResolver.ResolveAll([]string{"8.14", "8.x", "8.13..8.14"})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"8.14.3", "8.13.4"}, versions)
+	})
+}
+
+func Test_Matrix(t *testing.T) {
+	m, err := Matrix{
+		From:       []string{"7.17", "latest"},
+		To:         []string{"8.14", "latest"},
+		Installers: []string{"tar", "rpm"},
+		Methods:    []string{MethodFleet, MethodLocal},
+	}.Resolve(testResolver)
+	assert.Nil(t, err)
+
+	t.Run("Downgrades are discarded", func(t *testing.T) {
+		scenarios := m.Scenarios()
+
+		// 7.17.22 -> 8.14.3, 7.17.22 -> 8.15.0-SNAPSHOT and 8.15.0-SNAPSHOT -> 8.15.0-SNAPSHOT, per installer and method
+		assert.Len(t, scenarios, 12)
+		for _, s := range scenarios {
+			assert.NotEqual(t, Scenario{From: "8.15.0-SNAPSHOT", To: "8.14.3"}, Scenario{From: s.From, To: s.To})
+		}
+	})
+
+	t.Run("Feature runs the supported scenarios only", func(t *testing.T) {
+		feature := m.Feature()
+
+		assert.Equal(t, 6, strings.Count(feature, "Scenario: "))
+		assert.Contains(t, feature, `Scenario: Upgrading a "tar" agent from "7.17.22" to "8.14.3" using "local"`)
+		assert.Contains(t, feature, `When agent is upgraded to "8.14.3" version using "local"`)
+		assert.NotContains(t, feature, `"rpm" installer`)
+	})
+
+	t.Run("Feature is written to a directory", func(t *testing.T) {
+		dir := t.TempDir()
+
+		featureFile, err := m.WriteFeature(dir)
+		assert.Nil(t, err)
+		assert.Equal(t, filepath.Join(dir, "upgrade_matrix.feature"), featureFile)
+	})
+
+	t.Run("Unsupported methods are rejected", func(t *testing.T) {
+		_, err := Matrix{From: []string{"latest"}, To: []string{"latest"}, Methods: []string{"ssh"}}.Resolve(testResolver)
+		assert.Error(t, err)
+	})
+}
+
+func Test_NewMatrixFromEnv(t *testing.T) {
+	t.Run("Matrix mode is disabled without from versions", func(t *testing.T) {
+		t.Setenv("UPGRADE_MATRIX_FROM", "")
+
+		_, ok := NewMatrixFromEnv()
+		assert.False(t, ok)
+	})
+
+	t.Run("Matrix mode uses defaults", func(t *testing.T) {
+		t.Setenv("UPGRADE_MATRIX_FROM", "7.17, 8.x")
+
+		m, ok := NewMatrixFromEnv()
+		assert.True(t, ok)
+		assert.Equal(t, []string{"7.17", "8.x"}, m.From)
+		assert.Equal(t, []string{"latest"}, m.To)
+		assert.Equal(t, []string{"tar"}, m.Installers)
+		assert.Equal(t, []string{MethodFleet, MethodLocal}, m.Methods)
+	})
+}
+
+func Test_Report(t *testing.T) {
+	m := Matrix{
+		From:       []string{"8.13.4"},
+		To:         []string{"8.14.3"},
+		Installers: []string{"tar", "deb"},
+		Methods:    []string{MethodFleet},
+	}
+	r := NewReport(m)
+
+	tarScenario := Scenario{From: "8.13.4", To: "8.14.3", Installer: "tar", Method: MethodFleet}
+	assert.True(t, r.Record(tarScenario.Name(), errors.New("version mismatch")))
+	assert.False(t, r.Record("Deploying the agent", nil))
+
+	results := r.Results()
+	assert.Equal(t, StatusFailed, results[0].Status)
+	assert.Equal(t, "version mismatch", results[0].Error)
+	assert.Equal(t, StatusUnsupported, results[1].Status)
+
+	expected := "| Upgrade | tar/fleet | deb/fleet |\n" +
+		"|---|---|---|\n" +
+		"| 8.13.4 -> 8.14.3 | failed | unsupported |\n"
+	assert.Equal(t, expected, r.Table())
+
+	reportFile := filepath.Join(t.TempDir(), "upgrade-matrix.md")
+	assert.Nil(t, r.Write(reportFile))
+
+	_, err := os.Stat(strings.TrimSuffix(reportFile, ".md") + ".json")
+	assert.Nil(t, err)
+}
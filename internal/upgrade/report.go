@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// StatusFailed the upgrade scenario failed
+	StatusFailed = "failed"
+	// StatusNotRun the upgrade scenario was not run
+	StatusNotRun = "not run"
+	// StatusPassed the upgrade scenario passed
+	StatusPassed = "passed"
+	// StatusUnsupported the installer of the upgrade scenario does not support upgrades
+	StatusUnsupported = "unsupported"
+)
+
+// Result represents the outcome of an upgrade scenario
+type Result struct {
+	Scenario
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report represents the compatibility report for the scenarios of an upgrade matrix. It's safe for concurrent use
+type Report struct {
+	columns []string // installer/method pairs, in order
+	mu      sync.Mutex
+	results []Result
+	rows    []string // from/to pairs, in order
+}
+
+// NewReport creates a report for the scenarios of a matrix, where no scenario has been run yet
+func NewReport(m Matrix) *Report {
+	r := &Report{
+		columns: []string{},
+		results: []Result{},
+		rows:    []string{},
+	}
+
+	for _, s := range m.Scenarios() {
+		status := StatusNotRun
+		if !s.IsSupported() {
+			status = StatusUnsupported
+		}
+		r.results = append(r.results, Result{Scenario: s, Status: status})
+
+		r.rows = appendUnique(r.rows, rowKey(s))
+		r.columns = appendUnique(r.columns, columnKey(s))
+	}
+
+	return r
+}
+
+// Record records the outcome of a scenario by its name, returning false if the scenario is not in the matrix
+func (r *Report) Record(name string, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.results {
+		if r.results[i].Name() != name {
+			continue
+		}
+
+		r.results[i].Status = StatusPassed
+		if err != nil {
+			r.results[i].Status = StatusFailed
+			r.results[i].Error = err.Error()
+		}
+		return true
+	}
+
+	return false
+}
+
+// Results returns the results of the scenarios, in the order of the matrix
+func (r *Report) Results() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]Result, len(r.results))
+	copy(results, r.results)
+	return results
+}
+
+// Table returns the compatibility table in Markdown format, where each row is an upgrade path
+// and each column is an installer and upgrade method
+func (r *Report) Table() string {
+	results := r.Results()
+
+	statuses := map[string]string{}
+	for _, res := range results {
+		statuses[rowKey(res.Scenario)+"|"+columnKey(res.Scenario)] = res.Status
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("| Upgrade |")
+	for _, c := range r.columns {
+		fmt.Fprintf(&sb, " %s |", c)
+	}
+	sb.WriteString("\n|---|")
+	for range r.columns {
+		sb.WriteString("---|")
+	}
+	sb.WriteString("\n")
+
+	for _, row := range r.rows {
+		fmt.Fprintf(&sb, "| %s |", row)
+		for _, c := range r.columns {
+			status, ok := statuses[row+"|"+c]
+			if !ok {
+				status = "-"
+			}
+			fmt.Fprintf(&sb, " %s |", status)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// Write writes the compatibility table to a Markdown file, and the results to a JSON file next to it
+func (r *Report) Write(path string) error {
+	err := os.WriteFile(path, []byte(r.Table()), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the upgrade matrix report to %s: %w", path, err)
+	}
+
+	bytes, err := json.MarshalIndent(r.Results(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	jsonPath := strings.TrimSuffix(path, ".md") + ".json"
+	err = os.WriteFile(jsonPath, bytes, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write the upgrade matrix results to %s: %w", jsonPath, err)
+	}
+
+	return nil
+}
+
+func rowKey(s Scenario) string {
+	return s.From + " -> " + s.To
+}
+
+func columnKey(s Scenario) string {
+	return s.Installer + "/" + s.Method
+}
+
+func appendUnique(items []string, item string) []string {
+	for _, i := range items {
+		if i == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
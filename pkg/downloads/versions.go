@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -43,6 +44,7 @@ var binariesMutex sync.RWMutex
 // using as key the URL of the version. If another request is trying to fetch the same URL, it will return the string version
 // of the already requested one.
 var elasticVersionsCache = map[string]string{}
+var elasticVersionsListCache = map[string][]string{}
 var elasticVersionsMutex sync.RWMutex
 
 // GithubCommitSha1 represents the value of the "GITHUB_CHECK_SHA1" environment variable
@@ -138,6 +140,12 @@ func FetchElasticArtifactForSnapshots(ctx context.Context, useCISnapshots bool,
 	return binaryName, binaryPath, nil
 }
 
+// GetArtifactName returns the file name of an Elastic artifact, without downloading it,
+// i.e. GetArtifactName("elastic-agent", "8.15.0", "linux", "x86_64", "tar.gz", false) returns elastic-agent-8.15.0-linux-x86_64.tar.gz
+func GetArtifactName(artifact string, version string, os string, arch string, extension string, isDocker bool) string {
+	return buildArtifactName(artifact, version, os, arch, extension, isDocker)
+}
+
 // GetCommitVersion returns a version including the version and the git commit, if it exists
 func GetCommitVersion(version string) string {
 	return newElasticVersion(version).HashedVersion
@@ -182,12 +190,119 @@ func GetElasticArtifactVersion(version string) (string, error) {
 		return version, nil
 	}
 
+	body, err := fetchArtifactsAPI(cacheKey, version)
+	if err != nil {
+		return "", err
+	}
+
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", fmt.Errorf("parsing JSON body %s: %w", body, err)
+	}
+
+	builds := jsonParsed.Path("version.builds")
+
+	lastBuild := builds.Children()[0]
+	latestVersion := lastBuild.Path("version").Data().(string)
+
+	log.WithFields(log.Fields{
+		"alias":   version,
+		"version": latestVersion,
+	}).Debug("Latest version for current version obtained")
+
+	elasticVersionsMutex.Lock()
+	elasticVersionsCache[cacheKey] = latestVersion
+	elasticVersionsMutex.Unlock()
+
+	return latestVersion, nil
+}
+
+// GetElasticArtifactVersions returns the versions available in Elastic's artifact repository, including snapshots
+func GetElasticArtifactVersions() ([]string, error) {
+	url := "https://artifacts-api.elastic.co/v1/versions/?x-elastic-no-kpi=true"
+
+	elasticVersionsMutex.RLock()
+	val, ok := elasticVersionsListCache[url]
+	elasticVersionsMutex.RUnlock()
+	if ok {
+		log.WithFields(log.Fields{
+			"URL":      url,
+			"versions": len(val),
+		}).Debug("Retrieving versions from local cache")
+		return val, nil
+	}
+
+	body, err := fetchArtifactsAPI(url, "all")
+	if err != nil {
+		return nil, err
+	}
+
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JSON body %s: %w", body, err)
+	}
+
+	versions := []string{}
+	for _, v := range jsonParsed.Path("versions").Children() {
+		if version, ok := v.Data().(string); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	elasticVersionsMutex.Lock()
+	elasticVersionsListCache[url] = versions
+	elasticVersionsMutex.Unlock()
+
+	return versions, nil
+}
+
+// CompareVersions compares two versions, ignoring the git commit and snapshot, returning -1, 0 or 1
+// if the first version is lower than, equal to or greater than the second one.
+// i.e. CompareVersions("8.9.0", "8.10.0-SNAPSHOT") returns -1
+func CompareVersions(a string, b string) int {
+	partsA := versionParts(a)
+	partsB := versionParts(b)
+
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if partsA[i] < partsB[i] {
+			return -1
+		}
+		if partsA[i] > partsB[i] {
+			return 1
+		}
+	}
+
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+// versionParts returns the numeric parts of a version, ignoring the git commit and snapshot
+func versionParts(version string) []int {
+	version = strings.ReplaceAll(RemoveCommitFromSnapshot(version), "-SNAPSHOT", "")
+
+	parts := []int{}
+	for _, p := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// fetchArtifactsAPI retrieves the body of a request to Elastic's artifacts API, retrying on connection errors
+func fetchArtifactsAPI(url string, version string) ([]byte, error) {
 	exp := utils.GetExponentialBackOff(time.Minute)
 
 	body := []byte{}
 
 	apiStatus := func() error {
-		url := cacheKey
 		resp, err := http.Get(url)
 		if err != nil {
 			return fmt.Errorf("error getting %s: %w", url, err)
@@ -207,29 +322,10 @@ func GetElasticArtifactVersion(version string) (string, error) {
 
 	err := backoff.Retry(apiStatus, exp)
 	if err != nil {
-		return "", err
-	}
-
-	jsonParsed, err := gabs.ParseJSON(body)
-	if err != nil {
-		return "", fmt.Errorf("parsing JSON body %s: %w", body, err)
+		return nil, err
 	}
 
-	builds := jsonParsed.Path("version.builds")
-
-	lastBuild := builds.Children()[0]
-	latestVersion := lastBuild.Path("version").Data().(string)
-
-	log.WithFields(log.Fields{
-		"alias":   version,
-		"version": latestVersion,
-	}).Debug("Latest version for current version obtained")
-
-	elasticVersionsMutex.Lock()
-	elasticVersionsCache[cacheKey] = latestVersion
-	elasticVersionsMutex.Unlock()
-
-	return latestVersion, nil
+	return body, nil
 }
 
 // GetFullVersion returns a version including the full version: version, git commit and snapshot
@@ -504,6 +504,22 @@ func TestFetchBeatsBinaryFromLocalPath(t *testing.T) {
 	})
 }
 
+func Test_CompareVersions(t *testing.T) {
+	t.Run("Lower version", func(t *testing.T) {
+		assert.Equal(t, -1, CompareVersions("8.9.0", "8.10.0"), "Minor versions are compared as numbers")
+		assert.Equal(t, -1, CompareVersions("7.17.10", "8.0.0-SNAPSHOT"), "Snapshot is ignored")
+	})
+
+	t.Run("Equal version", func(t *testing.T) {
+		assert.Equal(t, 0, CompareVersions("8.10.0-abcdef-SNAPSHOT", "8.10.0"), "Commit and snapshot are ignored")
+	})
+
+	t.Run("Greater version", func(t *testing.T) {
+		assert.Equal(t, 1, CompareVersions("8.10.1", "8.10.0"), "Patch versions are compared")
+		assert.Equal(t, 1, CompareVersions("8.10.0", "8.10"), "Longer versions are greater")
+	})
+}
+
 func Test_IsAlias(t *testing.T) {
 	t.Run("From not an alias", func(t *testing.T) {
 		assert.False(t, IsAlias("1.2.3-SNAPSHOT"), "Version should not be an alias")